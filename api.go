@@ -0,0 +1,173 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiServer serves the HTTP API used to inspect and change filters at
+// runtime, and a status page. All requests must include the API token as
+// bearer token, or as password for basic authentication so the status page
+// can be opened in a browser.
+type apiServer struct {
+	token   string
+	mutes   *muteList
+	filters map[string]interface{}
+	// settings returns the filters that can be changed by reloading the
+	// configuration, if it is not nil.
+	settings func() map[string]interface{}
+	recent   *recentEvents
+	watches  *watchMonitor
+	syncs    *syncTracker
+}
+
+type muteRequest struct {
+	Namespace   string   `json:"namespace"`
+	Reason      string   `json:"reason"`
+	Fingerprint []string `json:"fingerprint"`
+	Comment     string   `json:"comment"`
+	Duration    string   `json:"duration"`
+}
+
+func newAPIServer(token string, mutes *muteList, filters map[string]interface{}, recent *recentEvents, watches *watchMonitor, syncs *syncTracker) *apiServer {
+	return &apiServer{token: token, mutes: mutes, filters: filters, recent: recent, watches: watches, syncs: syncs}
+}
+
+// currentFilters returns the filters that are fixed at startup, and the
+// current settings of those that can be reloaded.
+func (s *apiServer) currentFilters() map[string]interface{} {
+	filters := make(map[string]interface{})
+	for k, v := range s.filters {
+		filters[k] = v
+	}
+	if s.settings != nil {
+		for k, v := range s.settings() {
+			filters[k] = v
+		}
+	}
+	return filters
+}
+
+// Start serves the API on address in the background.
+func (s *apiServer) Start(address string) {
+	go func() {
+		logger.Info("Starting API server", "address", address)
+		if err := http.ListenAndServe(address, s); err != nil {
+			logger.Error("Error running API server", "error", err)
+		}
+	}()
+}
+
+func (s *apiServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if _, password, ok := req.BasicAuth(); ok {
+		token = password
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+		w.Header().Add("WWW-Authenticate", "Bearer")
+		w.Header().Add("WWW-Authenticate", `Basic realm="k8s-sentry"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case req.URL.Path == "/" && req.Method == http.MethodGet:
+		s.statusPage(w, req)
+	case req.URL.Path == "/api/v1/filters" && req.Method == http.MethodGet:
+		filters := s.currentFilters()
+		filters["mutes"] = s.mutes.Active(time.Now())
+		writeJSON(w, http.StatusOK, filters)
+	case req.URL.Path == "/api/v1/mutes" && req.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, s.mutes.Active(time.Now()))
+	case req.URL.Path == "/api/v1/mutes" && req.Method == http.MethodPost:
+		s.addMute(w, req)
+	case strings.HasPrefix(req.URL.Path, "/api/v1/mutes/") && req.Method == http.MethodDelete:
+		id := strings.TrimPrefix(req.URL.Path, "/api/v1/mutes/")
+		if !s.mutes.Delete(id) {
+			http.Error(w, "Mute not found", http.StatusNotFound)
+			return
+		}
+		logger.Info("Removed mute", "id", id)
+		w.WriteHeader(http.StatusNoContent)
+	case req.URL.Path == "/api/v1/events" && req.Method == http.MethodGet && s.recent != nil:
+		s.listEvents(w, req)
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
+
+func (s *apiServer) listEvents(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	filter := recentEventFilter{
+		Cluster:   query.Get("cluster"),
+		Namespace: query.Get("namespace"),
+		Reason:    query.Get("reason"),
+		Decision:  query.Get("decision"),
+	}
+	if filter.Decision != "" && filter.Decision != decisionReported && filter.Decision != decisionSkipped {
+		http.Error(w, fmt.Sprintf("Invalid decision %q", filter.Decision), http.StatusBadRequest)
+		return
+	}
+	limit := 50
+	if value := query.Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 {
+			http.Error(w, fmt.Sprintf("Invalid limit %q", value), http.StatusBadRequest)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, s.recent.List(filter, limit))
+}
+
+func (s *apiServer) addMute(w http.ResponseWriter, req *http.Request) {
+	var request muteRequest
+	if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	duration, err := time.ParseDuration(request.Duration)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid duration: %v", err), http.StatusBadRequest)
+		return
+	}
+	m, err := s.mutes.Add(mute{
+		Namespace:   request.Namespace,
+		Reason:      request.Reason,
+		Fingerprint: request.Fingerprint,
+		Comment:     request.Comment,
+	}, duration, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	logger.Info("Added mute", "id", m.ID, "namespace", m.Namespace, "reason", m.Reason, "until", m.Until, "comment", m.Comment)
+	writeJSON(w, http.StatusCreated, m)
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		logger.Error("Error writing API response", "error", err)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIServerMutes(t *testing.T) {
+	t.Parallel()
+
+	mutes := newMuteList()
+	server := newAPIServer("secret", mutes, map[string]interface{}{"sample-rates": "warning=0.5"}, nil, nil, nil)
+
+	request := httptest.NewRequest(http.MethodGet, "/api/v1/filters", nil)
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("Unauthenticated request returned %d", response.Code)
+	}
+
+	request = httptest.NewRequest(http.MethodPost, "/api/v1/mutes", strings.NewReader(`{"namespace": "shop", "reason": "BackOff", "duration": "1h"}`))
+	request.Header.Set("Authorization", "Bearer secret")
+	response = httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+	if response.Code != http.StatusCreated {
+		t.Fatalf("Adding mute returned %d: %s", response.Code, response.Body)
+	}
+	var added mute
+	if err := json.NewDecoder(response.Body).Decode(&added); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	if mutes.Match("shop", "BackOff", nil, now) == nil {
+		t.Error("Event not muted")
+	}
+	if mutes.Match("shop", "FailedMount", nil, now) != nil || mutes.Match("shop", "BackOff", nil, now.Add(2*time.Hour)) != nil {
+		t.Error("Mute matched other event")
+	}
+
+	request = httptest.NewRequest(http.MethodDelete, "/api/v1/mutes/"+added.ID, nil)
+	request.Header.Set("Authorization", "Bearer secret")
+	response = httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+	if response.Code != http.StatusNoContent || len(mutes.Active(now)) != 0 {
+		t.Errorf("Deleting mute returned %d", response.Code)
+	}
+}
+
+func TestMuteListAddValidation(t *testing.T) {
+	t.Parallel()
+
+	mutes := newMuteList()
+	if _, err := mutes.Add(mute{}, time.Hour, time.Now()); err == nil {
+		t.Error("Mute without matcher accepted")
+	}
+	if _, err := mutes.Add(mute{Namespace: "shop"}, 30*24*time.Hour, time.Now()); err == nil {
+		t.Error("Mute with long duration accepted")
+	}
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	lru "github.com/hashicorp/golang-lru"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// appLabelTags maps the recommended application labels to the tags they
+// are reported as.
+var appLabelTags = map[string]string{
+	"app.kubernetes.io/name":     "app.name",
+	"app.kubernetes.io/instance": "app.instance",
+	"app.kubernetes.io/version":  "app.version",
+	"app.kubernetes.io/part-of":  "app.part-of",
+}
+
+// labelResources are the resources of kinds whose labels are looked up for
+// events. Pods are handled by the PodEventHandler.
+var labelResources = map[string]schema.GroupResource{
+	"Deployment":              {Group: "apps", Resource: "deployments"},
+	"StatefulSet":             {Group: "apps", Resource: "statefulsets"},
+	"DaemonSet":               {Group: "apps", Resource: "daemonsets"},
+	"ReplicaSet":              {Group: "apps", Resource: "replicasets"},
+	"Job":                     {Group: "batch", Resource: "jobs"},
+	"CronJob":                 {Group: "batch", Resource: "cronjobs"},
+	"Service":                 {Resource: "services"},
+	"PersistentVolumeClaim":   {Resource: "persistentvolumeclaims"},
+	"HorizontalPodAutoscaler": {Group: "autoscaling", Resource: "horizontalpodautoscalers"},
+	"Ingress":                 {Group: "networking.k8s.io", Resource: "ingresses"},
+}
+
+// objectLabelsTTL is how long the labels of an object are cached.
+const objectLabelsTTL = 5 * time.Minute
+
+type cachedLabels struct {
+	labels  map[string]string
+	fetched time.Time
+}
+
+// addAppLabelTags adds the recommended application labels as tags.
+func addAppLabelTags(event *sentry.Event, labels map[string]string) {
+	for label, tag := range appLabelTags {
+		if value := labels[label]; value != "" {
+			event.Tags[tag] = value
+		}
+	}
+}
+
+// objectLabels returns the labels of the object an event is about, or nil if
+// they can not be looked up. Labels are cached in cache for a few minutes.
+func objectLabels(app *application, ref v1.ObjectReference, cache *lru.Cache, now time.Time) map[string]string {
+	resource, ok := labelResources[ref.Kind]
+	if !ok || app.clientset == nil || ref.APIVersion == "" || ref.Namespace == "" {
+		return nil
+	}
+	path := "/apis/" + ref.APIVersion
+	if ref.APIVersion == "v1" {
+		path = "/api/v1"
+	}
+	path += "/namespaces/" + ref.Namespace + "/" + resource.Resource + "/" + ref.Name
+	if value, ok := cache.Get(path); ok {
+		if cached := value.(cachedLabels); now.Sub(cached.fetched) < objectLabelsTTL {
+			return cached.labels
+		}
+	}
+
+	var obj struct {
+		Metadata metav1.ObjectMeta `json:"metadata"`
+	}
+	data, err := app.clientset.CoreV1().RESTClient().Get().AbsPath(path).DoRaw()
+	if err == nil {
+		err = json.Unmarshal(data, &obj)
+	}
+	if err != nil {
+		// Cache failures too, so a missing permission does not result in a
+		// request for every event.
+		logger.Debug("Error getting object labels", "path", path, "error", err)
+	}
+	cache.Add(path, cachedLabels{labels: obj.Metadata.Labels, fetched: now})
+	return obj.Metadata.Labels
+}
+
+// appLabelAccessChecks returns the access checks for looking up the labels
+// of the objects events are about.
+func appLabelAccessChecks(app *application) []accessCheck {
+	if app.objectLabels == nil {
+		return nil
+	}
+	var checks []accessCheck
+	for _, resource := range labelResources {
+		checks = append(checks, getAccess(resource.Group, resource.Resource, app.namespace))
+	}
+	sort.Slice(checks, func(i, j int) bool { return checks[i].resource < checks[j].resource })
+	return checks
+}
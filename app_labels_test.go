@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAddAppLabelTags(t *testing.T) {
+	t.Parallel()
+
+	event := sentry.NewEvent()
+	addAppLabelTags(event, map[string]string{
+		"app.kubernetes.io/name":     "checkout",
+		"app.kubernetes.io/instance": "checkout-eu",
+		"app.kubernetes.io/part-of":  "shop",
+		"app.kubernetes.io/version":  "",
+		"tier":                       "frontend",
+	})
+	expected := map[string]string{"app.name": "checkout", "app.instance": "checkout-eu", "app.part-of": "shop"}
+	if len(event.Tags) != len(expected) {
+		t.Errorf("Unexpected tags %v", event.Tags)
+	}
+	for key, value := range expected {
+		if event.Tags[key] != value {
+			t.Errorf("Tag %s is %q, expected %q", key, event.Tags[key], value)
+		}
+	}
+}
+
+func TestPodEventHandlerAppLabels(t *testing.T) {
+	t.Parallel()
+
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout-5d9c7-x2x", Labels: map[string]string{"app.kubernetes.io/name": "checkout"}}}
+	event := sentry.NewEvent()
+	applyHandler(event, &PodEventHandler{Pod: pod, Event: &v1.Event{}})
+	if event.Tags["app.name"] != "checkout" {
+		t.Errorf("Unexpected tags %v", event.Tags)
+	}
+}
@@ -16,9 +16,10 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/getsentry/sentry-go"
@@ -37,11 +38,66 @@ type terminationKey struct {
 
 type application struct {
 	clientset          *kubernetes.Clientset
+	clusterName        string
 	defaultEnvironment string
 	release            string
 	namespace          string
 	defaultTags        map[string]string
+	grouping           string
+	timestamps         string
 	terminationsSeen   *lru.Cache
+	restarts           *lru.Cache
+	objectLabels       *lru.Cache
+	shards             *shardManager
+	sampler            *sampler
+	archive            *eventArchive
+	realert            *realertPolicy
+	maxEventAge        time.Duration
+
+	certExpiryWarning    time.Duration
+	certExpiryError      time.Duration
+	certificatesReported *lru.Cache
+	endpoints            *endpointTracker
+	pdbs                 *pdbMonitor
+	statefulSets         *statefulSetMonitor
+	daemonSets           *daemonSetMonitor
+	critical             *criticalRestartTracker
+	dns                  *dnsAggregator
+	nodes                *nodeTracker
+	capacity             *capacityTracker
+	preemptionLevel      sentry.Level
+	jobLogLines          int
+	failedPods           bool
+	helmReleases         bool
+	pendingPods          *pendingPodCache
+	maintenance          []maintenanceWindow
+	escalation           *escalator
+	rules                []rule
+	extensions           []extension
+	extensionTimeout     time.Duration
+	settingsFilters      map[string]interface{}
+	snooze               *snoozeChecker
+	mutes                *muteList
+	recent               *recentEvents
+	dedup                *dedupStore
+	digest               *digest
+	budget               *eventBudget
+	flaps                *flapDetector
+	transactions         *transactionSender
+	metrics              *sentryMetrics
+	logs                 *sentryLogExporter
+	podStartup           *podStartupTracker
+	rollouts             *rolloutTracker
+	otlp                 *otlpExporter
+	watches              *watchMonitor
+	syncs                *syncTracker
+	waitForSync          bool
+	workers              *sync.WaitGroup
+	settingsLock         *sync.RWMutex
+
+	// baseLock protects the default environment and tags, which are also
+	// used by monitors outside the event pipeline.
+	baseLock sync.RWMutex
 }
 
 func (app *application) Run() (chan struct{}, error) {
@@ -50,67 +106,366 @@ func (app *application) Run() (chan struct{}, error) {
 		return nil, err
 	}
 	app.terminationsSeen = terminationsSeen
+	if app.restarts, err = lru.New(1000); err != nil {
+		return nil, err
+	}
+	app.workers = &sync.WaitGroup{}
 	if app.namespace == "" {
 		app.namespace = v1.NamespaceAll
 	}
 	stop := make(chan struct{})
-	go app.monitorEvents(stop)
+	if app.shards != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-stop
+			cancel()
+		}()
+		app.shards.Run(ctx)
+	}
+	app.startMonitor("event monitor", func() { app.monitorEvents(stop) })
+	if app.certExpiryWarning > 0 {
+		if app.certificatesReported, err = lru.New(1000); err != nil {
+			return nil, err
+		}
+		app.startMonitor("certificate monitor", func() { app.monitorCertificates(stop) })
+	}
+	if app.endpoints != nil {
+		app.startMonitor("endpoint monitor", func() { app.monitorEndpoints(stop) })
+	}
+	if app.pdbs != nil {
+		app.startMonitor("PodDisruptionBudget monitor", func() { app.monitorPDBs(stop) })
+	}
+	if app.statefulSets != nil {
+		app.startMonitor("StatefulSet monitor", func() { app.monitorStatefulSets(stop) })
+	}
+	if app.daemonSets != nil {
+		app.startMonitor("DaemonSet monitor", func() { app.monitorDaemonSets(stop) })
+	}
+	if app.needsPods() {
+		app.startMonitor("pod monitor", func() { app.monitorPods(stop) })
+	}
+	if app.nodes != nil {
+		app.startMonitor("node monitor", func() { app.monitorNodes(stop) })
+	}
+	if app.capacity != nil {
+		app.startMonitor("capacity node monitor", func() { app.monitorCapacityNodes(stop) })
+	}
+	if app.budget != nil {
+		app.startWorker("event budget", func() { app.runEventBudget(stop) })
+	}
+	if app.digest != nil {
+		app.startWorker("digest", func() { app.runDigest(stop) })
+	}
+	if app.transactions != nil {
+		app.startWorker("transaction sender", func() { app.transactions.Run(stop) })
+	}
+	if app.metrics != nil {
+		app.startWorker("metrics sender", func() { app.metrics.Run(stop) })
+	}
+	if app.logs != nil {
+		app.startWorker("log exporter", func() { app.logs.Run(stop) })
+	}
+	if app.helmReleases {
+		app.startMonitor("Helm release monitor", func() { app.monitorHelmReleases(stop) })
+	}
+	if app.rollouts != nil {
+		app.startMonitor("rollout monitor", func() { app.monitorRollouts(stop) })
+	}
 	return stop, nil
 }
 
-func (app application) monitorEvents(stop chan struct{}) {
+func (app *application) monitorEvents(stop chan struct{}) {
+	if app.waitForSync {
+		app.waitForInformers("event monitor", stop)
+	}
+	if app.shards == nil {
+		controller := app.newEventController()
+		app.registerInformer("event monitor", controller.HasSynced)
+		controller.Run(stop)
+		return
+	}
+
+	// Events are ignored until a shard is claimed, so the controller is only
+	// started once a shard is claimed, and started again to list all events
+	// whenever another shard is claimed after a failover.
+	var lock sync.Mutex
+	var controller cache.Controller
+	app.registerInformer("event monitor", func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return controller != nil && controller.HasSynced()
+	})
+	var controllerStop chan struct{}
+	for {
+		select {
+		case <-stop:
+			if controllerStop != nil {
+				close(controllerStop)
+			}
+			return
+		case <-app.shards.Claimed():
+			if controllerStop != nil {
+				close(controllerStop)
+			}
+			controllerStop = make(chan struct{})
+			lock.Lock()
+			controller = app.newEventController()
+			lock.Unlock()
+			go controller.Run(controllerStop)
+		}
+	}
+}
+
+// newEventController creates the controller that watches events.
+func (app *application) newEventController() cache.Controller {
 	watchList := cache.NewListWatchFromClient(
 		app.clientset.CoreV1().RESTClient(),
 		"events",
 		app.namespace,
 		fields.Everything(),
 	)
+	handlers := cache.ResourceEventHandlerFuncs{
+		AddFunc:    app.handleEventAdd,
+		UpdateFunc: app.handleEventUpdate,
+	}
 	_, controller := cache.NewInformer(
-		watchList,
+		app.instrument("event monitor", "events", watchList),
 		&v1.Event{},
 		time.Second*30,
-		cache.ResourceEventHandlerFuncs{
-			AddFunc: app.handleEventAdd,
-		},
+		recoverHandlers("event monitor", handlers),
 	)
-
-	controller.Run(stop)
+	return controller
 }
 
-func (app application) handleEventAdd(obj interface{}) {
+func (app *application) handleEventAdd(obj interface{}) {
 	evt, ok := obj.(*v1.Event)
 	if !ok {
 		sentry.CaptureMessage("Unexpected event type")
 		return
 	}
+	app.reportEvent(evt)
+}
+
+// handleEventUpdate reports a repeated event again when its count passes
+// one of the re-alert counts, or when the increased count escalates it.
+func (app *application) handleEventUpdate(oldObj, newObj interface{}) {
+	oldEvt, ok := oldObj.(*v1.Event)
+	if !ok {
+		return
+	}
+	evt, ok := newObj.(*v1.Event)
+	if !ok || eventCount(evt) <= eventCount(oldEvt) {
+		return
+	}
+	if app.realert != nil && app.realert.Due(eventCount(oldEvt), eventCount(evt)) {
+		app.reportEvent(evt)
+		return
+	}
+	if app.recur(evt) {
+		app.reportEvent(evt)
+	}
+}
+
+// recur records that the count of an event increased with the escalator,
+// and returns true if the event should be reported again.
+func (app *application) recur(evt *v1.Event) bool {
+	if app.settingsLock != nil {
+		app.settingsLock.RLock()
+		defer app.settingsLock.RUnlock()
+	}
+	return app.escalation != nil && app.escalation.Recur(evt, time.Now())
+}
 
-	if skipEvent(evt) {
+func (app *application) reportEvent(evt *v1.Event) {
+	if app.settingsLock != nil {
+		app.settingsLock.RLock()
+		defer app.settingsLock.RUnlock()
+	}
+	sentryEvent, cause := app.processEvent(evt)
+	if app.archive != nil {
+		app.archive.Record(evt, app.clusterName, sentryEvent != nil)
+	}
+	if sentryEvent == nil {
+		logger.Debug("Skipping event", eventFields(evt, "cause", cause)...)
+		// Events in a digest or a DNS failure report were reported, so they
+		// must not be counted again after a restart.
+		if app.dedup != nil && (cause == causeDigest || cause == causeDNSReported) {
+			app.dedup.Add(dedupKey(app.clusterName, evt), time.Now())
+		}
+		if app.recent != nil {
+			app.recent.Record(app.clusterName, evt, nil, cause, time.Now())
+		}
 		return
 	}
 
+	logger.Info("Reporting event", eventFields(evt, "type", evt.Type, "message", sentryEvent.Message)...)
+	app.capture(sentryEvent)
+	if app.dedup != nil {
+		app.dedup.Add(dedupKey(app.clusterName, evt), time.Now())
+	}
+	if app.recent != nil {
+		app.recent.Record(app.clusterName, evt, sentryEvent, "", time.Now())
+	}
+}
+
+// capture sends an event to Sentry, and to the OTLP collector if
+// configured.
+func (app *application) capture(sentryEvent *sentry.Event) {
+	sentry.CaptureEvent(sentryEvent)
+	if app.otlp != nil {
+		app.otlp.Export(sentryEvent)
+	}
+}
+
+// newBaseEvent creates a Sentry event with the tags and environment that are
+// common to all events for a namespace.
+func (app *application) newBaseEvent(namespace string) *sentry.Event {
 	sentryEvent := sentry.NewEvent()
 	sentryEvent.Platform = "other"
+	sentryEvent.Environment = app.environment(namespace)
+	sentryEvent.Logger = "kubernetes"
+
+	copyTags(sentryEvent, app.tags())
+	sentryEvent.Tags["namespace"] = namespace
+	if app.clusterName != "" {
+		sentryEvent.Tags["cluster"] = app.clusterName
+	}
+	return sentryEvent
+}
+
+// environment returns the environment for events in a namespace.
+func (app *application) environment(namespace string) string {
+	app.baseLock.RLock()
+	defer app.baseLock.RUnlock()
 	if app.defaultEnvironment != "" {
-		sentryEvent.Environment = app.defaultEnvironment
-	} else {
-		sentryEvent.Environment = evt.InvolvedObject.Namespace
+		return app.defaultEnvironment
 	}
+	return namespace
+}
 
-	sentryEvent.Logger = "kubernetes"
+// tags returns the tags that are added to all events. The map must not be
+// modified.
+func (app *application) tags() map[string]string {
+	app.baseLock.RLock()
+	defer app.baseLock.RUnlock()
+	return app.defaultTags
+}
+
+// Causes for skipped events that were included in another report.
+const (
+	causeDigest      = "included in digest"
+	causeDNSReported = "DNS failure already reported"
+)
+
+// processEvent runs an event through all filters and converts it to a Sentry
+// event. If the event should not be reported nil is returned, together with
+// the reason why it was skipped.
+func (app *application) processEvent(evt *v1.Event) (*sentry.Event, string) {
+	if app.nodes != nil {
+		app.nodes.RecordEvent(evt)
+	}
+	if app.podStartup != nil {
+		app.podStartup.RecordEvent(evt)
+	}
+	if skipEvent(evt) && !(app.preemptionLevel != "" && isPreemption(evt)) && !isCapacityFailure(evt) &&
+		!(app.flaps != nil && isNodeReadyTransition(evt)) {
+		if app.logs != nil && !(app.maxEventAge > 0 && time.Since(eventTime(evt)) > app.maxEventAge) &&
+			(app.shards == nil || app.shards.Owns(evt.Namespace)) {
+			app.logs.Export(app.newEventLog(evt))
+			return nil, "normal event sent to logs"
+		}
+		return nil, "normal event"
+	}
+
+	if app.maxEventAge > 0 && time.Since(eventTime(evt)) > app.maxEventAge {
+		return nil, "event too old"
+	}
+
+	if app.shards != nil && !app.shards.Owns(evt.Namespace) {
+		return nil, "namespace not in shard"
+	}
+
+	if app.dedup != nil && app.dedup.Reported(dedupKey(app.clusterName, evt), time.Now()) {
+		return nil, "already reported"
+	}
+
+	if app.metrics != nil {
+		app.metrics.RecordEvent(app.clusterName, evt)
+	}
+
+	if app.flaps != nil && isNodeReadyTransition(evt) {
+		transitions := app.flaps.Record(evt.InvolvedObject.Name, evt.Reason == "NodeReady", eventTime(evt))
+		if transitions == nil {
+			return nil, "node not flapping"
+		}
+		return app.newNodeFlappingEvent(evt.InvolvedObject.Name, transitions), ""
+	}
+
+	if app.snooze != nil {
+		if until := app.snooze.SnoozedUntil(evt, time.Now()); !until.IsZero() {
+			return nil, snoozeCause(until)
+		}
+	}
+
+	sentryEvent := app.newSentryEvent(evt)
+	if app.mutes != nil {
+		if m := app.mutes.Match(evt.InvolvedObject.Namespace, evt.Reason, sentryEvent.Fingerprint, time.Now()); m != nil {
+			return nil, "muted by " + m.ID
+		}
+	}
+	if window := activeMaintenanceWindow(app.maintenance, evt.InvolvedObject.Namespace, eventTime(evt)); window != nil {
+		if window.action == maintenanceSuppress {
+			return nil, "maintenance window"
+		}
+		sentryEvent.Level = downgradeLevel(sentryEvent.Level)
+		sentryEvent.Tags["maintenance"] = "true"
+	}
+	if !applyRules(app.rules, sentryEvent, evt) {
+		return nil, "dropped by rule"
+	}
+	if !applyExtensions(app.extensions, app.extensionTimeout, sentryEvent, evt) {
+		return nil, "dropped by extension"
+	}
+	if app.escalation != nil {
+		app.escalation.Escalate(sentryEvent, evt, time.Now())
+	}
+	if app.dns != nil && isDNSFailure(evt) && !app.dns.Aggregate(sentryEvent, evt, app.environment("")) {
+		return nil, causeDNSReported
+	}
+	if app.digest != nil && app.digest.Record(evt.InvolvedObject.Namespace, evt.Reason, sentryEvent.Level) {
+		return nil, causeDigest
+	}
+	if app.sampler != nil && !app.sampler.Sample(sentryEvent, evt.Reason) {
+		return nil, "sampled out"
+	}
+	if app.budget != nil && !app.budget.Allow(evt.InvolvedObject.Namespace, evt.Reason, time.Now()) {
+		return nil, "event budget exceeded"
+	}
+
+	return sentryEvent, ""
+}
+
+// newSentryEvent converts a Kubernetes event to a Sentry event.
+func (app *application) newSentryEvent(evt *v1.Event) *sentry.Event {
+	sentryEvent := app.newBaseEvent(evt.InvolvedObject.Namespace)
 	sentryEvent.Message = fmt.Sprintf("%s/%s: %s", evt.InvolvedObject.Kind, evt.InvolvedObject.Name, evt.Message)
 	sentryEvent.Level = getSentryLevel(evt)
-	sentryEvent.Timestamp = evt.ObjectMeta.CreationTimestamp.Unix()
+	sentryEvent.Timestamp = eventTimestamp(app.timestamps, evt).Unix()
 	sentryEvent.Fingerprint = []string{
-		evt.Source.Component,
+		eventComponent(evt),
 		evt.Type,
 		evt.Reason,
 		evt.Message,
 	}
 
-	copyTags(sentryEvent, app.defaultTags)
-	sentryEvent.Tags["namespace"] = evt.InvolvedObject.Namespace
-	sentryEvent.Tags["component"] = evt.Source.Component
-	if evt.ClusterName != "" {
+	sentryEvent.Tags["component"] = eventComponent(evt)
+	if evt.ReportingController != "" {
+		sentryEvent.Tags["reporting.controller"] = evt.ReportingController
+	}
+	if evt.ReportingInstance != "" {
+		sentryEvent.Tags["reporting.instance"] = evt.ReportingInstance
+	}
+	if app.clusterName == "" && evt.ClusterName != "" {
 		sentryEvent.Tags["cluster"] = evt.ClusterName
 	}
 	sentryEvent.Tags["reason"] = evt.Reason
@@ -119,16 +474,23 @@ func (app application) handleEventAdd(obj interface{}) {
 	if evt.Action != "" {
 		sentryEvent.Extra["action"] = evt.Action
 	}
-	sentryEvent.Extra["count"] = evt.Count
+	sentryEvent.Extra["count"] = eventCount(evt)
 
-	handler := NewEventHandler(&app, evt)
-	sentryEvent.Fingerprint = append(sentryEvent.Fingerprint, handler.Fingerprint()...)
-	for k, v := range handler.Tags() {
-		sentryEvent.Tags[k] = v
+	applyHandler(sentryEvent, NewEventHandler(app, evt))
+	for _, handler := range NewReasonEventHandlers(app, evt) {
+		applyHandler(sentryEvent, handler)
 	}
-
-	log.Printf("%s %s\n", evt.Type, sentryEvent.Message)
-	sentry.CaptureEvent(sentryEvent)
+	if app.objectLabels != nil {
+		addAppLabelTags(sentryEvent, objectLabels(app, evt.InvolvedObject, app.objectLabels, time.Now()))
+	}
+	applyFingerprintStrategy(app.grouping, sentryEvent, evt)
+	if app.logs != nil {
+		sentryEvent.Contexts["trace"] = map[string]string{
+			"trace_id": objectTraceID(app.clusterName, evt.InvolvedObject),
+			"span_id":  randomID(8),
+		}
+	}
+	return sentryEvent
 }
 
 func skipEvent(evt *v1.Event) bool {
@@ -137,19 +499,31 @@ func skipEvent(evt *v1.Event) bool {
 
 func getSentryLevel(evt *v1.Event) sentry.Level {
 	switch evt.Type {
+	case v1.EventTypeNormal:
+		return sentry.LevelInfo
 	case v1.EventTypeWarning:
 		return sentry.LevelWarning
 	case "Error":
 		return sentry.LevelError
 	default:
-		fmt.Printf("Unexpected event type: %v\n", evt.Type)
+		logger.Warning("Unexpected event type", "type", evt.Type)
 		return sentry.LevelInfo
 	}
 }
 
+// eventComponent returns the component that emitted an event. Events created
+// through the events.k8s.io API set the reporting controller instead of the
+// source.
+func eventComponent(evt *v1.Event) string {
+	if evt.Source.Component != "" {
+		return evt.Source.Component
+	}
+	return evt.ReportingController
+}
+
 func getEventFingerprint(evt *v1.Event) []string {
 	return []string{
-		evt.Source.Component,
+		eventComponent(evt),
 		evt.InvolvedObject.APIVersion,
 		evt.InvolvedObject.Kind,
 		evt.InvolvedObject.Namespace,
@@ -161,6 +535,17 @@ func getEventFingerprint(evt *v1.Event) []string {
 	}
 }
 
+// eventFields returns logging fields identifying an event, followed by extra.
+func eventFields(evt *v1.Event, extra ...interface{}) []interface{} {
+	fields := []interface{}{
+		"namespace", evt.InvolvedObject.Namespace,
+		"kind", evt.InvolvedObject.Kind,
+		"name", evt.InvolvedObject.Name,
+		"reason", evt.Reason,
+	}
+	return append(fields, extra...)
+}
+
 func inCluster() bool {
 	return os.Getenv("KUBERNETES_SERVICE_HOST") != "" && os.Getenv("KUBERNETES_SERVICE_PORT") != ""
 }
@@ -3,9 +3,11 @@ package main
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/getsentry/sentry-go"
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func testSkipEvent(t *testing.T) {
@@ -80,3 +82,34 @@ func TestInCluster(t *testing.T) {
 	os.Unsetenv("KUBERNETES_SERVICE_HOST")
 	os.Unsetenv("KUBERNETES_SERVICE_PORT")
 }
+
+func TestProcessEventMaxAge(t *testing.T) {
+	t.Parallel()
+
+	app := &application{maxEventAge: 10 * time.Minute}
+	evt := &v1.Event{Type: v1.EventTypeWarning, LastTimestamp: metav1.NewTime(time.Now().Add(-time.Hour))}
+	if event, cause := app.processEvent(evt); event != nil || cause != "event too old" {
+		t.Errorf("Old event not skipped: %v %s", event, cause)
+	}
+}
+
+func TestNewSentryEventReportingController(t *testing.T) {
+	t.Parallel()
+
+	app := &application{}
+	evt := &v1.Event{
+		InvolvedObject:      v1.ObjectReference{Kind: "Database", Namespace: "shop", Name: "orders"},
+		Type:                v1.EventTypeWarning,
+		Reason:              "BackupFailed",
+		Message:             "Backup failed",
+		ReportingController: "example.com/database-operator",
+		ReportingInstance:   "database-operator-7f9c",
+	}
+	event := app.newSentryEvent(evt)
+	if event.Fingerprint[0] != "example.com/database-operator" || event.Tags["component"] != "example.com/database-operator" {
+		t.Errorf("Event not attributed to reporting controller: %v %v", event.Fingerprint, event.Tags)
+	}
+	if event.Tags["reporting.controller"] != "example.com/database-operator" || event.Tags["reporting.instance"] != "database-operator-7f9c" {
+		t.Errorf("Unexpected tags %v", event.Tags)
+	}
+}
@@ -0,0 +1,251 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	archiveProcessed = "processed"
+	archiveReceived  = "received"
+)
+
+// eventArchive writes events to rotating NDJSON files. Rotated files are
+// optionally uploaded to an S3-compatible bucket in the background, and
+// removed once uploaded. The files use the same format as kubectl, so they
+// can be used with the replay command.
+type eventArchive struct {
+	dir            string
+	receivedEvents bool
+	maxSize        int64
+	maxFiles       int
+	rotateInterval time.Duration
+	uploader       *s3Uploader
+	uploads        chan struct{}
+	uploadLock     sync.Mutex
+
+	lock     sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+func newEventArchive(dir, mode string, maxSize int64, maxFiles int, rotateInterval time.Duration, uploader *s3Uploader) (*eventArchive, error) {
+	if mode != archiveProcessed && mode != archiveReceived {
+		return nil, fmt.Errorf("invalid archive mode '%s', expected %s or %s", mode, archiveProcessed, archiveReceived)
+	}
+	if dir == "" {
+		var err error
+		if dir, err = ioutil.TempDir("", "k8s-sentry-archive"); err != nil {
+			return nil, err
+		}
+	} else if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &eventArchive{
+		dir:            dir,
+		receivedEvents: mode == archiveReceived,
+		maxSize:        maxSize,
+		maxFiles:       maxFiles,
+		rotateInterval: rotateInterval,
+		uploader:       uploader,
+		uploads:        make(chan struct{}, 1),
+	}, nil
+}
+
+// Record archives an event. reported indicates if the event was reported to
+// Sentry; unreported events are only archived if all received events should
+// be archived.
+func (a *eventArchive) Record(evt *v1.Event, clusterName string, reported bool) {
+	if !reported && !a.receivedEvents {
+		return
+	}
+
+	archived := *evt
+	if clusterName != "" {
+		archived.ClusterName = clusterName
+	}
+	data, err := json.Marshal(&archived)
+	if err != nil {
+		logger.Error("Error encoding event for archive", "error", err)
+		return
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if err := a.write(append(data, '\n')); err != nil {
+		logger.Error("Error writing event archive", "error", err)
+	}
+}
+
+// Run periodically rotates the archive and uploads rotated files until stop
+// is closed. Files that failed to upload are retried every minute.
+func (a *eventArchive) Run(stop chan struct{}) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-a.uploads:
+			a.upload()
+		case <-ticker.C:
+			a.lock.Lock()
+			if a.file != nil && time.Since(a.openedAt) >= a.rotateInterval {
+				if err := a.rotate(); err != nil {
+					logger.Error("Error rotating event archive", "error", err)
+				}
+			}
+			a.lock.Unlock()
+			a.upload()
+		}
+	}
+}
+
+// Close rotates the current file and uploads all rotated files.
+func (a *eventArchive) Close() error {
+	a.lock.Lock()
+	var err error
+	if a.file != nil {
+		err = a.rotate()
+	}
+	a.lock.Unlock()
+	a.upload()
+	return err
+}
+
+func (a *eventArchive) currentPath() string {
+	return filepath.Join(a.dir, "events.ndjson")
+}
+
+func (a *eventArchive) write(data []byte) error {
+	if a.file == nil {
+		file, err := os.OpenFile(a.currentPath(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return err
+		}
+		a.file = file
+		a.size = info.Size()
+		a.openedAt = time.Now()
+	}
+
+	n, err := a.file.Write(data)
+	a.size += int64(n)
+	if err != nil {
+		return err
+	}
+	if a.size >= a.maxSize {
+		return a.rotate()
+	}
+	return nil
+}
+
+func (a *eventArchive) rotate() error {
+	if err := a.file.Close(); err != nil {
+		return err
+	}
+	a.file = nil
+
+	name := fmt.Sprintf("events-%s.ndjson", time.Now().UTC().Format("20060102T150405.000Z"))
+	path := filepath.Join(a.dir, name)
+	if err := os.Rename(a.currentPath(), path); err != nil {
+		return err
+	}
+
+	if a.uploader != nil {
+		select {
+		case a.uploads <- struct{}{}:
+		default:
+		}
+	}
+	return a.prune()
+}
+
+// upload uploads all rotated files, oldest first, and removes them once they
+// are uploaded. Files that fail to upload are kept until the next upload, or
+// until they are removed because there are too many.
+func (a *eventArchive) upload() {
+	if a.uploader == nil {
+		return
+	}
+	a.uploadLock.Lock()
+	defer a.uploadLock.Unlock()
+	rotated, err := a.rotatedFiles()
+	if err != nil {
+		logger.Error("Error listing event archive", "error", err)
+		return
+	}
+	for _, name := range rotated {
+		path := filepath.Join(a.dir, name)
+		if err := a.uploader.Upload(path, name); err != nil {
+			if !os.IsNotExist(err) {
+				logger.Error("Error uploading event archive", "file", name, "error", err)
+			}
+			return
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			logger.Error("Error removing uploaded event archive", "file", name, "error", err)
+		}
+	}
+}
+
+// rotatedFiles returns the names of all rotated files, oldest first.
+func (a *eventArchive) rotatedFiles() ([]string, error) {
+	files, err := ioutil.ReadDir(a.dir)
+	if err != nil {
+		return nil, err
+	}
+	var rotated []string
+	for _, file := range files {
+		if strings.HasPrefix(file.Name(), "events-") && strings.HasSuffix(file.Name(), ".ndjson") {
+			rotated = append(rotated, file.Name())
+		}
+	}
+	sort.Strings(rotated)
+	return rotated, nil
+}
+
+// prune removes the oldest rotated files if there are more than maxFiles.
+func (a *eventArchive) prune() error {
+	rotated, err := a.rotatedFiles()
+	if err != nil {
+		return err
+	}
+	for len(rotated) > a.maxFiles {
+		if err := os.Remove(filepath.Join(a.dir, rotated[0])); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		rotated = rotated[1:]
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestEventArchive(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "k8s-sentry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	archive, err := newEventArchive(dir, archiveProcessed, 50, 2, time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	evt := &v1.Event{Reason: "BackOff", Message: "Back-off restarting failed container"}
+	archive.Record(evt, "test", false)
+	if _, err := os.Stat(archive.currentPath()); !os.IsNotExist(err) {
+		t.Error("Unreported event archived in processed mode")
+	}
+
+	for i := 0; i < 5; i++ {
+		archive.Record(evt, "test", true)
+		time.Sleep(time.Millisecond)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Errorf("Expected 2 rotated files, found %d", len(files))
+	}
+
+	events, err := readEvents(dir + "/" + files[0].Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Reason != "BackOff" || events[0].ClusterName != "test" {
+		t.Errorf("Unexpected archived events: %v", events)
+	}
+}
+
+func TestEventArchiveUploadRetry(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "k8s-sentry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	status := http.StatusInternalServerError
+	uploaded := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.Header.Get("Authorization") == "" {
+			t.Errorf("Unexpected upload request %s %s", r.Method, r.URL.Path)
+		}
+		if status == http.StatusOK {
+			uploaded++
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	endpoint, _ := url.Parse(server.URL)
+	uploader := &s3Uploader{endpoint: endpoint, bucket: "archive", region: "us-east-1", accessKey: "key", secretKey: "secret", client: server.Client()}
+
+	archive, err := newEventArchive(dir, archiveProcessed, 1<<20, 10, time.Hour, uploader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive.Record(&v1.Event{Reason: "BackOff"}, "test", true)
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if rotated, _ := archive.rotatedFiles(); len(rotated) != 1 {
+		t.Fatalf("Failed upload not kept: %v", rotated)
+	}
+
+	status = http.StatusOK
+	archive.upload()
+	if rotated, _ := archive.rotatedFiles(); len(rotated) != 0 || uploaded != 1 {
+		t.Errorf("Upload not retried: %d uploads, %v left", uploaded, rotated)
+	}
+}
@@ -0,0 +1,250 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/getsentry/sentry-go"
+	lru "github.com/hashicorp/golang-lru"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// auditEventList is the subset of an audit.k8s.io/v1 EventList that is
+// needed to report audit events.
+type auditEventList struct {
+	Items []auditEvent `json:"items"`
+}
+
+type auditEvent struct {
+	AuditID    string `json:"auditID"`
+	Stage      string `json:"stage"`
+	RequestURI string `json:"requestURI"`
+	Verb       string `json:"verb"`
+	User       struct {
+		Username string   `json:"username"`
+		Groups   []string `json:"groups"`
+	} `json:"user"`
+	SourceIPs []string `json:"sourceIPs"`
+	UserAgent string   `json:"userAgent"`
+	ObjectRef *struct {
+		Resource    string `json:"resource"`
+		Namespace   string `json:"namespace"`
+		Name        string `json:"name"`
+		APIGroup    string `json:"apiGroup"`
+		Subresource string `json:"subresource"`
+	} `json:"objectRef"`
+	ResponseStatus *metav1.Status    `json:"responseStatus"`
+	Annotations    map[string]string `json:"annotations"`
+	StageTimestamp metav1.MicroTime  `json:"stageTimestamp"`
+}
+
+// maxAuditBodySize is the maximum size of an audit webhook request.
+const maxAuditBodySize = 10 << 20
+
+// auditReceiver accepts audit webhook requests from the Kubernetes API
+// server and reports policy-relevant entries to Sentry as monitor events of
+// app. Requests must use a client certificate signed by the client CA, or
+// the token, or both if both are configured.
+type auditReceiver struct {
+	app         *application
+	ignoreUsers map[string]bool
+	seen        *lru.Cache
+	token       string
+	report      func(sentryEvent *sentry.Event, ref v1.ObjectReference, key string) bool
+}
+
+func newAuditReceiver(app *application, ignoreUsers []string) (*auditReceiver, error) {
+	seen, err := lru.New(1000)
+	if err != nil {
+		return nil, err
+	}
+	receiver := &auditReceiver{
+		app:         app,
+		ignoreUsers: make(map[string]bool),
+		seen:        seen,
+		report:      app.reportMonitorEvent,
+	}
+	for _, user := range ignoreUsers {
+		receiver.ignoreUsers[user] = true
+	}
+	return receiver, nil
+}
+
+// Start serves the audit webhook on address in the background. If
+// clientCAFile is set, clients must present a certificate signed by it.
+func (r *auditReceiver) Start(address, certFile, keyFile, clientCAFile string) error {
+	if clientCAFile == "" && r.token == "" {
+		return fmt.Errorf("AUDIT_CLIENT_CA or AUDIT_TOKEN must be set to authenticate audit webhooks")
+	}
+	if clientCAFile != "" && certFile == "" {
+		return fmt.Errorf("AUDIT_TLS_CERT must be set to verify client certificates")
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/", r)
+	server := &http.Server{Addr: address, Handler: mux}
+	if clientCAFile != "" {
+		data, err := ioutil.ReadFile(clientCAFile)
+		if err != nil {
+			return fmt.Errorf("error reading audit client CA: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificates found in %s", clientCAFile)
+		}
+		server.TLSConfig = &tls.Config{ClientCAs: pool, ClientAuth: tls.RequireAndVerifyClientCert}
+	}
+	go func() {
+		logger.Info("Starting audit webhook receiver", "address", address)
+		var err error
+		if certFile != "" {
+			err = server.ListenAndServeTLS(certFile, keyFile)
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil {
+			logger.Error("Error running audit webhook receiver", "error", err)
+		}
+	}()
+	return nil
+}
+
+func (r *auditReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.token != "" {
+		token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(r.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	var list auditEventList
+	if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxAuditBodySize)).Decode(&list); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid audit event list: %v", err), http.StatusBadRequest)
+		return
+	}
+	for i := range list.Items {
+		evt := &list.Items[i]
+		if sentryEvent := r.convert(evt); sentryEvent != nil {
+			if r.report(sentryEvent, auditObjectReference(evt), "") {
+				logger.Info("Reporting audit event", "audit-id", evt.AuditID, "message", sentryEvent.Message)
+			}
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// auditCategory determines why an audit event is relevant. An empty string
+// is returned for events that should not be reported.
+func auditCategory(evt *auditEvent) string {
+	if evt.Annotations["authorization.k8s.io/decision"] == "forbid" {
+		return "rbac-denied"
+	}
+	if evt.ResponseStatus != nil && evt.ResponseStatus.Code == http.StatusForbidden {
+		return "forbidden"
+	}
+	if evt.ObjectRef != nil && evt.ObjectRef.Resource == "pods" &&
+		(evt.ObjectRef.Subresource == "exec" || evt.ObjectRef.Subresource == "attach") {
+		return "pod-" + evt.ObjectRef.Subresource
+	}
+	return ""
+}
+
+// auditObjectReference returns a reference to the object of an audit event.
+func auditObjectReference(evt *auditEvent) v1.ObjectReference {
+	if evt.ObjectRef == nil {
+		return v1.ObjectReference{}
+	}
+	ref := v1.ObjectReference{Namespace: evt.ObjectRef.Namespace, Name: evt.ObjectRef.Name}
+	if evt.ObjectRef.Resource == "pods" && evt.ObjectRef.APIGroup == "" {
+		ref.Kind = "Pod"
+	}
+	return ref
+}
+
+// convert converts an audit event to a Sentry event, or returns nil if the
+// audit event should not be reported.
+func (r *auditReceiver) convert(evt *auditEvent) *sentry.Event {
+	// The API server may log multiple stages for a single request.
+	if evt.Stage == "RequestReceived" || r.ignoreUsers[evt.User.Username] {
+		return nil
+	}
+	category := auditCategory(evt)
+	if category == "" {
+		return nil
+	}
+	if seen, _ := r.seen.ContainsOrAdd(evt.AuditID, true); seen {
+		return nil
+	}
+
+	resource, namespace, name := "", "", ""
+	if evt.ObjectRef != nil {
+		resource = evt.ObjectRef.Resource
+		if evt.ObjectRef.APIGroup != "" {
+			resource += "." + evt.ObjectRef.APIGroup
+		}
+		if evt.ObjectRef.Subresource != "" {
+			resource += "/" + evt.ObjectRef.Subresource
+		}
+		namespace = evt.ObjectRef.Namespace
+		name = evt.ObjectRef.Name
+	}
+
+	sentryEvent := r.app.newBaseEvent(namespace)
+	sentryEvent.Logger = "kubernetes-audit"
+	sentryEvent.Timestamp = evt.StageTimestamp.Unix()
+	sentryEvent.Level = sentry.LevelWarning
+	switch category {
+	case "rbac-denied", "forbidden":
+		sentryEvent.Message = fmt.Sprintf("%s was forbidden to %s %s", evt.User.Username, evt.Verb, resource)
+	default:
+		sentryEvent.Message = fmt.Sprintf("%s used %s on pod %s/%s", evt.User.Username, evt.ObjectRef.Subresource, namespace, name)
+	}
+	sentryEvent.Fingerprint = []string{"audit", category, evt.User.Username, evt.Verb, resource, namespace}
+
+	sentryEvent.Tags["audit.category"] = category
+	sentryEvent.Tags["audit.user"] = evt.User.Username
+	sentryEvent.Tags["audit.verb"] = evt.Verb
+	sentryEvent.Tags["resource"] = resource
+	if namespace == "" {
+		delete(sentryEvent.Tags, "namespace")
+	}
+	sentryEvent.Extra["audit-id"] = evt.AuditID
+	sentryEvent.Extra["request-uri"] = evt.RequestURI
+	sentryEvent.Extra["groups"] = evt.User.Groups
+	sentryEvent.Extra["source-ips"] = evt.SourceIPs
+	sentryEvent.Extra["user-agent"] = evt.UserAgent
+	if name != "" {
+		sentryEvent.Extra["name"] = name
+	}
+	if reason := evt.Annotations["authorization.k8s.io/reason"]; reason != "" {
+		sentryEvent.Extra["authorization-reason"] = reason
+	}
+	return sentryEvent
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestAuditReceiverConvert(t *testing.T) {
+	t.Parallel()
+
+	receiver, err := newAuditReceiver(&application{clusterName: "test", defaultEnvironment: "production"}, []string{"system:anonymous"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var list auditEventList
+	err = json.Unmarshal([]byte(`{"items": [
+		{"auditID": "1", "stage": "ResponseComplete", "verb": "list", "user": {"username": "jane"},
+		 "objectRef": {"resource": "secrets", "namespace": "default"},
+		 "responseStatus": {"code": 403}, "annotations": {"authorization.k8s.io/decision": "forbid"}},
+		{"auditID": "1", "stage": "ResponseComplete", "verb": "list", "user": {"username": "jane"},
+		 "objectRef": {"resource": "secrets", "namespace": "default"},
+		 "responseStatus": {"code": 403}, "annotations": {"authorization.k8s.io/decision": "forbid"}},
+		{"auditID": "2", "stage": "ResponseStarted", "verb": "create", "user": {"username": "joe"},
+		 "objectRef": {"resource": "pods", "subresource": "exec", "namespace": "default", "name": "web"}},
+		{"auditID": "3", "stage": "ResponseComplete", "verb": "get", "user": {"username": "joe"},
+		 "objectRef": {"resource": "pods", "namespace": "default", "name": "web"},
+		 "responseStatus": {"code": 200}},
+		{"auditID": "4", "stage": "ResponseComplete", "verb": "get", "user": {"username": "system:anonymous"},
+		 "responseStatus": {"code": 403}}
+	]}`), &list)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := receiver.convert(&list.Items[0])
+	if event == nil || event.Tags["audit.category"] != "rbac-denied" || event.Tags["cluster"] != "test" || event.Environment != "production" {
+		t.Errorf("RBAC denial not reported correctly: %v", event)
+	}
+	if receiver.convert(&list.Items[1]) != nil {
+		t.Error("Audit event with same ID reported twice")
+	}
+	event = receiver.convert(&list.Items[2])
+	if event == nil || event.Tags["audit.category"] != "pod-exec" {
+		t.Errorf("Pod exec not reported correctly: %v", event)
+	}
+	if receiver.convert(&list.Items[3]) != nil {
+		t.Error("Regular request reported")
+	}
+	if receiver.convert(&list.Items[4]) != nil {
+		t.Error("Ignored user reported")
+	}
+}
+
+func TestAuditReceiverAuthentication(t *testing.T) {
+	t.Parallel()
+
+	receiver, err := newAuditReceiver(&application{clusterName: "test"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var captured []*sentry.Event
+	receiver.token = "secret"
+	receiver.report = func(event *sentry.Event, ref v1.ObjectReference, key string) bool {
+		captured = append(captured, event)
+		return true
+	}
+	body := `{"items": [{"auditID": "1", "stage": "ResponseComplete", "verb": "list", "user": {"username": "jane"},
+		"responseStatus": {"code": 403}}]}`
+
+	request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	response := httptest.NewRecorder()
+	receiver.ServeHTTP(response, request)
+	if response.Code != http.StatusUnauthorized || len(captured) != 0 {
+		t.Errorf("Request without token accepted: %d", response.Code)
+	}
+
+	request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	request.Header.Set("Authorization", "Bearer secret")
+	response = httptest.NewRecorder()
+	receiver.ServeHTTP(response, request)
+	if response.Code != http.StatusOK || len(captured) != 1 {
+		t.Errorf("Request with token not handled: %d, %d events", response.Code, len(captured))
+	}
+
+	request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"items": ["`+strings.Repeat("x", maxAuditBodySize)+`"]}`))
+	request.Header.Set("Authorization", "Bearer secret")
+	response = httptest.NewRecorder()
+	receiver.ServeHTTP(response, request)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Oversized request accepted: %d", response.Code)
+	}
+
+	receiver.token = ""
+	if err := receiver.Start(":0", "", "", ""); err == nil {
+		t.Error("Receiver started without authentication")
+	}
+	if err := receiver.Start(":0", "", "", "ca.pem"); err == nil {
+		t.Error("Receiver started to verify client certificates without TLS")
+	}
+}
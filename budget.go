@@ -0,0 +1,149 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// budgetWindow is the period for which the event budget of a namespace is
+// counted.
+const budgetWindow = time.Minute
+
+// budgetUsage is the number of events of a namespace in the current budget
+// window.
+type budgetUsage struct {
+	start      time.Time
+	reported   int
+	suppressed map[string]int
+}
+
+// eventBudget limits the number of events reported per namespace per
+// minute, so a single misbehaving namespace can not use up the Sentry quota.
+// Events over the budget are counted by reason and summarized in a single
+// event per namespace once the window ends.
+type eventBudget struct {
+	limit int
+
+	lock    sync.Mutex
+	usage   map[string]*budgetUsage
+	pending map[string]map[string]int
+}
+
+func newEventBudget(limit int) *eventBudget {
+	return &eventBudget{
+		limit:   limit,
+		usage:   make(map[string]*budgetUsage),
+		pending: make(map[string]map[string]int),
+	}
+}
+
+// Allow counts an event, and returns false if the namespace exceeded its
+// budget.
+func (b *eventBudget) Allow(namespace, reason string, now time.Time) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	start := now.Truncate(budgetWindow)
+	usage := b.usage[namespace]
+	if usage == nil || usage.start.Before(start) {
+		if usage != nil {
+			b.end(namespace, usage)
+		}
+		usage = &budgetUsage{start: start}
+		b.usage[namespace] = usage
+	}
+	if usage.reported < b.limit {
+		usage.reported++
+		return true
+	}
+	if usage.suppressed == nil {
+		usage.suppressed = make(map[string]int)
+	}
+	usage.suppressed[reason]++
+	return false
+}
+
+// end moves the suppressed events of a window that ended to the pending
+// summaries. It must be called with the lock held.
+func (b *eventBudget) end(namespace string, usage *budgetUsage) {
+	if len(usage.suppressed) == 0 {
+		return
+	}
+	pending := b.pending[namespace]
+	if pending == nil {
+		pending = make(map[string]int)
+		b.pending[namespace] = pending
+	}
+	for reason, count := range usage.suppressed {
+		pending[reason] += count
+	}
+}
+
+// Flush returns the suppressed events per namespace and reason of all
+// windows that ended before now.
+func (b *eventBudget) Flush(now time.Time) map[string]map[string]int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for namespace, usage := range b.usage {
+		if !usage.start.Add(budgetWindow).After(now) {
+			b.end(namespace, usage)
+			delete(b.usage, namespace)
+		}
+	}
+	result := b.pending
+	b.pending = make(map[string]map[string]int)
+	return result
+}
+
+// runEventBudget reports namespaces that exceeded their event budget once
+// per window, until stop is closed.
+func (app *application) runEventBudget(stop chan struct{}) {
+	ticker := time.NewTicker(budgetWindow / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			for namespace, suppressed := range app.budget.Flush(time.Now().Add(budgetWindow)) {
+				app.capture(app.newBudgetEvent(namespace, suppressed))
+			}
+			return
+		case <-ticker.C:
+			for namespace, suppressed := range app.budget.Flush(time.Now()) {
+				app.capture(app.newBudgetEvent(namespace, suppressed))
+			}
+		}
+	}
+}
+
+func (app *application) newBudgetEvent(namespace string, suppressed map[string]int) *sentry.Event {
+	total := 0
+	for _, count := range suppressed {
+		total += count
+	}
+
+	sentryEvent := app.newBaseEvent(namespace)
+	sentryEvent.Level = sentry.LevelWarning
+	sentryEvent.Message = fmt.Sprintf("Namespace %s exceeded its event budget of %d events per minute, %d events were not reported", namespace, app.budget.limit, total)
+	sentryEvent.Fingerprint = []string{"event-budget", namespace}
+	sentryEvent.Tags["event-budget"] = "exceeded"
+	sentryEvent.Extra["suppressed"] = suppressed
+	sentryEvent.Extra["budget"] = app.budget.limit
+	return sentryEvent
+}
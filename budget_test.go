@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEventBudget(t *testing.T) {
+	t.Parallel()
+
+	budget := newEventBudget(2)
+	start := time.Date(2019, 10, 22, 15, 0, 0, 0, time.UTC)
+	for i, allowed := range []bool{true, true, false, false} {
+		if budget.Allow("shop", "BackOff", start.Add(time.Duration(i)*time.Second)) != allowed {
+			t.Errorf("Unexpected result for event %d", i+1)
+		}
+	}
+	if !budget.Allow("db", "BackOff", start) {
+		t.Error("Budget shared between namespaces")
+	}
+	if flushed := budget.Flush(start.Add(30 * time.Second)); len(flushed) != 0 {
+		t.Errorf("Window flushed early: %v", flushed)
+	}
+
+	// The next window starts with a new budget, and keeps the suppressed
+	// events of the previous window for the summary.
+	next := start.Add(time.Minute)
+	if !budget.Allow("shop", "Unhealthy", next) || !budget.Allow("shop", "Unhealthy", next) || budget.Allow("shop", "Unhealthy", next) {
+		t.Error("Budget not reset for the next window")
+	}
+	flushed := budget.Flush(next.Add(10 * time.Second))
+	if len(flushed) != 1 || flushed["shop"]["BackOff"] != 2 || flushed["shop"]["Unhealthy"] != 0 {
+		t.Errorf("Unexpected summary %v", flushed)
+	}
+	flushed = budget.Flush(next.Add(time.Minute))
+	if len(flushed) != 1 || flushed["shop"]["Unhealthy"] != 1 {
+		t.Errorf("Unexpected summary %v", flushed)
+	}
+}
+
+func TestNewBudgetEvent(t *testing.T) {
+	t.Parallel()
+
+	app := &application{budget: newEventBudget(100)}
+	event := app.newBudgetEvent("shop", map[string]int{"BackOff": 40, "Unhealthy": 2})
+	if event.Message != "Namespace shop exceeded its event budget of 100 events per minute, 42 events were not reported" {
+		t.Errorf("Unexpected message %q", event.Message)
+	}
+	if event.Fingerprint[0] != "event-budget" || event.Fingerprint[1] != "shop" {
+		t.Errorf("Unexpected fingerprint %v", event.Fingerprint)
+	}
+}
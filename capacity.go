@@ -0,0 +1,219 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/tools/cache"
+)
+
+// nodePoolLabels are labels cloud providers and provisioners add to nodes
+// with the name of their node pool.
+var nodePoolLabels = []string{
+	"eks.amazonaws.com/nodegroup",
+	"cloud.google.com/gke-nodepool",
+	"kubernetes.azure.com/agentpool",
+	"karpenter.sh/nodepool",
+	"karpenter.sh/provisioner-name",
+}
+
+// capacityResources are the resources included in capacity summaries.
+var capacityResources = []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory, v1.ResourcePods}
+
+// podNodeIndex indexes pods by the name of their node.
+const podNodeIndex = "node"
+
+// poolCapacity summarizes the capacity of a node pool.
+type poolCapacity struct {
+	Nodes       int               `json:"nodes"`
+	Schedulable int               `json:"schedulable"`
+	Allocatable map[string]string `json:"allocatable"`
+	Requested   map[string]string `json:"requested"`
+	Free        map[string]string `json:"free"`
+}
+
+// capacityTracker keeps nodes and running pods in a cache, to summarize the
+// allocatable and requested resources of the cluster without API calls.
+type capacityTracker struct {
+	lock  sync.RWMutex
+	nodes cache.Store
+	pods  cache.Indexer
+}
+
+func newCapacityTracker() *capacityTracker {
+	return &capacityTracker{}
+}
+
+func (app *application) monitorCapacityNodes(stop chan struct{}) {
+	watchList := cache.NewListWatchFromClient(
+		app.clientset.CoreV1().RESTClient(),
+		"nodes",
+		v1.NamespaceAll,
+		fields.Everything(),
+	)
+	store, controller := cache.NewInformer(
+		app.instrument("capacity node monitor", "nodes", watchList),
+		&v1.Node{},
+		0,
+		cache.ResourceEventHandlerFuncs{},
+	)
+	app.capacity.lock.Lock()
+	app.capacity.nodes = store
+	app.capacity.lock.Unlock()
+
+	app.registerInformer("capacity node monitor", controller.HasSynced)
+	controller.Run(stop)
+}
+
+// podNodeName indexes scheduled pods that have not terminated, which are the
+// pods that use resources on a node.
+func podNodeName(obj interface{}) ([]string, error) {
+	if pod, ok := obj.(*v1.Pod); ok && pod.Spec.NodeName != "" && pod.Status.Phase != v1.PodSucceeded && pod.Status.Phase != v1.PodFailed {
+		return []string{pod.Spec.NodeName}, nil
+	}
+	return nil, nil
+}
+
+// Summary returns the capacity of every node pool. Only schedulable nodes
+// count towards the allocatable resources, since cordoned nodes do not
+// accept new pods.
+func (t *capacityTracker) Summary() map[string]*poolCapacity {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	if t.nodes == nil || t.pods == nil {
+		return nil
+	}
+
+	allocatable := make(map[string]v1.ResourceList)
+	requested := make(map[string]v1.ResourceList)
+	summary := make(map[string]*poolCapacity)
+	for _, obj := range t.nodes.List() {
+		node, ok := obj.(*v1.Node)
+		if !ok {
+			continue
+		}
+		pool := nodePool(node)
+		if summary[pool] == nil {
+			summary[pool] = &poolCapacity{}
+			allocatable[pool] = make(v1.ResourceList)
+			requested[pool] = make(v1.ResourceList)
+		}
+		summary[pool].Nodes++
+		if node.Spec.Unschedulable {
+			continue
+		}
+		summary[pool].Schedulable++
+		addResources(allocatable[pool], node.Status.Allocatable)
+		pods, _ := t.pods.ByIndex(podNodeIndex, node.Name)
+		for _, obj := range pods {
+			if pod, ok := obj.(*v1.Pod); ok {
+				addResources(requested[pool], podRequests(pod))
+				count := requested[pool][v1.ResourcePods]
+				count.Add(*resource.NewQuantity(1, resource.DecimalSI))
+				requested[pool][v1.ResourcePods] = count
+			}
+		}
+	}
+
+	for pool, capacity := range summary {
+		capacity.Allocatable = make(map[string]string)
+		capacity.Requested = make(map[string]string)
+		capacity.Free = make(map[string]string)
+		for _, name := range capacityResources {
+			allocated := allocatable[pool][name]
+			used := requested[pool][name]
+			free := allocated.DeepCopy()
+			free.Sub(used)
+			capacity.Allocatable[string(name)] = allocated.String()
+			capacity.Requested[string(name)] = used.String()
+			capacity.Free[string(name)] = free.String()
+		}
+	}
+	return summary
+}
+
+// Node returns a node from the cache, or nil if it is not known.
+func (t *capacityTracker) Node(name string) *v1.Node {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	if t.nodes == nil {
+		return nil
+	}
+	obj, exists, err := t.nodes.GetByKey(name)
+	if err != nil || !exists {
+		return nil
+	}
+	node, _ := obj.(*v1.Node)
+	return node
+}
+
+// PodsOnNode returns the running pods on a node from the cache.
+func (t *capacityTracker) PodsOnNode(name string) []*v1.Pod {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	if t.pods == nil {
+		return nil
+	}
+	objs, _ := t.pods.ByIndex(podNodeIndex, name)
+	pods := make([]*v1.Pod, 0, len(objs))
+	for _, obj := range objs {
+		if pod, ok := obj.(*v1.Pod); ok {
+			pods = append(pods, pod)
+		}
+	}
+	return pods
+}
+
+// nodePool returns the name of the node pool of a node, or "default" if the
+// node has no node pool label.
+func nodePool(node *v1.Node) string {
+	for _, label := range nodePoolLabels {
+		if pool := node.Labels[label]; pool != "" {
+			return pool
+		}
+	}
+	return "default"
+}
+
+// podRequests returns the resources requested by a pod, the way the
+// scheduler computes them: the sum of the requests of all containers, or
+// the largest request of an init container if that is larger.
+func podRequests(pod *v1.Pod) v1.ResourceList {
+	requests := make(v1.ResourceList)
+	for _, container := range pod.Spec.Containers {
+		addResources(requests, container.Resources.Requests)
+	}
+	for _, container := range pod.Spec.InitContainers {
+		for name, quantity := range container.Resources.Requests {
+			if current, ok := requests[name]; !ok || quantity.Cmp(current) > 0 {
+				requests[name] = quantity.DeepCopy()
+			}
+		}
+	}
+	return requests
+}
+
+func addResources(total, resources v1.ResourceList) {
+	for name, quantity := range resources {
+		sum := total[name]
+		sum.Add(quantity)
+		total[name] = sum
+	}
+}
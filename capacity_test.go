@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestCapacityTrackerSummary(t *testing.T) {
+	t.Parallel()
+
+	newNode := func(name, pool string, unschedulable bool) *v1.Node {
+		node := &v1.Node{}
+		node.Name = name
+		node.Labels = map[string]string{"cloud.google.com/gke-nodepool": pool}
+		node.Spec.Unschedulable = unschedulable
+		node.Status.Allocatable = v1.ResourceList{
+			v1.ResourceCPU:    resource.MustParse("2"),
+			v1.ResourceMemory: resource.MustParse("4Gi"),
+			v1.ResourcePods:   resource.MustParse("110"),
+		}
+		return node
+	}
+	newPod := func(name, node, cpu, memory string) *v1.Pod {
+		pod := &v1.Pod{}
+		pod.Namespace = "shop"
+		pod.Name = name
+		pod.Spec.NodeName = node
+		pod.Spec.Containers = []v1.Container{{
+			Resources: v1.ResourceRequirements{Requests: v1.ResourceList{
+				v1.ResourceCPU:    resource.MustParse(cpu),
+				v1.ResourceMemory: resource.MustParse(memory),
+			}},
+		}}
+		return pod
+	}
+
+	tracker := newCapacityTracker()
+	if tracker.Summary() != nil {
+		t.Error("Summary before the caches are started")
+	}
+	tracker.nodes = cache.NewStore(cache.MetaNamespaceKeyFunc)
+	tracker.pods = cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{podNodeIndex: podNodeName})
+	tracker.nodes.Add(newNode("web-1", "web", false))
+	tracker.nodes.Add(newNode("web-2", "web", false))
+	tracker.nodes.Add(newNode("web-3", "web", true))
+	tracker.nodes.Add(newNode("batch-1", "batch", false))
+	tracker.pods.Add(newPod("a", "web-1", "1500m", "1Gi"))
+	tracker.pods.Add(newPod("b", "web-2", "500m", "3Gi"))
+	tracker.pods.Add(newPod("c", "web-3", "1", "1Gi"))
+
+	summary := tracker.Summary()
+	web := summary["web"]
+	if web == nil || web.Nodes != 3 || web.Schedulable != 2 {
+		t.Fatalf("Unexpected web pool: %+v", web)
+	}
+	if web.Allocatable["cpu"] != "4" || web.Requested["cpu"] != "2" || web.Free["cpu"] != "2" {
+		t.Errorf("Unexpected CPU capacity: %+v", web)
+	}
+	if web.Free["memory"] != "4Gi" || web.Requested["pods"] != "2" {
+		t.Errorf("Unexpected capacity: %+v", web)
+	}
+	if batch := summary["batch"]; batch == nil || batch.Requested["cpu"] != "0" {
+		t.Errorf("Unexpected batch pool: %+v", batch)
+	}
+
+	evt := &v1.Event{Reason: "FailedScheduling", Message: "0/4 nodes are available: 4 Insufficient cpu."}
+	event := sentry.NewEvent()
+	applyHandler(event, NewSchedulingEventHandler(&application{capacity: tracker}, evt))
+	if _, ok := event.Extra["node-capacity"]; !ok {
+		t.Error("Capacity not added to scheduling failure")
+	}
+}
+
+func TestPodRequests(t *testing.T) {
+	t.Parallel()
+
+	pod := &v1.Pod{}
+	pod.Spec.Containers = []v1.Container{
+		{Resources: v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("100m")}}},
+		{Resources: v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("200m")}}},
+	}
+	pod.Spec.InitContainers = []v1.Container{
+		{Resources: v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("500m"), v1.ResourceMemory: resource.MustParse("64Mi")}}},
+	}
+	requests := podRequests(pod)
+	if cpu := requests[v1.ResourceCPU]; cpu.String() != "500m" {
+		t.Errorf("Unexpected CPU request %s", cpu.String())
+	}
+	if memory := requests[v1.ResourceMemory]; memory.String() != "64Mi" {
+		t.Errorf("Unexpected memory request %s", memory.String())
+	}
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/tools/cache"
+)
+
+// certificateReportInterval is the minimum time between two reports for the
+// same certificate.
+const certificateReportInterval = 24 * time.Hour
+
+func (app *application) monitorCertificates(stop chan struct{}) {
+	watchList := cache.NewListWatchFromClient(
+		app.clientset.CoreV1().RESTClient(),
+		"secrets",
+		app.namespace,
+		fields.OneTermEqualSelector("type", string(v1.SecretTypeTLS)),
+	)
+	_, controller := cache.NewInformer(
+		app.instrument("certificate monitor", "secrets", watchList),
+		&v1.Secret{},
+		time.Hour,
+		recoverHandlers("certificate monitor", cache.ResourceEventHandlerFuncs{
+			AddFunc: app.checkCertificate,
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				app.checkCertificate(newObj)
+			},
+		}),
+	)
+
+	app.registerInformer("certificate monitor", controller.HasSynced)
+	controller.Run(stop)
+}
+
+func (app *application) checkCertificate(obj interface{}) {
+	secret, ok := obj.(*v1.Secret)
+	if !ok {
+		return
+	}
+	cert, err := parseCertificate(secret.Data[v1.TLSCertKey])
+	if err != nil {
+		logger.Debug("Unable to parse certificate", "namespace", secret.Namespace, "secret", secret.Name, "error", err)
+		return
+	}
+
+	remaining := time.Until(cert.NotAfter)
+	level := certificateLevel(remaining, app.certExpiryWarning, app.certExpiryError)
+	if level == "" {
+		return
+	}
+
+	key := fmt.Sprintf("%s/%s/%s", secret.UID, cert.NotAfter, level)
+	if last, ok := app.certificatesReported.Get(key); ok && time.Since(last.(time.Time)) < certificateReportInterval {
+		return
+	}
+	app.certificatesReported.Add(key, time.Now())
+
+	sentryEvent := app.newBaseEvent(secret.Namespace)
+	sentryEvent.Level = level
+	if remaining <= 0 {
+		sentryEvent.Message = fmt.Sprintf("Secret/%s: certificate expired on %s", secret.Name, cert.NotAfter.Format(time.RFC3339))
+	} else {
+		sentryEvent.Message = fmt.Sprintf("Secret/%s: certificate expires in %d days", secret.Name, int(remaining.Hours()/24))
+	}
+	sentryEvent.Fingerprint = []string{"certificate-expiry", secret.Namespace, secret.Name}
+	sentryEvent.Tags["kind"] = "Secret"
+	sentryEvent.Tags["secret"] = secret.Name
+	if len(cert.DNSNames) > 0 {
+		sentryEvent.Tags["sans"] = truncate(strings.Join(cert.DNSNames, ","), 200)
+	}
+	sentryEvent.Extra["not-after"] = cert.NotAfter.Format(time.RFC3339)
+	sentryEvent.Extra["subject"] = cert.Subject.String()
+	sentryEvent.Extra["issuer"] = cert.Issuer.String()
+	sentryEvent.Extra["sans"] = cert.DNSNames
+	if ingresses := app.ingressesUsingSecret(secret); len(ingresses) > 0 {
+		sentryEvent.Extra["ingresses"] = ingresses
+	}
+
+	logger.Info("Reporting expiring certificate", "namespace", secret.Namespace, "secret", secret.Name, "not-after", cert.NotAfter)
+	app.reportMonitorEvent(sentryEvent, objectReference("Secret", secret), "certificate/"+key)
+}
+
+// ingressesUsingSecret returns the names of all Ingresses that use a secret
+// for TLS.
+func (app *application) ingressesUsingSecret(secret *v1.Secret) []string {
+	ingresses, err := app.clientset.NetworkingV1beta1().Ingresses(secret.Namespace).List(metav1.ListOptions{})
+	if err != nil {
+		logger.Debug("Unable to list ingresses", "namespace", secret.Namespace, "error", err)
+		return nil
+	}
+	var result []string
+	for _, ingress := range ingresses.Items {
+		for _, tls := range ingress.Spec.TLS {
+			if tls.SecretName == secret.Name {
+				result = append(result, ingress.Name)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// certificateLevel determines the Sentry level for a certificate that expires
+// after remaining. An empty level is returned if the certificate is not
+// expiring soon.
+func certificateLevel(remaining, warning, error time.Duration) sentry.Level {
+	switch {
+	case remaining <= error:
+		return sentry.LevelError
+	case remaining <= warning:
+		return sentry.LevelWarning
+	default:
+		return ""
+	}
+}
+
+// parseCertificate parses the first certificate in PEM encoded data.
+func parseCertificate(data []byte) (*x509.Certificate, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("no certificate found")
+		}
+		if block.Type == "CERTIFICATE" {
+			return x509.ParseCertificate(block.Bytes)
+		}
+	}
+}
+
+func truncate(value string, length int) string {
+	if len(value) <= length {
+		return value
+	}
+	return value[:length-3] + "..."
+}
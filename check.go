@@ -0,0 +1,380 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/getsentry/sentry-go"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// accessCheck verifies that a resource can be used. Resources that are
+// listed are checked by listing them, for all other verbs the API server is
+// asked with a SelfSubjectAccessReview.
+type accessCheck struct {
+	group       string
+	resource    string
+	subresource string
+	namespace   string
+	verbs       []string
+	list        func(options metav1.ListOptions) error
+}
+
+func checkConfigCommand(args []string) error {
+	cfg, err := parseConfig(flag.NewFlagSet("check-config", flag.ExitOnError), args)
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	options, err := cfg.sentryOptions()
+	if err != nil {
+		problems = append(problems, err.Error())
+	} else if options.Dsn == "" {
+		problems = append(problems, "no Sentry DSN configured: set SENTRY_DSN or SENTRY_DSN_FILE")
+	} else if _, err := sentry.NewDsn(options.Dsn); err != nil {
+		problems = append(problems, fmt.Sprintf("invalid Sentry DSN: %v", err))
+	}
+
+	apps, err := cfg.applications()
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+	for i, app := range apps {
+		checks := append(app.accessChecks(), cfg.accessChecks(app, i == 0)...)
+		problems = append(problems, app.checkAccess(checks)...)
+	}
+
+	if len(problems) > 0 {
+		for _, problem := range problems {
+			fmt.Printf("ERROR: %s\n", problem)
+		}
+		return fmt.Errorf("found %d configuration problem(s)", len(problems))
+	}
+	fmt.Println("Configuration OK")
+	return nil
+}
+
+// handlerAccessChecks return the checks for the resources that event
+// handlers get or list to add details to events.
+var handlerAccessChecks = []func(app *application) []accessCheck{
+	podAccessChecks,
+	containerConfigAccessChecks,
+	deadlineAccessChecks,
+	replicaSetAccessChecks,
+	ingressAccessChecks,
+	jobFailureAccessChecks,
+	limitRangeAccessChecks,
+	quotaAccessChecks,
+	volumeAccessChecks,
+	preemptionAccessChecks,
+	systemOOMAccessChecks,
+	autoscalerAccessChecks,
+	certManagerAccessChecks,
+	appLabelAccessChecks,
+}
+
+// getAccess returns the check for getting a resource.
+func getAccess(group, resource, namespace string) accessCheck {
+	return accessCheck{group: group, resource: resource, namespace: namespace, verbs: []string{"get"}}
+}
+
+// accessChecks returns the checks for all resources the application watches
+// or gets.
+func (app *application) accessChecks() []accessCheck {
+	checks := []accessCheck{
+		{
+			resource:  "events",
+			namespace: app.namespace,
+			list: func(options metav1.ListOptions) error {
+				_, err := app.clientset.CoreV1().Events(app.namespace).List(options)
+				return err
+			},
+		},
+	}
+	if app.certExpiryWarning > 0 {
+		checks = append(checks, accessCheck{
+			resource:  "secrets",
+			namespace: app.namespace,
+			list: func(options metav1.ListOptions) error {
+				_, err := app.clientset.CoreV1().Secrets(app.namespace).List(options)
+				return err
+			},
+		}, accessCheck{
+			group:     "networking.k8s.io",
+			resource:  "ingresses",
+			namespace: app.namespace,
+			list: func(options metav1.ListOptions) error {
+				_, err := app.clientset.NetworkingV1beta1().Ingresses(app.namespace).List(options)
+				return err
+			},
+		})
+	}
+	if app.endpoints != nil {
+		checks = append(checks, accessCheck{
+			resource:  "endpoints",
+			namespace: app.namespace,
+			list: func(options metav1.ListOptions) error {
+				_, err := app.clientset.CoreV1().Endpoints(app.namespace).List(options)
+				return err
+			},
+		}, getAccess("", "services", app.namespace))
+	}
+	if app.pdbs != nil {
+		checks = append(checks, accessCheck{
+			group:     "policy",
+			resource:  "poddisruptionbudgets",
+			namespace: app.namespace,
+			list: func(options metav1.ListOptions) error {
+				_, err := app.clientset.PolicyV1beta1().PodDisruptionBudgets(app.namespace).List(options)
+				return err
+			},
+		})
+	}
+	if app.statefulSets != nil {
+		checks = append(checks, accessCheck{
+			group:     "apps",
+			resource:  "statefulsets",
+			namespace: app.namespace,
+			list: func(options metav1.ListOptions) error {
+				_, err := app.clientset.AppsV1().StatefulSets(app.namespace).List(options)
+				return err
+			},
+		})
+	}
+	if app.daemonSets != nil {
+		checks = append(checks, accessCheck{
+			group:     "apps",
+			resource:  "daemonsets",
+			namespace: app.namespace,
+			list: func(options metav1.ListOptions) error {
+				_, err := app.clientset.AppsV1().DaemonSets(app.namespace).List(options)
+				return err
+			},
+		})
+	}
+	// DaemonSets and PodDisruptionBudgets list the nodes and their pods to
+	// find out why pods are not scheduled or can not be evicted.
+	if app.nodes != nil || app.capacity != nil || app.daemonSets != nil || app.pdbs != nil {
+		checks = append(checks, accessCheck{
+			resource: "nodes",
+			list: func(options metav1.ListOptions) error {
+				_, err := app.clientset.CoreV1().Nodes().List(options)
+				return err
+			},
+		})
+	}
+	if app.needsPods() || app.daemonSets != nil || app.pdbs != nil {
+		namespace := app.namespace
+		if app.needsPods() {
+			namespace = app.podNamespace()
+		}
+		checks = append(checks, accessCheck{
+			resource:  "pods",
+			namespace: namespace,
+			list: func(options metav1.ListOptions) error {
+				_, err := app.clientset.CoreV1().Pods(namespace).List(options)
+				return err
+			},
+		})
+	}
+	if app.helmReleases {
+		checks = append(checks, accessCheck{
+			resource:  "secrets",
+			namespace: app.namespace,
+			list: func(options metav1.ListOptions) error {
+				options.LabelSelector = "owner=helm"
+				_, err := app.clientset.CoreV1().Secrets(app.namespace).List(options)
+				return err
+			},
+		})
+	}
+	if app.rollouts != nil {
+		checks = append(checks, accessCheck{
+			group:     "apps",
+			resource:  "deployments",
+			namespace: app.namespace,
+			list: func(options metav1.ListOptions) error {
+				_, err := app.clientset.AppsV1().Deployments(app.namespace).List(options)
+				return err
+			},
+		})
+	}
+	if app.snooze != nil {
+		checks = append(checks,
+			getAccess("", "namespaces", ""),
+			getAccess("", "pods", app.namespace),
+			getAccess("apps", "replicasets", app.namespace),
+			getAccess("apps", "deployments", app.namespace),
+			getAccess("apps", "statefulsets", app.namespace),
+			getAccess("apps", "daemonsets", app.namespace),
+			getAccess("batch", "jobs", app.namespace),
+			getAccess("batch", "cronjobs", app.namespace),
+		)
+	}
+	if app.shards != nil {
+		checks = append(checks, accessCheck{
+			group:     "coordination.k8s.io",
+			resource:  "leases",
+			namespace: app.shards.leaseNamespace,
+			verbs:     []string{"get", "create", "update"},
+		})
+	}
+
+	for _, handlerChecks := range handlerAccessChecks {
+		checks = append(checks, handlerChecks(app)...)
+	}
+	return checks
+}
+
+// accessChecks returns the checks for the resources used by features that
+// are shared by all clusters. The ConfigMap with reported events is stored
+// in the primary cluster.
+func (c *config) accessChecks(app *application, primary bool) []accessCheck {
+	var checks []accessCheck
+	if c.dedupConfigMap != "" && primary {
+		checks = append(checks, accessCheck{
+			resource:  "configmaps",
+			namespace: strings.Split(c.dedupConfigMap, "/")[0],
+			verbs:     []string{"get", "create", "update"},
+		})
+	}
+	if c.ownershipKey != "" {
+		// Namespaces are listed, unless a single namespace is watched.
+		if app.namespace == v1.NamespaceAll {
+			checks = append(checks, accessCheck{
+				resource: "namespaces",
+				list: func(options metav1.ListOptions) error {
+					_, err := app.clientset.CoreV1().Namespaces().List(options)
+					return err
+				},
+			})
+		} else {
+			checks = append(checks, getAccess("", "namespaces", ""))
+		}
+		checks = append(checks,
+			accessCheck{
+				group:     "apps",
+				resource:  "deployments",
+				namespace: app.namespace,
+				list: func(options metav1.ListOptions) error {
+					_, err := app.clientset.AppsV1().Deployments(app.namespace).List(options)
+					return err
+				},
+			},
+			accessCheck{
+				group:     "apps",
+				resource:  "statefulsets",
+				namespace: app.namespace,
+				list: func(options metav1.ListOptions) error {
+					_, err := app.clientset.AppsV1().StatefulSets(app.namespace).List(options)
+					return err
+				},
+			},
+			accessCheck{
+				group:     "apps",
+				resource:  "daemonsets",
+				namespace: app.namespace,
+				list: func(options metav1.ListOptions) error {
+					_, err := app.clientset.AppsV1().DaemonSets(app.namespace).List(options)
+					return err
+				},
+			},
+		)
+	}
+	return checks
+}
+
+// checkAccess performs every check, and returns a description of every
+// failure.
+func (app *application) checkAccess(checks []accessCheck) []string {
+	prefix := ""
+	if app.clusterName != "" {
+		prefix = fmt.Sprintf("cluster %s: ", app.clusterName)
+	}
+	var problems []string
+	reviewed := make(map[string]bool)
+	for _, check := range checks {
+		where := "all namespaces"
+		if check.namespace != "" {
+			where = fmt.Sprintf("namespace %s", check.namespace)
+		}
+		resource := check.resource
+		if check.subresource != "" {
+			resource += "/" + check.subresource
+		}
+		if check.group != "" {
+			resource += "." + check.group
+		}
+
+		if check.list == nil {
+			for _, verb := range check.verbs {
+				// Several handlers get the same resources.
+				key := strings.Join([]string{verb, resource, check.namespace}, " ")
+				if reviewed[key] {
+					continue
+				}
+				reviewed[key] = true
+				allowed, err := app.reviewAccess(check, verb)
+				if err != nil {
+					problems = append(problems, fmt.Sprintf("%serror checking access to %s in %s: %v", prefix, resource, where, err))
+				} else if !allowed {
+					problems = append(problems, fmt.Sprintf("%snot allowed to %s %s in %s: grant the %s verb for %s to the service account",
+						prefix, verb, resource, where, verb, resource))
+				}
+			}
+			continue
+		}
+
+		err := check.list(metav1.ListOptions{Limit: 1})
+		if err == nil {
+			continue
+		}
+		if apierrors.IsForbidden(err) {
+			problems = append(problems, fmt.Sprintf("%snot allowed to list %s in %s: grant the list and watch verbs for %s to the service account",
+				prefix, resource, where, resource))
+		} else {
+			problems = append(problems, fmt.Sprintf("%serror listing %s in %s: %v", prefix, resource, where, err))
+		}
+	}
+	return problems
+}
+
+// reviewAccess asks the API server if verb is allowed for the resource of
+// check.
+func (app *application) reviewAccess(check accessCheck, verb string) (bool, error) {
+	review, err := app.clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(&authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace:   check.namespace,
+				Verb:        verb,
+				Group:       check.group,
+				Resource:    check.resource,
+				Subresource: check.subresource,
+			},
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+	return review.Status.Allowed, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	lru "github.com/hashicorp/golang-lru"
+)
+
+func TestAccessChecks(t *testing.T) {
+	t.Parallel()
+
+	snooze, err := newSnoozeChecker(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels, err := lru.New(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &application{
+		namespace:    "shop",
+		jobLogLines:  50,
+		snooze:       snooze,
+		objectLabels: labels,
+		shards:       newShardManager(nil, 2, "k8s-sentry", "test"),
+	}
+	cfg := &config{dedupConfigMap: "k8s-sentry/reported", ownershipKey: "team"}
+	checks := append(app.accessChecks(), cfg.accessChecks(app, true)...)
+
+	found := make(map[string]bool)
+	for _, check := range checks {
+		verbs := check.verbs
+		if check.list != nil {
+			verbs = []string{"list"}
+		}
+		for _, verb := range verbs {
+			found[strings.Join([]string{verb, check.group, check.resource, check.subresource, check.namespace}, " ")] = true
+		}
+	}
+	for _, expected := range []string{
+		"get  pods log shop",
+		"get  configmaps  shop",
+		"get  secrets  shop",
+		"get  namespaces  ",
+		"get apps deployments  shop",
+		"update coordination.k8s.io leases  k8s-sentry",
+		"create coordination.k8s.io leases  k8s-sentry",
+		"update  configmaps  k8s-sentry",
+		"list apps daemonsets  shop",
+		"list  limitranges  shop",
+		"list  pods  ",
+		"get  nodes  ",
+		"get  resourcequotas  shop",
+		"get  persistentvolumes  ",
+		"get apps replicasets  shop",
+		"get networking.k8s.io ingresses  shop",
+		"get cert-manager.io clusterissuers  ",
+		"get acme.cert-manager.io challenges  shop",
+		"get autoscaling horizontalpodautoscalers  shop",
+	} {
+		if !found[expected] {
+			t.Errorf("Missing access check %q", expected)
+		}
+	}
+
+	if checks := cfg.accessChecks(app, false); len(checks) != 4 {
+		t.Errorf("Expected 4 checks for a secondary cluster, got %d", len(checks))
+	}
+}
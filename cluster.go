@@ -0,0 +1,222 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// execAPIVersions maps API versions of exec authentication plugins which the
+// Kubernetes client does not support to a compatible version it does.
+var execAPIVersions = map[string]string{
+	"client.authentication.k8s.io/v1": "client.authentication.k8s.io/v1beta1",
+}
+
+// cluster is a Kubernetes cluster that should be monitored.
+type cluster struct {
+	name       string
+	restConfig *rest.Config
+	clientset  *kubernetes.Clientset
+}
+
+// kubeOverrides override the context, server and credentials of a
+// kubeconfig.
+type kubeOverrides struct {
+	context   string
+	server    string
+	caFile    string
+	token     string
+	tokenFile string
+}
+
+func (o kubeOverrides) configOverrides() clientcmd.ConfigOverrides {
+	overrides := clientcmd.ConfigOverrides{CurrentContext: o.context}
+	overrides.ClusterInfo.Server = o.server
+	overrides.ClusterInfo.CertificateAuthority = o.caFile
+	overrides.AuthInfo.Token = o.token
+	overrides.AuthInfo.TokenFile = o.tokenFile
+	return overrides
+}
+
+// findClusters determines which clusters should be monitored. Every file in
+// configDir and every context in contexts is treated as a separate cluster.
+// If neither is given a single cluster is returned, using name as its name,
+// and the context, server and credentials of overrides.
+func findClusters(name, configFile, configDir string, contexts []string, overrides kubeOverrides) ([]cluster, error) {
+	var clusters []cluster
+
+	overridden := overrides != kubeOverrides{}
+	if overridden && (configDir != "" || len(contexts) > 0) {
+		return nil, fmt.Errorf("a context, server or token can not be set when monitoring multiple clusters")
+	}
+
+	if configDir != "" {
+		files, err := ioutil.ReadDir(configDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			// Skip hidden files, which includes the ..data links Kubernetes
+			// creates when mounting a Secret or ConfigMap.
+			if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+				continue
+			}
+			restConfig, err := createKubernetesConfigWithOverrides(filepath.Join(configDir, file.Name()), clientcmd.ConfigOverrides{})
+			if err != nil {
+				return nil, fmt.Errorf("error loading %s: %v", file.Name(), err)
+			}
+			clusters = append(clusters, cluster{
+				name:       strings.TrimSuffix(file.Name(), filepath.Ext(file.Name())),
+				restConfig: restConfig,
+			})
+		}
+	}
+
+	for _, context := range contexts {
+		restConfig, err := createKubernetesConfigWithOverrides(configFile, clientcmd.ConfigOverrides{CurrentContext: context})
+		if err != nil {
+			return nil, fmt.Errorf("error loading context %s: %v", context, err)
+		}
+		clusters = append(clusters, cluster{name: context, restConfig: restConfig})
+	}
+
+	if configDir != "" || len(contexts) > 0 {
+		if len(clusters) == 0 {
+			return nil, fmt.Errorf("no clusters found")
+		}
+		return clusters, nil
+	}
+
+	var restConfig *rest.Config
+	var err error
+	if overridden {
+		restConfig, err = createKubernetesConfigWithOverrides(configFile, overrides.configOverrides())
+	} else {
+		restConfig, err = createKubernetesConfig(configFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []cluster{{name: name, restConfig: restConfig}}, nil
+}
+
+// createKubernetesConfigWithOverrides loads a kubeconfig file, or the
+// default kubeconfig files if configFile is empty, and applies overrides.
+// When only overrides are given, for example a server and token, no
+// kubeconfig file is needed.
+func createKubernetesConfigWithOverrides(configFile string, overrides clientcmd.ConfigOverrides) (*rest.Config, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if configFile != "" {
+		rules.ExplicitPath = configFile
+	}
+	raw, err := rules.Load()
+	if err != nil {
+		return nil, err
+	}
+	prepareKubeconfig(raw, overrides)
+	return clientcmd.NewNonInteractiveClientConfig(*raw, overrides.CurrentContext, &overrides, rules).ClientConfig()
+}
+
+// prepareKubeconfig makes a kubeconfig usable by the Kubernetes client.
+// Credential plugins that use a newer API version are switched to an older
+// compatible version; plugins such as aws, gke-gcloud-auth-plugin and
+// kubelogin respond with the version they are asked for. Credentials and
+// certificate authorities that are overridden are removed, since they can
+// not be combined with the overrides.
+func prepareKubeconfig(raw *clientcmdapi.Config, overrides clientcmd.ConfigOverrides) {
+	for _, authInfo := range raw.AuthInfos {
+		if overrides.AuthInfo.Token != "" || overrides.AuthInfo.TokenFile != "" {
+			authInfo.Exec = nil
+			authInfo.AuthProvider = nil
+		}
+		if authInfo.Exec == nil {
+			continue
+		}
+		if version, ok := execAPIVersions[authInfo.Exec.APIVersion]; ok {
+			authInfo.Exec.APIVersion = version
+		}
+	}
+	if overrides.ClusterInfo.CertificateAuthority != "" {
+		for _, cluster := range raw.Clusters {
+			cluster.CertificateAuthorityData = nil
+		}
+	}
+}
+
+func parseList(value string) []string {
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// requestTimeout is a http.RoundTripper that limits the time of Kubernetes
+// API requests, except watches. rest.Config.Timeout can not be used for
+// this, since it also ends watches.
+type requestTimeout struct {
+	next    http.RoundTripper
+	timeout time.Duration
+}
+
+// newRequestTimeout returns a function to wrap the transport of a
+// Kubernetes client with a requestTimeout.
+func newRequestTimeout(timeout time.Duration) func(http.RoundTripper) http.RoundTripper {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return &requestTimeout{next: next, timeout: timeout}
+	}
+}
+
+func (t *requestTimeout) RoundTrip(req *http.Request) (*http.Response, error) {
+	if watch := req.URL.Query().Get("watch"); watch == "true" || watch == "1" {
+		return t.next.RoundTrip(req)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+	response, err := t.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// The timeout also applies to reading the response.
+	response.Body = &cancelBody{ReadCloser: response.Body, cancel: cancel}
+	return response, nil
+}
+
+// cancelBody cancels the context of a request when its response is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+current-context: dev
+clusters:
+- name: dev
+  cluster:
+    server: https://dev.example.com
+- name: eks
+  cluster:
+    server: https://eks.example.com
+contexts:
+- name: dev
+  context: {cluster: dev, user: dev}
+- name: eks
+  context: {cluster: eks, user: eks}
+users:
+- name: dev
+  user:
+    token: dev-token
+- name: eks
+  user:
+    exec:
+      apiVersion: client.authentication.k8s.io/v1
+      command: aws
+      args: [eks, get-token, --cluster-name, prod]
+`
+
+func TestRequestTimeout(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-req.Context().Done():
+		}
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: newRequestTimeout(10 * time.Millisecond)(http.DefaultTransport)}
+	if _, err := client.Get(server.URL + "/api/v1/pods"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Request did not time out: %v", err)
+	}
+	response, err := client.Get(server.URL + "/api/v1/pods?watch=true")
+	if err != nil {
+		t.Fatalf("Watch timed out: %v", err)
+	}
+	response.Body.Close()
+}
+
+func TestFindClustersOverrides(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "kubeconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config")
+	if err := ioutil.WriteFile(path, []byte(testKubeconfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	clusters, err := findClusters("prod", path, "", nil, kubeOverrides{context: "eks"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	restConfig := clusters[0].restConfig
+	if clusters[0].name != "prod" || restConfig.Host != "https://eks.example.com" {
+		t.Errorf("Unexpected cluster %s at %s", clusters[0].name, restConfig.Host)
+	}
+	if restConfig.ExecProvider == nil || restConfig.ExecProvider.APIVersion != "client.authentication.k8s.io/v1beta1" {
+		t.Errorf("Unexpected exec provider %+v", restConfig.ExecProvider)
+	}
+
+	clusters, err = findClusters("", path, "", nil, kubeOverrides{context: "eks", server: "https://127.0.0.1:6443", token: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	restConfig = clusters[0].restConfig
+	if restConfig.Host != "https://127.0.0.1:6443" || restConfig.BearerToken != "secret" || restConfig.ExecProvider != nil {
+		t.Errorf("Overrides not applied: %s %q %+v", restConfig.Host, restConfig.BearerToken, restConfig.ExecProvider)
+	}
+
+	if _, err := findClusters("", path, "", []string{"dev", "eks"}, kubeOverrides{token: "secret"}); err == nil {
+		t.Error("Overrides accepted for multiple clusters")
+	}
+}
@@ -0,0 +1,764 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	lru "github.com/hashicorp/golang-lru"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// config holds all configuration. Every setting can be set with a command
+// line flag, or with an environment variable.
+type config struct {
+	kubeconfig          string
+	kubeconfigDir       string
+	kubeContexts        string
+	kubeContext         string
+	kubeServer          string
+	kubeCAFile          string
+	kubeToken           string
+	kubeTokenFile       string
+	kubeQPS             float64
+	kubeBurst           int
+	kubeTimeout         time.Duration
+	clusterName         string
+	namespace           string
+	environment         string
+	release             string
+	tags                string
+	tagsFile            string
+	tagsFileKeys        string
+	fingerprint         string
+	timestampSource     string
+	logLevel            string
+	logFormat           string
+	pprofAddress        string
+	healthAddress       string
+	waitForSync         bool
+	watchThreshold      time.Duration
+	dsn                 string
+	dsnFile             string
+	selfDSN             string
+	selfInterval        time.Duration
+	goroutineLimit      int
+	sampleRate          float64
+	sentryDebug         bool
+	maxBreadcrumbs      int
+	serverName          string
+	attachStacktrace    bool
+	bufferSize          int
+	concurrency         int
+	tunnel              string
+	levelDSNs           string
+	shutdownTimeout     time.Duration
+	sampleRates         string
+	realertEvery        int
+	maxEventAge         time.Duration
+	realertThresholds   string
+	shards              int
+	shardLeaseNamespace string
+	archiveDir          string
+	archiveEvents       string
+	archiveMaxSize      int
+	archiveMaxFiles     int
+	archiveRotate       time.Duration
+	archiveS3Endpoint   string
+	archiveS3Bucket     string
+	archiveS3Prefix     string
+	archiveS3Region     string
+	auditAddress        string
+	auditTLSCert        string
+	auditTLSKey         string
+	auditIgnoreUsers    string
+	auditClientCA       string
+	auditToken          string
+	reportAPIWarnings   bool
+	certExpiryWarning   time.Duration
+	certExpiryError     time.Duration
+	endpointOutage      time.Duration
+	pdbThreshold        time.Duration
+	statefulSetStuck    time.Duration
+	daemonSetThreshold  time.Duration
+	criticalNamespaces  string
+	criticalRestarts    int
+	dnsInterval         time.Duration
+	trackNodes          bool
+	nodeCapacity        bool
+	nodeFlapThreshold   int
+	nodeFlapWindow      time.Duration
+	appLabelTags        bool
+	spotLevel           string
+	preemptionLevel     string
+	jobLogLines         int
+	maintenanceWindows  string
+	escalationRules     string
+	honorSnooze         bool
+	apiAddress          string
+	apiToken            string
+	recentEvents        int
+	dedupFile           string
+	dedupConfigMap      string
+	dedupTTL            time.Duration
+	ownershipKey        string
+	ownershipInterval   time.Duration
+	sentryAPIURL        string
+	sentryAPIToken      string
+	sentryOrg           string
+	sentryProject       string
+	digestInterval      time.Duration
+	digestReasons       string
+	digestOnly          bool
+	eventBudget         int
+	failedPods          bool
+	helmReleases        bool
+	podStartup          bool
+	rollouts            bool
+	sentryMetrics       bool
+	sentryLogs          bool
+	otlpEndpoint        string
+	otlpHeaders         string
+	scrubBuiltins       bool
+	scrubPatterns       string
+	rulesFile           string
+	extensions          string
+	extensionTimeout    time.Duration
+}
+
+// bindFlags registers a flag for every setting with fs. The default value
+// for each flag is taken from its environment variable.
+func (c *config) bindFlags(fs *flag.FlagSet) {
+	stringVar(fs, &c.kubeconfig, "kubeconfig", "", "", "Kubernetes configuration file")
+	stringVar(fs, &c.kubeconfigDir, "kubeconfig-dir", "KUBECONFIG_DIR", "", "Directory with a kubeconfig file for every cluster to monitor")
+	stringVar(fs, &c.kubeContexts, "kube-contexts", "KUBE_CONTEXTS", "", "Comma-separated list of kubeconfig contexts to monitor")
+	stringVar(fs, &c.kubeContext, "context", "KUBE_CONTEXT", "", "Kubeconfig context to use instead of the current context")
+	stringVar(fs, &c.kubeServer, "server", "KUBE_SERVER", "", "URL of the Kubernetes API server, overriding the kubeconfig")
+	stringVar(fs, &c.kubeCAFile, "certificate-authority", "KUBE_CA_FILE", "", "Certificate authority file for the Kubernetes API server, overriding the kubeconfig")
+	stringVar(fs, &c.kubeToken, "token", "KUBE_TOKEN", "", "Bearer token for the Kubernetes API server, overriding the kubeconfig")
+	stringVar(fs, &c.kubeTokenFile, "token-file", "KUBE_TOKEN_FILE", "", "File with a bearer token for the Kubernetes API server, overriding the kubeconfig")
+	float64Var(fs, &c.kubeQPS, "kube-api-qps", "KUBE_API_QPS", 5, "Maximum number of Kubernetes API requests per second")
+	intVar(fs, &c.kubeBurst, "kube-api-burst", "KUBE_API_BURST", 10, "Maximum burst of Kubernetes API requests above the QPS")
+	durationVar(fs, &c.kubeTimeout, "kube-api-timeout", "KUBE_API_TIMEOUT", 0, "Timeout for Kubernetes API requests other than watches (disabled if 0)")
+	stringVar(fs, &c.clusterName, "cluster-name", "CLUSTER_NAME", "", "Name of the cluster")
+	stringVar(fs, &c.namespace, "namespace", "NAMESPACE", "", "Only monitor this namespace")
+	stringVar(fs, &c.environment, "environment", "ENVIRONMENT", "", "Environment for Sentry issues (defaults to the namespace)")
+	stringVar(fs, &c.release, "release", "RELEASE", "", "Release reported to Sentry")
+	stringVar(fs, &c.tags, "tags", "TAGS", "", "Comma-separated list of key=value tags to add to all Sentry issues")
+	stringVar(fs, &c.tagsFile, "tags-file", "TAGS_FILE", "", "Downward API file with labels or annotations to add as tags to all Sentry issues")
+	stringVar(fs, &c.tagsFileKeys, "tags-file-keys", "TAGS_FILE_KEYS", "", "Comma-separated list of keys from the tags file to use (defaults to all)")
+	stringVar(fs, &c.fingerprint, "fingerprint-strategy", "FINGERPRINT_STRATEGY", fingerprintObject, "How events are grouped into issues: object, workload or reason")
+	stringVar(fs, &c.timestampSource, "timestamp-source", "TIMESTAMP_SOURCE", timestampCreation, "Event time reported to Sentry: creationTimestamp, lastTimestamp, eventTime or series")
+	stringVar(fs, &c.logLevel, "log-level", "LOG_LEVEL", "info", "Minimum log level (debug, info, warning or error)")
+	stringVar(fs, &c.logFormat, "log-format", "LOG_FORMAT", "text", "Log format (text or json)")
+	stringVar(fs, &c.pprofAddress, "pprof-address", "PPROF_ADDRESS", "", "Address to serve pprof handlers on (disabled if empty)")
+	stringVar(fs, &c.healthAddress, "health-address", "HEALTH_ADDRESS", "", "Address to serve the /healthz and /readyz health checks on (disabled if empty)")
+	boolVar(fs, &c.waitForSync, "wait-for-sync", "WAIT_FOR_SYNC", false, "Only process events once all other informers have synced")
+	durationVar(fs, &c.watchThreshold, "watch-failure-threshold", "WATCH_FAILURE_THRESHOLD", 5*time.Minute, "Report watches that keep failing for this duration")
+	stringVar(fs, &c.dsn, "sentry-dsn", "SENTRY_DSN", "", "DSN for the Sentry project")
+	stringVar(fs, &c.dsnFile, "sentry-dsn-file", "SENTRY_DSN_FILE", "", "File to read the Sentry DSN from")
+	stringVar(fs, &c.selfDSN, "self-dsn", "SELF_DSN", "", "DSN for the Sentry project to report problems in k8s-sentry itself to (defaults to SENTRY_DSN)")
+	durationVar(fs, &c.selfInterval, "self-monitor-interval", "SELF_MONITOR_INTERVAL", time.Minute, "Interval at which k8s-sentry checks itself for anomalies (disabled if 0)")
+	intVar(fs, &c.goroutineLimit, "self-goroutine-limit", "SELF_GOROUTINE_LIMIT", 1000, "Number of goroutines above which a possible goroutine leak is reported (disabled if 0)")
+	float64Var(fs, &c.sampleRate, "sentry-sample-rate", "SENTRY_SAMPLE_RATE", 1.0, "Sample rate for Sentry events (0.0, 1.0]")
+	boolVar(fs, &c.sentryDebug, "sentry-debug", "SENTRY_DEBUG", false, "Print Sentry SDK debug information")
+	intVar(fs, &c.maxBreadcrumbs, "sentry-max-breadcrumbs", "SENTRY_MAX_BREADCRUMBS", 30, "Maximum number of breadcrumbs per Sentry event")
+	stringVar(fs, &c.serverName, "sentry-server-name", "SENTRY_SERVER_NAME", "", "Server name reported to Sentry (defaults to the hostname)")
+	boolVar(fs, &c.attachStacktrace, "sentry-attach-stacktrace", "SENTRY_ATTACH_STACKTRACE", false, "Attach stacktraces to Sentry messages")
+	durationVar(fs, &c.shutdownTimeout, "shutdown-timeout", "SHUTDOWN_TIMEOUT", 10*time.Second, "Maximum time to finish processing and send queued events when stopping")
+	intVar(fs, &c.bufferSize, "sentry-buffer-size", "SENTRY_BUFFER_SIZE", 30, "Number of Sentry events to queue before dropping the least severe events")
+	intVar(fs, &c.concurrency, "sentry-concurrency", "SENTRY_CONCURRENCY", 2, "Maximum number of concurrent requests to Sentry")
+	stringVar(fs, &c.tunnel, "sentry-tunnel", "SENTRY_TUNNEL", "", "URL of a tunnel to send events to instead of the Sentry server of the DSN")
+	stringVar(fs, &c.levelDSNs, "sentry-level-dsns", "SENTRY_LEVEL_DSNS", "", "Comma-separated list of level=DSN pairs to send events of a level to another Sentry project")
+	durationVar(fs, &c.maxEventAge, "max-event-age", "MAX_EVENT_AGE", 0, "Skip events that were last seen longer ago than this (disabled if 0)")
+	intVar(fs, &c.realertEvery, "realert-every", "REALERT_EVERY", 0, "Report repeated events again every this many occurrences (disabled if 0)")
+	stringVar(fs, &c.realertThresholds, "realert-thresholds", "REALERT_THRESHOLDS", "", "Comma-separated list of occurrence counts at which repeated events are reported again")
+	stringVar(fs, &c.sampleRates, "sample-rates", "SAMPLE_RATES", "", "Comma-separated list of level=rate or reason=rate sample rates")
+	intVar(fs, &c.shards, "shards", "SHARDS", 1, "Number of replicas to split namespaces over")
+	stringVar(fs, &c.shardLeaseNamespace, "shard-lease-namespace", "SHARD_LEASE_NAMESPACE", "default", "Namespace for the shard Leases")
+	stringVar(fs, &c.archiveDir, "archive-dir", "ARCHIVE_DIR", "", "Directory to archive events in")
+	stringVar(fs, &c.archiveEvents, "archive-events", "ARCHIVE_EVENTS", archiveProcessed, "Events to archive: processed or received")
+	intVar(fs, &c.archiveMaxSize, "archive-max-size", "ARCHIVE_MAX_SIZE", 100, "Maximum size of an archive file in megabytes")
+	intVar(fs, &c.archiveMaxFiles, "archive-max-files", "ARCHIVE_MAX_FILES", 10, "Maximum number of rotated archive files to keep")
+	durationVar(fs, &c.archiveRotate, "archive-rotate-interval", "ARCHIVE_ROTATE_INTERVAL", time.Hour, "Maximum age of an archive file before it is rotated")
+	stringVar(fs, &c.archiveS3Endpoint, "archive-s3-endpoint", "ARCHIVE_S3_ENDPOINT", "", "Endpoint of the S3-compatible storage (defaults to AWS)")
+	stringVar(fs, &c.archiveS3Bucket, "archive-s3-bucket", "ARCHIVE_S3_BUCKET", "", "Bucket to upload rotated archive files to")
+	stringVar(fs, &c.archiveS3Prefix, "archive-s3-prefix", "ARCHIVE_S3_PREFIX", "", "Prefix for uploaded archive files")
+	stringVar(fs, &c.archiveS3Region, "archive-s3-region", "ARCHIVE_S3_REGION", "us-east-1", "Region of the S3 bucket")
+	stringVar(fs, &c.auditAddress, "audit-address", "AUDIT_ADDRESS", "", "Address to receive Kubernetes audit webhooks on (disabled if empty)")
+	stringVar(fs, &c.auditTLSCert, "audit-tls-cert", "AUDIT_TLS_CERT", "", "TLS certificate file for the audit webhook receiver")
+	stringVar(fs, &c.auditTLSKey, "audit-tls-key", "AUDIT_TLS_KEY", "", "TLS key file for the audit webhook receiver")
+	stringVar(fs, &c.auditClientCA, "audit-client-ca", "AUDIT_CLIENT_CA", "", "CA file to verify client certificates of audit webhook requests with")
+	stringVar(fs, &c.auditToken, "audit-token", "AUDIT_TOKEN", "", "Bearer token audit webhook requests must use")
+	boolVar(fs, &c.reportAPIWarnings, "report-api-warnings", "REPORT_API_WARNINGS", false, "Report warnings returned by the Kubernetes API, such as deprecated API usage")
+	stringVar(fs, &c.auditIgnoreUsers, "audit-ignore-users", "AUDIT_IGNORE_USERS", "", "Comma-separated list of users whose audit events are ignored")
+	durationVar(fs, &c.certExpiryWarning, "cert-expiry-warning", "CERT_EXPIRY_WARNING", 0, "Report TLS certificates that expire within this duration (disabled if 0)")
+	durationVar(fs, &c.certExpiryError, "cert-expiry-error", "CERT_EXPIRY_ERROR", 7*24*time.Hour, "Report TLS certificates that expire within this duration as errors")
+	durationVar(fs, &c.endpointOutage, "endpoint-outage-threshold", "ENDPOINT_OUTAGE_THRESHOLD", 0, "Report Services without ready endpoints for this duration (disabled if 0)")
+	durationVar(fs, &c.pdbThreshold, "pdb-threshold", "PDB_THRESHOLD", 0, "Report PodDisruptionBudgets that are violated or block a drain for this duration (disabled if 0)")
+	durationVar(fs, &c.statefulSetStuck, "statefulset-threshold", "STATEFULSET_THRESHOLD", 0, "Report StatefulSet rollouts that make no progress for this duration (disabled if 0)")
+	durationVar(fs, &c.daemonSetThreshold, "daemonset-threshold", "DAEMONSET_THRESHOLD", 0, "Report DaemonSets with fewer ready pods than desired for this duration (disabled if 0)")
+	stringVar(fs, &c.criticalNamespaces, "critical-namespaces", "CRITICAL_NAMESPACES", "", "Comma-separated list of namespaces in which every container restart is reported")
+	intVar(fs, &c.criticalRestarts, "critical-restart-threshold", "CRITICAL_RESTART_THRESHOLD", 3, "Number of restarts within an hour after which restarts in critical namespaces are reported as errors")
+	durationVar(fs, &c.dnsInterval, "dns-aggregation-interval", "DNS_AGGREGATION_INTERVAL", 0, "Combine cluster DNS failures into one issue, reported at most once per this duration (disabled if 0)")
+	boolVar(fs, &c.trackNodes, "track-node-maintenance", "TRACK_NODE_MAINTENANCE", false, "Add node cordon and drain activity to events for pods on the node")
+	boolVar(fs, &c.nodeCapacity, "node-capacity", "NODE_CAPACITY", false, "Add the allocatable and requested resources per node pool to scheduling failures")
+	intVar(fs, &c.nodeFlapThreshold, "node-flap-threshold", "NODE_FLAP_THRESHOLD", 0, "Number of ready transitions within the flap window after which a node is reported as flapping (disabled if 0)")
+	boolVar(fs, &c.appLabelTags, "app-label-tags", "APP_LABEL_TAGS", false, "Look up the app.kubernetes.io labels of objects other than pods to add as tags")
+	durationVar(fs, &c.nodeFlapWindow, "node-flap-window", "NODE_FLAP_WINDOW", 10*time.Minute, "Window in which node ready transitions are counted")
+	stringVar(fs, &c.spotLevel, "spot-interruption-level", "SPOT_INTERRUPTION_LEVEL", "", "Report events for pods on reclaimed spot nodes at this level (unchanged if empty)")
+	stringVar(fs, &c.preemptionLevel, "preemption-level", "PREEMPTION_LEVEL", "", "Report preempted pods at this level: info or warning (disabled if empty)")
+	intVar(fs, &c.jobLogLines, "job-log-lines", "JOB_LOG_LINES", 50, "Number of log lines of the last failed pod to add to failed Job events (disabled if 0)")
+	stringVar(fs, &c.maintenanceWindows, "maintenance-windows", "MAINTENANCE_WINDOWS", "", "Semicolon-separated list of maintenance windows during which events are suppressed or downgraded")
+	stringVar(fs, &c.escalationRules, "escalation-rules", "ESCALATION_RULES", "", "Semicolon-separated list of rules that raise the level of recurring events")
+	boolVar(fs, &c.honorSnooze, "honor-snooze", "HONOR_SNOOZE", false, "Mute events for namespaces and workloads with a k8s-sentry.io/snooze-until annotation")
+	stringVar(fs, &c.apiAddress, "api-address", "API_ADDRESS", "", "Address to serve the runtime API on (disabled if empty)")
+	stringVar(fs, &c.apiToken, "api-token", "API_TOKEN", "", "Bearer token required for the runtime API")
+	intVar(fs, &c.recentEvents, "recent-events", "RECENT_EVENTS", 200, "Number of recently processed events to keep for the runtime API")
+	stringVar(fs, &c.dedupFile, "dedup-file", "DEDUP_FILE", "", "File to remember reported events in across restarts")
+	stringVar(fs, &c.dedupConfigMap, "dedup-configmap", "DEDUP_CONFIGMAP", "", "ConfigMap (<namespace>/<name>) to remember reported events in across restarts")
+	durationVar(fs, &c.dedupTTL, "dedup-ttl", "DEDUP_TTL", 2*time.Hour, "How long reported events are remembered")
+	stringVar(fs, &c.ownershipKey, "ownership-key", "OWNERSHIP_KEY", "", "Label or annotation of namespaces and workloads with their owners, to synchronize to Sentry ownership rules (disabled if empty)")
+	durationVar(fs, &c.ownershipInterval, "ownership-interval", "OWNERSHIP_INTERVAL", 10*time.Minute, "Interval at which Sentry ownership rules are synchronized")
+	stringVar(fs, &c.sentryAPIURL, "sentry-api-url", "SENTRY_API_URL", "", "URL of the Sentry API (defaults to the Sentry server of the DSN)")
+	stringVar(fs, &c.sentryAPIToken, "sentry-api-token", "SENTRY_API_TOKEN", "", "Sentry auth token with project:write scope")
+	stringVar(fs, &c.sentryOrg, "sentry-org", "SENTRY_ORG", "", "Slug of the Sentry organization")
+	stringVar(fs, &c.sentryProject, "sentry-project", "SENTRY_PROJECT", "", "Slug of the Sentry project")
+	durationVar(fs, &c.digestInterval, "digest-interval", "DIGEST_INTERVAL", 0, "Send a digest of warnings per namespace at this interval (disabled if 0)")
+	stringVar(fs, &c.digestReasons, "digest-reasons", "DIGEST_REASONS", "", "Comma-separated list of event reasons to include in the digest (defaults to all warnings)")
+	boolVar(fs, &c.digestOnly, "digest-only", "DIGEST_ONLY", false, "Only report digest warnings in the digest, not individually")
+	intVar(fs, &c.eventBudget, "event-budget", "EVENT_BUDGET", 0, "Maximum number of events per namespace per minute (disabled if 0)")
+	boolVar(fs, &c.failedPods, "report-failed-pods", "REPORT_FAILED_PODS", false, "Report pods that enter the Failed phase, also without a warning event")
+	boolVar(fs, &c.helmReleases, "report-helm-releases", "REPORT_HELM_RELEASES", false, "Report Helm releases that fail or are rolled back")
+	boolVar(fs, &c.podStartup, "pod-startup-transactions", "POD_STARTUP_TRANSACTIONS", false, "Send a Sentry performance transaction for every pod startup")
+	boolVar(fs, &c.rollouts, "rollout-transactions", "ROLLOUT_TRANSACTIONS", false, "Send a Sentry performance transaction for every Deployment rollout")
+	boolVar(fs, &c.sentryLogs, "sentry-logs", "SENTRY_LOGS", false, "Send normal events to Sentry Logs instead of dropping them")
+	boolVar(fs, &c.sentryMetrics, "sentry-metrics", "SENTRY_METRICS", false, "Send Sentry metrics with the number of events per namespace and reason")
+	stringVar(fs, &c.otlpEndpoint, "otlp-endpoint", "OTLP_ENDPOINT", "", "URL of an OpenTelemetry collector to also export events to (disabled if empty)")
+	stringVar(fs, &c.otlpHeaders, "otlp-headers", "OTLP_HEADERS", "", "Comma-separated list of key=value headers to send to the OpenTelemetry collector")
+	boolVar(fs, &c.scrubBuiltins, "scrub-builtins", "SCRUB_BUILTINS", true, "Remove credentials, tokens and email addresses from events")
+	stringVar(fs, &c.scrubPatterns, "scrub-patterns", "SCRUB_PATTERNS", "", "Semicolon-separated list of regular expressions to remove from events")
+	stringVar(fs, &c.rulesFile, "rules-file", "RULES_FILE", "", "JSON file with rules that drop or modify events")
+	stringVar(fs, &c.extensions, "extensions", "EXTENSIONS", "", "Comma-separated list of commands or URLs that can enrich or drop events")
+	durationVar(fs, &c.extensionTimeout, "extension-timeout", "EXTENSION_TIMEOUT", 5*time.Second, "Maximum time an extension may take to process an event")
+}
+
+// sentryOptions returns the Sentry client options. This reads the DSN file
+// if one is configured.
+func (c *config) sentryOptions() (sentry.ClientOptions, error) {
+	// The Sentry client treats a sample rate of 0 as 1.
+	if c.sampleRate <= 0 || c.sampleRate > 1 {
+		return sentry.ClientOptions{}, fmt.Errorf("sample rate must be in (0.0, 1.0]")
+	}
+	if c.bufferSize < 1 {
+		return sentry.ClientOptions{}, fmt.Errorf("buffer size must be at least 1")
+	}
+	if c.concurrency < 1 {
+		return sentry.ClientOptions{}, fmt.Errorf("concurrency must be at least 1")
+	}
+
+	dsn := c.dsn
+	if c.dsnFile != "" {
+		var err error
+		if dsn, err = readDSNFile(c.dsnFile); err != nil {
+			return sentry.ClientOptions{}, fmt.Errorf("error reading DSN file: %v", err)
+		}
+	}
+
+	levelDSNs, err := parseLevelDSNs(c.levelDSNs)
+	if err != nil {
+		return sentry.ClientOptions{}, err
+	}
+	transport := newQueuedTransport("sentry", c.bufferSize, c.concurrency)
+	transport.tunnel = c.tunnel
+	transport.levelDSNs = levelDSNs
+
+	scrubber, err := newScrubber(c.scrubBuiltins, parseScrubPatterns(c.scrubPatterns))
+	if err != nil {
+		return sentry.ClientOptions{}, err
+	}
+
+	return sentry.ClientOptions{
+		Dsn:              dsn,
+		Environment:      c.environment,
+		Release:          c.release,
+		SampleRate:       c.sampleRate,
+		Debug:            c.sentryDebug,
+		MaxBreadcrumbs:   c.maxBreadcrumbs,
+		ServerName:       c.serverName,
+		AttachStacktrace: c.attachStacktrace,
+		Transport:        transport,
+		BeforeSend: func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+			scrubber.Scrub(event)
+			event = addVersionInfo(event, hint)
+			sanitizeEvent(event)
+			return event
+		},
+	}, nil
+}
+
+// applications creates an application for every cluster that should be
+// monitored.
+func (c *config) applications() ([]*application, error) {
+	clusters, err := findClusters(c.clusterName, c.kubeconfig, c.kubeconfigDir, parseList(c.kubeContexts), kubeOverrides{
+		context:   c.kubeContext,
+		server:    c.kubeServer,
+		caFile:    c.kubeCAFile,
+		token:     c.kubeToken,
+		tokenFile: c.kubeTokenFile,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating kubernetes client: %v", err)
+	}
+
+	var apps []*application
+	for _, cluster := range clusters {
+		var warnings *warningReporter
+		if c.reportAPIWarnings {
+			warnings = newWarningReporter(cluster.name)
+		}
+		if cluster.clientset, err = c.newClientset(cluster, warnings); err != nil {
+			return nil, fmt.Errorf("error creating kubernetes client: %v", err)
+		}
+		app, err := c.newApplication(cluster)
+		if err != nil {
+			return nil, err
+		}
+		if warnings != nil {
+			warnings.app = app
+		}
+		apps = append(apps, app)
+	}
+	return apps, nil
+}
+
+// newClientset creates the Kubernetes client for a cluster. Warnings of the
+// API server are reported by warnings, if it is not nil.
+func (c *config) newClientset(cluster cluster, warnings *warningReporter) (*kubernetes.Clientset, error) {
+	if c.kubeQPS <= 0 || c.kubeBurst < 1 {
+		return nil, fmt.Errorf("Kubernetes API QPS must be positive and burst at least 1")
+	}
+	restConfig := rest.CopyConfig(cluster.restConfig)
+	restConfig.QPS = float32(c.kubeQPS)
+	restConfig.Burst = c.kubeBurst
+	if c.kubeTimeout > 0 {
+		restConfig.Wrap(newRequestTimeout(c.kubeTimeout))
+	}
+	if warnings != nil {
+		restConfig.Wrap(warnings.Wrap)
+	}
+	return kubernetes.NewForConfig(restConfig)
+}
+
+// newApplication creates an application for a single cluster.
+func (c *config) newApplication(cluster cluster) (*application, error) {
+	settings, err := c.eventSettings()
+	if err != nil {
+		return nil, err
+	}
+
+	app := &application{
+		clientset:         cluster.clientset,
+		clusterName:       cluster.name,
+		namespace:         c.namespace,
+		certExpiryWarning: c.certExpiryWarning,
+		certExpiryError:   c.certExpiryError,
+		jobLogLines:       c.jobLogLines,
+		waitForSync:       c.waitForSync,
+		failedPods:        c.failedPods && cluster.clientset != nil,
+		helmReleases:      c.helmReleases && cluster.clientset != nil,
+		settingsLock:      &sync.RWMutex{},
+	}
+	app.applySettings(settings)
+	if c.endpointOutage > 0 {
+		app.endpoints = newEndpointTracker(c.endpointOutage)
+	}
+	if c.dnsInterval > 0 {
+		app.dns = newDNSAggregator(c.dnsInterval)
+	}
+	if cluster.clientset != nil {
+		app.pendingPods = newPendingPodCache(cluster.clientset, c.namespace)
+	}
+	if c.realertEvery < 0 {
+		return nil, fmt.Errorf("invalid re-alert interval: %d", c.realertEvery)
+	}
+	thresholds, err := parseRealertThresholds(c.realertThresholds)
+	if err != nil {
+		return nil, err
+	}
+	if c.realertEvery > 0 || len(thresholds) > 0 {
+		app.realert = &realertPolicy{every: int32(c.realertEvery), thresholds: thresholds}
+	}
+	if c.honorSnooze && cluster.clientset != nil {
+		if app.snooze, err = newSnoozeChecker(cluster.clientset); err != nil {
+			return nil, err
+		}
+	}
+	if c.appLabelTags && cluster.clientset != nil {
+		if app.objectLabels, err = lru.New(1000); err != nil {
+			return nil, err
+		}
+	}
+	if c.nodeFlapThreshold > 0 {
+		app.flaps = newFlapDetector(c.nodeFlapThreshold, c.nodeFlapWindow)
+	}
+	if c.eventBudget > 0 {
+		app.budget = newEventBudget(c.eventBudget)
+	}
+	if c.digestInterval > 0 {
+		app.digest = newDigest(c.digestInterval, parseList(c.digestReasons), c.digestOnly)
+	}
+	if (c.podStartup || c.rollouts) && cluster.clientset != nil {
+		app.transactions = newTransactionSender(c.bufferSize, c.tunnel)
+	}
+	if c.sentryMetrics {
+		app.metrics = newSentryMetrics(c.tunnel)
+	}
+	if c.sentryLogs {
+		scrubber, err := newScrubber(c.scrubBuiltins, parseScrubPatterns(c.scrubPatterns))
+		if err != nil {
+			return nil, err
+		}
+		app.logs = newSentryLogExporter(c.bufferSize*10, c.tunnel, scrubber)
+	}
+	if c.podStartup && cluster.clientset != nil {
+		if app.podStartup, err = newPodStartupTracker(); err != nil {
+			return nil, err
+		}
+	}
+	if c.rollouts && cluster.clientset != nil {
+		app.rollouts = newRolloutTracker()
+	}
+	if c.trackNodes {
+		app.nodes = newNodeTracker()
+		switch sentry.Level(c.spotLevel) {
+		case "", sentry.LevelDebug, sentry.LevelInfo, sentry.LevelWarning:
+			app.nodes.interruptionLevel = sentry.Level(c.spotLevel)
+		default:
+			return nil, fmt.Errorf("invalid spot interruption level '%s', expected debug, info or warning", c.spotLevel)
+		}
+	}
+	if c.nodeCapacity && cluster.clientset != nil {
+		app.capacity = newCapacityTracker()
+	}
+	if c.pdbThreshold > 0 {
+		app.pdbs = newPDBMonitor(c.pdbThreshold)
+	}
+	if c.statefulSetStuck > 0 {
+		app.statefulSets = newStatefulSetMonitor(c.statefulSetStuck)
+	}
+	if c.daemonSetThreshold > 0 {
+		app.daemonSets = newDaemonSetMonitor(c.daemonSetThreshold)
+	}
+	if namespaces := parseList(c.criticalNamespaces); len(namespaces) > 0 {
+		if c.criticalRestarts < 1 {
+			return nil, fmt.Errorf("critical restart threshold must be at least 1")
+		}
+		app.critical = newCriticalRestartTracker(namespaces, c.criticalRestarts)
+	}
+
+	if c.shards < 1 {
+		return nil, fmt.Errorf("invalid number of shards: %d", c.shards)
+	}
+	if c.shards > 1 && cluster.clientset != nil {
+		identity, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("error determining hostname: %v", err)
+		}
+		app.shards = newShardManager(cluster.clientset, c.shards, c.shardLeaseNamespace, identity)
+	}
+	return app, nil
+}
+
+// eventArchive creates the event archive, or returns nil if archiving is not
+// enabled.
+func (c *config) eventArchive() (*eventArchive, error) {
+	if c.archiveDir == "" && c.archiveS3Bucket == "" {
+		return nil, nil
+	}
+	if c.archiveMaxSize < 1 || c.archiveMaxFiles < 1 {
+		return nil, fmt.Errorf("archive size and number of files must be at least 1")
+	}
+
+	var uploader *s3Uploader
+	if c.archiveS3Bucket != "" {
+		var err error
+		if uploader, err = newS3Uploader(c.archiveS3Endpoint, c.archiveS3Bucket, c.archiveS3Prefix, c.archiveS3Region); err != nil {
+			return nil, err
+		}
+	}
+	return newEventArchive(c.archiveDir, c.archiveEvents, int64(c.archiveMaxSize)*1024*1024, c.archiveMaxFiles, c.archiveRotate, uploader)
+}
+
+// dedupStore creates the store of reported events, or returns nil if
+// reported events are not remembered. A ConfigMap is stored in the first
+// cluster.
+func (c *config) dedupStore(apps []*application) (*dedupStore, error) {
+	var backend dedupBackend
+	switch {
+	case c.dedupFile != "" && c.dedupConfigMap != "":
+		return nil, fmt.Errorf("DEDUP_FILE and DEDUP_CONFIGMAP can not be used together")
+	case c.dedupFile != "":
+		backend = dedupFile(c.dedupFile)
+	case c.dedupConfigMap != "":
+		if len(apps) == 0 || apps[0].clientset == nil {
+			return nil, fmt.Errorf("DEDUP_CONFIGMAP requires a Kubernetes cluster")
+		}
+		configMap, err := newDedupConfigMap(apps[0].clientset, c.dedupConfigMap)
+		if err != nil {
+			return nil, err
+		}
+		backend = configMap
+	default:
+		return nil, nil
+	}
+	if c.dedupTTL <= 0 {
+		return nil, fmt.Errorf("invalid DEDUP_TTL: %v", c.dedupTTL)
+	}
+	return newDedupStore(backend, c.dedupTTL)
+}
+
+// otlpExporter creates the OTLP exporter, or returns nil if exporting is not
+// enabled.
+func (c *config) otlpExporter() (*otlpExporter, error) {
+	if c.otlpEndpoint == "" {
+		return nil, nil
+	}
+	headers := make(map[string]string)
+	if c.otlpHeaders != "" {
+		var err error
+		if headers, err = parseTags(c.otlpHeaders); err != nil {
+			return nil, fmt.Errorf("error parsing OTLP headers: %v", err)
+		}
+	}
+	scrubber, err := newScrubber(c.scrubBuiltins, parseScrubPatterns(c.scrubPatterns))
+	if err != nil {
+		return nil, err
+	}
+	return newOTLPExporter(c.otlpEndpoint, headers, scrubber), nil
+}
+
+// ownershipSyncer returns the syncer for Sentry ownership rules, or nil if
+// it is not enabled.
+func (c *config) ownershipSyncer(dsn string) (*ownershipSyncer, error) {
+	if c.ownershipKey == "" {
+		return nil, nil
+	}
+	if c.sentryAPIToken == "" || c.sentryOrg == "" || c.sentryProject == "" {
+		return nil, fmt.Errorf("SENTRY_API_TOKEN, SENTRY_ORG and SENTRY_PROJECT must be set to synchronize ownership rules")
+	}
+	apiURL := c.sentryAPIURL
+	if apiURL == "" {
+		u, err := url.Parse(dsn)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("SENTRY_API_URL must be set to synchronize ownership rules without a DSN")
+		}
+		apiURL = u.Scheme + "://" + u.Host + "/api/0"
+	}
+	return newOwnershipSyncer(apiURL, c.sentryOrg, c.sentryProject, c.sentryAPIToken, c.ownershipKey), nil
+}
+
+// filters returns a description of the filters that are fixed at startup
+// for the runtime API. Filters that can be reloaded are described by
+// settingsFilters.
+func (c *config) filters() map[string]interface{} {
+	return map[string]interface{}{
+		"namespace":    c.namespace,
+		"honor-snooze": c.honorSnooze,
+		"shards":       c.shards,
+	}
+}
+
+// settingsFilters returns a description of the filters that can be changed
+// by reloading the configuration.
+func (c *config) settingsFilters() map[string]interface{} {
+	return map[string]interface{}{
+		"sample-rates":        c.sampleRates,
+		"maintenance-windows": c.maintenanceWindows,
+		"escalation-rules":    c.escalationRules,
+		"rules-file":          c.rulesFile,
+		"extensions":          c.extensions,
+	}
+}
+
+// defaultTags returns the tags that should be added to all Sentry issues.
+// Tags from TAGS override those from TAGS_FILE.
+func (c *config) defaultTags() (map[string]string, error) {
+	tags := make(map[string]string)
+	if c.tagsFile != "" {
+		data, err := ioutil.ReadFile(c.tagsFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading tags file: %v", err)
+		}
+		if tags, err = parseDownwardAPIFile(string(data), parseList(c.tagsFileKeys)); err != nil {
+			return nil, fmt.Errorf("error parsing tags file: %v", err)
+		}
+	}
+	if c.tags == "" {
+		return tags, nil
+	}
+	envTags, err := parseTags(c.tags)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing default tags: %v", err)
+	}
+	for key, value := range envTags {
+		tags[key] = value
+	}
+	return tags, nil
+}
+
+// parseDownwardAPIFile parses a file with labels or annotations mounted with
+// the Downward API, which has a key="value" line per label. If keys is not
+// empty only those keys are returned.
+func parseDownwardAPIFile(data string, keys []string) (map[string]string, error) {
+	result := make(map[string]string)
+	for i, line := range strings.Split(data, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("line %d: expected key=\"value\"", i+1)
+		}
+		value, err := strconv.Unquote(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid value: %v", i+1, err)
+		}
+		result[parts[0]] = value
+	}
+	if len(keys) == 0 {
+		return result, nil
+	}
+	selected := make(map[string]string)
+	for _, key := range keys {
+		if value, ok := result[key]; ok {
+			selected[key] = value
+		}
+	}
+	return selected, nil
+}
+
+func stringVar(fs *flag.FlagSet, p *string, name, env, value, usage string) {
+	fs.StringVar(p, name, envOrDefault(env, value), usage+envUsage(env))
+}
+
+func boolVar(fs *flag.FlagSet, p *bool, name, env string, value bool, usage string) {
+	fs.BoolVar(p, name, envBool(env, value), usage+envUsage(env))
+}
+
+func intVar(fs *flag.FlagSet, p *int, name, env string, value int, usage string) {
+	fs.IntVar(p, name, envInt(env, value), usage+envUsage(env))
+}
+
+func float64Var(fs *flag.FlagSet, p *float64, name, env string, value float64, usage string) {
+	fs.Float64Var(p, name, envFloat(env, value), usage+envUsage(env))
+}
+
+func durationVar(fs *flag.FlagSet, p *time.Duration, name, env string, value time.Duration, usage string) {
+	fs.DurationVar(p, name, envDuration(env, value), usage+envUsage(env))
+}
+
+func envUsage(env string) string {
+	if env == "" {
+		return ""
+	}
+	return fmt.Sprintf(" [$%s]", env)
+}
+
+func envOrDefault(key, defaultValue string) string {
+	if value := configFileValues[key]; key != "" && value != "" {
+		return value
+	}
+	if value := os.Getenv(key); key != "" && value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func envBool(key string, defaultValue bool) bool {
+	value := envOrDefault(key, "")
+	if value == "" {
+		return defaultValue
+	}
+	result, err := strconv.ParseBool(value)
+	if err != nil {
+		logger.Fatal("Invalid boolean environment variable", "variable", key, "value", value)
+	}
+	return result
+}
+
+func envInt(key string, defaultValue int) int {
+	value := envOrDefault(key, "")
+	if value == "" {
+		return defaultValue
+	}
+	result, err := strconv.Atoi(value)
+	if err != nil {
+		logger.Fatal("Invalid integer environment variable", "variable", key, "value", value)
+	}
+	return result
+}
+
+func envFloat(key string, defaultValue float64) float64 {
+	value := envOrDefault(key, "")
+	if value == "" {
+		return defaultValue
+	}
+	result, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		logger.Fatal("Invalid numeric environment variable", "variable", key, "value", value)
+	}
+	return result
+}
+
+func envDuration(key string, defaultValue time.Duration) time.Duration {
+	value := envOrDefault(key, "")
+	if value == "" {
+		return defaultValue
+	}
+	result, err := time.ParseDuration(value)
+	if err != nil {
+		logger.Fatal("Invalid duration environment variable", "variable", key, "value", value)
+	}
+	return result
+}
+
+func parseTags(tags string) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, tag := range strings.Split(tags, ",") {
+		keyValue := strings.Split(tag, "=")
+		if len(keyValue) != 2 {
+			return nil, fmt.Errorf("invalid tag '%s', expected key=value pair", tag)
+		}
+
+		key := keyValue[0]
+		value := keyValue[1]
+
+		result[key] = value
+	}
+
+	return result, nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseDownwardAPIFile(t *testing.T) {
+	t.Parallel()
+
+	data := "app.kubernetes.io/name=\"k8s-sentry\"\nregion=\"eu-west-1\"\ntier=\"platform \\\"core\\\"\"\n"
+	tags, err := parseDownwardAPIFile(data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"app.kubernetes.io/name": "k8s-sentry", "region": "eu-west-1", "tier": `platform "core"`}
+	if !reflect.DeepEqual(tags, expected) {
+		t.Errorf("Unexpected tags %v", tags)
+	}
+	if tags, _ := parseDownwardAPIFile(data, []string{"region", "zone"}); !reflect.DeepEqual(tags, map[string]string{"region": "eu-west-1"}) {
+		t.Errorf("Unexpected selected tags %v", tags)
+	}
+	if _, err := parseDownwardAPIFile("region=eu-west-1", nil); err == nil {
+		t.Error("No error for unquoted value")
+	}
+}
+
+func TestDefaultTagsFile(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "k8s-sentry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "labels")
+	if err := ioutil.WriteFile(path, []byte("region=\"eu-west-1\"\ntier=\"platform\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config{tags: "tier=batch,team=core", tagsFile: path}
+	tags, err := cfg.defaultTags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tags, map[string]string{"region": "eu-west-1", "tier": "batch", "team": "core"}) {
+		t.Errorf("Unexpected tags %v", tags)
+	}
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// criticalRestartWindow is the period in which restarts are counted to
+// decide if a critical component restarts repeatedly.
+const criticalRestartWindow = time.Hour
+
+// containerRestart describes a container restart detected by comparing two
+// versions of a pod.
+type containerRestart struct {
+	container string
+	restarts  int32
+	last      *v1.ContainerStateTerminated
+}
+
+// criticalRestartTracker counts recent restarts of containers in critical
+// namespaces, such as kube-system. Restarts are reported as warnings, and
+// as errors once a container restarted threshold times within an hour.
+type criticalRestartTracker struct {
+	namespaces []string
+	threshold  int
+
+	lock     sync.Mutex
+	restarts map[string][]time.Time
+}
+
+func newCriticalRestartTracker(namespaces []string, threshold int) *criticalRestartTracker {
+	return &criticalRestartTracker{
+		namespaces: namespaces,
+		threshold:  threshold,
+		restarts:   make(map[string][]time.Time),
+	}
+}
+
+// Critical returns true if a namespace is critical.
+func (t *criticalRestartTracker) Critical(namespace string) bool {
+	for _, critical := range t.namespaces {
+		if critical == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// Record records a restart and returns the level to report it at, together
+// with the number of restarts in the last hour.
+func (t *criticalRestartTracker) Record(key string, now time.Time) (sentry.Level, int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	var recent []time.Time
+	for _, restart := range t.restarts[key] {
+		if now.Sub(restart) < criticalRestartWindow {
+			recent = append(recent, restart)
+		}
+	}
+	recent = append(recent, now)
+	t.restarts[key] = recent
+	if len(recent) >= t.threshold {
+		return sentry.LevelError, len(recent)
+	}
+	return sentry.LevelWarning, len(recent)
+}
+
+// containerRestarts returns the containers whose restart count increased
+// between two versions of a pod.
+func containerRestarts(oldPod, pod *v1.Pod) []containerRestart {
+	previous := make(map[string]int32)
+	for _, status := range oldPod.Status.ContainerStatuses {
+		previous[status.Name] = status.RestartCount
+	}
+	var restarts []containerRestart
+	for _, status := range pod.Status.ContainerStatuses {
+		if count, ok := previous[status.Name]; ok && status.RestartCount > count {
+			restarts = append(restarts, containerRestart{
+				container: status.Name,
+				restarts:  status.RestartCount,
+				last:      status.LastTerminationState.Terminated,
+			})
+		}
+	}
+	return restarts
+}
+
+// criticalPodHandlers returns the pod handlers that report container
+// restarts in critical namespaces.
+func (app *application) criticalPodHandlers() cache.ResourceEventHandler {
+	return recoverHandlers("critical pod monitor", cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldPod, ok := oldObj.(*v1.Pod)
+			if !ok {
+				return
+			}
+			pod, ok := newObj.(*v1.Pod)
+			if !ok || !app.critical.Critical(pod.Namespace) {
+				return
+			}
+			for _, restart := range containerRestarts(oldPod, pod) {
+				app.reportCriticalRestart(pod, restart, time.Now())
+			}
+		},
+	})
+}
+
+// reportCriticalRestart reports the restart of a container in a critical
+// namespace.
+func (app *application) reportCriticalRestart(pod *v1.Pod, restart containerRestart, now time.Time) {
+	workload := podWorkload(pod)
+	level, recent := app.critical.Record(pod.Namespace+"/"+workload+"/"+restart.container, now)
+
+	sentryEvent := app.newBaseEvent(pod.Namespace)
+	sentryEvent.Level = level
+	sentryEvent.Message = fmt.Sprintf("%s: container %s restarted (%d restarts in the last hour)", workload, restart.container, recent)
+	sentryEvent.Fingerprint = []string{"critical-restart", pod.Namespace, workload, restart.container}
+	sentryEvent.Tags["kind"] = "Pod"
+	sentryEvent.Tags["critical"] = "true"
+	sentryEvent.Tags["container"] = restart.container
+	sentryEvent.Tags["workload"] = workload
+	if pod.Spec.NodeName != "" {
+		sentryEvent.Tags["node"] = pod.Spec.NodeName
+	}
+	sentryEvent.Extra["pod"] = pod.Name
+	sentryEvent.Extra["restart-count"] = restart.restarts
+	if restart.last != nil {
+		sentryEvent.Extra["exit-code"] = restart.last.ExitCode
+		sentryEvent.Extra["termination-reason"] = restart.last.Reason
+		if restart.last.Message != "" {
+			sentryEvent.Extra["termination-message"] = restart.last.Message
+		}
+	}
+	if restarts := restartHistory(pod, restart.container, app.restarts); len(restarts) > 0 {
+		sentryEvent.Extra["restart-history"] = restarts
+	}
+
+	logger.Info("Reporting critical container restart", "namespace", pod.Namespace, "pod", pod.Name, "container", restart.container)
+	app.reportMonitorEvent(sentryEvent, objectReference("Pod", pod), fmt.Sprintf("critical-restart/%s/%s/%d", pod.UID, restart.container, restart.restarts))
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestCriticalRestartTracker(t *testing.T) {
+	t.Parallel()
+
+	tracker := newCriticalRestartTracker([]string{"kube-system"}, 3)
+	start := time.Now()
+	for i, expected := range []sentry.Level{sentry.LevelWarning, sentry.LevelWarning, sentry.LevelError} {
+		if level, count := tracker.Record("kube-system/Deployment/coredns/coredns", start.Add(time.Duration(i)*time.Minute)); level != expected || count != i+1 {
+			t.Errorf("Unexpected result for restart %d: %s %d", i+1, level, count)
+		}
+	}
+	if level, count := tracker.Record("kube-system/Deployment/coredns/coredns", start.Add(2*time.Hour)); level != sentry.LevelWarning || count != 1 {
+		t.Errorf("Old restarts counted: %s %d", level, count)
+	}
+}
+
+func TestContainerRestarts(t *testing.T) {
+	t.Parallel()
+
+	oldPod := &v1.Pod{Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{
+		{Name: "coredns", RestartCount: 1},
+		{Name: "sidecar", RestartCount: 0},
+	}}}
+	pod := &v1.Pod{Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{
+		{
+			Name:                 "coredns",
+			RestartCount:         2,
+			LastTerminationState: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled"}},
+		},
+		{Name: "sidecar", RestartCount: 0},
+		{Name: "new", RestartCount: 1},
+	}}}
+
+	restarts := containerRestarts(oldPod, pod)
+	if len(restarts) != 1 || restarts[0].container != "coredns" || restarts[0].restarts != 2 || restarts[0].last.Reason != "OOMKilled" {
+		t.Errorf("Unexpected restarts: %+v", restarts)
+	}
+}
@@ -0,0 +1,284 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+// daemonSetMonitor reports DaemonSets that have fewer ready pods than
+// desired for longer than a threshold.
+type daemonSetMonitor struct {
+	unavailable *conditionTracker
+}
+
+func newDaemonSetMonitor(threshold time.Duration) *daemonSetMonitor {
+	return &daemonSetMonitor{unavailable: newConditionTracker(threshold)}
+}
+
+// Update records the status of a DaemonSet.
+func (m *daemonSetMonitor) Update(key string, ds *appsv1.DaemonSet, now time.Time) {
+	m.unavailable.Set(key, daemonSetUnavailable(ds), now)
+}
+
+// Delete stops tracking a DaemonSet.
+func (m *daemonSetMonitor) Delete(key string, now time.Time) {
+	m.unavailable.Set(key, false, now)
+}
+
+func daemonSetUnavailable(ds *appsv1.DaemonSet) bool {
+	return ds.Status.ObservedGeneration >= ds.Generation &&
+		ds.Status.NumberReady < ds.Status.DesiredNumberScheduled
+}
+
+func (app *application) monitorDaemonSets(stop chan struct{}) {
+	watchList := cache.NewListWatchFromClient(
+		app.clientset.AppsV1().RESTClient(),
+		"daemonsets",
+		app.namespace,
+		fields.Everything(),
+	)
+	update := func(obj interface{}) {
+		ds, ok := obj.(*appsv1.DaemonSet)
+		if !ok {
+			return
+		}
+		if key, err := cache.MetaNamespaceKeyFunc(ds); err == nil {
+			app.daemonSets.Update(key, ds, time.Now())
+		}
+	}
+	store, controller := cache.NewInformer(
+		app.instrument("DaemonSet monitor", "daemonsets", watchList),
+		&appsv1.DaemonSet{},
+		time.Minute*10,
+		recoverHandlers("DaemonSet monitor", cache.ResourceEventHandlerFuncs{
+			AddFunc: update,
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				update(newObj)
+			},
+			DeleteFunc: func(obj interface{}) {
+				if key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj); err == nil {
+					app.daemonSets.Delete(key, time.Now())
+				}
+			},
+		}),
+	)
+	app.registerInformer("DaemonSet monitor", controller.HasSynced)
+	go controller.Run(stop)
+
+	ticker := time.NewTicker(time.Second * 30)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			for key, since := range app.daemonSets.unavailable.Expired(now) {
+				if obj, exists, _ := store.GetByKey(key); exists {
+					app.reportDaemonSet(obj.(*appsv1.DaemonSet), since)
+				}
+			}
+		}
+	}
+}
+
+// reportDaemonSet reports a DaemonSet with missing pods, including the nodes
+// without a ready pod and the reasons why.
+func (app *application) reportDaemonSet(ds *appsv1.DaemonSet, since time.Time) {
+	sentryEvent := app.newBaseEvent(ds.Namespace)
+	sentryEvent.Level = sentry.LevelError
+	sentryEvent.Message = fmt.Sprintf("DaemonSet/%s: %d of %d pods not ready",
+		ds.Name, ds.Status.DesiredNumberScheduled-ds.Status.NumberReady, ds.Status.DesiredNumberScheduled)
+	sentryEvent.Fingerprint = []string{"daemonset-unavailable", ds.Namespace, ds.Name}
+	sentryEvent.Tags["kind"] = "DaemonSet"
+	sentryEvent.Tags["daemonset"] = ds.Name
+	sentryEvent.Extra["since"] = since.UTC().Format(time.RFC3339)
+	sentryEvent.Extra["desired"] = ds.Status.DesiredNumberScheduled
+	sentryEvent.Extra["ready"] = ds.Status.NumberReady
+	sentryEvent.Extra["misscheduled"] = ds.Status.NumberMisscheduled
+
+	missing, excluded, err := app.daemonSetNodes(ds)
+	if err != nil {
+		logger.Debug("Unable to determine nodes for DaemonSet", "namespace", ds.Namespace, "daemonset", ds.Name, "error", err)
+	}
+	if len(missing) > 0 {
+		nodes := make([]string, 0, len(missing))
+		for node := range missing {
+			nodes = append(nodes, node)
+		}
+		sort.Strings(nodes)
+		sentryEvent.Tags["nodes"] = truncate(strings.Join(nodes, ","), 200)
+		sentryEvent.Extra["missing-nodes"] = missing
+	}
+	if len(excluded) > 0 {
+		sentryEvent.Extra["excluded-nodes"] = excluded
+	}
+
+	logger.Info("Reporting DaemonSet", "namespace", ds.Namespace, "daemonset", ds.Name, "message", sentryEvent.Message)
+	app.reportMonitorEvent(sentryEvent, objectReference("DaemonSet", ds), fingerprintKey(sentryEvent))
+}
+
+// daemonSetNodes lists the nodes and pods for a DaemonSet, and determines
+// on which nodes its pod is missing.
+func (app *application) daemonSetNodes(ds *appsv1.DaemonSet) (map[string]string, map[string]string, error) {
+	nodes, err := app.clientset.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+	selector, err := metav1.LabelSelectorAsSelector(ds.Spec.Selector)
+	if err != nil {
+		return nil, nil, err
+	}
+	pods, err := app.clientset.CoreV1().Pods(ds.Namespace).List(metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, nil, err
+	}
+	missing, excluded := daemonSetNodeStatus(ds, nodes.Items, pods.Items)
+	return missing, excluded, nil
+}
+
+// daemonSetNodeStatus returns the nodes that should run a pod for a
+// DaemonSet but do not have a ready one, and the nodes that are excluded
+// because of a taint, each with the reason.
+func daemonSetNodeStatus(ds *appsv1.DaemonSet, nodes []v1.Node, pods []v1.Pod) (map[string]string, map[string]string) {
+	podsByNode := make(map[string]*v1.Pod)
+	for i := range pods {
+		pod := &pods[i]
+		if owner := metav1.GetControllerOf(pod); owner == nil || owner.UID != ds.UID {
+			continue
+		}
+		if node := daemonPodNode(pod); node != "" {
+			podsByNode[node] = pod
+		}
+	}
+
+	missing := make(map[string]string)
+	excluded := make(map[string]string)
+	template := ds.Spec.Template.Spec
+	for i := range nodes {
+		node := &nodes[i]
+		if !labels.SelectorFromSet(template.NodeSelector).Matches(labels.Set(node.Labels)) {
+			continue
+		}
+		if taint := untoleratedTaint(node.Spec.Taints, template.Tolerations); taint != nil {
+			excluded[node.Name] = "taint " + taint.ToString()
+			continue
+		}
+
+		var reasons []string
+		pod := podsByNode[node.Name]
+		switch {
+		case pod == nil:
+			reasons = append(reasons, "no pod")
+		case podReady(pod):
+			continue
+		default:
+			reasons = append(reasons, podNotReadyReason(pod))
+		}
+		reasons = append(reasons, nodeProblems(node)...)
+		missing[node.Name] = strings.Join(reasons, ", ")
+	}
+	return missing, excluded
+}
+
+// daemonPodNode returns the node a DaemonSet pod is, or will be, running on.
+// Pending DaemonSet pods are bound to their node with node affinity.
+func daemonPodNode(pod *v1.Pod) string {
+	if pod.Spec.NodeName != "" {
+		return pod.Spec.NodeName
+	}
+	affinity := pod.Spec.Affinity
+	if affinity == nil || affinity.NodeAffinity == nil || affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return ""
+	}
+	for _, term := range affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+		for _, field := range term.MatchFields {
+			if field.Key == "metadata.name" && len(field.Values) == 1 {
+				return field.Values[0]
+			}
+		}
+	}
+	return ""
+}
+
+// untoleratedTaint returns the first taint that prevents pods from being
+// scheduled on a node and is not tolerated.
+func untoleratedTaint(taints []v1.Taint, tolerations []v1.Toleration) *v1.Taint {
+	for i := range taints {
+		taint := &taints[i]
+		if taint.Effect == v1.TaintEffectPreferNoSchedule {
+			continue
+		}
+		tolerated := false
+		for j := range tolerations {
+			if tolerations[j].ToleratesTaint(taint) {
+				tolerated = true
+				break
+			}
+		}
+		if !tolerated {
+			return taint
+		}
+	}
+	return nil
+}
+
+// podNotReadyReason describes why a pod is not ready.
+func podNotReadyReason(pod *v1.Pod) string {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodScheduled && condition.Status == v1.ConditionFalse && condition.Message != "" {
+			return "unschedulable: " + condition.Message
+		}
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Waiting != nil && status.State.Waiting.Reason != "" {
+			return status.Name + ": " + status.State.Waiting.Reason
+		}
+	}
+	return "pod " + strings.ToLower(string(pod.Status.Phase)) + " and not ready"
+}
+
+// nodeProblems returns the conditions that indicate a node is not healthy.
+func nodeProblems(node *v1.Node) []string {
+	var problems []string
+	if node.Spec.Unschedulable {
+		problems = append(problems, "cordoned")
+	}
+	for _, condition := range node.Status.Conditions {
+		switch condition.Type {
+		case v1.NodeReady:
+			if condition.Status != v1.ConditionTrue {
+				problems = append(problems, "NotReady")
+			}
+		case v1.NodeMemoryPressure, v1.NodeDiskPressure, v1.NodePIDPressure, v1.NodeNetworkUnavailable:
+			if condition.Status == v1.ConditionTrue {
+				problems = append(problems, string(condition.Type))
+			}
+		}
+	}
+	return problems
+}
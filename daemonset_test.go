@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDaemonSetMonitor(t *testing.T) {
+	t.Parallel()
+
+	ds := &appsv1.DaemonSet{Status: appsv1.DaemonSetStatus{DesiredNumberScheduled: 3, NumberReady: 2}}
+	monitor := newDaemonSetMonitor(10 * time.Minute)
+	start := time.Now()
+	monitor.Update("kube-system/cni", ds, start)
+	if expired := monitor.unavailable.Expired(start.Add(5 * time.Minute)); len(expired) != 0 {
+		t.Errorf("Reported before threshold: %v", expired)
+	}
+	if expired := monitor.unavailable.Expired(start.Add(11 * time.Minute)); len(expired) != 1 {
+		t.Errorf("Not reported after threshold: %v", expired)
+	}
+}
+
+func TestDaemonSetNodeStatus(t *testing.T) {
+	t.Parallel()
+
+	controller := true
+	ds := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "cni", UID: "ds-uid"},
+		Spec: appsv1.DaemonSetSpec{Template: v1.PodTemplateSpec{Spec: v1.PodSpec{
+			NodeSelector: map[string]string{"kubernetes.io/os": "linux"},
+			Tolerations:  []v1.Toleration{{Key: "node-role.kubernetes.io/master", Effect: v1.TaintEffectNoSchedule}},
+		}}},
+	}
+	linux := map[string]string{"kubernetes.io/os": "linux"}
+	nodes := []v1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "healthy", Labels: linux}},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "pressure", Labels: linux},
+			Status:     v1.NodeStatus{Conditions: []v1.NodeCondition{{Type: v1.NodeMemoryPressure, Status: v1.ConditionTrue}}},
+		},
+		{ObjectMeta: metav1.ObjectMeta{Name: "pending", Labels: linux}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "master", Labels: linux}, Spec: v1.NodeSpec{Taints: []v1.Taint{{Key: "node-role.kubernetes.io/master", Effect: v1.TaintEffectNoSchedule}}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "gpu", Labels: linux}, Spec: v1.NodeSpec{Taints: []v1.Taint{{Key: "gpu", Value: "true", Effect: v1.TaintEffectNoSchedule}}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "windows", Labels: map[string]string{"kubernetes.io/os": "windows"}}},
+	}
+	owner := []metav1.OwnerReference{{Kind: "DaemonSet", Name: "cni", UID: "ds-uid", Controller: &controller}}
+	pods := []v1.Pod{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "cni-a", OwnerReferences: owner},
+			Spec:       v1.PodSpec{NodeName: "healthy"},
+			Status:     v1.PodStatus{Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue, LastTransitionTime: metav1.Now()}}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "cni-b", OwnerReferences: owner},
+			Spec: v1.PodSpec{Affinity: &v1.Affinity{NodeAffinity: &v1.NodeAffinity{RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
+				NodeSelectorTerms: []v1.NodeSelectorTerm{{MatchFields: []v1.NodeSelectorRequirement{{Key: "metadata.name", Operator: v1.NodeSelectorOpIn, Values: []string{"pending"}}}}},
+			}}}},
+			Status: v1.PodStatus{
+				Phase:      v1.PodPending,
+				Conditions: []v1.PodCondition{{Type: v1.PodScheduled, Status: v1.ConditionFalse, Message: "0/6 nodes are available: 1 Insufficient cpu."}},
+			},
+		},
+	}
+
+	missing, excluded := daemonSetNodeStatus(ds, nodes, pods)
+	if len(missing) != 3 || missing["master"] != "no pod" {
+		t.Errorf("Unexpected missing nodes: %v", missing)
+	}
+	if missing["pressure"] != "no pod, MemoryPressure" {
+		t.Errorf("Unexpected reason for node with memory pressure: %s", missing["pressure"])
+	}
+	if missing["pending"] != "unschedulable: 0/6 nodes are available: 1 Insufficient cpu." {
+		t.Errorf("Unexpected reason for node with pending pod: %s", missing["pending"])
+	}
+	if len(excluded) != 1 || excluded["gpu"] != "taint gpu=true:NoSchedule" {
+		t.Errorf("Unexpected excluded nodes: %v", excluded)
+	}
+}
@@ -0,0 +1,298 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// dedupSaveInterval is how often reported events are saved.
+	dedupSaveInterval = 10 * time.Second
+	// maxDedupEntries limits the number of reported events that are kept.
+	maxDedupEntries = 10000
+	// maxDedupSize limits the size of the saved reported events, so they fit
+	// in a ConfigMap, which can not be larger than 1MiB.
+	maxDedupSize = 512 * 1024
+	// dedupConfigMapKey is the key of the ConfigMap data with the reported
+	// events.
+	dedupConfigMapKey = "reported.json"
+)
+
+// dedupBackend stores the reported events.
+type dedupBackend interface {
+	Load() ([]byte, error)
+	Save(data []byte) error
+}
+
+// dedupStore remembers which events were reported, so events are not
+// reported again after a restart, relist or shard failover. Entries expire
+// after ttl.
+type dedupStore struct {
+	backend dedupBackend
+	ttl     time.Duration
+
+	// saveLock serializes saves, so lookups are not blocked by the backend.
+	saveLock sync.Mutex
+
+	lock     sync.Mutex
+	reported map[string]time.Time
+	dirty    bool
+}
+
+func newDedupStore(backend dedupBackend, ttl time.Duration) (*dedupStore, error) {
+	s := &dedupStore{backend: backend, ttl: ttl, reported: make(map[string]time.Time)}
+	data, err := backend.Load()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.merge(data, time.Now()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// dedupKey identifies an event. The count is included so repeated events
+// that are reported again are not considered duplicates.
+func dedupKey(cluster string, evt *v1.Event) string {
+	if evt.UID == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s/%d", cluster, evt.UID, eventCount(evt))
+}
+
+// Reported returns true if the event with key was reported before.
+func (s *dedupStore) Reported(key string, now time.Time) bool {
+	if key == "" {
+		return false
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	expires, ok := s.reported[key]
+	return ok && now.Before(expires)
+}
+
+// Add records that the event with key was reported.
+func (s *dedupStore) Add(key string, now time.Time) {
+	if key == "" {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.reported[key] = now.Add(s.ttl)
+	s.dirty = true
+}
+
+// Run periodically saves the reported events until stop is closed.
+func (s *dedupStore) Run(stop chan struct{}) {
+	ticker := time.NewTicker(dedupSaveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := s.Save(time.Now()); err != nil {
+				logger.Error("Error saving reported events", "error", err)
+			}
+		}
+	}
+}
+
+// Save stores the reported events if they changed. Events stored by other
+// replicas are merged first. The backend is used without holding the lock,
+// so reporting events is not delayed by it.
+func (s *dedupStore) Save(now time.Time) error {
+	s.saveLock.Lock()
+	defer s.saveLock.Unlock()
+
+	s.lock.Lock()
+	dirty := s.dirty
+	s.dirty = false
+	s.lock.Unlock()
+	if !dirty {
+		return nil
+	}
+
+	data, err := s.backend.Load()
+	if err == nil {
+		s.lock.Lock()
+		if err := s.merge(data, now); err != nil {
+			logger.Warning("Ignoring invalid reported events", "error", err)
+		}
+		s.expire(now)
+		data, err = s.encode()
+		s.lock.Unlock()
+	}
+	if err == nil {
+		err = s.backend.Save(data)
+	}
+	if err != nil {
+		s.lock.Lock()
+		s.dirty = true
+		s.lock.Unlock()
+	}
+	return err
+}
+
+// merge adds reported events from data, which must be locked by the caller.
+func (s *dedupStore) merge(data []byte, now time.Time) error {
+	if len(data) == 0 {
+		return nil
+	}
+	var reported map[string]time.Time
+	if err := json.Unmarshal(data, &reported); err != nil {
+		return err
+	}
+	for key, expires := range reported {
+		if expires.After(now) && expires.After(s.reported[key]) {
+			s.reported[key] = expires
+		}
+	}
+	return nil
+}
+
+// expire removes expired entries, and the oldest entries if there are too
+// many. It must be called with the lock held.
+func (s *dedupStore) expire(now time.Time) {
+	for key, expires := range s.reported {
+		if !expires.After(now) {
+			delete(s.reported, key)
+		}
+	}
+	if len(s.reported) > maxDedupEntries {
+		s.removeOldest(len(s.reported) - maxDedupEntries)
+	}
+}
+
+// encode returns the reported events as JSON, after removing the oldest
+// entries if they do not fit in maxDedupSize. It must be called with the
+// lock held.
+func (s *dedupStore) encode() ([]byte, error) {
+	for {
+		data, err := json.Marshal(s.reported)
+		if err != nil || len(data) <= maxDedupSize {
+			return data, err
+		}
+		// Remove the share of entries by which the size is exceeded.
+		s.removeOldest(len(s.reported) - len(s.reported)*maxDedupSize/len(data) + 1)
+	}
+}
+
+// removeOldest removes the n entries that expire first. It must be called
+// with the lock held.
+func (s *dedupStore) removeOldest(n int) {
+	keys := make([]string, 0, len(s.reported))
+	for key := range s.reported {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return s.reported[keys[i]].Before(s.reported[keys[j]]) })
+	if n > len(keys) {
+		n = len(keys)
+	}
+	for _, key := range keys[:n] {
+		delete(s.reported, key)
+	}
+}
+
+// dedupFile stores reported events in a local file, which should be on a
+// persistent volume.
+type dedupFile string
+
+func (f dedupFile) Load() ([]byte, error) {
+	data, err := ioutil.ReadFile(string(f))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+func (f dedupFile) Save(data []byte) error {
+	temp, err := ioutil.TempFile(filepath.Dir(string(f)), ".reported-")
+	if err != nil {
+		return err
+	}
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		os.Remove(temp.Name())
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+	return os.Rename(temp.Name(), string(f))
+}
+
+// dedupConfigMap stores reported events in a ConfigMap, which allows
+// replicas to share them.
+type dedupConfigMap struct {
+	clientset *kubernetes.Clientset
+	namespace string
+	name      string
+}
+
+func newDedupConfigMap(clientset *kubernetes.Clientset, reference string) (*dedupConfigMap, error) {
+	parts := strings.Split(reference, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("invalid ConfigMap '%s', expected <namespace>/<name>", reference)
+	}
+	return &dedupConfigMap{clientset: clientset, namespace: parts[0], name: parts[1]}, nil
+}
+
+func (c *dedupConfigMap) Load() ([]byte, error) {
+	configMap, err := c.clientset.CoreV1().ConfigMaps(c.namespace).Get(c.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return []byte(configMap.Data[dedupConfigMapKey]), nil
+}
+
+func (c *dedupConfigMap) Save(data []byte) error {
+	configMaps := c.clientset.CoreV1().ConfigMaps(c.namespace)
+	configMap, err := configMaps.Get(c.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		configMap = &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: c.namespace, Name: c.name},
+			Data:       map[string]string{dedupConfigMapKey: string(data)},
+		}
+		_, err = configMaps.Create(configMap)
+		return err
+	} else if err != nil {
+		return err
+	}
+	if configMap.Data == nil {
+		configMap.Data = make(map[string]string)
+	}
+	configMap.Data[dedupConfigMapKey] = string(data)
+	_, err = configMaps.Update(configMap)
+	return err
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestDedupStore(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "dedup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	backend := dedupFile(filepath.Join(dir, "reported.json"))
+
+	store, err := newDedupStore(backend, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	evt := &v1.Event{Count: 1}
+	evt.UID = "0c4b6a6e"
+	key := dedupKey("prod", evt)
+	if store.Reported(key, now) {
+		t.Error("New event reported before")
+	}
+	store.Add(key, now)
+	if err := store.Save(now); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = newDedupStore(backend, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !store.Reported(key, now) {
+		t.Error("Reported event not loaded")
+	}
+	if store.Reported(key, now.Add(2*time.Hour)) {
+		t.Error("Reported event did not expire")
+	}
+	evt.Count = 10
+	if store.Reported(dedupKey("prod", evt), now) {
+		t.Error("Repeated event considered a duplicate")
+	}
+	if dedupKey("prod", &v1.Event{}) != "" || store.Reported("", now) {
+		t.Error("Event without UID deduplicated")
+	}
+}
+
+func TestDedupStoreExpire(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	store := &dedupStore{ttl: time.Hour, reported: make(map[string]time.Time)}
+	for i := 0; i < maxDedupEntries+10; i++ {
+		store.Add(string(rune(i)), now.Add(time.Duration(i)*time.Second))
+	}
+	store.reported["expired"] = now.Add(-time.Second)
+	store.expire(now)
+	if len(store.reported) != maxDedupEntries || store.Reported(string(rune(0)), now) {
+		t.Errorf("Kept %d entries", len(store.reported))
+	}
+}
+
+func TestDedupStoreEncodeSize(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	store := &dedupStore{ttl: time.Hour, reported: make(map[string]time.Time)}
+	key := strings.Repeat("x", 200)
+	for i := 0; i < maxDedupEntries; i++ {
+		store.Add(fmt.Sprintf("%s/%d", key, i), now.Add(time.Duration(i)*time.Second))
+	}
+	data, err := store.encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) > maxDedupSize {
+		t.Errorf("Encoded %d bytes", len(data))
+	}
+	if store.Reported(key+"/0", now) || !store.Reported(fmt.Sprintf("%s/%d", key, maxDedupEntries-1), now) {
+		t.Error("Newest entries not kept")
+	}
+}
+
+func TestReportEventDedupDigest(t *testing.T) {
+	t.Parallel()
+
+	app := &application{
+		clusterName: "prod",
+		digest:      newDigest(time.Hour, []string{"BackOff"}, true),
+		dedup:       &dedupStore{ttl: time.Hour, reported: make(map[string]time.Time)},
+	}
+	evt := &v1.Event{Type: v1.EventTypeWarning, Reason: "BackOff", Count: 1}
+	evt.UID = "0c4b6a6e"
+	app.reportEvent(evt)
+	if !app.dedup.Reported(dedupKey("prod", evt), time.Now()) {
+		t.Error("Event included in digest not remembered")
+	}
+	if event, cause := app.processEvent(evt); event != nil || cause != "already reported" {
+		t.Errorf("Event included in digest processed again: %s", cause)
+	}
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// digest counts warning events per namespace and reason, so a periodic
+// summary can be sent instead of, or in addition to, individual events.
+type digest struct {
+	interval time.Duration
+	reasons  map[string]bool
+	only     bool
+
+	lock   sync.Mutex
+	counts map[string]map[string]int
+}
+
+func newDigest(interval time.Duration, reasons []string, only bool) *digest {
+	d := &digest{
+		interval: interval,
+		only:     only,
+		counts:   make(map[string]map[string]int),
+	}
+	if len(reasons) > 0 {
+		d.reasons = make(map[string]bool)
+		for _, reason := range reasons {
+			d.reasons[reason] = true
+		}
+	}
+	return d
+}
+
+// Record counts an event. It returns true if the event should only be
+// reported as part of the digest.
+func (d *digest) Record(namespace, reason string, level sentry.Level) bool {
+	if level != sentry.LevelWarning || (d.reasons != nil && !d.reasons[reason]) {
+		return false
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.counts[namespace] == nil {
+		d.counts[namespace] = make(map[string]int)
+	}
+	d.counts[namespace][reason]++
+	return d.only
+}
+
+// Flush returns the counts since the previous flush.
+func (d *digest) Flush() map[string]map[string]int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	counts := d.counts
+	d.counts = make(map[string]map[string]int)
+	return counts
+}
+
+// runDigest sends a digest event for every namespace with warnings once per
+// interval, until stop is closed.
+func (app *application) runDigest(stop chan struct{}) {
+	ticker := time.NewTicker(app.digest.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			// Send the warnings collected so far instead of losing them.
+			for namespace, counts := range app.digest.Flush() {
+				app.capture(app.newDigestEvent(namespace, counts))
+			}
+			return
+		case <-ticker.C:
+			for namespace, counts := range app.digest.Flush() {
+				app.capture(app.newDigestEvent(namespace, counts))
+			}
+		}
+	}
+}
+
+func (app *application) newDigestEvent(namespace string, counts map[string]int) *sentry.Event {
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+
+	sentryEvent := app.newBaseEvent(namespace)
+	sentryEvent.Level = sentry.LevelInfo
+	sentryEvent.Message = fmt.Sprintf("%d warnings in the last %s", total, app.digest.interval)
+	sentryEvent.Fingerprint = []string{"digest", namespace}
+	sentryEvent.Tags["digest"] = "true"
+	sentryEvent.Extra["warnings"] = counts
+	sentryEvent.Extra["interval"] = app.digest.interval.String()
+	return sentryEvent
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+func TestDigest(t *testing.T) {
+	t.Parallel()
+
+	d := newDigest(time.Hour, []string{"BackOff", "Unhealthy"}, true)
+	if !d.Record("shop", "BackOff", sentry.LevelWarning) {
+		t.Error("Digest reason not kept out of individual reports")
+	}
+	d.Record("shop", "BackOff", sentry.LevelWarning)
+	d.Record("shop", "Unhealthy", sentry.LevelWarning)
+	if d.Record("shop", "FailedMount", sentry.LevelWarning) || d.Record("shop", "BackOff", sentry.LevelError) {
+		t.Error("Other events kept out of individual reports")
+	}
+
+	counts := d.Flush()
+	if len(counts) != 1 || counts["shop"]["BackOff"] != 2 || counts["shop"]["Unhealthy"] != 1 {
+		t.Errorf("Unexpected counts: %v", counts)
+	}
+	if counts := d.Flush(); len(counts) != 0 {
+		t.Errorf("Counts not reset: %v", counts)
+	}
+
+	event := (&application{digest: d}).newDigestEvent("shop", map[string]int{"BackOff": 2, "Unhealthy": 1})
+	if event.Message != "3 warnings in the last 1h0m0s" || event.Fingerprint[0] != "digest" {
+		t.Errorf("Unexpected digest event: %s %v", event.Message, event.Fingerprint)
+	}
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+)
+
+var dnsFailureRegexp = regexp.MustCompile(`(?i)lookup \S+ on \S+:53: .*(i/o timeout|server misbehaving|connection refused)|SERVFAIL|temporary failure in name resolution`)
+
+// dnsAggregator combines DNS failures from all namespaces into a single
+// cluster-level issue. A DNS outage shows up as errors in many unrelated
+// pods, which would otherwise result in a large number of issues.
+type dnsAggregator struct {
+	interval time.Duration
+
+	lock       sync.Mutex
+	namespaces map[string]time.Time
+	lastReport time.Time
+}
+
+func newDNSAggregator(interval time.Duration) *dnsAggregator {
+	return &dnsAggregator{
+		interval:   interval,
+		namespaces: make(map[string]time.Time),
+	}
+}
+
+func isDNSFailure(evt *v1.Event) bool {
+	return dnsFailureRegexp.MatchString(evt.Message)
+}
+
+// Aggregate turns a Sentry event for a DNS failure into a cluster-level
+// event with the cluster-level environment, listing the namespaces with DNS
+// failures in the last ten intervals. It returns false if a DNS failure was
+// already reported less than an interval ago.
+func (a *dnsAggregator) Aggregate(sentryEvent *sentry.Event, evt *v1.Event, environment string) bool {
+	now := eventTime(evt)
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.namespaces[evt.InvolvedObject.Namespace] = now
+	var namespaces []string
+	for namespace, seen := range a.namespaces {
+		if now.Sub(seen) > 10*a.interval {
+			delete(a.namespaces, namespace)
+		} else {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	if now.Sub(a.lastReport) < a.interval {
+		return false
+	}
+	a.lastReport = now
+
+	sort.Strings(namespaces)
+	sentryEvent.Extra["message"] = sentryEvent.Message
+	sentryEvent.Extra["affected-namespaces"] = namespaces
+	sentryEvent.Message = "Cluster DNS failures"
+	sentryEvent.Level = sentry.LevelError
+	sentryEvent.Fingerprint = []string{"cluster-dns", sentryEvent.Tags["cluster"]}
+	sentryEvent.Environment = environment
+	sentryEvent.Extra["namespace"] = evt.InvolvedObject.Namespace
+	delete(sentryEvent.Tags, "namespace")
+	sentryEvent.Tags["dns"] = "failure"
+	return true
+}
+
+// eventTime returns the time an event was last seen. Events created with
+// the events.k8s.io API record repeated occurrences in their series, and use
+// eventTime instead of lastTimestamp.
+func eventTime(evt *v1.Event) time.Time {
+	if evt.Series != nil && !evt.Series.LastObservedTime.IsZero() {
+		return evt.Series.LastObservedTime.Time
+	}
+	if !evt.LastTimestamp.IsZero() {
+		return evt.LastTimestamp.Time
+	}
+	if !evt.EventTime.IsZero() {
+		return evt.EventTime.Time
+	}
+	return evt.CreationTimestamp.Time
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestIsDNSFailure(t *testing.T) {
+	t.Parallel()
+
+	failures := []string{
+		`Readiness probe failed: Get http://api:8080/health: dial tcp: lookup api.shop.svc.cluster.local on 10.96.0.10:53: read udp 10.1.2.3:45678->10.96.0.10:53: i/o timeout`,
+		`Error: failed to resolve db.example.com: SERVFAIL`,
+	}
+	for _, message := range failures {
+		if !isDNSFailure(&v1.Event{Message: message}) {
+			t.Errorf("DNS failure not recognised: %s", message)
+		}
+	}
+	if isDNSFailure(&v1.Event{Message: `dial tcp: lookup typo.example.com on 10.96.0.10:53: no such host`}) {
+		t.Error("Unknown host recognised as DNS failure")
+	}
+}
+
+func TestDNSAggregator(t *testing.T) {
+	t.Parallel()
+
+	aggregator := newDNSAggregator(time.Minute)
+	start := time.Now()
+	newEvent := func(namespace string, offset time.Duration) (*sentry.Event, *v1.Event) {
+		evt := &v1.Event{
+			InvolvedObject: v1.ObjectReference{Namespace: namespace},
+			LastTimestamp:  metav1.NewTime(start.Add(offset)),
+		}
+		event := sentry.NewEvent()
+		event.Environment = namespace
+		event.Tags["cluster"] = "production"
+		event.Tags["namespace"] = namespace
+		return event, evt
+	}
+
+	if event, evt := newEvent("shop", 0); !aggregator.Aggregate(event, evt, "") || event.Fingerprint[0] != "cluster-dns" {
+		t.Errorf("First DNS failure not reported: %v", event.Fingerprint)
+	} else if event.Environment != "" || event.Tags["namespace"] != "" {
+		t.Errorf("Namespace of first DNS failure kept: %s %v", event.Environment, event.Tags)
+	}
+	if event, evt := newEvent("billing", 10*time.Second); aggregator.Aggregate(event, evt, "") {
+		t.Error("DNS failure reported within interval")
+	}
+	event, evt := newEvent("search", 2*time.Minute)
+	if !aggregator.Aggregate(event, evt, "production") {
+		t.Fatal("DNS failure not reported after interval")
+	}
+	if namespaces := event.Extra["affected-namespaces"].([]string); len(namespaces) != 3 {
+		t.Errorf("Unexpected affected namespaces: %v", namespaces)
+	}
+	if event.Environment != "production" {
+		t.Errorf("Unexpected environment %s", event.Environment)
+	}
+}
+
+func TestEventTime(t *testing.T) {
+	t.Parallel()
+
+	created := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	evt := &v1.Event{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(created)}}
+	if when := eventTime(evt); !when.Equal(created) {
+		t.Errorf("Unexpected time without timestamps: %s", when)
+	}
+	evt.EventTime = metav1.NewMicroTime(created.Add(time.Minute))
+	if when := eventTime(evt); !when.Equal(created.Add(time.Minute)) {
+		t.Errorf("Unexpected time with eventTime: %s", when)
+	}
+	evt.LastTimestamp = metav1.NewTime(created.Add(2 * time.Minute))
+	if when := eventTime(evt); !when.Equal(created.Add(2 * time.Minute)) {
+		t.Errorf("Unexpected time with lastTimestamp: %s", when)
+	}
+	evt.Series = &v1.EventSeries{LastObservedTime: metav1.NewMicroTime(created.Add(3 * time.Minute))}
+	if when := eventTime(evt); !when.Equal(created.Add(3 * time.Minute)) {
+		t.Errorf("Unexpected time with series: %s", when)
+	}
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+const dsnFileCheckInterval = 30 * time.Second
+
+func readDSNFile(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// watchDSNFile periodically re-reads the DSN file until stop is closed, and
+// re-initialises the Sentry client if it has changed. This allows rotating
+// the DSN by updating a mounted Secret. The options of the current client
+// are used, so settings applied by a reload are kept.
+func watchDSNFile(path string, health *healthMonitor, stop chan struct{}) {
+	ticker := time.NewTicker(dsnFileCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := updateDSN(path, health); err != nil {
+				logger.Error("Error updating Sentry DSN", "path", path, "error", err)
+			}
+		}
+	}
+}
+
+// updateDSN re-initialises the Sentry client if the DSN in the DSN file
+// differs from the DSN of the current client.
+func updateDSN(path string, health *healthMonitor) error {
+	dsn, err := readDSNFile(path)
+	if err != nil {
+		return err
+	}
+	hub := sentry.CurrentHub()
+	oldClient := hub.Client()
+	if oldClient == nil || oldClient.Options().Dsn == dsn {
+		return nil
+	}
+
+	options := oldClient.Options()
+	options.Dsn = dsn
+	transport, ok := options.Transport.(*queuedTransport)
+	if ok {
+		transport = transport.clone()
+		options.Transport = transport
+	}
+	client, err := sentry.NewClient(options)
+	if err != nil {
+		return err
+	}
+	hub.BindClient(client)
+	if ok && health != nil {
+		health.AddQueue("Sentry", transport.Usage)
+	}
+	oldClient.Flush(time.Second * 1)
+	logger.Info("Sentry DSN changed, re-initialised Sentry client", "path", path)
+	return nil
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+)
+
+type serviceEndpoints struct {
+	hadReady  bool
+	zeroSince time.Time
+	reported  bool
+}
+
+// endpointTracker tracks the number of ready endpoints for Services, and
+// determines which Services have lost all their ready endpoints for longer
+// than a threshold. Services which never had ready endpoints are ignored.
+type endpointTracker struct {
+	threshold time.Duration
+
+	lock     sync.Mutex
+	services map[types.NamespacedName]*serviceEndpoints
+}
+
+func newEndpointTracker(threshold time.Duration) *endpointTracker {
+	return &endpointTracker{
+		threshold: threshold,
+		services:  make(map[types.NamespacedName]*serviceEndpoints),
+	}
+}
+
+// Update records the number of ready endpoints for a Service.
+func (t *endpointTracker) Update(service types.NamespacedName, ready int, now time.Time) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	state, ok := t.services[service]
+	if !ok {
+		state = &serviceEndpoints{}
+		t.services[service] = state
+	}
+	if ready > 0 {
+		*state = serviceEndpoints{hadReady: true}
+	} else if state.hadReady && state.zeroSince.IsZero() {
+		state.zeroSince = now
+	}
+}
+
+// Delete stops tracking a Service.
+func (t *endpointTracker) Delete(service types.NamespacedName) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.services, service)
+}
+
+// Expired returns all Services that have had no ready endpoints for longer
+// than the threshold, together with the time they lost their last endpoint.
+// Each outage is only returned once.
+func (t *endpointTracker) Expired(now time.Time) map[types.NamespacedName]time.Time {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	expired := make(map[types.NamespacedName]time.Time)
+	for service, state := range t.services {
+		if !state.zeroSince.IsZero() && !state.reported && now.Sub(state.zeroSince) >= t.threshold {
+			state.reported = true
+			expired[service] = state.zeroSince
+		}
+	}
+	return expired
+}
+
+func readyEndpoints(endpoints *v1.Endpoints) int {
+	ready := 0
+	for _, subset := range endpoints.Subsets {
+		ready += len(subset.Addresses)
+	}
+	return ready
+}
+
+func (app *application) monitorEndpoints(stop chan struct{}) {
+	watchList := cache.NewListWatchFromClient(
+		app.clientset.CoreV1().RESTClient(),
+		"endpoints",
+		app.namespace,
+		fields.Everything(),
+	)
+	update := func(obj interface{}) {
+		if endpoints, ok := obj.(*v1.Endpoints); ok {
+			app.endpoints.Update(types.NamespacedName{Namespace: endpoints.Namespace, Name: endpoints.Name}, readyEndpoints(endpoints), time.Now())
+		}
+	}
+	_, controller := cache.NewInformer(
+		app.instrument("endpoint monitor", "endpoints", watchList),
+		&v1.Endpoints{},
+		time.Minute*10,
+		recoverHandlers("endpoint monitor", cache.ResourceEventHandlerFuncs{
+			AddFunc: update,
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				update(newObj)
+			},
+			DeleteFunc: func(obj interface{}) {
+				if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+					obj = tombstone.Obj
+				}
+				if endpoints, ok := obj.(*v1.Endpoints); ok {
+					app.endpoints.Delete(types.NamespacedName{Namespace: endpoints.Namespace, Name: endpoints.Name})
+				}
+			},
+		}),
+	)
+	app.registerInformer("endpoint monitor", controller.HasSynced)
+	go controller.Run(stop)
+
+	ticker := time.NewTicker(time.Second * 30)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			for service, since := range app.endpoints.Expired(now) {
+				app.reportEndpointOutage(service, since)
+			}
+		}
+	}
+}
+
+func (app *application) reportEndpointOutage(service types.NamespacedName, since time.Time) {
+	sentryEvent := app.newBaseEvent(service.Namespace)
+	sentryEvent.Level = sentry.LevelError
+	sentryEvent.Message = fmt.Sprintf("Service/%s: no ready endpoints since %s", service.Name, since.UTC().Format(time.RFC3339))
+	sentryEvent.Fingerprint = []string{"service-no-endpoints", service.Namespace, service.Name}
+	sentryEvent.Tags["kind"] = "Service"
+	sentryEvent.Tags["service"] = service.Name
+	sentryEvent.Extra["since"] = since.UTC().Format(time.RFC3339)
+
+	svc, err := app.clientset.CoreV1().Services(service.Namespace).Get(service.Name, metav1.GetOptions{})
+	if err != nil {
+		logger.Debug("Unable to get service", "namespace", service.Namespace, "service", service.Name, "error", err)
+	} else if len(svc.Spec.Selector) > 0 {
+		sentryEvent.Tags["selector"] = labels.SelectorFromSet(svc.Spec.Selector).String()
+	}
+
+	logger.Info("Reporting service without endpoints", "namespace", service.Namespace, "service", service.Name, "since", since)
+	app.reportMonitorEvent(sentryEvent, v1.ObjectReference{Kind: "Service", Namespace: service.Namespace, Name: service.Name}, fingerprintKey(sentryEvent))
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestEndpointTracker(t *testing.T) {
+	t.Parallel()
+
+	tracker := newEndpointTracker(time.Minute)
+	service := types.NamespacedName{Namespace: "shop", Name: "web"}
+	idle := types.NamespacedName{Namespace: "shop", Name: "idle"}
+	start := time.Now()
+
+	tracker.Update(idle, 0, start)
+	tracker.Update(service, 2, start)
+	tracker.Update(service, 0, start.Add(time.Second))
+	if expired := tracker.Expired(start.Add(30 * time.Second)); len(expired) != 0 {
+		t.Errorf("Services reported before threshold: %v", expired)
+	}
+
+	expired := tracker.Expired(start.Add(2 * time.Minute))
+	if len(expired) != 1 || !expired[service].Equal(start.Add(time.Second)) {
+		t.Errorf("Unexpected expired services: %v", expired)
+	}
+	if expired := tracker.Expired(start.Add(3 * time.Minute)); len(expired) != 0 {
+		t.Errorf("Outage reported twice: %v", expired)
+	}
+
+	tracker.Update(service, 1, start.Add(4*time.Minute))
+	tracker.Update(service, 0, start.Add(5*time.Minute))
+	if expired := tracker.Expired(start.Add(7 * time.Minute)); len(expired) != 1 {
+		t.Errorf("New outage not reported: %v", expired)
+	}
+}
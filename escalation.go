@@ -0,0 +1,216 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	lru "github.com/hashicorp/golang-lru"
+	v1 "k8s.io/api/core/v1"
+)
+
+// escalationRule raises the level of events at level from to level to once
+// the same fingerprint occurred count times within window.
+type escalationRule struct {
+	from   sentry.Level
+	count  int
+	window time.Duration
+	to     sentry.Level
+}
+
+// occurrence records that an issue occurred count times at a time.
+type occurrence struct {
+	at    time.Time
+	count int
+}
+
+// escalationState is what the escalator remembers about an event, so later
+// increases of its count can be attributed to its fingerprint.
+type escalationState struct {
+	count     int
+	key       string
+	level     sentry.Level
+	escalated bool
+}
+
+// escalator counts recent occurrences per fingerprint, and escalates the
+// level of events for fingerprints that keep recurring.
+type escalator struct {
+	rules     []escalationRule
+	maxWindow time.Duration
+
+	lock        sync.Mutex
+	occurrences *lru.Cache
+	counts      *lru.Cache
+}
+
+func newEscalator(rules []escalationRule) (*escalator, error) {
+	occurrences, err := lru.New(5000)
+	if err != nil {
+		return nil, err
+	}
+	counts, err := lru.New(5000)
+	if err != nil {
+		return nil, err
+	}
+	e := &escalator{rules: rules, occurrences: occurrences, counts: counts}
+	for _, rule := range rules {
+		if rule.window > e.maxWindow {
+			e.maxWindow = rule.window
+		}
+	}
+	return e, nil
+}
+
+// Escalate records an occurrence of an event and raises the level of the
+// Sentry event if it matches a rule. An event counts as its count when it is
+// first seen, and as the number of times its count increased since after.
+func (e *escalator) Escalate(sentryEvent *sentry.Event, evt *v1.Event, now time.Time) {
+	key := strings.Join(sentryEvent.Fingerprint, "\x00")
+	level := sentryEvent.Level
+
+	e.lock.Lock()
+	count := int(eventCount(evt))
+	if count < 1 {
+		count = 1
+	}
+	added := count
+	if cached, ok := e.counts.Get(evt.UID); ok {
+		added = 0
+		if previous := cached.(escalationState).count; count > previous {
+			added = count - previous
+		}
+	}
+	recent := e.record(key, added, now)
+	e.lock.Unlock()
+
+	for _, rule := range e.rules {
+		if sentryEvent.Level != rule.from {
+			continue
+		}
+		if total := recurrences(recent, rule.window, now); total >= rule.count {
+			sentryEvent.Level = rule.to
+			sentryEvent.Tags["escalated"] = "true"
+			sentryEvent.Extra["recurrences"] = fmt.Sprintf("%d in %s", total, rule.window)
+		}
+	}
+
+	e.lock.Lock()
+	e.counts.Add(evt.UID, escalationState{count: count, key: key, level: level, escalated: sentryEvent.Level != level})
+	e.lock.Unlock()
+}
+
+// Recur records an increase of the count of an event that was escalated
+// before, without reporting it. It returns true if the event should be
+// reported again because it is now escalated. Events are only reported
+// again once.
+func (e *escalator) Recur(evt *v1.Event, now time.Time) bool {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	cached, ok := e.counts.Get(evt.UID)
+	if !ok {
+		return false
+	}
+	state := cached.(escalationState)
+	count := int(eventCount(evt))
+	if count <= state.count {
+		return false
+	}
+	recent := e.record(state.key, count-state.count, now)
+	state.count = count
+	e.counts.Add(evt.UID, state)
+	if state.escalated {
+		return false
+	}
+	for _, rule := range e.rules {
+		if rule.from == state.level && recurrences(recent, rule.window, now) >= rule.count {
+			return true
+		}
+	}
+	return false
+}
+
+// record adds an occurrence for a fingerprint, and returns its recent
+// occurrences. The lock must be held.
+func (e *escalator) record(key string, count int, now time.Time) []occurrence {
+	var recent []occurrence
+	if cached, ok := e.occurrences.Get(key); ok {
+		for _, o := range cached.([]occurrence) {
+			if now.Sub(o.at) < e.maxWindow {
+				recent = append(recent, o)
+			}
+		}
+	}
+	if count > 0 {
+		recent = append(recent, occurrence{at: now, count: count})
+	}
+	e.occurrences.Add(key, recent)
+	return recent
+}
+
+// recurrences returns the number of occurrences within window.
+func recurrences(recent []occurrence, window time.Duration, now time.Time) int {
+	total := 0
+	for _, o := range recent {
+		if now.Sub(o.at) < window {
+			total += o.count
+		}
+	}
+	return total
+}
+
+// parseEscalationRules parses a semicolon-separated list of rules in the
+// form "<level> <count> <window> <new level>".
+func parseEscalationRules(value string) ([]escalationRule, error) {
+	var rules []escalationRule
+	for _, entry := range strings.Split(value, ";") {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("invalid escalation rule '%s'", strings.TrimSpace(entry))
+		}
+		rule := escalationRule{from: sentry.Level(fields[0]), to: sentry.Level(fields[3])}
+		if !validLevel(rule.from) || !validLevel(rule.to) {
+			return nil, fmt.Errorf("invalid level in escalation rule '%s'", strings.TrimSpace(entry))
+		}
+		count, err := strconv.Atoi(fields[1])
+		if err != nil || count < 1 {
+			return nil, fmt.Errorf("invalid count in escalation rule '%s'", strings.TrimSpace(entry))
+		}
+		rule.count = count
+		if rule.window, err = time.ParseDuration(fields[2]); err != nil || rule.window <= 0 {
+			return nil, fmt.Errorf("invalid window in escalation rule '%s'", strings.TrimSpace(entry))
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func validLevel(level sentry.Level) bool {
+	switch level {
+	case sentry.LevelDebug, sentry.LevelInfo, sentry.LevelWarning, sentry.LevelError, sentry.LevelFatal:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestParseEscalationRules(t *testing.T) {
+	t.Parallel()
+
+	rules, err := parseEscalationRules("warning 50 10m error; error 200 1h fatal")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rules) != 2 {
+		t.Fatalf("expected 2 rules, got %d", len(rules))
+	}
+	if rules[0] != (escalationRule{from: sentry.LevelWarning, count: 50, window: 10 * time.Minute, to: sentry.LevelError}) {
+		t.Errorf("unexpected rule: %+v", rules[0])
+	}
+
+	for _, value := range []string{"warning 50 10m", "warn 50 10m error", "warning 0 10m error", "warning 50 soon error"} {
+		if _, err := parseEscalationRules(value); err == nil {
+			t.Errorf("expected an error for '%s'", value)
+		}
+	}
+}
+
+func TestEscalator(t *testing.T) {
+	t.Parallel()
+
+	e, err := newEscalator([]escalationRule{
+		{from: sentry.LevelWarning, count: 5, window: 10 * time.Minute, to: sentry.LevelError},
+		{from: sentry.LevelError, count: 10, window: 10 * time.Minute, to: sentry.LevelFatal},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	escalate := func(uid string, count int32, now time.Time) sentry.Level {
+		sentryEvent := sentry.NewEvent()
+		sentryEvent.Level = sentry.LevelWarning
+		sentryEvent.Fingerprint = []string{"kubelet", "Warning", "BackOff"}
+		e.Escalate(sentryEvent, &v1.Event{ObjectMeta: metav1.ObjectMeta{UID: types.UID(uid)}, Count: count}, now)
+		return sentryEvent.Level
+	}
+
+	now := time.Now()
+	for i := 0; i < 4; i++ {
+		if level := escalate(string(rune('a'+i)), 1, now); level != sentry.LevelWarning {
+			t.Fatalf("occurrence %d escalated to %s", i+1, level)
+		}
+	}
+	if level := escalate("e", 1, now); level != sentry.LevelError {
+		t.Errorf("expected error after 5 occurrences, got %s", level)
+	}
+	// The count of a repeated event increased by 5.
+	escalate("e", 6, now)
+	if level := escalate("f", 1, now); level != sentry.LevelFatal {
+		t.Errorf("expected fatal after 11 occurrences, got %s", level)
+	}
+	if level := escalate("g", 1, now.Add(11*time.Minute)); level != sentry.LevelWarning {
+		t.Errorf("expected old occurrences to expire, got %s", level)
+	}
+}
+
+func TestEscalateEventUpdate(t *testing.T) {
+	t.Parallel()
+
+	e, err := newEscalator([]escalationRule{{from: sentry.LevelWarning, count: 5, window: 10 * time.Minute, to: sentry.LevelError}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &application{escalation: e, recent: newRecentEvents(10)}
+	evt := &v1.Event{
+		ObjectMeta:     metav1.ObjectMeta{UID: "backoff", Namespace: "shop"},
+		InvolvedObject: v1.ObjectReference{Kind: "Pod", Namespace: "shop", Name: "web-1"},
+		Type:           v1.EventTypeWarning,
+		Reason:         "BackOff",
+		Count:          1,
+		LastTimestamp:  metav1.Now(),
+	}
+	app.handleEventAdd(evt)
+	update := func(count int32) {
+		updated := evt.DeepCopy()
+		updated.Count = count
+		app.handleEventUpdate(evt, updated)
+		evt = updated
+	}
+	update(3)
+	update(3)
+	if reported := app.recent.List(recentEventFilter{Decision: decisionReported}, 10); len(reported) != 1 {
+		t.Fatalf("Expected 1 report before escalation, got %d", len(reported))
+	}
+	update(6)
+	update(8)
+	reported := app.recent.List(recentEventFilter{Decision: decisionReported}, 10)
+	if len(reported) != 2 {
+		t.Fatalf("Expected the escalated event to be reported once, got %d reports", len(reported))
+	}
+	if level := reported[0].Payload.Level; level != sentry.LevelError {
+		t.Errorf("Expected the event to be reported as error, got %s", level)
+	}
+}
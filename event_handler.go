@@ -16,6 +16,7 @@ limitations under the License.
 package main
 
 import (
+	"github.com/getsentry/sentry-go"
 	v1 "k8s.io/api/core/v1"
 )
 
@@ -28,19 +29,82 @@ type EventHandler interface {
 	Tags() map[string]string
 }
 
+// EventEnricher can optionally be implemented by an EventHandler to make
+// further changes to the Sentry event, such as changing its level or
+// fingerprint, or adding extra data.
+type EventEnricher interface {
+	Enrich(event *sentry.Event)
+}
+
+// EventHandlerFactory creates an EventHandler for an event. It returns nil if
+// the handler does not apply to the event.
+type EventHandlerFactory func(app *application, evt *v1.Event) EventHandler
+
 type registryKey struct {
 	APIVersion string
 	Kind       string
 }
 
-var handlerRegistry = map[registryKey]func(*application, *v1.Event) EventHandler{
-	registryKey{APIVersion: "v1", Kind: "Pod"}: NewPodEventHandler,
+// handlerRegistry contains the handlers for the kind of the involved object.
+// An empty APIVersion matches all versions of a kind.
+var handlerRegistry = map[registryKey]EventHandlerFactory{
+	registryKey{APIVersion: "v1", Kind: "Pod"}:       NewPodEventHandler,
+	registryKey{Kind: "Node"}:                        NewNodeEventHandler,
+	registryKey{APIVersion: "batch/v1", Kind: "Job"}: NewJobEventHandler,
+	registryKey{Kind: "Ingress"}:                     NewIngressEventHandler,
+}
+
+// reasonRegistry contains handlers for specific event reasons. These are
+// applied in addition to the handler for the kind of the involved object.
+var reasonRegistry = map[string][]EventHandlerFactory{
+	"FailedCreate":              {NewReplicaSetEventHandler, NewLimitRangeEventHandler, NewWebhookEventHandler, NewQuotaEventHandler},
+	"FailedScheduling":          {NewSchedulingEventHandler, NewAutoscalerEventHandler, NewDeviceEventHandler},
+	"Failed":                    {NewImagePullEventHandler, NewContainerConfigEventHandler},
+	"BackOff":                   {NewImagePullEventHandler},
+	"FailedAttachVolume":        {NewVolumeEventHandler},
+	"FailedMount":               {NewVolumeEventHandler},
+	"Preempted":                 {NewPreemptionEventHandler},
+	"BackoffLimitExceeded":      {NewJobFailureEventHandler},
+	"DeadlineExceeded":          {NewJobFailureEventHandler, NewDeadlineEventHandler},
+	"NotTriggerScaleUp":         {NewAutoscalerEventHandler},
+	"FailedScaleUp":             {NewAutoscalerEventHandler},
+	"InsufficientCapacityError": {NewAutoscalerEventHandler},
+	"UnexpectedAdmissionError":  {NewDeviceEventHandler},
+	"Unhealthy":                 {NewProbeEventHandler},
+	"SystemOOM":                 {NewSystemOOMEventHandler},
+	"SyncLoadBalancerFailed":    {NewLoadBalancerEventHandler},
+	"UpdateLoadBalancerFailed":  {NewLoadBalancerEventHandler},
+	"DeleteLoadBalancerFailed":  {NewLoadBalancerEventHandler},
+	"FailedDeployModel":         {NewLoadBalancerEventHandler},
+	"FailedBuildModel":          {NewLoadBalancerEventHandler},
+}
+
+// RegisterKindHandler registers the handler for events about objects of a
+// kind, replacing any existing handler. Use an empty apiVersion to handle all
+// versions of a kind, which is convenient for custom resources. Handlers must
+// be registered before events are processed, typically from an init function.
+func RegisterKindHandler(apiVersion, kind string, factory EventHandlerFactory) {
+	handlerRegistry[registryKey{APIVersion: apiVersion, Kind: kind}] = factory
+}
+
+// RegisterReasonHandler adds a handler for events with a reason. Handlers
+// for a reason are applied in the order in which they were registered.
+func RegisterReasonHandler(reason string, factory EventHandlerFactory) {
+	reasonRegistry[reason] = append(reasonRegistry[reason], factory)
+}
+
+// kindHandlerFactory returns the registered handler for a kind, preferring
+// a handler for the exact API version.
+func kindHandlerFactory(apiVersion, kind string) EventHandlerFactory {
+	if factory := handlerRegistry[registryKey{APIVersion: apiVersion, Kind: kind}]; factory != nil {
+		return factory
+	}
+	return handlerRegistry[registryKey{Kind: kind}]
 }
 
 // NewEventHandler is a factory function to create the right EventHandler for an event
 func NewEventHandler(app *application, evt *v1.Event) EventHandler {
-	key := registryKey{APIVersion: evt.InvolvedObject.APIVersion, Kind: evt.InvolvedObject.Kind}
-	factory := handlerRegistry[key]
+	factory := kindHandlerFactory(evt.InvolvedObject.APIVersion, evt.InvolvedObject.Kind)
 	if factory != nil {
 		if handler := factory(app, evt); handler != nil {
 			return handler
@@ -48,3 +112,25 @@ func NewEventHandler(app *application, evt *v1.Event) EventHandler {
 	}
 	return NewDefaultEventHandler(app, evt)
 }
+
+// NewReasonEventHandlers creates the EventHandlers for the reason of an event.
+func NewReasonEventHandlers(app *application, evt *v1.Event) []EventHandler {
+	var handlers []EventHandler
+	for _, factory := range reasonRegistry[evt.Reason] {
+		if handler := factory(app, evt); handler != nil {
+			handlers = append(handlers, handler)
+		}
+	}
+	return handlers
+}
+
+// applyHandler adds the information from an EventHandler to a Sentry event.
+func applyHandler(event *sentry.Event, handler EventHandler) {
+	event.Fingerprint = append(event.Fingerprint, handler.Fingerprint()...)
+	for k, v := range handler.Tags() {
+		event.Tags[k] = v
+	}
+	if enricher, ok := handler.(EventEnricher); ok {
+		enricher.Enrich(event)
+	}
+}
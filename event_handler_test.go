@@ -0,0 +1,60 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+)
+
+type widgetEventHandler struct{}
+
+func (h widgetEventHandler) Fingerprint() []string {
+	return []string{"widget"}
+}
+
+func (h widgetEventHandler) Tags() map[string]string {
+	return map[string]string{"widget": "true"}
+}
+
+// This test modifies the registries, so it must not run in parallel.
+func TestRegisterHandlers(t *testing.T) {
+	RegisterKindHandler("", "TestWidget", func(*application, *v1.Event) EventHandler { return widgetEventHandler{} })
+	RegisterReasonHandler("TestWidgetBroken", func(*application, *v1.Event) EventHandler { return widgetEventHandler{} })
+
+	app := &application{}
+	evt := &v1.Event{
+		InvolvedObject: v1.ObjectReference{APIVersion: "example.com/v1beta1", Kind: "TestWidget", Name: "w"},
+		Reason:         "TestWidgetBroken",
+	}
+	if _, ok := NewEventHandler(app, evt).(widgetEventHandler); !ok {
+		t.Error("Kind handler not used for any API version")
+	}
+	if handlers := NewReasonEventHandlers(app, evt); len(handlers) != 1 {
+		t.Errorf("Unexpected reason handlers: %v", handlers)
+	}
+
+	evt.InvolvedObject.Kind = "Gadget"
+	if _, ok := NewEventHandler(app, evt).(*DefaultEventHandler); !ok {
+		t.Error("Default handler not used for unregistered kind")
+	}
+}
+
+func TestNodeEventHandler(t *testing.T) {
+	t.Parallel()
+
+	evt := &v1.Event{InvolvedObject: v1.ObjectReference{Kind: "Node", Name: "node-1"}}
+	handler, ok := NewEventHandler(&application{}, evt).(*NodeEventHandler)
+	if !ok {
+		t.Fatal("Node handler not used")
+	}
+	event := sentry.NewEvent()
+	applyHandler(event, handler)
+	if event.Tags["node"] != "node-1" {
+		t.Errorf("Unexpected tags: %v", event.Tags)
+	}
+	if !reflect.DeepEqual(event.Fingerprint, []string{"Node", "node-1"}) {
+		t.Errorf("Unexpected fingerprint: %v", event.Fingerprint)
+	}
+}
@@ -0,0 +1,580 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// This file implements the subset of the Common Expression Language (CEL)
+// that is needed to write event rules: literals, field selection, indexing,
+// comparison, logical operators, the in operator and the string functions
+// startsWith, endsWith, contains, matches and size. String literals support
+// the escape sequences of CEL, but not its raw or triple-quoted strings.
+
+// expression is a compiled expression.
+type expression func(vars map[string]interface{}) (interface{}, error)
+
+type token struct {
+	kind  string // ident, string, int, op or eof
+	value string
+	pos   int
+}
+
+func tokenize(source string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(source); {
+		c := rune(source[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"' || c == '\'':
+			end := i + 1
+			var value strings.Builder
+			for end < len(source) && rune(source[end]) != c {
+				if source[end] != '\\' {
+					value.WriteByte(source[end])
+					end++
+					continue
+				}
+				// CEL allows both quotes, ? and ` to be escaped in
+				// either kind of string, the other escapes match Go.
+				if end+1 < len(source) && strings.IndexByte("'\"?`", source[end+1]) != -1 {
+					value.WriteByte(source[end+1])
+					end += 2
+					continue
+				}
+				r, _, tail, err := strconv.UnquoteChar(source[end:], byte(c))
+				if err != nil {
+					return nil, fmt.Errorf("invalid escape sequence at %d", end)
+				}
+				value.WriteRune(r)
+				end = len(source) - len(tail)
+			}
+			if end >= len(source) {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			tokens = append(tokens, token{"string", value.String(), i})
+			i = end + 1
+		case unicode.IsDigit(c):
+			end := i
+			for end < len(source) && unicode.IsDigit(rune(source[end])) {
+				end++
+			}
+			tokens = append(tokens, token{"int", source[i:end], i})
+			i = end
+		case unicode.IsLetter(c) || c == '_':
+			end := i
+			for end < len(source) && (unicode.IsLetter(rune(source[end])) || unicode.IsDigit(rune(source[end])) || source[end] == '_') {
+				end++
+			}
+			tokens = append(tokens, token{"ident", source[i:end], i})
+			i = end
+		default:
+			op := ""
+			for _, candidate := range []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")", "[", "]", ",", "."} {
+				if strings.HasPrefix(source[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character '%c' at %d", c, i)
+			}
+			tokens = append(tokens, token{"op", op, i})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{"eof", "", len(source)}), nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// compileExpression parses an expression.
+func compileExpression(source string) (expression, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	expr, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != "eof" {
+		return nil, fmt.Errorf("unexpected '%s' at %d", t.value, t.pos)
+	}
+	return expr, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) accept(value string) bool {
+	if t := p.peek(); (t.kind == "op" || t.kind == "ident") && t.value == value {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(value string) error {
+	if !p.accept(value) {
+		t := p.peek()
+		return fmt.Errorf("expected '%s' at %d", value, t.pos)
+	}
+	return nil
+}
+
+func (p *parser) or() (expression, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = logical(left, right, true)
+	}
+	return left, nil
+}
+
+func (p *parser) and() (expression, error) {
+	left, err := p.relation()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.relation()
+		if err != nil {
+			return nil, err
+		}
+		left = logical(left, right, false)
+	}
+	return left, nil
+}
+
+// logical creates a short-circuiting || (or is true) or && expression.
+func logical(left, right expression, or bool) expression {
+	return func(vars map[string]interface{}) (interface{}, error) {
+		l, err := evalBool(left, vars)
+		if err != nil {
+			return nil, err
+		}
+		if l == or {
+			return l, nil
+		}
+		return evalBool(right, vars)
+	}
+}
+
+func (p *parser) relation() (expression, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">", "in"} {
+		if p.accept(op) {
+			right, err := p.unary()
+			if err != nil {
+				return nil, err
+			}
+			return compare(op, left, right), nil
+		}
+	}
+	return left, nil
+}
+
+func compare(op string, left, right expression) expression {
+	return func(vars map[string]interface{}) (interface{}, error) {
+		l, err := left(vars)
+		if err != nil {
+			return nil, err
+		}
+		r, err := right(vars)
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case "==":
+			return equal(l, r), nil
+		case "!=":
+			return !equal(l, r), nil
+		case "in":
+			return contains(r, l)
+		}
+		switch l := l.(type) {
+		case int64:
+			r, ok := r.(int64)
+			if !ok {
+				return nil, fmt.Errorf("can not compare int with %T", r)
+			}
+			return map[string]bool{"<": l < r, "<=": l <= r, ">": l > r, ">=": l >= r}[op], nil
+		case string:
+			r, ok := r.(string)
+			if !ok {
+				return nil, fmt.Errorf("can not compare string with %T", r)
+			}
+			return map[string]bool{"<": l < r, "<=": l <= r, ">": l > r, ">=": l >= r}[op], nil
+		default:
+			return nil, fmt.Errorf("can not compare %T", l)
+		}
+	}
+}
+
+func equal(l, r interface{}) bool {
+	switch l.(type) {
+	case string, int64, bool, nil:
+		return l == r
+	default:
+		return fmt.Sprint(l) == fmt.Sprint(r)
+	}
+}
+
+func contains(container, item interface{}) (interface{}, error) {
+	switch c := container.(type) {
+	case []interface{}:
+		for _, element := range c {
+			if equal(element, item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case []string:
+		for _, element := range c {
+			if element == item {
+				return true, nil
+			}
+		}
+		return false, nil
+	case map[string]string:
+		key, _ := item.(string)
+		_, ok := c[key]
+		return ok, nil
+	case map[string]interface{}:
+		key, _ := item.(string)
+		_, ok := c[key]
+		return ok, nil
+	default:
+		return nil, fmt.Errorf("'in' not supported for %T", container)
+	}
+}
+
+func (p *parser) unary() (expression, error) {
+	if p.accept("!") {
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(vars map[string]interface{}) (interface{}, error) {
+			value, err := evalBool(operand, vars)
+			return !value, err
+		}, nil
+	}
+	return p.postfix()
+}
+
+func (p *parser) postfix() (expression, error) {
+	expr, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.accept("."):
+			name := p.peek()
+			if name.kind != "ident" {
+				return nil, fmt.Errorf("expected field name at %d", name.pos)
+			}
+			p.pos++
+			if p.accept("(") {
+				args, err := p.arguments()
+				if err != nil {
+					return nil, err
+				}
+				if expr, err = method(name.value, expr, args); err != nil {
+					return nil, err
+				}
+			} else {
+				expr = index(expr, literal(name.value))
+			}
+		case p.accept("["):
+			key, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			expr = index(expr, key)
+		default:
+			return expr, nil
+		}
+	}
+}
+
+func (p *parser) arguments() ([]expression, error) {
+	var args []expression
+	if p.accept(")") {
+		return args, nil
+	}
+	for {
+		arg, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if p.accept(")") {
+			return args, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) primary() (expression, error) {
+	t := p.peek()
+	switch {
+	case t.kind == "string":
+		p.pos++
+		return literal(t.value), nil
+	case t.kind == "int":
+		p.pos++
+		value, err := strconv.ParseInt(t.value, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return literal(value), nil
+	case t.kind == "ident" && (t.value == "true" || t.value == "false"):
+		p.pos++
+		return literal(t.value == "true"), nil
+	case t.kind == "ident" && t.value == "size":
+		p.pos++
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		args, err := p.arguments()
+		if err != nil {
+			return nil, err
+		}
+		if len(args) != 1 {
+			return nil, fmt.Errorf("size expects one argument")
+		}
+		return method("size", args[0], nil)
+	case t.kind == "ident":
+		p.pos++
+		return func(vars map[string]interface{}) (interface{}, error) {
+			value, ok := vars[t.value]
+			if !ok {
+				return nil, fmt.Errorf("undeclared reference to '%s'", t.value)
+			}
+			return value, nil
+		}, nil
+	case p.accept("("):
+		expr, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return expr, p.expect(")")
+	case p.accept("["):
+		var elements []expression
+		if !p.accept("]") {
+			var err error
+			if elements, err = p.listElements(); err != nil {
+				return nil, err
+			}
+		}
+		return func(vars map[string]interface{}) (interface{}, error) {
+			list := make([]interface{}, len(elements))
+			for i, element := range elements {
+				value, err := element(vars)
+				if err != nil {
+					return nil, err
+				}
+				list[i] = value
+			}
+			return list, nil
+		}, nil
+	default:
+		return nil, fmt.Errorf("unexpected '%s' at %d", t.value, t.pos)
+	}
+}
+
+func (p *parser) listElements() ([]expression, error) {
+	var elements []expression
+	for {
+		element, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, element)
+		if p.accept("]") {
+			return elements, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func literal(value interface{}) expression {
+	return func(map[string]interface{}) (interface{}, error) {
+		return value, nil
+	}
+}
+
+func index(container, key expression) expression {
+	return func(vars map[string]interface{}) (interface{}, error) {
+		c, err := container(vars)
+		if err != nil {
+			return nil, err
+		}
+		k, err := key(vars)
+		if err != nil {
+			return nil, err
+		}
+		switch c := c.(type) {
+		case map[string]interface{}:
+			if value, ok := c[fmt.Sprint(k)]; ok {
+				return value, nil
+			}
+		case map[string]string:
+			if value, ok := c[fmt.Sprint(k)]; ok {
+				return value, nil
+			}
+		case []string:
+			if i, ok := k.(int64); ok && i >= 0 && int(i) < len(c) {
+				return c[i], nil
+			}
+		case []interface{}:
+			if i, ok := k.(int64); ok && i >= 0 && int(i) < len(c) {
+				return c[i], nil
+			}
+		}
+		return nil, fmt.Errorf("no such key: %v", k)
+	}
+}
+
+func method(name string, target expression, args []expression) (expression, error) {
+	switch name {
+	case "size":
+		if len(args) != 0 {
+			return nil, fmt.Errorf("size expects no arguments")
+		}
+		return func(vars map[string]interface{}) (interface{}, error) {
+			value, err := target(vars)
+			if err != nil {
+				return nil, err
+			}
+			switch v := value.(type) {
+			case string:
+				return int64(len(v)), nil
+			case []string:
+				return int64(len(v)), nil
+			case []interface{}:
+				return int64(len(v)), nil
+			case map[string]string:
+				return int64(len(v)), nil
+			case map[string]interface{}:
+				return int64(len(v)), nil
+			default:
+				return nil, fmt.Errorf("size not supported for %T", value)
+			}
+		}, nil
+	case "startsWith", "endsWith", "contains", "matches":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%s expects one argument", name)
+		}
+		if name == "matches" {
+			// Constant patterns, which can be evaluated without
+			// variables, are compiled once.
+			if pattern, err := args[0](nil); err == nil {
+				if pattern, ok := pattern.(string); ok {
+					re, err := regexp.Compile(pattern)
+					if err != nil {
+						return nil, fmt.Errorf("invalid regular expression for matches: %v", err)
+					}
+					return matchRegexp(target, re), nil
+				}
+			}
+		}
+		return func(vars map[string]interface{}) (interface{}, error) {
+			value, err := target(vars)
+			if err != nil {
+				return nil, err
+			}
+			arg, err := args[0](vars)
+			if err != nil {
+				return nil, err
+			}
+			s, ok1 := value.(string)
+			a, ok2 := arg.(string)
+			if !ok1 || !ok2 {
+				return nil, fmt.Errorf("%s expects strings", name)
+			}
+			switch name {
+			case "startsWith":
+				return strings.HasPrefix(s, a), nil
+			case "endsWith":
+				return strings.HasSuffix(s, a), nil
+			case "contains":
+				return strings.Contains(s, a), nil
+			default:
+				return regexp.MatchString(a, s)
+			}
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown function '%s'", name)
+	}
+}
+
+// matchRegexp returns an expression that matches target with re.
+func matchRegexp(target expression, re *regexp.Regexp) expression {
+	return func(vars map[string]interface{}) (interface{}, error) {
+		value, err := target(vars)
+		if err != nil {
+			return nil, err
+		}
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("matches expects strings")
+		}
+		return re.MatchString(s), nil
+	}
+}
+
+func evalBool(expr expression, vars map[string]interface{}) (bool, error) {
+	value, err := expr(vars)
+	if err != nil {
+		return false, err
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("expected bool, got %T", value)
+	}
+	return b, nil
+}
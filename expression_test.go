@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestExpression(t *testing.T) {
+	t.Parallel()
+
+	vars := map[string]interface{}{
+		"event": map[string]interface{}{
+			"reason": "BackOff",
+			"count":  int64(5),
+			"tags":   map[string]string{"namespace": "ci-1234"},
+		},
+	}
+	tests := []struct {
+		source string
+		result interface{}
+	}{
+		{`event.reason == "BackOff"`, true},
+		{`event.reason != 'BackOff'`, false},
+		{`event.count >= 5 && event.count < 10`, true},
+		{`event.tags["namespace"].startsWith("ci-")`, true},
+		{`event.tags.namespace.matches("^ci-[0-9]+$")`, true},
+		{`event.reason in ["Failed", "BackOff"]`, true},
+		{`"cluster" in event.tags`, false},
+		{`!("cluster" in event.tags) || event.tags.cluster == "prod"`, true},
+		{`size(event.reason) == 7 && event.reason.size() == 7`, true},
+		{`event.reason.contains("Off")`, true},
+		{`event.tags.namespace`, "ci-1234"},
+		{`event.tags.namespace.matches(event.reason)`, false},
+		{`"a\tb\x41\u00e9\'\"\101" == 'a\u0009bAé\'"A'`, true},
+	}
+	for _, test := range tests {
+		expr, err := compileExpression(test.source)
+		if err != nil {
+			t.Errorf("Error compiling %s: %v", test.source, err)
+			continue
+		}
+		result, err := expr(vars)
+		if err != nil {
+			t.Errorf("Error evaluating %s: %v", test.source, err)
+		} else if result != test.result {
+			t.Errorf("Unexpected result for %s: %v", test.source, result)
+		}
+	}
+}
+
+func TestExpressionErrors(t *testing.T) {
+	t.Parallel()
+
+	for _, source := range []string{`event.reason ==`, `"unterminated`, `event.reason.foo()`, `(true`, `1 $ 2`, `event.reason.matches("[")`, `"\q"`} {
+		if _, err := compileExpression(source); err == nil {
+			t.Errorf("No error compiling %s", source)
+		}
+	}
+
+	expr, err := compileExpression(`event.missing == "x"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := expr(map[string]interface{}{"event": map[string]interface{}{}}); err == nil {
+		t.Error("No error for missing field")
+	}
+}
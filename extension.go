@@ -0,0 +1,190 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+)
+
+// extensionProtocolVersion is the version of the request and response
+// format. It is increased for incompatible changes only.
+const extensionProtocolVersion = 1
+
+// extensionEvent is the part of a Sentry event an extension can see.
+type extensionEvent struct {
+	Message     string                 `json:"message"`
+	Level       sentry.Level           `json:"level"`
+	Tags        map[string]string      `json:"tags"`
+	Fingerprint []string               `json:"fingerprint"`
+	Extra       map[string]interface{} `json:"extra"`
+}
+
+// extensionRequest is sent to an extension for every event.
+type extensionRequest struct {
+	Version         int            `json:"version"`
+	Event           extensionEvent `json:"event"`
+	KubernetesEvent *v1.Event      `json:"kubernetesEvent"`
+}
+
+// extensionResponse describes the changes an extension makes to an event.
+// All fields are optional.
+type extensionResponse struct {
+	Drop        bool                   `json:"drop"`
+	Level       sentry.Level           `json:"level"`
+	Tags        map[string]string      `json:"tags"`
+	Fingerprint []string               `json:"fingerprint"`
+	Extra       map[string]interface{} `json:"extra"`
+}
+
+// extension is a program or HTTP endpoint outside of k8s-sentry that can
+// enrich or drop events.
+type extension interface {
+	Call(ctx context.Context, request []byte) ([]byte, error)
+	String() string
+}
+
+// execExtension runs a command for every event. The request is written to
+// its standard input, and the response read from its standard output.
+type execExtension struct {
+	command []string
+}
+
+func (e execExtension) String() string {
+	return strings.Join(e.command, " ")
+}
+
+func (e execExtension) Call(ctx context.Context, request []byte) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, e.command[0], e.command[1:]...)
+	cmd.Stdin = bytes.NewReader(request)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s", err, truncate(strings.TrimSpace(stderr.String()), 200))
+	}
+	return output, nil
+}
+
+// httpExtension POSTs every event to a URL.
+type httpExtension struct {
+	url    string
+	client *http.Client
+}
+
+func (e httpExtension) String() string {
+	return e.url
+}
+
+func (e httpExtension) Call(ctx context.Context, request []byte) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(request))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return body, nil
+}
+
+// parseExtensions parses a comma-separated list of extensions. Entries
+// starting with http:// or https:// are URLs, all others are commands with
+// space-separated arguments.
+func parseExtensions(value string) []extension {
+	var extensions []extension
+	for _, item := range parseList(value) {
+		if strings.HasPrefix(item, "http://") || strings.HasPrefix(item, "https://") {
+			extensions = append(extensions, httpExtension{url: item, client: &http.Client{}})
+		} else {
+			extensions = append(extensions, execExtension{command: strings.Fields(item)})
+		}
+	}
+	return extensions
+}
+
+// applyExtensions calls all extensions for an event, in order. It returns
+// false if an extension drops the event. Extensions that fail are logged and
+// otherwise ignored, so a broken extension never stops events from being
+// reported.
+func applyExtensions(extensions []extension, timeout time.Duration, sentryEvent *sentry.Event, evt *v1.Event) bool {
+	for _, ext := range extensions {
+		request, err := json.Marshal(extensionRequest{
+			Version: extensionProtocolVersion,
+			Event: extensionEvent{
+				Message:     sentryEvent.Message,
+				Level:       sentryEvent.Level,
+				Tags:        sentryEvent.Tags,
+				Fingerprint: sentryEvent.Fingerprint,
+				Extra:       sentryEvent.Extra,
+			},
+			KubernetesEvent: evt,
+		})
+		if err != nil {
+			logger.Warning("Unable to encode extension request", eventFields(evt, "error", err)...)
+			return true
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		output, err := ext.Call(ctx, request)
+		cancel()
+		if err != nil {
+			logger.Warning("Extension failed", eventFields(evt, "extension", ext.String(), "error", err)...)
+			continue
+		}
+
+		var response extensionResponse
+		if len(bytes.TrimSpace(output)) > 0 {
+			if err := json.Unmarshal(output, &response); err != nil {
+				logger.Warning("Invalid extension response", eventFields(evt, "extension", ext.String(), "error", err)...)
+				continue
+			}
+		}
+		if response.Drop {
+			return false
+		}
+		if response.Level != "" {
+			sentryEvent.Level = response.Level
+		}
+		copyTags(sentryEvent, response.Tags)
+		if len(response.Fingerprint) > 0 {
+			sentryEvent.Fingerprint = response.Fingerprint
+		}
+		for k, v := range response.Extra {
+			sentryEvent.Extra[k] = v
+		}
+	}
+	return true
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestParseExtensions(t *testing.T) {
+	t.Parallel()
+
+	extensions := parseExtensions("https://hooks.example.com/k8s, /usr/local/bin/enrich --verbose")
+	if len(extensions) != 2 {
+		t.Fatalf("Unexpected number of extensions: %d", len(extensions))
+	}
+	if _, ok := extensions[0].(httpExtension); !ok {
+		t.Errorf("First extension is not an HTTP extension: %T", extensions[0])
+	}
+	if e, ok := extensions[1].(execExtension); !ok || len(e.command) != 2 {
+		t.Errorf("Unexpected second extension: %#v", extensions[1])
+	}
+}
+
+func TestApplyExtensions(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request extensionRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Error(err)
+		}
+		if request.Version != extensionProtocolVersion || request.KubernetesEvent.Reason != "BackOff" {
+			t.Errorf("Unexpected request: %+v", request)
+		}
+		response := extensionResponse{
+			Tags:  map[string]string{"team": "payments"},
+			Extra: map[string]interface{}{"runbook": "https://runbooks.example.com/backoff"},
+		}
+		if request.Event.Tags["namespace"] == "ci" {
+			response.Drop = true
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	extensions := []extension{httpExtension{url: server.URL, client: server.Client()}}
+	evt := &v1.Event{Reason: "BackOff"}
+	sentryEvent := sentry.NewEvent()
+	sentryEvent.Level = sentry.LevelWarning
+	if !applyExtensions(extensions, time.Second, sentryEvent, evt) {
+		t.Fatal("Event dropped")
+	}
+	if sentryEvent.Tags["team"] != "payments" || sentryEvent.Extra["runbook"] == nil {
+		t.Errorf("Event not enriched: %+v", sentryEvent)
+	}
+	if sentryEvent.Level != sentry.LevelWarning {
+		t.Errorf("Unexpected level: %s", sentryEvent.Level)
+	}
+
+	sentryEvent = sentry.NewEvent()
+	sentryEvent.Tags["namespace"] = "ci"
+	if applyExtensions(extensions, time.Second, sentryEvent, evt) {
+		t.Error("Event not dropped")
+	}
+}
+
+func TestApplyExtensionsFailure(t *testing.T) {
+	t.Parallel()
+
+	extensions := []extension{execExtension{command: []string{"/nonexistent/extension"}}}
+	if !applyExtensions(extensions, time.Second, sentry.NewEvent(), &v1.Event{}) {
+		t.Error("Event dropped by failing extension")
+	}
+}
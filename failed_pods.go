@@ -0,0 +1,113 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// failedPodHandlers returns the pod handlers that report pods entering the
+// Failed phase.
+func (app *application) failedPodHandlers() cache.ResourceEventHandler {
+	return recoverHandlers("failed pod monitor", cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldPod, ok := oldObj.(*v1.Pod)
+			if !ok {
+				return
+			}
+			pod, ok := newObj.(*v1.Pod)
+			if !ok || oldPod.Status.Phase == v1.PodFailed || pod.Status.Phase != v1.PodFailed || !app.watchedNamespace(pod.Namespace) {
+				return
+			}
+			logger.Info("Reporting failed pod", "namespace", pod.Namespace, "pod", pod.Name, "reason", pod.Status.Reason)
+			app.reportMonitorEvent(app.newFailedPodEvent(pod), objectReference("Pod", pod), "pod-failed/"+string(pod.UID))
+		},
+	})
+}
+
+// newFailedPodEvent creates a Sentry event for a pod that entered the Failed
+// phase.
+func (app *application) newFailedPodEvent(pod *v1.Pod) *sentry.Event {
+	workload := podWorkload(pod)
+	reason := pod.Status.Reason
+	if reason == "" {
+		reason = string(v1.PodFailed)
+	}
+
+	sentryEvent := app.newBaseEvent(pod.Namespace)
+	sentryEvent.Level = sentry.LevelError
+	sentryEvent.Message = fmt.Sprintf("Pod/%s: %s", pod.Name, failedPodMessage(pod))
+	sentryEvent.Fingerprint = []string{"pod-failed", pod.Namespace, workload, reason}
+	sentryEvent.User = podUser(pod)
+	sentryEvent.Tags["kind"] = "Pod"
+	sentryEvent.Tags["reason"] = reason
+	sentryEvent.Tags["workload"] = workload
+	if pod.Spec.NodeName != "" {
+		sentryEvent.Tags["node"] = pod.Spec.NodeName
+	}
+	sentryEvent.Extra["pod"] = pod.Name
+	if pod.Status.Message != "" {
+		sentryEvent.Extra["status-message"] = pod.Status.Message
+	}
+	if states := containerStates(pod); len(states) > 0 {
+		sentryEvent.Extra["containers"] = states
+	}
+	if restarts := restartHistory(pod, "", app.restarts); len(restarts) > 0 {
+		sentryEvent.Extra["restart-history"] = restarts
+	}
+	return sentryEvent
+}
+
+// failedPodMessage describes why a pod failed, using the pod status or the
+// first container that terminated with an error.
+func failedPodMessage(pod *v1.Pod) string {
+	if pod.Status.Message != "" {
+		return pod.Status.Message
+	}
+	statuses := append(append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if terminated := status.State.Terminated; terminated != nil && terminated.ExitCode != 0 {
+			return fmt.Sprintf("container %s terminated with exit code %d (%s)", status.Name, terminated.ExitCode, terminated.Reason)
+		}
+	}
+	return "pod failed"
+}
+
+// containerStates describes the state of every container in a pod.
+func containerStates(pod *v1.Pod) map[string]string {
+	states := make(map[string]string)
+	statuses := append(append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		switch {
+		case status.State.Terminated != nil:
+			terminated := status.State.Terminated
+			state := fmt.Sprintf("terminated: %s (exit code %d)", terminated.Reason, terminated.ExitCode)
+			if terminated.Message != "" {
+				state += ": " + terminated.Message
+			}
+			states[status.Name] = state
+		case status.State.Waiting != nil:
+			states[status.Name] = "waiting: " + status.State.Waiting.Reason
+		case status.State.Running != nil:
+			states[status.Name] = "running"
+		}
+	}
+	return states
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewFailedPodEvent(t *testing.T) {
+	t.Parallel()
+
+	app := &application{}
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "batch-x2x"},
+		Spec:       v1.PodSpec{NodeName: "node-1"},
+		Status: v1.PodStatus{
+			Phase: v1.PodFailed,
+			InitContainerStatuses: []v1.ContainerStatus{
+				{Name: "migrate", State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: "Completed"}}},
+			},
+			ContainerStatuses: []v1.ContainerStatus{
+				{Name: "main", State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: "Error", ExitCode: 2}}},
+				{Name: "proxy", State: v1.ContainerState{Running: &v1.ContainerStateRunning{}}},
+			},
+		},
+	}
+
+	event := app.newFailedPodEvent(pod)
+	if event.Message != "Pod/batch-x2x: container main terminated with exit code 2 (Error)" {
+		t.Errorf("unexpected message: %s", event.Message)
+	}
+	if !reflect.DeepEqual(event.Fingerprint, []string{"pod-failed", "shop", "Pod/batch-x2x", "Failed"}) {
+		t.Errorf("unexpected fingerprint: %v", event.Fingerprint)
+	}
+	if event.Tags["node"] != "node-1" || event.Tags["reason"] != "Failed" {
+		t.Errorf("unexpected tags: %v", event.Tags)
+	}
+	expected := map[string]string{
+		"migrate": "terminated: Completed (exit code 0)",
+		"main":    "terminated: Error (exit code 2)",
+		"proxy":   "running",
+	}
+	if !reflect.DeepEqual(event.Extra["containers"], expected) {
+		t.Errorf("unexpected container states: %v", event.Extra["containers"])
+	}
+}
+
+func TestFailedPodMessageStatus(t *testing.T) {
+	t.Parallel()
+
+	pod := &v1.Pod{Status: v1.PodStatus{
+		Phase:   v1.PodFailed,
+		Reason:  "Evicted",
+		Message: "The node was low on resource: memory.",
+	}}
+	if msg := failedPodMessage(pod); msg != pod.Status.Message {
+		t.Errorf("unexpected message: %s", msg)
+	}
+	if msg := failedPodMessage(&v1.Pod{}); msg != "pod failed" {
+		t.Errorf("unexpected message: %s", msg)
+	}
+}
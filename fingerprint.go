@@ -0,0 +1,68 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+)
+
+// Fingerprint strategies determine how events are grouped into issues.
+const (
+	// fingerprintObject creates an issue per involved object, or per
+	// controller for pods.
+	fingerprintObject = "object"
+	// fingerprintWorkload creates an issue per workload, such as a
+	// Deployment, combining all of its pods.
+	fingerprintWorkload = "workload"
+	// fingerprintReason creates a single issue per event reason for the
+	// whole cluster.
+	fingerprintReason = "reason"
+)
+
+func validateFingerprintStrategy(strategy string) error {
+	switch strategy {
+	case fingerprintObject, fingerprintWorkload, fingerprintReason:
+		return nil
+	default:
+		return fmt.Errorf("invalid fingerprint strategy '%s', expected object, workload or reason", strategy)
+	}
+}
+
+// applyFingerprintStrategy changes the fingerprint of an event for the
+// workload and reason strategies. Fingerprints that were replaced by an
+// event handler, for example to group webhook failures by webhook, are left
+// alone.
+func applyFingerprintStrategy(strategy string, event *sentry.Event, evt *v1.Event) {
+	fingerprint := event.Fingerprint
+	if strategy == fingerprintObject || len(fingerprint) < 4 ||
+		fingerprint[0] != eventComponent(evt) || fingerprint[1] != evt.Type || fingerprint[2] != evt.Reason {
+		return
+	}
+
+	switch strategy {
+	case fingerprintWorkload:
+		workload := event.Tags["workload"]
+		if workload == "" {
+			workload = evt.InvolvedObject.Kind + "/" + evt.InvolvedObject.Name
+		}
+		event.Fingerprint = append(fingerprint[:4:4], evt.InvolvedObject.Namespace, workload)
+	case fingerprintReason:
+		event.Fingerprint = []string{"reason", evt.Type, evt.Reason}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestApplyFingerprintStrategy(t *testing.T) {
+	t.Parallel()
+
+	evt := &v1.Event{
+		InvolvedObject: v1.ObjectReference{Kind: "Pod", Namespace: "shop", Name: "web-5d9c7-x2x"},
+		Source:         v1.EventSource{Component: "kubelet"},
+		Type:           v1.EventTypeWarning,
+		Reason:         "BackOff",
+		Message:        "Back-off restarting failed container",
+	}
+	newEvent := func() *sentry.Event {
+		event := sentry.NewEvent()
+		event.Fingerprint = []string{"kubelet", "Warning", "BackOff", evt.Message, "apps/v1", "ReplicaSet", "web-5d9c7"}
+		event.Tags["workload"] = "Deployment/web"
+		return event
+	}
+
+	tests := []struct {
+		strategy    string
+		fingerprint []string
+	}{
+		{fingerprintObject, []string{"kubelet", "Warning", "BackOff", evt.Message, "apps/v1", "ReplicaSet", "web-5d9c7"}},
+		{fingerprintWorkload, []string{"kubelet", "Warning", "BackOff", evt.Message, "shop", "Deployment/web"}},
+		{fingerprintReason, []string{"reason", "Warning", "BackOff"}},
+	}
+	for _, test := range tests {
+		event := newEvent()
+		applyFingerprintStrategy(test.strategy, event, evt)
+		if !reflect.DeepEqual(event.Fingerprint, test.fingerprint) {
+			t.Errorf("Unexpected fingerprint for %s: %v", test.strategy, event.Fingerprint)
+		}
+	}
+
+	event := newEvent()
+	event.Fingerprint = []string{"admission-webhook", "policy.example.com", "shop"}
+	applyFingerprintStrategy(fingerprintReason, event, evt)
+	if event.Fingerprint[0] != "admission-webhook" {
+		t.Errorf("Handler fingerprint replaced: %v", event.Fingerprint)
+	}
+
+	if err := validateFingerprintStrategy("namespace"); err == nil {
+		t.Error("No error for invalid strategy")
+	}
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+)
+
+// isNodeReadyTransition returns true for the events emitted when a node
+// becomes ready or not ready. Both are normal events.
+func isNodeReadyTransition(evt *v1.Event) bool {
+	return evt.InvolvedObject.Kind == "Node" && (evt.Reason == "NodeReady" || evt.Reason == "NodeNotReady")
+}
+
+// nodeReadiness is the readiness history of a node.
+type nodeReadiness struct {
+	ready       bool
+	transitions []time.Time
+}
+
+// flapDetector detects nodes that keep switching between ready and not
+// ready. A node is flapping when it changes state threshold times within
+// window.
+type flapDetector struct {
+	threshold int
+	window    time.Duration
+
+	lock  sync.Mutex
+	nodes map[string]*nodeReadiness
+}
+
+func newFlapDetector(threshold int, window time.Duration) *flapDetector {
+	return &flapDetector{threshold: threshold, window: window, nodes: make(map[string]*nodeReadiness)}
+}
+
+// Record records the readiness of a node. If the node is flapping it
+// returns the times of the transitions, and starts counting again.
+func (d *flapDetector) Record(node string, ready bool, now time.Time) []time.Time {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	readiness := d.nodes[node]
+	if readiness == nil {
+		d.nodes[node] = &nodeReadiness{ready: ready}
+		return nil
+	}
+	if readiness.ready == ready {
+		return nil
+	}
+	readiness.ready = ready
+
+	since := now.Add(-d.window)
+	transitions := readiness.transitions[:0]
+	for _, transition := range readiness.transitions {
+		if transition.After(since) {
+			transitions = append(transitions, transition)
+		}
+	}
+	readiness.transitions = append(transitions, now)
+	if len(readiness.transitions) < d.threshold {
+		return nil
+	}
+	flaps := readiness.transitions
+	readiness.transitions = nil
+	return flaps
+}
+
+func (app *application) newNodeFlappingEvent(node string, transitions []time.Time) *sentry.Event {
+	sentryEvent := app.newBaseEvent("")
+	sentryEvent.Level = sentry.LevelError
+	sentryEvent.Message = fmt.Sprintf("Node/%s: node is flapping, %d ready transitions within %s", node, len(transitions), app.flaps.window)
+	sentryEvent.Fingerprint = []string{"node-flapping", node}
+	sentryEvent.Tags["kind"] = "Node"
+	sentryEvent.Tags["reason"] = "NodeFlapping"
+	sentryEvent.Tags["node"] = node
+	sentryEvent.Tags["node.flaps"] = strconv.Itoa(len(transitions))
+	var times []string
+	for _, transition := range transitions {
+		times = append(times, transition.UTC().Format(time.RFC3339))
+	}
+	sentryEvent.Extra["transitions"] = times
+	sentryEvent.Extra["window"] = app.flaps.window.String()
+	if app.nodes != nil {
+		app.nodes.Enrich(sentryEvent, node, time.Now())
+	}
+	return sentryEvent
+}
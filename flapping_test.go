@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFlapDetector(t *testing.T) {
+	t.Parallel()
+
+	d := newFlapDetector(3, 10*time.Minute)
+	now := time.Now()
+	if d.Record("node-1", true, now) != nil || d.Record("node-1", true, now.Add(time.Minute)) != nil {
+		t.Error("Flapping without transitions")
+	}
+	if d.Record("node-1", false, now.Add(2*time.Minute)) != nil || d.Record("node-1", true, now.Add(3*time.Minute)) != nil {
+		t.Error("Flapping below threshold")
+	}
+	if d.Record("node-2", false, now.Add(3*time.Minute)) != nil {
+		t.Error("Flapping for other node")
+	}
+	if flaps := d.Record("node-1", false, now.Add(4*time.Minute)); len(flaps) != 3 {
+		t.Errorf("Expected 3 flaps, got %v", flaps)
+	}
+	// Counting starts again after a report, and old transitions expire.
+	if d.Record("node-1", true, now.Add(5*time.Minute)) != nil || d.Record("node-1", false, now.Add(6*time.Minute)) != nil {
+		t.Error("Flapping reported again too soon")
+	}
+	if d.Record("node-1", true, now.Add(20*time.Minute)) != nil {
+		t.Error("Expired transitions counted")
+	}
+}
+
+func TestProcessEventNodeFlapping(t *testing.T) {
+	t.Parallel()
+
+	app := &application{flaps: newFlapDetector(2, 10*time.Minute)}
+	now := time.Now()
+	for i, reason := range []string{"NodeReady", "NodeNotReady", "NodeReady"} {
+		evt := &v1.Event{
+			InvolvedObject: v1.ObjectReference{Kind: "Node", Name: "node-1"},
+			Type:           v1.EventTypeNormal,
+			Reason:         reason,
+			LastTimestamp:  metav1.NewTime(now.Add(time.Duration(i) * time.Minute)),
+		}
+		sentryEvent, cause := app.processEvent(evt)
+		if i < 2 && sentryEvent != nil {
+			t.Errorf("Transition %d reported", i)
+		}
+		if i == 2 {
+			if sentryEvent == nil {
+				t.Fatalf("Flapping not reported: %s", cause)
+			}
+			if sentryEvent.Tags["node.flaps"] != "2" || sentryEvent.Fingerprint[0] != "node-flapping" || sentryEvent.Level != "error" {
+				t.Errorf("Unexpected event %+v", sentryEvent)
+			}
+		}
+	}
+}
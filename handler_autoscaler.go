@@ -0,0 +1,225 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+)
+
+// pendingPodsTTL is how long the summary of pending pods is cached. Capacity
+// problems cause events for every pending pod, so this avoids listing all
+// pending pods for each of them.
+const pendingPodsTTL = 30 * time.Second
+
+var (
+	autoscalerCausesRegexp = regexp.MustCompile(`(?:didn't trigger scale-up|scale-up)[^:]*: (.+)$`)
+	quotedRegexp           = regexp.MustCompile(`"[^"]*"`)
+	bracedRegexp           = regexp.MustCompile(`\{[^}]*\}`)
+	numberRegexp           = regexp.MustCompile(`\d+`)
+)
+
+// isCapacityFailure returns true for events from the cluster autoscaler that
+// are reported as Normal events even though pods can not be scheduled.
+func isCapacityFailure(evt *v1.Event) bool {
+	return evt.Reason == "NotTriggerScaleUp"
+}
+
+// AutoscalerEventHandler handles capacity failures reported by the cluster
+// autoscaler or Karpenter. Every pending pod generates such events, so they
+// are grouped by cause for the whole cluster.
+type AutoscalerEventHandler struct {
+	Event       *v1.Event
+	Autoscaler  string
+	Causes      []string
+	PendingPods int
+	Requests    v1.ResourceList
+}
+
+// Fingerprint returns the fingerprint entries that are specific for an event type
+func (h AutoscalerEventHandler) Fingerprint() []string {
+	return nil
+}
+
+// Tags returns a set of tags that should be added to the event
+func (h AutoscalerEventHandler) Tags() map[string]string {
+	return map[string]string{
+		"autoscaler":        h.Autoscaler,
+		"autoscaler.causes": truncate(strings.Join(h.Causes, ", "), 200),
+	}
+}
+
+// Enrich groups the event by autoscaler, reason and causes, and adds the
+// total resources requested by pending pods.
+func (h AutoscalerEventHandler) Enrich(event *sentry.Event) {
+	if event.Level == sentry.LevelInfo {
+		event.Level = sentry.LevelWarning
+	}
+	event.Fingerprint = append([]string{"autoscaler", h.Autoscaler, h.Event.Reason}, h.Causes...)
+	if h.Requests == nil {
+		return
+	}
+	requests := make(map[string]string)
+	for name, quantity := range h.Requests {
+		requests[string(name)] = quantity.String()
+	}
+	event.Extra["pending-pods"] = h.PendingPods
+	event.Extra["pending-requests"] = requests
+}
+
+// NewAutoscalerEventHandler creates a new AutoscalerEventHandler instance if
+// the event was reported by an autoscaler.
+func NewAutoscalerEventHandler(app *application, evt *v1.Event) EventHandler {
+	autoscaler := "cluster-autoscaler"
+	if strings.Contains(strings.ToLower(evt.Source.Component), "karpenter") {
+		autoscaler = "karpenter"
+	} else if evt.Reason == "FailedScheduling" {
+		return nil
+	}
+	handler := &AutoscalerEventHandler{
+		Event:      evt,
+		Autoscaler: autoscaler,
+		Causes:     autoscalerCauses(evt.Message),
+	}
+	if app.pendingPods != nil {
+		handler.PendingPods, handler.Requests = app.pendingPods.Summary(time.Now())
+	}
+	return handler
+}
+
+// autoscalerCauses extracts the causes from an autoscaler message, without
+// node counts and object names.
+func autoscalerCauses(message string) []string {
+	if match := autoscalerCausesRegexp.FindStringSubmatch(message); match != nil {
+		causes := make(map[string]bool)
+		for _, part := range strings.Split(strings.TrimSuffix(match[1], "."), ", ") {
+			if cause := schedulingCauseRegexp.FindStringSubmatch(part); cause != nil {
+				part = cause[2]
+			}
+			if part = strings.TrimSpace(part); part != "" {
+				causes[part] = true
+			}
+		}
+		result := make([]string, 0, len(causes))
+		for cause := range causes {
+			result = append(result, cause)
+		}
+		sort.Strings(result)
+		return result
+	}
+
+	message = quotedRegexp.ReplaceAllString(message, `"*"`)
+	message = bracedRegexp.ReplaceAllString(message, "{...}")
+	return []string{numberRegexp.ReplaceAllString(message, "N")}
+}
+
+// pendingPodCache summarises the pods that can not be scheduled.
+type pendingPodCache struct {
+	list func() ([]v1.Pod, error)
+
+	lock     sync.Mutex
+	fetched  time.Time
+	count    int
+	requests v1.ResourceList
+}
+
+func newPendingPodCache(clientset *kubernetes.Clientset, namespace string) *pendingPodCache {
+	return &pendingPodCache{
+		list: func() ([]v1.Pod, error) {
+			pods, err := clientset.CoreV1().Pods(namespace).List(metav1.ListOptions{
+				FieldSelector: fields.OneTermEqualSelector("status.phase", string(v1.PodPending)).String(),
+			})
+			if err != nil {
+				return nil, err
+			}
+			return pods.Items, nil
+		},
+	}
+}
+
+// Summary returns the number of unschedulable pods, and the total of their
+// resource requests.
+func (c *pendingPodCache) Summary(now time.Time) (int, v1.ResourceList) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if now.Sub(c.fetched) < pendingPodsTTL {
+		return c.count, c.requests
+	}
+	pods, err := c.list()
+	if err != nil {
+		logger.Debug("Unable to list pending pods", "error", err)
+		return 0, nil
+	}
+	c.fetched = now
+	c.count, c.requests = summarizeUnschedulablePods(pods)
+	return c.count, c.requests
+}
+
+// summarizeUnschedulablePods counts the pods that the scheduler could not
+// place, and adds up their resource requests.
+func summarizeUnschedulablePods(pods []v1.Pod) (int, v1.ResourceList) {
+	count := 0
+	requests := v1.ResourceList{}
+	for _, pod := range pods {
+		unschedulable := false
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == v1.PodScheduled && condition.Status == v1.ConditionFalse && condition.Reason == v1.PodReasonUnschedulable {
+				unschedulable = true
+			}
+		}
+		if !unschedulable {
+			continue
+		}
+		count++
+		for _, container := range pod.Spec.Containers {
+			for name, quantity := range container.Resources.Requests {
+				total, ok := requests[name]
+				if !ok {
+					total = resource.Quantity{Format: quantity.Format}
+				}
+				total.Add(quantity)
+				requests[name] = total
+			}
+		}
+	}
+	return count, requests
+}
+
+// autoscalerAccessChecks returns the access checks for the
+// AutoscalerEventHandler, which lists the pending pods.
+func autoscalerAccessChecks(app *application) []accessCheck {
+	if app.pendingPods == nil {
+		return nil
+	}
+	return []accessCheck{{
+		resource:  "pods",
+		namespace: app.namespace,
+		list: func(options metav1.ListOptions) error {
+			_, err := app.clientset.CoreV1().Pods(app.namespace).List(options)
+			return err
+		},
+	}}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestAutoscalerCauses(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		message string
+		causes  []string
+	}{
+		{
+			"pod didn't trigger scale-up (it wouldn't fit if a new node is added): 2 max node group size reached, 1 Insufficient memory",
+			[]string{"Insufficient memory", "max node group size reached"},
+		},
+		{
+			"pod didn't trigger scale-up: 3 node(s) didn't match node selector",
+			[]string{"node(s) didn't match node selector"},
+		},
+		{
+			`Failed to schedule pod, incompatible with nodepool "default", daemonset overhead={"cpu":"150m","pods":"3"}, no instance type satisfied resources {"cpu":"12","pods":"4"}`,
+			[]string{`Failed to schedule pod, incompatible with nodepool "*", daemonset overhead={...}, no instance type satisfied resources {...}`},
+		},
+	}
+	for _, test := range tests {
+		if causes := autoscalerCauses(test.message); !reflect.DeepEqual(causes, test.causes) {
+			t.Errorf("Unexpected causes for %s: %q", test.message, causes)
+		}
+	}
+}
+
+func TestNewAutoscalerEventHandler(t *testing.T) {
+	t.Parallel()
+
+	evt := &v1.Event{Reason: "FailedScheduling", Source: v1.EventSource{Component: "default-scheduler"}}
+	if NewAutoscalerEventHandler(&application{}, evt) != nil {
+		t.Error("Handler created for scheduler event")
+	}
+
+	evt = &v1.Event{
+		Type:    v1.EventTypeNormal,
+		Reason:  "NotTriggerScaleUp",
+		Message: "pod didn't trigger scale-up: 1 Insufficient cpu",
+		Source:  v1.EventSource{Component: "cluster-autoscaler"},
+	}
+	if !isCapacityFailure(evt) {
+		t.Error("NotTriggerScaleUp not recognised")
+	}
+	handler := NewAutoscalerEventHandler(&application{}, evt)
+	event := sentry.NewEvent()
+	event.Level = sentry.LevelInfo
+	applyHandler(event, handler)
+	if event.Level != sentry.LevelWarning {
+		t.Errorf("Unexpected level: %s", event.Level)
+	}
+	if !reflect.DeepEqual(event.Fingerprint, []string{"autoscaler", "cluster-autoscaler", "NotTriggerScaleUp", "Insufficient cpu"}) {
+		t.Errorf("Unexpected fingerprint: %v", event.Fingerprint)
+	}
+}
+
+func TestPendingPodCache(t *testing.T) {
+	t.Parallel()
+
+	unschedulable := v1.PodStatus{Conditions: []v1.PodCondition{{Type: v1.PodScheduled, Status: v1.ConditionFalse, Reason: v1.PodReasonUnschedulable}}}
+	requests := func(cpu, memory string) v1.PodSpec {
+		return v1.PodSpec{Containers: []v1.Container{{Resources: v1.ResourceRequirements{Requests: v1.ResourceList{
+			v1.ResourceCPU:    resource.MustParse(cpu),
+			v1.ResourceMemory: resource.MustParse(memory),
+		}}}}}
+	}
+	calls := 0
+	cache := &pendingPodCache{list: func() ([]v1.Pod, error) {
+		calls++
+		return []v1.Pod{
+			{Spec: requests("500m", "1Gi"), Status: unschedulable},
+			{Spec: requests("1500m", "512Mi"), Status: unschedulable},
+			{Spec: requests("4", "8Gi")},
+		}, nil
+	}}
+
+	now := time.Now()
+	count, total := cache.Summary(now)
+	if count != 2 {
+		t.Errorf("Unexpected number of pending pods: %d", count)
+	}
+	if cpu := total[v1.ResourceCPU]; cpu.String() != "2" {
+		t.Errorf("Unexpected CPU requests: %s", cpu.String())
+	}
+	if memory := total[v1.ResourceMemory]; memory.String() != "1536Mi" {
+		t.Errorf("Unexpected memory requests: %s", memory.String())
+	}
+
+	cache.Summary(now.Add(10 * time.Second))
+	cache.Summary(now.Add(time.Minute))
+	if calls != 2 {
+		t.Errorf("Unexpected number of list calls: %d", calls)
+	}
+}
@@ -0,0 +1,235 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// certManagerGroups are the API groups of cert-manager resources, including
+// the group used before cert-manager 0.11.
+var certManagerGroups = map[string]bool{
+	"cert-manager.io":      true,
+	"acme.cert-manager.io": true,
+	"certmanager.k8s.io":   true,
+}
+
+// certManagerResources maps the kinds of cert-manager resources to their
+// resource names.
+var certManagerResources = map[string]string{
+	"Certificate":        "certificates",
+	"CertificateRequest": "certificaterequests",
+	"Order":              "orders",
+	"Challenge":          "challenges",
+	"Issuer":             "issuers",
+	"ClusterIssuer":      "clusterissuers",
+}
+
+// certManagerCertificateAnnotation is set by cert-manager on
+// CertificateRequests, with the name of their Certificate.
+const certManagerCertificateAnnotation = "cert-manager.io/certificate-name"
+
+// certManagerObject contains the fields of cert-manager resources that are
+// used to enrich events.
+type certManagerObject struct {
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              struct {
+		CommonName string   `json:"commonName"`
+		DNSNames   []string `json:"dnsNames"`
+		DNSName    string   `json:"dnsName"`
+		IssuerRef  struct {
+			Name string `json:"name"`
+			Kind string `json:"kind"`
+		} `json:"issuerRef"`
+	} `json:"spec"`
+	Status struct {
+		NotAfter *metav1.Time `json:"notAfter"`
+	} `json:"status"`
+}
+
+// CertManagerEventHandler handles failure events of cert-manager resources.
+// Failures of CertificateRequests, Orders and Challenges are grouped by the
+// Certificate they belong to when it is known. A failed renewal becomes more
+// urgent as the certificate approaches its expiry, so it is reported as an
+// error once the certificate expires within CERT_EXPIRY_ERROR.
+type CertManagerEventHandler struct {
+	Event       *v1.Event
+	Certificate string
+	Issuer      string
+	DNSNames    []string
+	NotAfter    time.Time
+	ErrorWithin time.Duration
+}
+
+// Fingerprint returns the fingerprint entries that are specific for an event type
+func (h CertManagerEventHandler) Fingerprint() []string {
+	return DefaultEventHandler{Event: h.Event}.Fingerprint()
+}
+
+// Tags returns a set of tags that should be added to the event
+func (h CertManagerEventHandler) Tags() map[string]string {
+	tags := map[string]string{}
+	if h.Certificate != "" {
+		tags["certificate"] = h.Event.InvolvedObject.Namespace + "/" + h.Certificate
+	}
+	if h.Issuer != "" {
+		tags["issuer"] = h.Issuer
+	}
+	if len(h.DNSNames) > 0 {
+		tags["dns-names"] = truncate(strings.Join(h.DNSNames, ","), 200)
+	}
+	return tags
+}
+
+// Enrich groups the event by certificate, or by issuer for events about
+// issuers, and raises the level when the certificate is about to expire.
+func (h CertManagerEventHandler) Enrich(event *sentry.Event) {
+	switch {
+	case h.Certificate != "":
+		event.Fingerprint = []string{"cert-manager", h.Event.InvolvedObject.Namespace, h.Certificate, h.Event.Reason}
+	case h.Event.InvolvedObject.Kind == "Issuer" || h.Event.InvolvedObject.Kind == "ClusterIssuer":
+		event.Fingerprint = []string{"cert-manager", h.Event.InvolvedObject.Kind, h.Event.InvolvedObject.Namespace, h.Event.InvolvedObject.Name, h.Event.Reason}
+	}
+	if len(h.DNSNames) > 0 {
+		event.Extra["dns-names"] = h.DNSNames
+	}
+	if h.NotAfter.IsZero() {
+		return
+	}
+	event.Extra["not-after"] = h.NotAfter.UTC().Format(time.RFC3339)
+	if h.ErrorWithin > 0 && time.Until(h.NotAfter) < h.ErrorWithin {
+		event.Level = sentry.LevelError
+		event.Tags["certificate.expiring"] = "true"
+	}
+}
+
+// NewCertManagerEventHandler creates a new CertManagerEventHandler instance
+// for warning events about cert-manager resources. The resources are read
+// to find the Certificate, issuer and DNS names.
+func NewCertManagerEventHandler(app *application, evt *v1.Event) EventHandler {
+	group := evt.InvolvedObject.APIVersion
+	if i := strings.Index(group, "/"); i != -1 {
+		group = group[:i]
+	}
+	if !certManagerGroups[group] || evt.Type != v1.EventTypeWarning {
+		return nil
+	}
+
+	handler := &CertManagerEventHandler{Event: evt, ErrorWithin: app.certExpiryError}
+	kind := evt.InvolvedObject.Kind
+	switch kind {
+	case "Certificate":
+		handler.Certificate = evt.InvolvedObject.Name
+	case "Issuer", "ClusterIssuer":
+		handler.Issuer = kind + "/" + evt.InvolvedObject.Name
+	}
+	if app.clientset == nil {
+		return handler
+	}
+
+	obj := getCertManagerObject(app, evt.InvolvedObject.APIVersion, kind, evt.InvolvedObject.Namespace, evt.InvolvedObject.Name)
+	if obj == nil {
+		return handler
+	}
+	if obj.Spec.IssuerRef.Name != "" {
+		issuerKind := obj.Spec.IssuerRef.Kind
+		if issuerKind == "" {
+			issuerKind = "Issuer"
+		}
+		handler.Issuer = issuerKind + "/" + obj.Spec.IssuerRef.Name
+	}
+	handler.DNSNames = certManagerDNSNames(obj)
+	if name := obj.Annotations[certManagerCertificateAnnotation]; kind == "CertificateRequest" && name != "" {
+		handler.Certificate = name
+		obj = getCertManagerObject(app, evt.InvolvedObject.APIVersion, "Certificate", evt.InvolvedObject.Namespace, name)
+		if obj != nil && len(handler.DNSNames) == 0 {
+			handler.DNSNames = certManagerDNSNames(obj)
+		}
+	}
+	if obj != nil && obj.Status.NotAfter != nil && handler.Certificate != "" {
+		handler.NotAfter = obj.Status.NotAfter.Time
+	}
+	return handler
+}
+
+// getCertManagerObject reads a cert-manager resource, or returns nil if that
+// fails.
+func getCertManagerObject(app *application, apiVersion, kind, namespace, name string) *certManagerObject {
+	resource, ok := certManagerResources[kind]
+	if !ok {
+		return nil
+	}
+	path := "/apis/" + apiVersion
+	if kind != "ClusterIssuer" {
+		path += "/namespaces/" + namespace
+	}
+	path += "/" + resource + "/" + name
+
+	data, err := app.clientset.CoreV1().RESTClient().Get().AbsPath(path).DoRaw()
+	if err != nil {
+		logger.Debug("Error getting cert-manager resource", "path", path, "error", err)
+		return nil
+	}
+	var obj certManagerObject
+	if err := json.Unmarshal(data, &obj); err != nil {
+		logger.Debug("Error decoding cert-manager resource", "path", path, "error", err)
+		return nil
+	}
+	return &obj
+}
+
+func certManagerDNSNames(obj *certManagerObject) []string {
+	names := obj.Spec.DNSNames
+	if obj.Spec.DNSName != "" {
+		names = append(names, obj.Spec.DNSName)
+	}
+	if len(names) == 0 && obj.Spec.CommonName != "" {
+		names = []string{obj.Spec.CommonName}
+	}
+	return names
+}
+
+func init() {
+	for kind := range certManagerResources {
+		RegisterKindHandler("", kind, NewCertManagerEventHandler)
+	}
+}
+
+// certManagerAccessChecks returns the access checks for the
+// CertManagerEventHandler, which gets the cert-manager resource an event is
+// about. ACME orders and challenges have their own API group.
+func certManagerAccessChecks(app *application) []accessCheck {
+	var checks []accessCheck
+	for kind, resource := range certManagerResources {
+		group, namespace := "cert-manager.io", app.namespace
+		switch kind {
+		case "Order", "Challenge":
+			group = "acme.cert-manager.io"
+		case "ClusterIssuer":
+			namespace = ""
+		}
+		checks = append(checks, getAccess(group, resource, namespace))
+	}
+	sort.Slice(checks, func(i, j int) bool { return checks[i].resource < checks[j].resource })
+	return checks
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestCertManagerEventHandler(t *testing.T) {
+	t.Parallel()
+
+	evt := &v1.Event{
+		InvolvedObject: v1.ObjectReference{APIVersion: "cert-manager.io/v1", Kind: "Certificate", Namespace: "shop", Name: "web-tls"},
+		Type:           v1.EventTypeWarning,
+		Reason:         "Failed",
+		Message:        "The certificate request has failed to complete and will be retried",
+	}
+	app := &application{certExpiryError: 7 * 24 * time.Hour}
+	handler, ok := NewEventHandler(app, evt).(*CertManagerEventHandler)
+	if !ok {
+		t.Fatal("No cert-manager handler for Certificate")
+	}
+	handler.Issuer = "ClusterIssuer/letsencrypt"
+	handler.DNSNames = []string{"shop.example.com", "www.shop.example.com"}
+
+	handler.NotAfter = time.Now().Add(30 * 24 * time.Hour)
+	event := sentry.NewEvent()
+	event.Level = sentry.LevelWarning
+	applyHandler(event, handler)
+	if event.Level != sentry.LevelWarning {
+		t.Errorf("Unexpected level %s for certificate that expires in 30 days", event.Level)
+	}
+	if event.Tags["certificate"] != "shop/web-tls" || event.Tags["issuer"] != "ClusterIssuer/letsencrypt" || event.Tags["dns-names"] != "shop.example.com,www.shop.example.com" {
+		t.Errorf("Unexpected tags %v", event.Tags)
+	}
+	if len(event.Fingerprint) != 4 || event.Fingerprint[2] != "web-tls" {
+		t.Errorf("Unexpected fingerprint %v", event.Fingerprint)
+	}
+
+	handler.NotAfter = time.Now().Add(2 * 24 * time.Hour)
+	event = sentry.NewEvent()
+	event.Level = sentry.LevelWarning
+	applyHandler(event, handler)
+	if event.Level != sentry.LevelError || event.Tags["certificate.expiring"] != "true" {
+		t.Errorf("Expiring certificate not escalated: %s %v", event.Level, event.Tags)
+	}
+
+	evt.InvolvedObject.APIVersion = "example.com/v1"
+	if _, ok := NewEventHandler(app, evt).(*DefaultEventHandler); !ok {
+		t.Error("Certificate of another group not handled by the default handler")
+	}
+}
+
+func TestCertManagerDNSNames(t *testing.T) {
+	t.Parallel()
+
+	var challenge certManagerObject
+	data := `{"metadata": {"name": "web-tls-1-2-3"}, "spec": {"dnsName": "shop.example.com", "issuerRef": {"name": "letsencrypt", "kind": "ClusterIssuer"}}}`
+	if err := json.Unmarshal([]byte(data), &challenge); err != nil {
+		t.Fatal(err)
+	}
+	if names := certManagerDNSNames(&challenge); len(names) != 1 || names[0] != "shop.example.com" {
+		t.Errorf("Unexpected DNS names %v", names)
+	}
+	if challenge.Spec.IssuerRef.Kind != "ClusterIssuer" {
+		t.Errorf("Unexpected issuer %+v", challenge.Spec.IssuerRef)
+	}
+}
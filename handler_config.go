@@ -0,0 +1,299 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	missingConfigRegexp    = regexp.MustCompile(`(configmap|secret) "([^"]+)" not found`)
+	missingConfigKeyRegexp = regexp.MustCompile(`couldn't find key (\S+) in (ConfigMap|Secret) [^/\s]+/(\S+)`)
+)
+
+// configReference is a reference from a container to a ConfigMap or Secret,
+// or to a single key in one.
+type configReference struct {
+	Kind     string
+	Name     string
+	Key      string
+	Usage    string
+	Optional bool
+}
+
+func (r configReference) String() string {
+	if r.Key != "" {
+		return fmt.Sprintf("key %s in %s %s", r.Key, r.Kind, r.Name)
+	}
+	return r.Kind + " " + r.Name
+}
+
+// ContainerConfigEventHandler handles failures to create a container because
+// a ConfigMap or Secret it references, or a key in one, does not exist. These
+// are grouped by the missing object, since all pods referencing it fail.
+type ContainerConfigEventHandler struct {
+	Event     *v1.Event
+	Container string
+	Missing   configReference
+}
+
+// Fingerprint returns the fingerprint entries that are specific for an event type
+func (h ContainerConfigEventHandler) Fingerprint() []string {
+	return nil
+}
+
+// Tags returns a set of tags that should be added to the event
+func (h ContainerConfigEventHandler) Tags() map[string]string {
+	tags := map[string]string{
+		"config.kind": h.Missing.Kind,
+		"config.name": h.Missing.Name,
+	}
+	if h.Missing.Key != "" {
+		tags["config.key"] = h.Missing.Key
+	}
+	return tags
+}
+
+// Enrich describes the missing object in the message, and groups the event
+// by the missing object.
+func (h ContainerConfigEventHandler) Enrich(event *sentry.Event) {
+	event.Message = fmt.Sprintf("%s/%s: missing %s", h.Event.InvolvedObject.Kind, h.Event.InvolvedObject.Name, h.Missing)
+	if h.Missing.Usage != "" {
+		event.Message += fmt.Sprintf(", referenced by %s of container %s", h.Missing.Usage, h.Container)
+	}
+	event.Fingerprint = []string{"missing-config", h.Event.InvolvedObject.Namespace, h.Missing.Kind, h.Missing.Name, h.Missing.Key}
+}
+
+// NewContainerConfigEventHandler creates a new ContainerConfigEventHandler
+// instance if the missing ConfigMap or Secret can be determined, either from
+// the event message or by checking the references in the pod spec.
+func NewContainerConfigEventHandler(app *application, evt *v1.Event) EventHandler {
+	if evt.InvolvedObject.Kind != "Pod" {
+		return nil
+	}
+	_, container := containerFromFieldPath(evt.InvolvedObject.FieldPath)
+	missing, parsed := parseMissingConfig(evt.Message)
+	if app.clientset == nil {
+		if !parsed {
+			return nil
+		}
+		return &ContainerConfigEventHandler{Event: evt, Container: container, Missing: missing}
+	}
+
+	pod, err := app.clientset.CoreV1().Pods(evt.InvolvedObject.Namespace).Get(evt.InvolvedObject.Name, metav1.GetOptions{})
+	if err != nil {
+		logger.Debug("Unable to get pod", eventFields(evt, "error", err)...)
+		if !parsed {
+			return nil
+		}
+		return &ContainerConfigEventHandler{Event: evt, Container: container, Missing: missing}
+	}
+	if !parsed && !hasConfigError(pod, container) {
+		return nil
+	}
+
+	references := containerConfigReferences(pod, container)
+	if parsed {
+		if reference := matchConfigReference(references, missing); reference != nil {
+			missing = *reference
+		}
+	} else {
+		reference := findMissingConfig(references, func(kind, name string) (map[string]bool, error) {
+			return configKeys(app, pod.Namespace, kind, name)
+		})
+		if reference == nil {
+			return nil
+		}
+		missing = *reference
+	}
+	return &ContainerConfigEventHandler{Event: evt, Container: container, Missing: missing}
+}
+
+// parseMissingConfig extracts the missing ConfigMap or Secret from the
+// message of a CreateContainerConfigError.
+func parseMissingConfig(message string) (configReference, bool) {
+	if match := missingConfigKeyRegexp.FindStringSubmatch(message); match != nil {
+		return configReference{Kind: match[2], Name: match[3], Key: match[1]}, true
+	}
+	if match := missingConfigRegexp.FindStringSubmatch(message); match != nil {
+		kind := "ConfigMap"
+		if match[1] == "secret" {
+			kind = "Secret"
+		}
+		return configReference{Kind: kind, Name: match[2]}, true
+	}
+	return configReference{}, false
+}
+
+// hasConfigError returns true if a container is waiting because it could
+// not be created.
+func hasConfigError(pod *v1.Pod, container string) bool {
+	statuses := append(append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if status.Name != container || status.State.Waiting == nil {
+			continue
+		}
+		switch status.State.Waiting.Reason {
+		case "CreateContainerConfigError", "CreateContainerError":
+			return true
+		}
+	}
+	return false
+}
+
+// containerConfigReferences returns all references to ConfigMaps and Secrets
+// in the environment and volumes of a container.
+func containerConfigReferences(pod *v1.Pod, name string) []configReference {
+	var container *v1.Container
+	for _, containers := range [][]v1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for i := range containers {
+			if containers[i].Name == name {
+				container = &containers[i]
+			}
+		}
+	}
+	if container == nil {
+		return nil
+	}
+
+	var references []configReference
+	for _, env := range container.Env {
+		if env.ValueFrom == nil {
+			continue
+		}
+		usage := "environment variable " + env.Name
+		if ref := env.ValueFrom.ConfigMapKeyRef; ref != nil {
+			references = append(references, configReference{Kind: "ConfigMap", Name: ref.Name, Key: ref.Key, Usage: usage, Optional: ref.Optional != nil && *ref.Optional})
+		}
+		if ref := env.ValueFrom.SecretKeyRef; ref != nil {
+			references = append(references, configReference{Kind: "Secret", Name: ref.Name, Key: ref.Key, Usage: usage, Optional: ref.Optional != nil && *ref.Optional})
+		}
+	}
+	for _, source := range container.EnvFrom {
+		if ref := source.ConfigMapRef; ref != nil {
+			references = append(references, configReference{Kind: "ConfigMap", Name: ref.Name, Usage: "envFrom", Optional: ref.Optional != nil && *ref.Optional})
+		}
+		if ref := source.SecretRef; ref != nil {
+			references = append(references, configReference{Kind: "Secret", Name: ref.Name, Usage: "envFrom", Optional: ref.Optional != nil && *ref.Optional})
+		}
+	}
+
+	mounted := make(map[string]bool)
+	for _, mount := range container.VolumeMounts {
+		mounted[mount.Name] = true
+	}
+	for _, volume := range pod.Spec.Volumes {
+		if !mounted[volume.Name] {
+			continue
+		}
+		usage := "volume " + volume.Name
+		if source := volume.ConfigMap; source != nil {
+			references = append(references, configReference{Kind: "ConfigMap", Name: source.Name, Usage: usage, Optional: source.Optional != nil && *source.Optional})
+		}
+		if source := volume.Secret; source != nil {
+			references = append(references, configReference{Kind: "Secret", Name: source.SecretName, Usage: usage, Optional: source.Optional != nil && *source.Optional})
+		}
+	}
+	return references
+}
+
+// matchConfigReference returns the reference for a missing object or key.
+func matchConfigReference(references []configReference, missing configReference) *configReference {
+	for i, reference := range references {
+		if reference.Kind != missing.Kind || reference.Name != missing.Name {
+			continue
+		}
+		if missing.Key == "" || reference.Key == missing.Key {
+			found := references[i]
+			found.Key = missing.Key
+			return &found
+		}
+	}
+	return nil
+}
+
+// findMissingConfig returns the first required reference to an object or
+// key that does not exist. keys returns the keys of an object, or nil if
+// the object does not exist.
+func findMissingConfig(references []configReference, keys func(kind, name string) (map[string]bool, error)) *configReference {
+	for i, reference := range references {
+		if reference.Optional {
+			continue
+		}
+		existing, err := keys(reference.Kind, reference.Name)
+		if err != nil {
+			logger.Debug("Unable to check reference", "kind", reference.Kind, "name", reference.Name, "error", err)
+			continue
+		}
+		if existing == nil {
+			missing := references[i]
+			missing.Key = ""
+			return &missing
+		}
+		if reference.Key != "" && !existing[reference.Key] {
+			return &references[i]
+		}
+	}
+	return nil
+}
+
+// configKeys returns the keys in a ConfigMap or Secret, or nil if it does
+// not exist.
+func configKeys(app *application, namespace, kind, name string) (map[string]bool, error) {
+	keys := make(map[string]bool)
+	if kind == "ConfigMap" {
+		configMap, err := app.clientset.CoreV1().ConfigMaps(namespace).Get(name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		for key := range configMap.Data {
+			keys[key] = true
+		}
+		for key := range configMap.BinaryData {
+			keys[key] = true
+		}
+		return keys, nil
+	}
+	secret, err := app.clientset.CoreV1().Secrets(namespace).Get(name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for key := range secret.Data {
+		keys[key] = true
+	}
+	return keys, nil
+}
+
+// containerConfigAccessChecks returns the access checks for the
+// ContainerConfigEventHandler, which gets the pod and the ConfigMaps and
+// Secrets it uses.
+func containerConfigAccessChecks(app *application) []accessCheck {
+	return []accessCheck{
+		getAccess("", "pods", app.namespace),
+		getAccess("", "configmaps", app.namespace),
+		getAccess("", "secrets", app.namespace),
+	}
+}
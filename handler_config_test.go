@@ -0,0 +1,134 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseMissingConfig(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		message  string
+		expected configReference
+	}{
+		{`Error: configmap "app-config" not found`, configReference{Kind: "ConfigMap", Name: "app-config"}},
+		{`Error: secret "db" not found`, configReference{Kind: "Secret", Name: "db"}},
+		{`Error: couldn't find key password in Secret shop/db`, configReference{Kind: "Secret", Name: "db", Key: "password"}},
+		{`Error: couldn't find key LOG_LEVEL in ConfigMap shop/app-config`, configReference{Kind: "ConfigMap", Name: "app-config", Key: "LOG_LEVEL"}},
+	}
+	for _, tc := range tests {
+		missing, ok := parseMissingConfig(tc.message)
+		if !ok || missing != tc.expected {
+			t.Errorf("%s: expected %+v, got %+v", tc.message, tc.expected, missing)
+		}
+	}
+	if _, ok := parseMissingConfig(`Error: failed to create containerd task`); ok {
+		t.Error("unexpected match for unrelated message")
+	}
+}
+
+func configTestPod() *v1.Pod {
+	optional := true
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "web-1"},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{
+				Name: "web",
+				Env: []v1.EnvVar{
+					{Name: "DB_PASSWORD", ValueFrom: &v1.EnvVarSource{SecretKeyRef: &v1.SecretKeySelector{
+						LocalObjectReference: v1.LocalObjectReference{Name: "db"},
+						Key:                  "password",
+					}}},
+				},
+				EnvFrom: []v1.EnvFromSource{
+					{ConfigMapRef: &v1.ConfigMapEnvSource{LocalObjectReference: v1.LocalObjectReference{Name: "flags"}, Optional: &optional}},
+				},
+				VolumeMounts: []v1.VolumeMount{{Name: "config"}},
+			}},
+			Volumes: []v1.Volume{
+				{Name: "config", VolumeSource: v1.VolumeSource{ConfigMap: &v1.ConfigMapVolumeSource{LocalObjectReference: v1.LocalObjectReference{Name: "app-config"}}}},
+				{Name: "unused", VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: "other"}}},
+			},
+		},
+	}
+}
+
+func TestContainerConfigReferences(t *testing.T) {
+	t.Parallel()
+
+	references := containerConfigReferences(configTestPod(), "web")
+	expected := []configReference{
+		{Kind: "Secret", Name: "db", Key: "password", Usage: "environment variable DB_PASSWORD"},
+		{Kind: "ConfigMap", Name: "flags", Usage: "envFrom", Optional: true},
+		{Kind: "ConfigMap", Name: "app-config", Usage: "volume config"},
+	}
+	if !reflect.DeepEqual(references, expected) {
+		t.Errorf("unexpected references: %+v", references)
+	}
+
+	missing := matchConfigReference(references, configReference{Kind: "Secret", Name: "db", Key: "password"})
+	if missing == nil || missing.Usage != "environment variable DB_PASSWORD" {
+		t.Errorf("unexpected match: %+v", missing)
+	}
+}
+
+func TestFindMissingConfig(t *testing.T) {
+	t.Parallel()
+
+	references := containerConfigReferences(configTestPod(), "web")
+	objects := map[string]map[string]bool{
+		"Secret/db":            {"username": true},
+		"ConfigMap/app-config": {"app.yaml": true},
+	}
+	keys := func(kind, name string) (map[string]bool, error) {
+		return objects[kind+"/"+name], nil
+	}
+	missing := findMissingConfig(references, keys)
+	if missing == nil || missing.String() != "key password in Secret db" {
+		t.Errorf("unexpected missing reference: %+v", missing)
+	}
+
+	objects["Secret/db"]["password"] = true
+	delete(objects, "ConfigMap/app-config")
+	missing = findMissingConfig(references, keys)
+	if missing == nil || missing.String() != "ConfigMap app-config" || missing.Usage != "volume config" {
+		t.Errorf("unexpected missing reference: %+v", missing)
+	}
+}
+
+func TestContainerConfigEventHandler(t *testing.T) {
+	t.Parallel()
+
+	evt := &v1.Event{
+		InvolvedObject: v1.ObjectReference{Kind: "Pod", Namespace: "shop", Name: "web-1", FieldPath: "spec.containers{web}"},
+		Reason:         "Failed",
+		Message:        `Error: secret "db" not found`,
+	}
+	handler := NewContainerConfigEventHandler(&application{}, evt)
+	if handler == nil {
+		t.Fatal("missing Secret not recognised")
+	}
+	if tags := handler.Tags(); tags["config.kind"] != "Secret" || tags["config.name"] != "db" {
+		t.Errorf("unexpected tags: %v", tags)
+	}
+
+	event := sentry.NewEvent()
+	handler.(*ContainerConfigEventHandler).Missing.Usage = "envFrom"
+	applyHandler(event, handler)
+	if event.Message != "Pod/web-1: missing Secret db, referenced by envFrom of container web" {
+		t.Errorf("unexpected message: %s", event.Message)
+	}
+	if !reflect.DeepEqual(event.Fingerprint, []string{"missing-config", "shop", "Secret", "db", ""}) {
+		t.Errorf("unexpected fingerprint: %v", event.Fingerprint)
+	}
+
+	evt.Message = "Error: failed to create containerd task"
+	if NewContainerConfigEventHandler(&application{}, evt) != nil {
+		t.Error("unexpected handler for unrelated failure")
+	}
+}
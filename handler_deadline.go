@@ -0,0 +1,117 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DeadlineEventHandler handles pods and Jobs that were terminated because
+// they were active for longer than their activeDeadlineSeconds.
+type DeadlineEventHandler struct {
+	Event    *v1.Event
+	Workload string
+	Deadline time.Duration
+	Runtime  time.Duration
+}
+
+// Fingerprint returns the fingerprint entries that are specific for an event type
+func (h DeadlineEventHandler) Fingerprint() []string {
+	return nil
+}
+
+// Tags returns a set of tags that should be added to the event
+func (h DeadlineEventHandler) Tags() map[string]string {
+	tags := map[string]string{"owner": h.Workload}
+	if h.Deadline > 0 {
+		tags["deadline"] = h.Deadline.String()
+	}
+	if h.Runtime > 0 {
+		tags["runtime"] = h.Runtime.Round(time.Second).String()
+	}
+	return tags
+}
+
+// Enrich groups the event by workload.
+func (h DeadlineEventHandler) Enrich(event *sentry.Event) {
+	event.Fingerprint = []string{"deadline-exceeded", h.Event.InvolvedObject.Namespace, h.Workload}
+}
+
+// NewDeadlineEventHandler creates a new DeadlineEventHandler instance
+func NewDeadlineEventHandler(app *application, evt *v1.Event) EventHandler {
+	handler := &DeadlineEventHandler{
+		Event:    evt,
+		Workload: evt.InvolvedObject.Kind + "/" + evt.InvolvedObject.Name,
+	}
+	if app.clientset == nil {
+		return handler
+	}
+
+	namespace := evt.InvolvedObject.Namespace
+	switch evt.InvolvedObject.Kind {
+	case "Pod":
+		pod, err := app.clientset.CoreV1().Pods(namespace).Get(evt.InvolvedObject.Name, metav1.GetOptions{})
+		if err != nil {
+			logger.Debug("Unable to get pod", eventFields(evt, "error", err)...)
+			return handler
+		}
+		handler.Workload = podWorkload(pod)
+		handler.Deadline = deadline(pod.Spec.ActiveDeadlineSeconds)
+		handler.Runtime = activeTime(pod.Status.StartTime, evt)
+	case "Job":
+		job, err := app.clientset.BatchV1().Jobs(namespace).Get(evt.InvolvedObject.Name, metav1.GetOptions{})
+		if err != nil {
+			logger.Debug("Unable to get job", eventFields(evt, "error", err)...)
+			return handler
+		}
+		if owner := metav1.GetControllerOf(job); owner != nil && owner.Kind == "CronJob" {
+			handler.Workload = "CronJob/" + owner.Name
+		}
+		handler.Deadline = deadline(job.Spec.ActiveDeadlineSeconds)
+		handler.Runtime = activeTime(job.Status.StartTime, evt)
+	default:
+		return nil
+	}
+	return handler
+}
+
+func deadline(seconds *int64) time.Duration {
+	if seconds == nil {
+		return 0
+	}
+	return time.Duration(*seconds) * time.Second
+}
+
+// activeTime returns the time between the start of an object and an event.
+func activeTime(start *metav1.Time, evt *v1.Event) time.Duration {
+	if start == nil {
+		return 0
+	}
+	return eventTime(evt).Sub(start.Time)
+}
+
+// deadlineAccessChecks returns the access checks for the
+// DeadlineEventHandler.
+func deadlineAccessChecks(app *application) []accessCheck {
+	return []accessCheck{
+		getAccess("", "pods", app.namespace),
+		getAccess("batch", "jobs", app.namespace),
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDeadlineEventHandler(t *testing.T) {
+	t.Parallel()
+
+	evt := &v1.Event{
+		InvolvedObject: v1.ObjectReference{Kind: "Pod", Namespace: "ci", Name: "build-7f9c-x2"},
+		Reason:         "DeadlineExceeded",
+	}
+	handler := NewDeadlineEventHandler(&application{}, evt).(*DeadlineEventHandler)
+	handler.Workload = "Deployment/build"
+	handler.Deadline = deadline(func() *int64 { v := int64(600); return &v }())
+	handler.Runtime = 603*time.Second + 400*time.Millisecond
+
+	event := sentry.NewEvent()
+	applyHandler(event, handler)
+	expected := map[string]string{"owner": "Deployment/build", "deadline": "10m0s", "runtime": "10m3s"}
+	if !reflect.DeepEqual(event.Tags, expected) {
+		t.Errorf("Unexpected tags: %v", event.Tags)
+	}
+	if !reflect.DeepEqual(event.Fingerprint, []string{"deadline-exceeded", "ci", "Deployment/build"}) {
+		t.Errorf("Unexpected fingerprint: %v", event.Fingerprint)
+	}
+}
+
+func TestActiveTime(t *testing.T) {
+	t.Parallel()
+
+	start := metav1.NewTime(time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC))
+	evt := &v1.Event{LastTimestamp: metav1.NewTime(start.Add(90 * time.Second))}
+	if runtime := activeTime(&start, evt); runtime != 90*time.Second {
+		t.Errorf("Unexpected runtime: %s", runtime)
+	}
+	if runtime := activeTime(nil, evt); runtime != 0 {
+		t.Errorf("Unexpected runtime without start: %s", runtime)
+	}
+}
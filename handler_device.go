@@ -0,0 +1,100 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+)
+
+var (
+	extendedResourceRegexp = regexp.MustCompile(`[a-z0-9]([-a-z0-9.]*[a-z0-9])?\.[a-z]+/[A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?`)
+	deviceCountRegexp      = regexp.MustCompile(`Requested: (\d+), Available: (\d+)`)
+)
+
+// DeviceEventHandler handles pods that can not get devices from a device
+// plugin, such as GPUs. These are grouped per device resource, since they
+// usually indicate a problem with the device plugin or a lack of capacity
+// rather than a problem with the pod.
+type DeviceEventHandler struct {
+	Event     *v1.Event
+	Resource  string
+	Requested int
+	Available int
+}
+
+// Fingerprint returns the fingerprint entries that are specific for an event type
+func (h DeviceEventHandler) Fingerprint() []string {
+	return nil
+}
+
+// Tags returns a set of tags that should be added to the event
+func (h DeviceEventHandler) Tags() map[string]string {
+	tags := map[string]string{
+		"device.resource": h.Resource,
+		"device.type":     h.Resource[strings.Index(h.Resource, "/")+1:],
+	}
+	if h.Event.Source.Host != "" {
+		tags["node"] = h.Event.Source.Host
+	}
+	return tags
+}
+
+// Enrich groups the event by device resource and reason.
+func (h DeviceEventHandler) Enrich(event *sentry.Event) {
+	event.Fingerprint = []string{"device-allocation", h.Resource, h.Event.Reason}
+	if h.Requested > 0 {
+		event.Extra["devices-requested"] = h.Requested
+		event.Extra["devices-available"] = h.Available
+	}
+}
+
+// NewDeviceEventHandler creates a new DeviceEventHandler instance if the
+// event is about an extended resource.
+func NewDeviceEventHandler(app *application, evt *v1.Event) EventHandler {
+	if evt.Reason == "FailedScheduling" && !strings.Contains(evt.Message, "Insufficient ") {
+		return nil
+	}
+	resource := deviceResource(evt.Message)
+	if resource == "" {
+		return nil
+	}
+	handler := &DeviceEventHandler{Event: evt, Resource: resource}
+	if match := deviceCountRegexp.FindStringSubmatch(evt.Message); match != nil {
+		handler.Requested, _ = strconv.Atoi(match[1])
+		handler.Available, _ = strconv.Atoi(match[2])
+	}
+	return handler
+}
+
+// deviceResource returns the first extended resource, such as
+// nvidia.com/gpu, in a message. For scheduling failures only resources the
+// cluster has insufficient capacity for are considered.
+func deviceResource(message string) string {
+	if i := strings.Index(message, "Insufficient "); i != -1 {
+		for _, part := range strings.Split(message[i:], "Insufficient ")[1:] {
+			if resource := extendedResourceRegexp.FindString(part); resource != "" && strings.HasPrefix(part, resource) {
+				return resource
+			}
+		}
+		return ""
+	}
+	return extendedResourceRegexp.FindString(message)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestDeviceResource(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		message  string
+		resource string
+	}{
+		{"Pod Allocate failed due to requested number of devices unavailable for nvidia.com/gpu. Requested: 1, Available: 0, which is unexpected", "nvidia.com/gpu"},
+		{"0/5 nodes are available: 2 Insufficient cpu, 3 Insufficient nvidia.com/gpu.", "nvidia.com/gpu"},
+		{"0/5 nodes are available: 5 Insufficient amd.com/gpu, 1 Insufficient memory.", "amd.com/gpu"},
+		{"0/5 nodes are available: 5 Insufficient cpu.", ""},
+		{"0/5 nodes are available: 5 node(s) didn't match node selector.", ""},
+	}
+	for _, test := range tests {
+		if resource := deviceResource(test.message); resource != test.resource {
+			t.Errorf("Unexpected resource for %s: %s", test.message, resource)
+		}
+	}
+}
+
+func TestDeviceEventHandler(t *testing.T) {
+	t.Parallel()
+
+	evt := &v1.Event{
+		Reason:  "UnexpectedAdmissionError",
+		Message: "Pod Allocate failed due to requested number of devices unavailable for nvidia.com/gpu. Requested: 2, Available: 1, which is unexpected",
+		Source:  v1.EventSource{Component: "kubelet", Host: "gpu-node-3"},
+	}
+	handler := NewDeviceEventHandler(&application{}, evt)
+	if handler == nil {
+		t.Fatal("No handler created")
+	}
+	event := sentry.NewEvent()
+	applyHandler(event, handler)
+	expected := map[string]string{"device.resource": "nvidia.com/gpu", "device.type": "gpu", "node": "gpu-node-3"}
+	if !reflect.DeepEqual(event.Tags, expected) {
+		t.Errorf("Unexpected tags: %v", event.Tags)
+	}
+	if !reflect.DeepEqual(event.Fingerprint, []string{"device-allocation", "nvidia.com/gpu", "UnexpectedAdmissionError"}) {
+		t.Errorf("Unexpected fingerprint: %v", event.Fingerprint)
+	}
+	if event.Extra["devices-requested"] != 2 || event.Extra["devices-available"] != 1 {
+		t.Errorf("Unexpected extra: %v", event.Extra)
+	}
+
+	if NewDeviceEventHandler(&application{}, &v1.Event{Reason: "FailedScheduling", Message: "0/5 nodes are available: 5 Insufficient cpu."}) != nil {
+		t.Error("Handler created for CPU shortage")
+	}
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"strings"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Categories of pod creation failures, as reported in the
+// failedcreate.category tag.
+const (
+	failedCreateQuota       = "quota"
+	failedCreateLimitRange  = "limit-range"
+	failedCreatePodSecurity = "pod-security"
+	failedCreatePSP         = "pod-security-policy"
+	failedCreateWebhook     = "webhook"
+	failedCreateInvalid     = "invalid-spec"
+	failedCreateForbidden   = "forbidden"
+	failedCreateOther       = "other"
+)
+
+// ReplicaSetEventHandler handles FailedCreate events of ReplicaSets. These
+// mean a rollout is not making any progress, so they are reported as errors
+// and attributed to the Deployment that owns the ReplicaSet, which is
+// stable across rollouts.
+type ReplicaSetEventHandler struct {
+	Event    *v1.Event
+	Workload string
+	Category string
+}
+
+// Fingerprint returns the fingerprint entries that are specific for an event type
+func (h ReplicaSetEventHandler) Fingerprint() []string {
+	return nil
+}
+
+// Tags returns a set of tags that should be added to the event
+func (h ReplicaSetEventHandler) Tags() map[string]string {
+	return map[string]string{
+		"workload":              h.Workload,
+		"failedcreate.category": h.Category,
+	}
+}
+
+// Enrich reports the event as error, grouped by workload and category.
+func (h ReplicaSetEventHandler) Enrich(event *sentry.Event) {
+	event.Level = sentry.LevelError
+	event.Fingerprint = []string{"failed-create", h.Event.InvolvedObject.Namespace, h.Workload, h.Category}
+}
+
+// NewReplicaSetEventHandler creates a new ReplicaSetEventHandler instance
+// for FailedCreate events of ReplicaSets.
+func NewReplicaSetEventHandler(app *application, evt *v1.Event) EventHandler {
+	if evt.InvolvedObject.Kind != "ReplicaSet" {
+		return nil
+	}
+	handler := &ReplicaSetEventHandler{
+		Event:    evt,
+		Workload: "ReplicaSet/" + evt.InvolvedObject.Name,
+		Category: failedCreateCategory(evt.Message),
+	}
+	if app.clientset != nil {
+		rs, err := app.clientset.AppsV1().ReplicaSets(evt.InvolvedObject.Namespace).Get(evt.InvolvedObject.Name, metav1.GetOptions{})
+		if err == nil {
+			if owner := metav1.GetControllerOf(rs); owner != nil {
+				handler.Workload = owner.Kind + "/" + owner.Name
+			}
+		} else {
+			logger.Debug("Error getting ReplicaSet", "namespace", evt.InvolvedObject.Namespace, "name", evt.InvolvedObject.Name, "error", err)
+		}
+	}
+	return handler
+}
+
+// failedCreateCategory returns why the API server refused to create a pod.
+func failedCreateCategory(message string) string {
+	switch {
+	case strings.Contains(message, "exceeded quota") || strings.Contains(message, "must specify limits") || strings.Contains(message, "must specify requests"):
+		return failedCreateQuota
+	case strings.Contains(message, "violates PodSecurity"):
+		return failedCreatePodSecurity
+	case strings.Contains(message, "pod security policy") || strings.Contains(message, "PodSecurityPolicy"):
+		return failedCreatePSP
+	case strings.Contains(message, "admission webhook"):
+		return failedCreateWebhook
+	case strings.Contains(message, "per Container") || strings.Contains(message, "per Pod") || strings.Contains(message, "LimitRange"):
+		return failedCreateLimitRange
+	case strings.Contains(message, "is invalid") || strings.Contains(message, "Invalid value") || strings.Contains(message, "Required value"):
+		return failedCreateInvalid
+	case strings.Contains(message, "forbidden"):
+		return failedCreateForbidden
+	default:
+		return failedCreateOther
+	}
+}
+
+// replicaSetAccessChecks returns the access checks for the
+// ReplicaSetEventHandler.
+func replicaSetAccessChecks(app *application) []accessCheck {
+	return []accessCheck{getAccess("apps", "replicasets", app.namespace)}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestFailedCreateCategory(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		`Error creating: pods "web-5d9c7-x2x" is forbidden: exceeded quota: compute, requested: cpu=2, used: cpu=9, limited: cpu=10`:                         failedCreateQuota,
+		`Error creating: pods "web-5d9c7-x2x" is forbidden: violates PodSecurity "restricted:latest": allowPrivilegeEscalation != false`:                     failedCreatePodSecurity,
+		`Error creating: pods "web-5d9c7-x2x" is forbidden: unable to validate against any pod security policy: []`:                                          failedCreatePSP,
+		`Error creating: admission webhook "validate.kyverno.svc" denied the request: policy require-labels failed`:                                          failedCreateWebhook,
+		`Error creating: pods "web-5d9c7-x2x" is forbidden: maximum memory usage per Container is 1Gi, but limit is 2Gi`:                                     failedCreateLimitRange,
+		`Error creating: Pod "web-5d9c7-x2x" is invalid: spec.containers[0].resources.requests: Invalid value: "2": must be less than or equal to cpu limit`: failedCreateInvalid,
+		`Error creating: pods "web-5d9c7-x2x" is forbidden: error looking up service account shop/web: serviceaccount "web" not found`:                       failedCreateForbidden,
+		`Error creating: Timeout: request did not complete within requested timeout`:                                                                         failedCreateOther,
+	}
+	for message, expected := range tests {
+		if category := failedCreateCategory(message); category != expected {
+			t.Errorf("Unexpected category for %q: %s", message, category)
+		}
+	}
+}
+
+func TestReplicaSetEventHandler(t *testing.T) {
+	t.Parallel()
+
+	evt := &v1.Event{
+		InvolvedObject: v1.ObjectReference{Kind: "ReplicaSet", Namespace: "shop", Name: "web-5d9c7"},
+		Reason:         "FailedCreate",
+		Message:        `Error creating: pods "web-5d9c7-x2x" is forbidden: violates PodSecurity "restricted:latest": runAsNonRoot != true`,
+	}
+	handlers := NewReasonEventHandlers(&application{}, evt)
+	if len(handlers) != 1 {
+		t.Fatalf("Expected a ReplicaSet handler, got %d", len(handlers))
+	}
+	event := sentry.NewEvent()
+	applyHandler(event, handlers[0])
+	if event.Level != sentry.LevelError {
+		t.Errorf("Unexpected level %s", event.Level)
+	}
+	if event.Tags["workload"] != "ReplicaSet/web-5d9c7" || event.Tags["failedcreate.category"] != failedCreatePodSecurity {
+		t.Errorf("Unexpected tags %v", event.Tags)
+	}
+	if len(event.Fingerprint) != 4 || event.Fingerprint[0] != "failed-create" {
+		t.Errorf("Unexpected fingerprint %v", event.Fingerprint)
+	}
+
+	evt.InvolvedObject.Kind = "Job"
+	if handlers := NewReasonEventHandlers(&application{}, evt); len(handlers) != 0 {
+		t.Error("ReplicaSet handler for Job event")
+	}
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+)
+
+var imagePullRegexp = regexp.MustCompile(`(?:pull|pulling) image "([^"]+)"`)
+
+// Image pull failure categories.
+const (
+	imagePullAuth        = "auth"
+	imagePullNotFound    = "not-found"
+	imagePullRateLimited = "rate-limited"
+	imagePullTimeout     = "timeout"
+	imagePullOther       = "other"
+)
+
+// imagePullPatterns maps lower-case message fragments to a category. They
+// are checked in order, since registries often include several of them in a
+// single message.
+var imagePullPatterns = []struct {
+	fragment string
+	category string
+}{
+	{"toomanyrequests", imagePullRateLimited},
+	{"rate limit", imagePullRateLimited},
+	{"429 too many requests", imagePullRateLimited},
+	{"unauthorized", imagePullAuth},
+	{"authentication required", imagePullAuth},
+	{"no basic auth credentials", imagePullAuth},
+	{"access denied", imagePullAuth},
+	{"403 forbidden", imagePullAuth},
+	{"manifest unknown", imagePullNotFound},
+	{"not found", imagePullNotFound},
+	{"does not exist", imagePullNotFound},
+	{"i/o timeout", imagePullTimeout},
+	{"deadline exceeded", imagePullTimeout},
+	{"timeout", imagePullTimeout},
+	{"connection refused", imagePullTimeout},
+	{"no such host", imagePullTimeout},
+}
+
+// ImagePullEventHandler handles image pull failures. These are grouped by
+// registry, except for missing images which are grouped by image: a registry
+// outage affects all images, while a typo only affects one.
+type ImagePullEventHandler struct {
+	Event    *v1.Event
+	Image    string
+	Registry string
+	Category string
+}
+
+// Fingerprint returns the fingerprint entries that are specific for an event type
+func (h ImagePullEventHandler) Fingerprint() []string {
+	return nil
+}
+
+// Tags returns a set of tags that should be added to the event
+func (h ImagePullEventHandler) Tags() map[string]string {
+	tags := map[string]string{
+		"image.registry": h.Registry,
+		"image":          h.Image,
+	}
+	if h.Category != "" {
+		tags["image.pull-error"] = h.Category
+	}
+	return tags
+}
+
+// Enrich replaces the fingerprint for classified failures.
+func (h ImagePullEventHandler) Enrich(event *sentry.Event) {
+	switch h.Category {
+	case "", imagePullOther:
+	case imagePullNotFound:
+		event.Fingerprint = []string{"image-pull", h.Category, h.Image}
+	default:
+		event.Fingerprint = []string{"image-pull", h.Category, h.Registry}
+	}
+}
+
+// NewImagePullEventHandler creates a new ImagePullEventHandler instance if
+// the event is about pulling an image.
+func NewImagePullEventHandler(app *application, evt *v1.Event) EventHandler {
+	match := imagePullRegexp.FindStringSubmatch(evt.Message)
+	if match == nil {
+		return nil
+	}
+	handler := &ImagePullEventHandler{
+		Event:    evt,
+		Image:    match[1],
+		Registry: imageRegistry(match[1]),
+	}
+	// Back-off events do not include the cause of the failure.
+	if evt.Reason != "BackOff" {
+		handler.Category = classifyImagePull(evt.Message)
+	}
+	return handler
+}
+
+func classifyImagePull(message string) string {
+	message = strings.ToLower(message)
+	for _, pattern := range imagePullPatterns {
+		if strings.Contains(message, pattern.fragment) {
+			return pattern.category
+		}
+	}
+	return imagePullOther
+}
+
+// imageRegistry returns the registry host of an image reference, using the
+// same rules as Docker.
+func imageRegistry(image string) string {
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		return parts[0]
+	}
+	return "docker.io"
+}
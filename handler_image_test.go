@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestImagePullEventHandler(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		reason   string
+		message  string
+		registry string
+		category string
+	}{
+		{"Failed", `Failed to pull image "nginx:1.17": rpc error: code = Unknown desc = toomanyrequests: You have reached your pull rate limit.`, "docker.io", imagePullRateLimited},
+		{"Failed", `Failed to pull image "gcr.io/acme/api:v2": rpc error: code = Unknown desc = Error response from daemon: unauthorized: authentication required`, "gcr.io", imagePullAuth},
+		{"Failed", `Failed to pull image "registry.acme.com:5000/web:v1.2": rpc error: code = NotFound desc = failed to resolve reference: not found`, "registry.acme.com:5000", imagePullNotFound},
+		{"Failed", `Failed to pull image "quay.io/acme/db:1": rpc error: code = Unknown desc = Get https://quay.io/v2/: dial tcp: i/o timeout`, "quay.io", imagePullTimeout},
+		{"BackOff", `Back-off pulling image "acme/worker:latest"`, "docker.io", ""},
+	}
+	for _, test := range tests {
+		handler := NewImagePullEventHandler(&application{}, &v1.Event{Reason: test.reason, Message: test.message})
+		if handler == nil {
+			t.Errorf("Image pull failure not recognised: %s", test.message)
+			continue
+		}
+		tags := handler.Tags()
+		if tags["image.registry"] != test.registry {
+			t.Errorf("Unexpected registry %q for %s", tags["image.registry"], test.message)
+		}
+		if tags["image.pull-error"] != test.category {
+			t.Errorf("Unexpected category %q for %s", tags["image.pull-error"], test.message)
+		}
+	}
+
+	if NewImagePullEventHandler(&application{}, &v1.Event{Reason: "Failed", Message: "Error: container has runAsNonRoot and image will run as root"}) != nil {
+		t.Error("Other failure recognised as image pull failure")
+	}
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"strings"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+	networkingv1beta1 "k8s.io/api/networking/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Categories of ingress controller errors, as reported in the ingress.error
+// tag.
+const (
+	ingressErrorRejected    = "rejected"
+	ingressErrorCertificate = "certificate"
+	ingressErrorInvalid     = "invalid-configuration"
+	ingressErrorBackend     = "backend"
+)
+
+// ingressClassAnnotation is the annotation that selects the ingress
+// controller of an Ingress.
+const ingressClassAnnotation = "kubernetes.io/ingress.class"
+
+// IngressEventHandler handles events about Ingresses, which are emitted by
+// ingress controllers such as ingress-nginx and the AWS Load Balancer
+// Controller. Errors mean the Ingress is not served as configured, so they
+// are reported as errors, tagged with the ingress class and host.
+type IngressEventHandler struct {
+	Event    *v1.Event
+	Ingress  *networkingv1beta1.Ingress
+	Category string
+}
+
+// Fingerprint returns the fingerprint entries that are specific for an event type
+func (h IngressEventHandler) Fingerprint() []string {
+	return []string{"Ingress", h.Event.InvolvedObject.Namespace, h.Event.InvolvedObject.Name}
+}
+
+// Tags returns a set of tags that should be added to the event
+func (h IngressEventHandler) Tags() map[string]string {
+	tags := map[string]string{
+		"ingress": h.Event.InvolvedObject.Namespace + "/" + h.Event.InvolvedObject.Name,
+	}
+	if component := eventComponent(h.Event); component != "" {
+		tags["ingress.controller"] = component
+	}
+	if h.Category != "" {
+		tags["ingress.error"] = h.Category
+	}
+	if h.Ingress == nil {
+		return tags
+	}
+	if class := h.Ingress.Annotations[ingressClassAnnotation]; class != "" {
+		tags["ingress.class"] = class
+	}
+	if hosts := ingressHosts(h.Ingress); len(hosts) > 0 {
+		tags["ingress.host"] = hosts[0]
+	}
+	return tags
+}
+
+// Enrich reports ingress controller errors as errors, grouped by Ingress
+// and error category, and adds all hosts of the Ingress.
+func (h IngressEventHandler) Enrich(event *sentry.Event) {
+	if h.Category != "" {
+		event.Level = sentry.LevelError
+		event.Fingerprint = []string{"ingress", h.Event.InvolvedObject.Namespace, h.Event.InvolvedObject.Name, h.Category}
+	}
+	if h.Ingress != nil {
+		if hosts := ingressHosts(h.Ingress); len(hosts) > 0 {
+			event.Extra["hosts"] = hosts
+		}
+	}
+}
+
+// NewIngressEventHandler creates a new IngressEventHandler instance. The
+// Ingress is used for its class and hosts if it can be read.
+func NewIngressEventHandler(app *application, evt *v1.Event) EventHandler {
+	handler := &IngressEventHandler{Event: evt}
+	if evt.Type == v1.EventTypeWarning {
+		handler.Category = ingressErrorCategory(evt.Reason, evt.Message)
+	}
+	if app.clientset != nil {
+		ingress, err := app.clientset.NetworkingV1beta1().Ingresses(evt.InvolvedObject.Namespace).Get(evt.InvolvedObject.Name, metav1.GetOptions{})
+		if err == nil {
+			handler.Ingress = ingress
+		} else {
+			logger.Debug("Error getting Ingress", "namespace", evt.InvolvedObject.Namespace, "name", evt.InvolvedObject.Name, "error", err)
+		}
+	}
+	return handler
+}
+
+// ingressErrorCategory returns the category of an ingress controller
+// warning, or an empty string if it is not a known error.
+func ingressErrorCategory(reason, message string) string {
+	lower := strings.ToLower(message)
+	switch {
+	case strings.Contains(lower, "certificate") || strings.Contains(lower, "tls") || strings.Contains(lower, "ssl"):
+		return ingressErrorCertificate
+	case reason == "Rejected":
+		return ingressErrorRejected
+	case reason == "FailedBuildModel" || reason == "FailedDeployModel" ||
+		strings.Contains(lower, "invalid") || strings.Contains(lower, "error in configuration") ||
+		strings.Contains(lower, "annotation"):
+		return ingressErrorInvalid
+	case strings.Contains(lower, "service") && (strings.Contains(lower, "not found") || strings.Contains(lower, "does not exist")):
+		return ingressErrorBackend
+	default:
+		return ""
+	}
+}
+
+// ingressHosts returns the hosts of the rules and TLS configuration of an
+// Ingress, without duplicates.
+func ingressHosts(ingress *networkingv1beta1.Ingress) []string {
+	var hosts []string
+	seen := make(map[string]bool)
+	add := func(host string) {
+		if host != "" && !seen[host] {
+			seen[host] = true
+			hosts = append(hosts, host)
+		}
+	}
+	for _, rule := range ingress.Spec.Rules {
+		add(rule.Host)
+	}
+	for _, tls := range ingress.Spec.TLS {
+		for _, host := range tls.Hosts {
+			add(host)
+		}
+	}
+	return hosts
+}
+
+// ingressAccessChecks returns the access checks for the IngressEventHandler.
+func ingressAccessChecks(app *application) []accessCheck {
+	return []accessCheck{getAccess("networking.k8s.io", "ingresses", app.namespace)}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+	networkingv1beta1 "k8s.io/api/networking/v1beta1"
+)
+
+func TestIngressErrorCategory(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		reason   string
+		message  string
+		category string
+	}{
+		{"Rejected", "host \"shop.example.com\" and path \"/\" is already defined in ingress shop/web", ingressErrorRejected},
+		{"Sync", "Error getting SSL certificate \"shop/web-tls\": local SSL certificate shop/web-tls was not found", ingressErrorCertificate},
+		{"FailedBuildModel", "Failed build model due to ingress: shop/web: unknown scheme internet", ingressErrorInvalid},
+		{"Sync", "Error: invalid annotation nginx.ingress.kubernetes.io/rewrite-target", ingressErrorInvalid},
+		{"Sync", "Service \"shop/web\" does not exist", ingressErrorBackend},
+		{"Sync", "Scheduled for sync", ""},
+	}
+	for _, test := range tests {
+		if category := ingressErrorCategory(test.reason, test.message); category != test.category {
+			t.Errorf("Unexpected category for %q: %q", test.message, category)
+		}
+	}
+}
+
+func TestIngressEventHandler(t *testing.T) {
+	t.Parallel()
+
+	ingress := &networkingv1beta1.Ingress{}
+	ingress.Annotations = map[string]string{ingressClassAnnotation: "nginx"}
+	ingress.Spec.Rules = []networkingv1beta1.IngressRule{{Host: "shop.example.com"}, {Host: "api.example.com"}}
+	ingress.Spec.TLS = []networkingv1beta1.IngressTLS{{Hosts: []string{"shop.example.com"}}}
+
+	handler := IngressEventHandler{
+		Event: &v1.Event{
+			InvolvedObject: v1.ObjectReference{Kind: "Ingress", Namespace: "shop", Name: "web"},
+			Source:         v1.EventSource{Component: "nginx-ingress-controller"},
+			Type:           v1.EventTypeWarning,
+			Reason:         "Rejected",
+		},
+		Ingress:  ingress,
+		Category: ingressErrorRejected,
+	}
+	event := sentry.NewEvent()
+	applyHandler(event, handler)
+	if event.Level != sentry.LevelError {
+		t.Errorf("Unexpected level %s", event.Level)
+	}
+	if event.Tags["ingress.class"] != "nginx" || event.Tags["ingress.host"] != "shop.example.com" || event.Tags["ingress.error"] != ingressErrorRejected {
+		t.Errorf("Unexpected tags %v", event.Tags)
+	}
+	if hosts, _ := event.Extra["hosts"].([]string); len(hosts) != 2 {
+		t.Errorf("Unexpected hosts %v", event.Extra["hosts"])
+	}
+	if len(event.Fingerprint) != 4 || event.Fingerprint[3] != ingressErrorRejected {
+		t.Errorf("Unexpected fingerprint %v", event.Fingerprint)
+	}
+}
@@ -0,0 +1,203 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/getsentry/sentry-go"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// JobEventHandler handles events involving Jobs. Jobs created by a CronJob
+// are grouped by the CronJob, since every run creates a Job with a new name.
+type JobEventHandler struct {
+	Job   *batchv1.Job
+	Event *v1.Event
+}
+
+// Fingerprint returns the fingerprint entries that are specific for an event type
+func (h JobEventHandler) Fingerprint() []string {
+	return fingerprintFromMeta(&h.Job.ObjectMeta)
+}
+
+// Tags returns a set of tags that should be added to the event
+func (h JobEventHandler) Tags() map[string]string {
+	tags := map[string]string{"job": h.Job.Name}
+	if owner := metav1.GetControllerOf(h.Job); owner != nil && owner.Kind == "CronJob" {
+		tags["cronjob"] = owner.Name
+	}
+	return tags
+}
+
+// NewJobEventHandler creates a new JobEventHandler instance
+func NewJobEventHandler(app *application, evt *v1.Event) EventHandler {
+	if app.clientset == nil {
+		return nil
+	}
+	job, err := app.clientset.BatchV1().Jobs(evt.InvolvedObject.Namespace).Get(evt.InvolvedObject.Name, metav1.GetOptions{})
+	if err != nil {
+		logger.Debug("Unable to get job", eventFields(evt, "error", err)...)
+		return nil
+	}
+	return &JobEventHandler{Job: job, Event: evt}
+}
+
+// JobFailureEventHandler handles Jobs that failed because they exceeded
+// their backoff limit or deadline. It adds the exit code and the last log
+// lines of the last failed pod.
+type JobFailureEventHandler struct {
+	Event     *v1.Event
+	Pod       string
+	Container string
+	State     *v1.ContainerStateTerminated
+	Logs      string
+}
+
+// Fingerprint returns the fingerprint entries that are specific for an event type
+func (h JobFailureEventHandler) Fingerprint() []string {
+	return nil
+}
+
+// Tags returns a set of tags that should be added to the event
+func (h JobFailureEventHandler) Tags() map[string]string {
+	tags := map[string]string{}
+	if h.State != nil {
+		tags["exit-code"] = strconv.Itoa(int(h.State.ExitCode))
+	}
+	return tags
+}
+
+// Enrich reports the failed Job as an error, and adds the details of the
+// last failed pod.
+func (h JobFailureEventHandler) Enrich(event *sentry.Event) {
+	event.Level = sentry.LevelError
+	job := h.Event.InvolvedObject.Name
+	if cronJob := event.Tags["cronjob"]; cronJob != "" {
+		job = "CronJob/" + cronJob
+	}
+	event.Fingerprint = []string{"job-failed", h.Event.InvolvedObject.Namespace, job, h.Event.Reason}
+	if h.Pod == "" {
+		return
+	}
+	event.Extra["pod"] = h.Pod
+	event.Extra["container"] = h.Container
+	if h.State != nil {
+		event.Extra["exit-code"] = h.State.ExitCode
+		if h.State.Reason != "" {
+			event.Extra["termination-reason"] = h.State.Reason
+		}
+		if h.State.Message != "" {
+			event.Extra["termination-message"] = h.State.Message
+		}
+	}
+	if h.Logs != "" {
+		event.Extra["logs"] = h.Logs
+	}
+}
+
+// NewJobFailureEventHandler creates a new JobFailureEventHandler instance
+func NewJobFailureEventHandler(app *application, evt *v1.Event) EventHandler {
+	if evt.InvolvedObject.Kind != "Job" {
+		return nil
+	}
+	handler := &JobFailureEventHandler{Event: evt}
+	if app.clientset == nil {
+		return handler
+	}
+
+	selector := labels.SelectorFromSet(labels.Set{"job-name": evt.InvolvedObject.Name})
+	pods, err := app.clientset.CoreV1().Pods(evt.InvolvedObject.Namespace).List(metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		logger.Debug("Unable to list pods for job", eventFields(evt, "error", err)...)
+		return handler
+	}
+	pod, container, state := lastFailedContainer(pods.Items)
+	if pod == nil {
+		return handler
+	}
+	handler.Pod = pod.Name
+	handler.Container = container
+	handler.State = state
+
+	if app.jobLogLines > 0 {
+		lines := int64(app.jobLogLines)
+		logs, err := app.clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &v1.PodLogOptions{Container: container, TailLines: &lines}).DoRaw()
+		if err != nil {
+			logger.Debug("Unable to get logs for failed job pod", eventFields(evt, "pod", pod.Name, "error", err)...)
+		} else {
+			handler.Logs = strings.TrimRight(string(logs), "\n")
+			if len(handler.Logs) > maxJobLogSize {
+				handler.Logs = "..." + handler.Logs[len(handler.Logs)-maxJobLogSize:]
+			}
+		}
+	}
+	return handler
+}
+
+// maxJobLogSize limits the size of logs added to an event, to stay well
+// below the maximum event size Sentry accepts.
+const maxJobLogSize = 16 * 1024
+
+// lastFailedContainer returns the pod and container that terminated with a
+// non-zero exit code most recently.
+func lastFailedContainer(pods []v1.Pod) (*v1.Pod, string, *v1.ContainerStateTerminated) {
+	var (
+		lastPod       *v1.Pod
+		lastContainer string
+		lastState     *v1.ContainerStateTerminated
+	)
+	for i := range pods {
+		for _, status := range pods[i].Status.ContainerStatuses {
+			state := status.State.Terminated
+			if state == nil {
+				state = status.LastTerminationState.Terminated
+			}
+			if state == nil || state.ExitCode == 0 {
+				continue
+			}
+			if lastState == nil || state.FinishedAt.After(lastState.FinishedAt.Time) {
+				lastPod, lastContainer, lastState = &pods[i], status.Name, state
+			}
+		}
+	}
+	return lastPod, lastContainer, lastState
+}
+
+// jobFailureAccessChecks returns the access checks for the JobEventHandler
+// and JobFailureEventHandler, which get the Job, and list its pods to add
+// the logs of the last failed one.
+func jobFailureAccessChecks(app *application) []accessCheck {
+	checks := []accessCheck{
+		getAccess("batch", "jobs", app.namespace),
+		{
+			resource:  "pods",
+			namespace: app.namespace,
+			list: func(options metav1.ListOptions) error {
+				_, err := app.clientset.CoreV1().Pods(app.namespace).List(options)
+				return err
+			},
+		},
+	}
+	if app.jobLogLines > 0 {
+		checks = append(checks, accessCheck{resource: "pods", subresource: "log", namespace: app.namespace, verbs: []string{"get"}})
+	}
+	return checks
+}
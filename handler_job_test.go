@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestLastFailedContainer(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	terminated := func(exitCode int32, finished time.Time) v1.ContainerState {
+		return v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: exitCode, FinishedAt: metav1.NewTime(finished)}}
+	}
+	pods := []v1.Pod{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "backup-a"},
+			Status:     v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{{Name: "backup", State: terminated(1, now.Add(-2*time.Minute))}}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "backup-b"},
+			Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{
+				{Name: "sidecar", State: terminated(0, now)},
+				{Name: "backup", LastTerminationState: terminated(137, now.Add(-time.Minute))},
+			}},
+		},
+	}
+
+	pod, container, state := lastFailedContainer(pods)
+	if pod == nil || pod.Name != "backup-b" || container != "backup" || state.ExitCode != 137 {
+		t.Errorf("Unexpected last failure: %v %s %v", pod, container, state)
+	}
+
+	if pod, _, _ := lastFailedContainer(pods[1:1]); pod != nil {
+		t.Errorf("Unexpected failure without pods: %v", pod)
+	}
+}
+
+func TestJobFailureEventHandler(t *testing.T) {
+	t.Parallel()
+
+	evt := &v1.Event{
+		InvolvedObject: v1.ObjectReference{Kind: "Job", Namespace: "ops", Name: "backup-1602720000"},
+		Reason:         "BackoffLimitExceeded",
+	}
+	handler := &JobFailureEventHandler{
+		Event:     evt,
+		Pod:       "backup-1602720000-x7k2p",
+		Container: "backup",
+		State:     &v1.ContainerStateTerminated{ExitCode: 2, Reason: "Error"},
+		Logs:      "pg_dump: connection refused",
+	}
+	event := sentry.NewEvent()
+	event.Level = sentry.LevelWarning
+	event.Tags["cronjob"] = "backup"
+	applyHandler(event, handler)
+
+	if event.Level != sentry.LevelError {
+		t.Errorf("Unexpected level: %s", event.Level)
+	}
+	if len(event.Fingerprint) != 4 || event.Fingerprint[2] != "CronJob/backup" {
+		t.Errorf("Unexpected fingerprint: %v", event.Fingerprint)
+	}
+	if event.Tags["exit-code"] != "2" || event.Extra["logs"] != "pg_dump: connection refused" {
+		t.Errorf("Unexpected event: %v %v", event.Tags, event.Extra)
+	}
+
+	if NewJobFailureEventHandler(&application{}, &v1.Event{InvolvedObject: v1.ObjectReference{Kind: "Pod"}}) != nil {
+		t.Error("Handler created for a pod")
+	}
+}
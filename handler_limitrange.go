@@ -0,0 +1,100 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"regexp"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// limitRangeRegexp matches the messages of the LimitRanger admission
+// plugin, such as "maximum memory usage per Container is 1Gi, but limit is
+// 2Gi" and "memory max limit to request ratio per Pod is 2, but provided
+// ratio is 4.000000".
+var limitRangeRegexp = regexp.MustCompile(`((?:minimum|maximum) (\S+) usage per (Container|Pod|PersistentVolumeClaim)|(\S+) max limit to request ratio per (Container|Pod)) is ([^,]+), but (?:provided ratio|limit|request) is (\S+)`)
+
+// LimitRangeEventHandler handles pods that were rejected because they
+// violate a LimitRange. These are grouped per namespace and constraint, so
+// platform teams can see which namespaces need other limits.
+type LimitRangeEventHandler struct {
+	Event       *v1.Event
+	Constraint  string
+	Allowed     string
+	Requested   string
+	LimitRanges map[string][]v1.LimitRangeItem
+}
+
+// Fingerprint returns the fingerprint entries that are specific for an event type
+func (h LimitRangeEventHandler) Fingerprint() []string {
+	return nil
+}
+
+// Tags returns a set of tags that should be added to the event
+func (h LimitRangeEventHandler) Tags() map[string]string {
+	return map[string]string{"limitrange.constraint": h.Constraint}
+}
+
+// Enrich groups the event by namespace and constraint, and adds the
+// LimitRanges of the namespace.
+func (h LimitRangeEventHandler) Enrich(event *sentry.Event) {
+	event.Fingerprint = []string{"limit-range", h.Event.InvolvedObject.Namespace, h.Constraint}
+	event.Extra["limitrange-violation"] = map[string]string{
+		"constraint": h.Constraint,
+		"allowed":    h.Allowed,
+		"requested":  h.Requested,
+	}
+	if len(h.LimitRanges) > 0 {
+		event.Extra["limitranges"] = h.LimitRanges
+	}
+}
+
+// NewLimitRangeEventHandler creates a new LimitRangeEventHandler instance
+// if a pod was rejected by a LimitRange.
+func NewLimitRangeEventHandler(app *application, evt *v1.Event) EventHandler {
+	match := limitRangeRegexp.FindStringSubmatch(evt.Message)
+	if match == nil {
+		return nil
+	}
+	handler := &LimitRangeEventHandler{Event: evt, Constraint: match[1], Allowed: match[6], Requested: match[7]}
+	if app.clientset != nil {
+		list, err := app.clientset.CoreV1().LimitRanges(evt.InvolvedObject.Namespace).List(metav1.ListOptions{})
+		if err == nil {
+			handler.LimitRanges = make(map[string][]v1.LimitRangeItem)
+			for _, limitRange := range list.Items {
+				handler.LimitRanges[limitRange.Name] = limitRange.Spec.Limits
+			}
+		} else {
+			logger.Debug("Error listing LimitRanges", "namespace", evt.InvolvedObject.Namespace, "error", err)
+		}
+	}
+	return handler
+}
+
+// limitRangeAccessChecks returns the access checks for the
+// LimitRangeEventHandler.
+func limitRangeAccessChecks(app *application) []accessCheck {
+	return []accessCheck{{
+		resource:  "limitranges",
+		namespace: app.namespace,
+		list: func(options metav1.ListOptions) error {
+			_, err := app.clientset.CoreV1().LimitRanges(app.namespace).List(options)
+			return err
+		},
+	}}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestLimitRangeEventHandler(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		message    string
+		constraint string
+		allowed    string
+		requested  string
+	}{
+		{`Error creating: pods "web-5d9c7-x2x" is forbidden: maximum memory usage per Container is 1Gi, but limit is 2Gi`, "maximum memory usage per Container", "1Gi", "2Gi"},
+		{`Error creating: pods "web-5d9c7-x2x" is forbidden: minimum cpu usage per Pod is 100m, but request is 50m`, "minimum cpu usage per Pod", "100m", "50m"},
+		{`Error creating: pods "web-5d9c7-x2x" is forbidden: memory max limit to request ratio per Container is 2, but provided ratio is 4.000000`, "memory max limit to request ratio per Container", "2", "4.000000"},
+	}
+	for _, test := range tests {
+		evt := &v1.Event{
+			InvolvedObject: v1.ObjectReference{Kind: "ReplicaSet", Namespace: "shop", Name: "web-5d9c7"},
+			Reason:         "FailedCreate",
+			Message:        test.message,
+		}
+		handlers := NewReasonEventHandlers(&application{}, evt)
+		if len(handlers) != 2 {
+			t.Errorf("Expected ReplicaSet and LimitRange handlers for %q, got %d", test.message, len(handlers))
+			continue
+		}
+		event := sentry.NewEvent()
+		for _, handler := range handlers {
+			applyHandler(event, handler)
+		}
+		if len(event.Fingerprint) != 3 || event.Fingerprint[0] != "limit-range" || event.Fingerprint[2] != test.constraint {
+			t.Errorf("Unexpected fingerprint %v", event.Fingerprint)
+		}
+		violation, _ := event.Extra["limitrange-violation"].(map[string]string)
+		if violation["allowed"] != test.allowed || violation["requested"] != test.requested {
+			t.Errorf("Unexpected violation %v", violation)
+		}
+		if event.Tags["failedcreate.category"] != failedCreateLimitRange {
+			t.Errorf("Unexpected category %s", event.Tags["failedcreate.category"])
+		}
+	}
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+)
+
+// loadBalancerErrorPrefixes are added by the service controller in front of
+// the error returned by the cloud provider.
+var loadBalancerErrorPrefixes = []string{
+	"Error syncing load balancer: ",
+	"Error updating load balancer with new hosts ",
+	"Error deleting load balancer: ",
+	"failed to ensure load balancer: ",
+	"failed to delete load balancer: ",
+}
+
+var (
+	gceErrorRegexp   = regexp.MustCompile(`googleapi: Error (\d+): .*?, (\w+)\s*$`)
+	azureErrorRegexp = regexp.MustCompile(`Code="([^"]+)"`)
+	awsErrorRegexp   = regexp.MustCompile(`(?s)(?:^|: )([A-Z][A-Za-z]+(?:\.[A-Za-z]+)?): .*status code: \d+`)
+)
+
+// LoadBalancerEventHandler handles failures to provision a load balancer
+// for a Service. Broken load balancers silently take endpoints offline, so
+// these are reported as errors, grouped per service.
+type LoadBalancerEventHandler struct {
+	Event    *v1.Event
+	Provider string
+	Code     string
+	Error    string
+}
+
+// Fingerprint returns the fingerprint entries that are specific for an event type
+func (h LoadBalancerEventHandler) Fingerprint() []string {
+	return nil
+}
+
+// Tags returns a set of tags that should be added to the event
+func (h LoadBalancerEventHandler) Tags() map[string]string {
+	tags := map[string]string{
+		"service":               h.Event.InvolvedObject.Namespace + "/" + h.Event.InvolvedObject.Name,
+		"loadbalancer.provider": h.Provider,
+	}
+	if h.Code != "" {
+		tags["loadbalancer.error"] = h.Code
+	}
+	return tags
+}
+
+// Enrich reports the event as error grouped by service, and adds the error
+// of the cloud provider.
+func (h LoadBalancerEventHandler) Enrich(event *sentry.Event) {
+	event.Level = sentry.LevelError
+	event.Fingerprint = []string{"load-balancer", h.Event.InvolvedObject.Namespace, h.Event.InvolvedObject.Name, h.Event.Reason}
+	event.Extra["provider-error"] = h.Error
+}
+
+// NewLoadBalancerEventHandler creates a new LoadBalancerEventHandler
+// instance for events about Services.
+func NewLoadBalancerEventHandler(app *application, evt *v1.Event) EventHandler {
+	if evt.InvolvedObject.Kind != "Service" || evt.Type != v1.EventTypeWarning {
+		return nil
+	}
+	message := loadBalancerError(evt.Message)
+	provider, code := parseLoadBalancerError(message)
+	if provider == "unknown" && strings.HasPrefix(evt.Reason, "Failed") {
+		// FailedDeployModel and FailedBuildModel are emitted by the AWS
+		// Load Balancer Controller.
+		provider = "aws"
+	}
+	return &LoadBalancerEventHandler{Event: evt, Provider: provider, Code: code, Error: message}
+}
+
+// loadBalancerError strips the prefixes added by the service controller
+// from an event message, leaving the error of the cloud provider.
+func loadBalancerError(message string) string {
+	for stripped := true; stripped; {
+		stripped = false
+		for _, prefix := range loadBalancerErrorPrefixes {
+			if strings.HasPrefix(message, prefix) {
+				message = strings.TrimPrefix(message, prefix)
+				stripped = true
+			}
+		}
+	}
+	return strings.TrimSpace(message)
+}
+
+// parseLoadBalancerError returns the cloud provider and error code of a
+// load balancer error.
+func parseLoadBalancerError(message string) (string, string) {
+	if match := gceErrorRegexp.FindStringSubmatch(message); match != nil {
+		return "gce", match[2]
+	}
+	if strings.Contains(message, "googleapi:") {
+		return "gce", ""
+	}
+	if match := azureErrorRegexp.FindStringSubmatch(message); match != nil {
+		return "azure", match[1]
+	}
+	if strings.Contains(message, "azure") || strings.Contains(message, "Azure") {
+		return "azure", ""
+	}
+	if match := awsErrorRegexp.FindStringSubmatch(message); match != nil {
+		return "aws", match[1]
+	}
+	if strings.Contains(message, "amazonaws.com") || strings.Contains(message, "elasticloadbalancing") || strings.Contains(message, "request id:") {
+		return "aws", ""
+	}
+	return "unknown", ""
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestParseLoadBalancerError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		message  string
+		provider string
+		code     string
+	}{
+		{
+			"Error syncing load balancer: failed to ensure load balancer: googleapi: Error 403: QUOTA_EXCEEDED - Quota 'FORWARDING_RULES' exceeded. Limit: 15.0 globally., quotaExceeded",
+			"gce", "quotaExceeded",
+		},
+		{
+			"Error syncing load balancer: failed to ensure load balancer: AccessDenied: User: arn:aws:sts::123:assumed-role/node is not authorized to perform: elasticloadbalancing:CreateLoadBalancer\n\tstatus code: 403, request id: 6f1c",
+			"aws", "AccessDenied",
+		},
+		{
+			`Error syncing load balancer: failed to ensure load balancer: Retriable: false, RetryAfter: 0s, HTTPStatusCode: 400, RawError: Code="PublicIPCountLimitReached" Message="Cannot create more than 10 public IP addresses"`,
+			"azure", "PublicIPCountLimitReached",
+		},
+		{"Error syncing load balancer: failed to ensure load balancer: something went wrong", "unknown", ""},
+	}
+	for _, test := range tests {
+		provider, code := parseLoadBalancerError(loadBalancerError(test.message))
+		if provider != test.provider || code != test.code {
+			t.Errorf("Unexpected result for %q: %s %s", test.message, provider, code)
+		}
+	}
+}
+
+func TestLoadBalancerEventHandler(t *testing.T) {
+	t.Parallel()
+
+	evt := &v1.Event{
+		InvolvedObject: v1.ObjectReference{Kind: "Service", Namespace: "shop", Name: "web"},
+		Type:           v1.EventTypeWarning,
+		Reason:         "SyncLoadBalancerFailed",
+		Message:        "Error syncing load balancer: failed to ensure load balancer: googleapi: Error 403: Quota exceeded., quotaExceeded",
+	}
+	handlers := NewReasonEventHandlers(&application{}, evt)
+	if len(handlers) != 1 {
+		t.Fatalf("Expected a load balancer handler, got %d", len(handlers))
+	}
+	event := sentry.NewEvent()
+	applyHandler(event, handlers[0])
+	if event.Level != sentry.LevelError {
+		t.Errorf("Unexpected level %s", event.Level)
+	}
+	if event.Tags["service"] != "shop/web" || event.Tags["loadbalancer.provider"] != "gce" || event.Tags["loadbalancer.error"] != "quotaExceeded" {
+		t.Errorf("Unexpected tags %v", event.Tags)
+	}
+	if len(event.Fingerprint) != 4 || event.Fingerprint[2] != "web" {
+		t.Errorf("Unexpected fingerprint %v", event.Fingerprint)
+	}
+	if event.Extra["provider-error"] != "googleapi: Error 403: Quota exceeded., quotaExceeded" {
+		t.Errorf("Unexpected provider error %v", event.Extra["provider-error"])
+	}
+
+	evt.Type = v1.EventTypeNormal
+	if handlers := NewReasonEventHandlers(&application{}, evt); len(handlers) != 0 {
+		t.Error("Handler for normal event")
+	}
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+)
+
+// NodeEventHandler handles events involving Nodes.
+type NodeEventHandler struct {
+	Event *v1.Event
+	Nodes *nodeTracker
+}
+
+// Fingerprint returns the fingerprint entries that are specific for an event type
+func (h NodeEventHandler) Fingerprint() []string {
+	return []string{"Node", h.Event.InvolvedObject.Name}
+}
+
+// Tags returns a set of tags that should be added to the event
+func (h NodeEventHandler) Tags() map[string]string {
+	return map[string]string{"node": h.Event.InvolvedObject.Name}
+}
+
+// Enrich adds recent maintenance activity for the node.
+func (h NodeEventHandler) Enrich(event *sentry.Event) {
+	if h.Nodes != nil {
+		h.Nodes.Enrich(event, h.Event.InvolvedObject.Name, time.Now())
+	}
+}
+
+// NewNodeEventHandler creates a new NodeEventHandler instance
+func NewNodeEventHandler(app *application, evt *v1.Event) EventHandler {
+	return &NodeEventHandler{Event: evt, Nodes: app.nodes}
+}
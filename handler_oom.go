@@ -0,0 +1,193 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+)
+
+// systemOOMTopPods is the number of pods with the most memory added to
+// SystemOOM events.
+const systemOOMTopPods = 5
+
+var systemOOMRegexp = regexp.MustCompile(`victim process: ([^,]+), pid: (\d+)`)
+
+// SystemOOMEventHandler handles SystemOOM events, which kubelet emits when
+// the kernel of a node kills a process outside of a container memory
+// limit. These affect every workload on the node, so they are reported as
+// errors and grouped per node.
+type SystemOOMEventHandler struct {
+	Event          *v1.Event
+	Node           string
+	Process        string
+	MemoryPressure *v1.NodeCondition
+	TopPods        []string
+}
+
+// Fingerprint returns the fingerprint entries that are specific for an event type
+func (h SystemOOMEventHandler) Fingerprint() []string {
+	return nil
+}
+
+// Tags returns a set of tags that should be added to the event
+func (h SystemOOMEventHandler) Tags() map[string]string {
+	tags := map[string]string{"node": h.Node}
+	if h.Process != "" {
+		tags["oom.process"] = h.Process
+	}
+	if h.MemoryPressure != nil {
+		tags["node.memory-pressure"] = string(h.MemoryPressure.Status)
+	}
+	return tags
+}
+
+// Enrich reports the event as error grouped by node, and adds the memory
+// pressure condition of the node and the pods with the most memory.
+func (h SystemOOMEventHandler) Enrich(event *sentry.Event) {
+	event.Level = sentry.LevelError
+	event.Fingerprint = []string{"system-oom", h.Node}
+	if h.MemoryPressure != nil {
+		event.Extra["memory-pressure"] = map[string]string{
+			"status":             string(h.MemoryPressure.Status),
+			"reason":             h.MemoryPressure.Reason,
+			"message":            h.MemoryPressure.Message,
+			"lastTransitionTime": h.MemoryPressure.LastTransitionTime.UTC().Format("2006-01-02T15:04:05Z"),
+		}
+	}
+	if len(h.TopPods) > 0 {
+		event.Extra["top-memory-pods"] = h.TopPods
+	}
+}
+
+// NewSystemOOMEventHandler creates a new SystemOOMEventHandler instance for
+// SystemOOM events about a node. The node and its pods are taken from the
+// capacity cache if NODE_CAPACITY is enabled, and are requested from the API
+// server otherwise.
+func NewSystemOOMEventHandler(app *application, evt *v1.Event) EventHandler {
+	if evt.InvolvedObject.Kind != "Node" {
+		return nil
+	}
+	handler := &SystemOOMEventHandler{Event: evt, Node: evt.InvolvedObject.Name}
+	if match := systemOOMRegexp.FindStringSubmatch(evt.Message); match != nil {
+		handler.Process = match[1]
+	}
+
+	var node *v1.Node
+	var pods []*v1.Pod
+	if app.capacity != nil {
+		node = app.capacity.Node(handler.Node)
+		pods = app.capacity.PodsOnNode(handler.Node)
+	} else if app.clientset != nil {
+		if n, err := app.clientset.CoreV1().Nodes().Get(handler.Node, metav1.GetOptions{}); err == nil {
+			node = n
+		} else {
+			logger.Debug("Error getting node", "node", handler.Node, "error", err)
+		}
+		list, err := app.clientset.CoreV1().Pods(v1.NamespaceAll).List(metav1.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector("spec.nodeName", handler.Node).String(),
+		})
+		if err == nil {
+			for i := range list.Items {
+				pods = append(pods, &list.Items[i])
+			}
+		} else {
+			logger.Debug("Error listing pods on node", "node", handler.Node, "error", err)
+		}
+	}
+
+	if node != nil {
+		for i, condition := range node.Status.Conditions {
+			if condition.Type == v1.NodeMemoryPressure {
+				handler.MemoryPressure = &node.Status.Conditions[i]
+			}
+		}
+	}
+	handler.TopPods = topMemoryPods(pods, systemOOMTopPods)
+	return handler
+}
+
+// topMemoryPods describes the pods that may use the most memory. Without
+// usage metrics, pods are ordered by their memory limit, or by their memory
+// request if they have no limit.
+func topMemoryPods(pods []*v1.Pod, count int) []string {
+	type podMemory struct {
+		pod    *v1.Pod
+		memory resource.Quantity
+		limit  bool
+	}
+	var candidates []podMemory
+	for _, pod := range pods {
+		if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+			continue
+		}
+		limits := make(v1.ResourceList)
+		limited := true
+		for _, container := range pod.Spec.Containers {
+			if _, ok := container.Resources.Limits[v1.ResourceMemory]; !ok {
+				limited = false
+			}
+			addResources(limits, container.Resources.Limits)
+		}
+		candidate := podMemory{pod: pod, memory: podRequests(pod)[v1.ResourceMemory]}
+		if limited && len(pod.Spec.Containers) > 0 {
+			candidate.memory, candidate.limit = limits[v1.ResourceMemory], true
+		}
+		candidates = append(candidates, candidate)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].memory.Cmp(candidates[j].memory) > 0
+	})
+	if len(candidates) > count {
+		candidates = candidates[:count]
+	}
+
+	result := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		kind := "request"
+		if candidate.limit {
+			kind = "limit"
+		}
+		result[i] = fmt.Sprintf("%s/%s: %s %s", candidate.pod.Namespace, candidate.pod.Name, candidate.memory.String(), kind)
+	}
+	return result
+}
+
+// systemOOMAccessChecks returns the access checks for the
+// SystemOOMEventHandler. The node and its pods are only read from the API
+// server if capacity is not monitored.
+func systemOOMAccessChecks(app *application) []accessCheck {
+	if app.capacity != nil {
+		return nil
+	}
+	return []accessCheck{
+		getAccess("", "nodes", ""),
+		{
+			resource: "pods",
+			list: func(options metav1.ListOptions) error {
+				_, err := app.clientset.CoreV1().Pods(v1.NamespaceAll).List(options)
+				return err
+			},
+		},
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestSystemOOMEventHandler(t *testing.T) {
+	t.Parallel()
+
+	newPod := func(name, request, limit string) *v1.Pod {
+		pod := &v1.Pod{}
+		pod.Namespace = "shop"
+		pod.Name = name
+		pod.Spec.NodeName = "node-1"
+		container := v1.Container{Resources: v1.ResourceRequirements{
+			Requests: v1.ResourceList{v1.ResourceMemory: resource.MustParse(request)},
+		}}
+		if limit != "" {
+			container.Resources.Limits = v1.ResourceList{v1.ResourceMemory: resource.MustParse(limit)}
+		}
+		pod.Spec.Containers = []v1.Container{container}
+		return pod
+	}
+
+	node := &v1.Node{}
+	node.Name = "node-1"
+	node.Status.Conditions = []v1.NodeCondition{
+		{Type: v1.NodeReady, Status: v1.ConditionTrue},
+		{Type: v1.NodeMemoryPressure, Status: v1.ConditionTrue, Reason: "KubeletHasInsufficientMemory"},
+	}
+	tracker := newCapacityTracker()
+	tracker.nodes = cache.NewStore(cache.MetaNamespaceKeyFunc)
+	tracker.pods = cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{podNodeIndex: podNodeName})
+	tracker.nodes.Add(node)
+	tracker.pods.Add(newPod("web", "256Mi", "1Gi"))
+	tracker.pods.Add(newPod("cache", "2Gi", ""))
+	tracker.pods.Add(newPod("worker", "128Mi", "512Mi"))
+
+	evt := &v1.Event{
+		InvolvedObject: v1.ObjectReference{Kind: "Node", Name: "node-1"},
+		Reason:         "SystemOOM",
+		Message:        "System OOM encountered, victim process: java, pid: 4242",
+	}
+	handlers := NewReasonEventHandlers(&application{capacity: tracker}, evt)
+	if len(handlers) != 1 {
+		t.Fatalf("Expected a SystemOOM handler, got %d", len(handlers))
+	}
+	event := sentry.NewEvent()
+	event.Level = sentry.LevelWarning
+	applyHandler(event, handlers[0])
+
+	if event.Level != sentry.LevelError {
+		t.Errorf("Unexpected level %s", event.Level)
+	}
+	if len(event.Fingerprint) != 2 || event.Fingerprint[0] != "system-oom" || event.Fingerprint[1] != "node-1" {
+		t.Errorf("Unexpected fingerprint %v", event.Fingerprint)
+	}
+	if event.Tags["oom.process"] != "java" || event.Tags["node.memory-pressure"] != "True" {
+		t.Errorf("Unexpected tags %v", event.Tags)
+	}
+	pods, _ := event.Extra["top-memory-pods"].([]string)
+	if len(pods) != 3 || pods[0] != "shop/cache: 2Gi request" || pods[1] != "shop/web: 1Gi limit" {
+		t.Errorf("Unexpected pods %v", pods)
+	}
+}
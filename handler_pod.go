@@ -16,15 +16,30 @@ limitations under the License.
 package main
 
 import (
+	"regexp"
+	"strings"
+	"time"
+
 	"github.com/getsentry/sentry-go"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// Container types, as reported in the container.type tag.
+const (
+	containerTypeRegular   = "container"
+	containerTypeInit      = "init"
+	containerTypeEphemeral = "ephemeral"
+)
+
+var containerFieldPathRegexp = regexp.MustCompile(`^spec\.(containers|initContainers|ephemeralContainers)\{([^}]+)\}`)
+
 // PodEventHandler handles events involved Pods.
 type PodEventHandler struct {
-	Pod   *v1.Pod
-	Event *v1.Event
+	Pod      *v1.Pod
+	Event    *v1.Event
+	Nodes    *nodeTracker
+	Restarts map[string]containerHistory
 }
 
 // Fingerprint returns the fingerprint entries that are specific for an event typeX
@@ -37,8 +52,118 @@ func (h PodEventHandler) Tags() map[string]string {
 	return h.Pod.Labels
 }
 
+// Enrich adds the service account as user, StatefulSet information, the
+// resources, QoS class and restart history of the pod, and maintenance
+// activity for the node the pod is running on.
+func (h PodEventHandler) Enrich(event *sentry.Event) {
+	event.User = podUser(h.Pod)
+	event.Tags["workload"] = podWorkload(h.Pod)
+	addAppLabelTags(event, h.Pod.Labels)
+	enrichStatefulSetPod(event, h.Pod, h.Event)
+	containerType, name := containerFromFieldPath(h.Event.InvolvedObject.FieldPath)
+	if name != "" {
+		event.Tags["container"] = name
+		event.Tags["container.type"] = containerType
+	}
+	if resources := containerResources(h.Pod, name); len(resources) > 0 {
+		event.Extra["resources"] = resources
+	}
+	if h.Pod.Status.QOSClass != "" {
+		event.Extra["qos-class"] = string(h.Pod.Status.QOSClass)
+	}
+	if len(h.Restarts) > 0 {
+		event.Extra["restart-history"] = h.Restarts
+	}
+	if h.Pod.Spec.NodeName == "" {
+		return
+	}
+	event.Tags["node"] = h.Pod.Spec.NodeName
+	if h.Nodes != nil {
+		h.Nodes.Enrich(event, h.Pod.Spec.NodeName, time.Now())
+	}
+}
+
+// containerFromFieldPath returns the type and name of the container an event
+// field path refers to. Ephemeral containers are debug containers added with
+// kubectl debug.
+func containerFromFieldPath(fieldPath string) (string, string) {
+	match := containerFieldPathRegexp.FindStringSubmatch(fieldPath)
+	if match == nil {
+		return "", ""
+	}
+	switch match[1] {
+	case "initContainers":
+		return containerTypeInit, match[2]
+	case "ephemeralContainers":
+		return containerTypeEphemeral, match[2]
+	default:
+		return containerTypeRegular, match[2]
+	}
+}
+
+// containerResources returns the resource requests and limits of a
+// container of a pod, or of all its containers if name is empty.
+func containerResources(pod *v1.Pod, name string) map[string]interface{} {
+	result := make(map[string]interface{})
+	add := func(containers []v1.Container) {
+		for _, container := range containers {
+			if name != "" && container.Name != name {
+				continue
+			}
+			resources := make(map[string]map[string]string)
+			if len(container.Resources.Requests) > 0 {
+				resources["requests"] = resourceListStrings(container.Resources.Requests)
+			}
+			if len(container.Resources.Limits) > 0 {
+				resources["limits"] = resourceListStrings(container.Resources.Limits)
+			}
+			result[container.Name] = resources
+		}
+	}
+	add(pod.Spec.InitContainers)
+	add(pod.Spec.Containers)
+	return result
+}
+
+func resourceListStrings(resources v1.ResourceList) map[string]string {
+	result := make(map[string]string, len(resources))
+	for resource, quantity := range resources {
+		result[string(resource)] = quantity.String()
+	}
+	return result
+}
+
+// podUser returns a Sentry user for the service account of a pod, so issues
+// can be searched and counted by workload identity.
+func podUser(pod *v1.Pod) sentry.User {
+	account := pod.Spec.ServiceAccountName
+	if account == "" {
+		account = "default"
+	}
+	return sentry.User{
+		ID:       "system:serviceaccount:" + pod.Namespace + ":" + account,
+		Username: pod.Namespace + "/" + account,
+	}
+}
+
+// podWorkload returns the kind and name of the workload that controls a
+// pod. ReplicaSets created by a Deployment are reported as the Deployment.
+func podWorkload(pod *v1.Pod) string {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return "Pod/" + pod.Name
+	}
+	if hash := pod.Labels["pod-template-hash"]; owner.Kind == "ReplicaSet" && hash != "" && strings.HasSuffix(owner.Name, "-"+hash) {
+		return "Deployment/" + strings.TrimSuffix(owner.Name, "-"+hash)
+	}
+	return owner.Kind + "/" + owner.Name
+}
+
 // NewPodEventHandler creates a new PodEventHandler instance
 func NewPodEventHandler(app *application, evt *v1.Event) EventHandler {
+	if app.clientset == nil {
+		return nil
+	}
 	pod, err := app.clientset.CoreV1().Pods(evt.Namespace).Get(
 		evt.InvolvedObject.Name,
 		metav1.GetOptions{
@@ -49,5 +174,18 @@ func NewPodEventHandler(app *application, evt *v1.Event) EventHandler {
 		sentry.CaptureException(err)
 		return nil
 	}
-	return &PodEventHandler{Pod: pod, Event: evt}
+	_, container := containerFromFieldPath(evt.InvolvedObject.FieldPath)
+	handler := &PodEventHandler{Pod: pod, Event: evt, Nodes: app.nodes}
+	// Terminations are remembered for all events, but only added to events
+	// about failing containers.
+	restarts := restartHistory(pod, container, app.restarts)
+	if restartHistoryReasons[evt.Reason] {
+		handler.Restarts = restarts
+	}
+	return handler
+}
+
+// podAccessChecks returns the access checks for the PodEventHandler.
+func podAccessChecks(app *application) []accessCheck {
+	return []accessCheck{getAccess("", "pods", app.namespace)}
 }
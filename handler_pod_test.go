@@ -0,0 +1,103 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestContainerFromFieldPath(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		fieldPath     string
+		containerType string
+		name          string
+	}{
+		{"spec.containers{web}", containerTypeRegular, "web"},
+		{"spec.initContainers{migrate}", containerTypeInit, "migrate"},
+		{"spec.ephemeralContainers{debugger-8xk2}", containerTypeEphemeral, "debugger-8xk2"},
+		{"", "", ""},
+		{"metadata.name", "", ""},
+	}
+	for _, test := range tests {
+		containerType, name := containerFromFieldPath(test.fieldPath)
+		if containerType != test.containerType || name != test.name {
+			t.Errorf("Unexpected result for %s: %s %s", test.fieldPath, containerType, name)
+		}
+	}
+}
+
+func TestPodEventHandlerContainerTags(t *testing.T) {
+	t.Parallel()
+
+	handler := PodEventHandler{
+		Pod:   &v1.Pod{},
+		Event: &v1.Event{InvolvedObject: v1.ObjectReference{Kind: "Pod", FieldPath: "spec.ephemeralContainers{debugger}"}},
+	}
+	event := sentry.NewEvent()
+	handler.Enrich(event)
+	if event.Tags["container"] != "debugger" || event.Tags["container.type"] != containerTypeEphemeral {
+		t.Errorf("Unexpected tags: %v", event.Tags)
+	}
+}
+
+func TestPodUser(t *testing.T) {
+	t.Parallel()
+
+	pod := &v1.Pod{}
+	pod.Namespace = "shop"
+	pod.Spec.ServiceAccountName = "checkout"
+	user := podUser(pod)
+	if user.ID != "system:serviceaccount:shop:checkout" || user.Username != "shop/checkout" {
+		t.Errorf("Unexpected user: %+v", user)
+	}
+
+	pod.Spec.ServiceAccountName = ""
+	if user := podUser(pod); user.Username != "shop/default" {
+		t.Errorf("Unexpected user without service account: %+v", user)
+	}
+}
+
+func TestPodEventHandlerResources(t *testing.T) {
+	t.Parallel()
+
+	pod := &v1.Pod{}
+	pod.Spec.Containers = []v1.Container{
+		{
+			Name: "web",
+			Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("100m"), v1.ResourceMemory: resource.MustParse("128Mi")},
+				Limits:   v1.ResourceList{v1.ResourceMemory: resource.MustParse("256Mi")},
+			},
+		},
+		{Name: "proxy"},
+	}
+	pod.Status.QOSClass = v1.PodQOSBurstable
+
+	handler := PodEventHandler{
+		Pod:   pod,
+		Event: &v1.Event{InvolvedObject: v1.ObjectReference{Kind: "Pod", FieldPath: "spec.containers{web}"}},
+	}
+	event := sentry.NewEvent()
+	handler.Enrich(event)
+	expected := map[string]interface{}{
+		"web": map[string]map[string]string{
+			"requests": {"cpu": "100m", "memory": "128Mi"},
+			"limits":   {"memory": "256Mi"},
+		},
+	}
+	if !reflect.DeepEqual(event.Extra["resources"], expected) {
+		t.Errorf("Unexpected resources: %v", event.Extra["resources"])
+	}
+	if event.Extra["qos-class"] != "Burstable" {
+		t.Errorf("Unexpected QoS class: %v", event.Extra["qos-class"])
+	}
+
+	if resources := containerResources(pod, ""); len(resources) != 2 {
+		t.Errorf("Expected resources of all containers, got %v", resources)
+	}
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"regexp"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var preemptedRegexp = regexp.MustCompile(`^Preempted by ([^/\s]+)/(\S+) on node (\S+)`)
+
+// PreemptionEventHandler handles events for pods that were preempted by a
+// pod with a higher priority.
+type PreemptionEventHandler struct {
+	Event              *v1.Event
+	Level              sentry.Level
+	PreemptorNamespace string
+	PreemptorName      string
+	Node               string
+	PriorityClass      string
+	Owner              *metav1.OwnerReference
+}
+
+// Fingerprint returns the fingerprint entries that are specific for an event type
+func (h PreemptionEventHandler) Fingerprint() []string {
+	return nil
+}
+
+// Tags returns a set of tags that should be added to the event
+func (h PreemptionEventHandler) Tags() map[string]string {
+	tags := map[string]string{
+		"preemption.preemptor": h.PreemptorNamespace + "/" + h.PreemptorName,
+		"preemption.node":      h.Node,
+	}
+	if h.PriorityClass != "" {
+		tags["preemption.priority-class"] = h.PriorityClass
+	}
+	if h.Owner != nil {
+		tags["preemption.victim-owner"] = h.Owner.Kind + "/" + h.Owner.Name
+	}
+	return tags
+}
+
+// Enrich sets the configured level, and groups preemptions by the workload
+// of the victim and the priority class of the preemptor.
+func (h PreemptionEventHandler) Enrich(event *sentry.Event) {
+	event.Level = h.Level
+	fingerprint := []string{"preemption", h.Event.InvolvedObject.Namespace}
+	if h.Owner != nil {
+		fingerprint = append(fingerprint, h.Owner.Kind, h.Owner.Name)
+	} else {
+		fingerprint = append(fingerprint, h.Event.InvolvedObject.Name)
+	}
+	event.Fingerprint = append(fingerprint, h.PriorityClass)
+}
+
+// NewPreemptionEventHandler creates a new PreemptionEventHandler instance if
+// reporting preemptions is enabled.
+func NewPreemptionEventHandler(app *application, evt *v1.Event) EventHandler {
+	if app.preemptionLevel == "" {
+		return nil
+	}
+	match := preemptedRegexp.FindStringSubmatch(evt.Message)
+	if match == nil {
+		return nil
+	}
+	handler := &PreemptionEventHandler{
+		Event:              evt,
+		Level:              app.preemptionLevel,
+		PreemptorNamespace: match[1],
+		PreemptorName:      match[2],
+		Node:               match[3],
+	}
+	if app.clientset == nil {
+		return handler
+	}
+
+	if preemptor, err := app.clientset.CoreV1().Pods(handler.PreemptorNamespace).Get(handler.PreemptorName, metav1.GetOptions{}); err == nil {
+		handler.PriorityClass = preemptor.Spec.PriorityClassName
+	} else {
+		logger.Debug("Unable to get preemptor pod", eventFields(evt, "error", err)...)
+	}
+	// The victim may already be gone, in which case the workload is unknown.
+	if victim, err := app.clientset.CoreV1().Pods(evt.InvolvedObject.Namespace).Get(evt.InvolvedObject.Name, metav1.GetOptions{}); err == nil {
+		handler.Owner = metav1.GetControllerOf(victim)
+	}
+	return handler
+}
+
+// isPreemption returns true for the Normal events the scheduler emits for
+// preempted pods.
+func isPreemption(evt *v1.Event) bool {
+	return evt.Reason == "Preempted" && evt.InvolvedObject.Kind == "Pod"
+}
+
+// preemptionAccessChecks returns the access checks for the
+// PreemptionEventHandler.
+func preemptionAccessChecks(app *application) []accessCheck {
+	return []accessCheck{getAccess("", "pods", app.namespace)}
+}
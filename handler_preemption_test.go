@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPreemptionEventHandler(t *testing.T) {
+	t.Parallel()
+
+	evt := &v1.Event{
+		Type:           v1.EventTypeNormal,
+		InvolvedObject: v1.ObjectReference{Kind: "Pod", Namespace: "batch", Name: "report-x7k2p"},
+		Reason:         "Preempted",
+		Message:        "Preempted by critical/ingest-0 on node node-7",
+	}
+	if NewPreemptionEventHandler(&application{}, evt) != nil {
+		t.Error("Preemption handled while disabled")
+	}
+
+	handler := NewPreemptionEventHandler(&application{preemptionLevel: sentry.LevelInfo}, evt)
+	if handler == nil {
+		t.Fatal("Preemption not recognised")
+	}
+	preemption := handler.(*PreemptionEventHandler)
+	preemption.PriorityClass = "critical"
+	preemption.Owner = &metav1.OwnerReference{Kind: "Job", Name: "report"}
+
+	tags := handler.Tags()
+	if tags["preemption.preemptor"] != "critical/ingest-0" || tags["preemption.node"] != "node-7" || tags["preemption.victim-owner"] != "Job/report" {
+		t.Errorf("Unexpected tags: %v", tags)
+	}
+	event := sentry.NewEvent()
+	preemption.Enrich(event)
+	if event.Level != sentry.LevelInfo || len(event.Fingerprint) != 5 {
+		t.Errorf("Unexpected level %s or fingerprint %v", event.Level, event.Fingerprint)
+	}
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+)
+
+var (
+	probeFailureRegexp = regexp.MustCompile(`^(Liveness|Readiness|Startup) probe (?:failed|errored): ?(.*)$`)
+	probeStatusRegexp  = regexp.MustCompile(`statuscode: (\d+)`)
+	probeURLRegexp     = regexp.MustCompile(`(?:Get|Head|Post) "?(https?://[^"\s]+?)"?: `)
+)
+
+// Probe failure results, as reported in the probe.result tag.
+const (
+	probeResultTimeout = "timeout"
+	probeResultRefused = "connection refused"
+	probeResultReset   = "connection reset"
+	probeResultFailed  = "failed"
+)
+
+// ProbeEventHandler handles Unhealthy events for failing liveness,
+// readiness and startup probes. The probe type and result are used for
+// grouping, so an endpoint returning errors is distinguishable from an
+// endpoint that times out.
+type ProbeEventHandler struct {
+	Event  *v1.Event
+	Probe  string
+	Result string
+	Path   string
+}
+
+// Fingerprint returns the fingerprint entries that are specific for an event type
+func (h ProbeEventHandler) Fingerprint() []string {
+	return nil
+}
+
+// Tags returns a set of tags that should be added to the event
+func (h ProbeEventHandler) Tags() map[string]string {
+	tags := map[string]string{
+		"probe.type":   h.Probe,
+		"probe.result": h.Result,
+	}
+	if h.Path != "" {
+		tags["probe.path"] = h.Path
+	}
+	return tags
+}
+
+// Enrich replaces the message in the fingerprint with the probe type and
+// result, since the message contains the pod IP.
+func (h ProbeEventHandler) Enrich(event *sentry.Event) {
+	for i, entry := range event.Fingerprint {
+		if entry == h.Event.Message {
+			event.Fingerprint[i] = "Unhealthy: " + h.Probe + " " + h.Result
+		}
+	}
+}
+
+// NewProbeEventHandler creates a new ProbeEventHandler instance if the event
+// message can be parsed.
+func NewProbeEventHandler(app *application, evt *v1.Event) EventHandler {
+	probe, result, path := parseProbeMessage(evt.Message)
+	if probe == "" {
+		return nil
+	}
+	return &ProbeEventHandler{Event: evt, Probe: probe, Result: result, Path: path}
+}
+
+// parseProbeMessage returns the probe type, result and HTTP path from the
+// message of an Unhealthy event.
+func parseProbeMessage(message string) (string, string, string) {
+	match := probeFailureRegexp.FindStringSubmatch(strings.TrimSpace(message))
+	if match == nil {
+		return "", "", ""
+	}
+	probe := strings.ToLower(match[1])
+	detail := match[2]
+
+	var path string
+	if u := probeURLRegexp.FindStringSubmatch(detail); u != nil {
+		if parsed, err := url.Parse(u[1]); err == nil {
+			path = parsed.Path
+		}
+	}
+
+	lower := strings.ToLower(detail)
+	var result string
+	switch {
+	case probeStatusRegexp.MatchString(detail):
+		result = "status " + probeStatusRegexp.FindStringSubmatch(detail)[1]
+	case strings.Contains(lower, "timeout") || strings.Contains(lower, "deadline exceeded") || strings.Contains(lower, "timed out"):
+		result = probeResultTimeout
+	case strings.Contains(lower, "connection refused"):
+		result = probeResultRefused
+	case strings.Contains(lower, "connection reset"):
+		result = probeResultReset
+	default:
+		result = probeResultFailed
+	}
+	return probe, result, path
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestParseProbeMessage(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		message string
+		probe   string
+		result  string
+		path    string
+	}{
+		{"Readiness probe failed: HTTP probe failed with statuscode: 503", "readiness", "status 503", ""},
+		{"Liveness probe failed: Get http://10.0.0.1:8080/healthz: net/http: request canceled (Client.Timeout exceeded while awaiting headers)", "liveness", probeResultTimeout, "/healthz"},
+		{`Liveness probe failed: Get "http://10.1.2.3:8080/live?full=1": context deadline exceeded`, "liveness", probeResultTimeout, "/live"},
+		{"Readiness probe failed: dial tcp 10.0.0.1:5432: connect: connection refused", "readiness", probeResultRefused, ""},
+		{"Startup probe failed: pg_isready: no response", "startup", probeResultFailed, ""},
+		{"Liveness probe errored: rpc error: code = DeadlineExceeded desc = context deadline exceeded", "liveness", probeResultTimeout, ""},
+		{"Back-off restarting failed container", "", "", ""},
+	}
+	for _, test := range tests {
+		probe, result, path := parseProbeMessage(test.message)
+		if probe != test.probe || result != test.result || path != test.path {
+			t.Errorf("Unexpected result for %s: %s %s %s", test.message, probe, result, path)
+		}
+	}
+}
+
+func TestProbeEventHandlerFingerprint(t *testing.T) {
+	t.Parallel()
+
+	evt := &v1.Event{Reason: "Unhealthy", Message: "Readiness probe failed: HTTP probe failed with statuscode: 503"}
+	event := sentry.NewEvent()
+	event.Fingerprint = []string{"kubelet", "Warning", "Unhealthy", evt.Message}
+	applyHandler(event, NewProbeEventHandler(&application{}, evt))
+	if event.Fingerprint[3] != "Unhealthy: readiness status 503" {
+		t.Errorf("Unexpected fingerprint: %v", event.Fingerprint)
+	}
+	if event.Tags["probe.type"] != "readiness" || event.Tags["probe.result"] != "status 503" {
+		t.Errorf("Unexpected tags: %v", event.Tags)
+	}
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var quotaExceededRegexp = regexp.MustCompile(`exceeded quota: ([^,\s]+)(?:, requested: ([^\s,]+(?:,[^\s,]+)*))?`)
+
+// QuotaEventHandler handles events caused by a request being rejected
+// because it would exceed a ResourceQuota.
+type QuotaEventHandler struct {
+	Event     *v1.Event
+	Quota     string
+	Resources []string
+	Status    *v1.ResourceQuotaStatus
+}
+
+// Fingerprint returns the fingerprint entries that are specific for an event type
+func (h QuotaEventHandler) Fingerprint() []string {
+	return nil
+}
+
+// Tags returns a set of tags that should be added to the event
+func (h QuotaEventHandler) Tags() map[string]string {
+	tags := map[string]string{"quota.name": h.Quota}
+	if len(h.Resources) > 0 {
+		tags["quota.resources"] = strings.Join(h.Resources, ",")
+	}
+	return tags
+}
+
+// Enrich groups the event by namespace and quota resources, and adds the
+// current quota usage.
+func (h QuotaEventHandler) Enrich(event *sentry.Event) {
+	event.Fingerprint = append([]string{"resource-quota", h.Event.InvolvedObject.Namespace, h.Quota}, h.Resources...)
+	if h.Status == nil {
+		return
+	}
+	usage := make(map[string]string)
+	for name, hard := range h.Status.Hard {
+		used := h.Status.Used[name]
+		usage[string(name)] = used.String() + "/" + hard.String()
+	}
+	event.Extra["quota-usage"] = usage
+}
+
+// NewQuotaEventHandler creates a new QuotaEventHandler instance if the event
+// was caused by an exceeded quota.
+func NewQuotaEventHandler(app *application, evt *v1.Event) EventHandler {
+	match := quotaExceededRegexp.FindStringSubmatch(evt.Message)
+	if match == nil {
+		return nil
+	}
+	handler := &QuotaEventHandler{
+		Event:     evt,
+		Quota:     match[1],
+		Resources: quotaResources(match[2]),
+	}
+	if app.clientset != nil {
+		quota, err := app.clientset.CoreV1().ResourceQuotas(evt.InvolvedObject.Namespace).Get(handler.Quota, metav1.GetOptions{})
+		if err != nil {
+			logger.Debug("Unable to get resource quota", "namespace", evt.InvolvedObject.Namespace, "quota", handler.Quota, "error", err)
+		} else {
+			handler.Status = &quota.Status
+		}
+	}
+	return handler
+}
+
+// quotaResources returns the sorted resource names from a list of
+// resource=quantity pairs.
+func quotaResources(requested string) []string {
+	var resources []string
+	for _, item := range parseList(requested) {
+		resources = append(resources, strings.SplitN(item, "=", 2)[0])
+	}
+	sort.Strings(resources)
+	return resources
+}
+
+// quotaAccessChecks returns the access checks for the QuotaEventHandler.
+func quotaAccessChecks(app *application) []accessCheck {
+	return []accessCheck{getAccess("", "resourcequotas", app.namespace)}
+}
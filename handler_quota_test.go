@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestQuotaEventHandler(t *testing.T) {
+	t.Parallel()
+
+	evt := &v1.Event{
+		InvolvedObject: v1.ObjectReference{Kind: "ReplicaSet", Namespace: "shop", Name: "web-5d4f"},
+		Reason:         "FailedCreate",
+		Message:        `Error creating: pods "web-5d4f-x2x8q" is forbidden: exceeded quota: compute, requested: limits.memory=1Gi,limits.cpu=2, used: limits.cpu=10,limits.memory=5Gi, limited: limits.cpu=10,limits.memory=8Gi`,
+	}
+	handler := NewQuotaEventHandler(&application{}, evt)
+	if handler == nil {
+		t.Fatal("Quota failure not recognised")
+	}
+	quotaHandler := handler.(*QuotaEventHandler)
+	quotaHandler.Status = &v1.ResourceQuotaStatus{
+		Hard: v1.ResourceList{v1.ResourceLimitsCPU: resource.MustParse("10")},
+		Used: v1.ResourceList{v1.ResourceLimitsCPU: resource.MustParse("10")},
+	}
+
+	if tags := handler.Tags(); tags["quota.name"] != "compute" || tags["quota.resources"] != "limits.cpu,limits.memory" {
+		t.Errorf("Unexpected tags: %v", tags)
+	}
+
+	event := sentry.NewEvent()
+	quotaHandler.Enrich(event)
+	expected := []string{"resource-quota", "shop", "compute", "limits.cpu", "limits.memory"}
+	if len(event.Fingerprint) != len(expected) {
+		t.Fatalf("Unexpected fingerprint: %v", event.Fingerprint)
+	}
+	for i := range expected {
+		if event.Fingerprint[i] != expected[i] {
+			t.Errorf("Unexpected fingerprint: %v", event.Fingerprint)
+		}
+	}
+	if usage := event.Extra["quota-usage"].(map[string]string); usage["limits.cpu"] != "10/10" {
+		t.Errorf("Unexpected quota usage: %v", usage)
+	}
+
+	evt.Message = "Error creating: Internal error occurred"
+	if NewQuotaEventHandler(&application{}, evt) != nil {
+		t.Error("Other failure recognised as quota failure")
+	}
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+)
+
+var (
+	schedulingFailureRegexp = regexp.MustCompile(`^0/(\d+) nodes are available: (.*)$`)
+	schedulingCauseRegexp   = regexp.MustCompile(`^(\d+) (.+)$`)
+)
+
+// SchedulingEventHandler handles FailedScheduling events. The scheduler
+// includes node counts in its messages, which change with the size of the
+// cluster, so the causes are extracted to group failures by cause.
+type SchedulingEventHandler struct {
+	Event    *v1.Event
+	Nodes    int
+	Causes   map[string]int
+	Capacity map[string]*poolCapacity
+}
+
+// Fingerprint returns the fingerprint entries that are specific for an event type
+func (h SchedulingEventHandler) Fingerprint() []string {
+	return nil
+}
+
+// Tags returns a set of tags that should be added to the event
+func (h SchedulingEventHandler) Tags() map[string]string {
+	return map[string]string{"scheduling.causes": strings.Join(h.causeNames(), ", ")}
+}
+
+// Enrich replaces the message in the fingerprint with the scheduling causes,
+// and adds the number of nodes per cause and the capacity of every node
+// pool.
+func (h SchedulingEventHandler) Enrich(event *sentry.Event) {
+	for i, entry := range event.Fingerprint {
+		if entry == h.Event.Message {
+			event.Fingerprint[i] = "FailedScheduling: " + strings.Join(h.causeNames(), ", ")
+		}
+	}
+	event.Extra["scheduling-nodes"] = h.Nodes
+	event.Extra["scheduling-causes"] = h.Causes
+	if h.Capacity != nil {
+		event.Extra["node-capacity"] = h.Capacity
+	}
+}
+
+func (h SchedulingEventHandler) causeNames() []string {
+	names := make([]string, 0, len(h.Causes))
+	for name := range h.Causes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewSchedulingEventHandler creates a new SchedulingEventHandler instance if
+// the event message can be parsed.
+func NewSchedulingEventHandler(app *application, evt *v1.Event) EventHandler {
+	nodes, causes := parseSchedulingMessage(evt.Message)
+	if causes == nil {
+		return nil
+	}
+	handler := &SchedulingEventHandler{Event: evt, Nodes: nodes, Causes: causes}
+	if app.capacity != nil {
+		handler.Capacity = app.capacity.Summary()
+	}
+	return handler
+}
+
+// parseSchedulingMessage parses a message such as "0/12 nodes are available:
+// 3 Insufficient cpu, 9 node(s) didn't match node selector." into the total
+// number of nodes and the number of nodes per cause.
+func parseSchedulingMessage(message string) (int, map[string]int) {
+	// Newer schedulers append the result of the preemption attempt.
+	if i := strings.Index(message, " preemption: "); i != -1 {
+		message = message[:i]
+	}
+	match := schedulingFailureRegexp.FindStringSubmatch(strings.TrimSpace(message))
+	if match == nil {
+		return 0, nil
+	}
+	nodes, _ := strconv.Atoi(match[1])
+	causes := make(map[string]int)
+	for _, part := range strings.Split(strings.TrimSuffix(match[2], "."), ", ") {
+		if cause := schedulingCauseRegexp.FindStringSubmatch(part); cause != nil {
+			count, _ := strconv.Atoi(cause[1])
+			causes[cause[2]] += count
+		} else if part = strings.TrimSpace(part); part != "" {
+			causes[part] = 0
+		}
+	}
+	if len(causes) == 0 {
+		return 0, nil
+	}
+	return nodes, causes
+}
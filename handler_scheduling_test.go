@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestParseSchedulingMessage(t *testing.T) {
+	t.Parallel()
+
+	nodes, causes := parseSchedulingMessage("0/12 nodes are available: 3 Insufficient cpu, 9 node(s) didn't match node selector.")
+	if nodes != 12 {
+		t.Errorf("Unexpected number of nodes: %d", nodes)
+	}
+	if len(causes) != 2 || causes["Insufficient cpu"] != 3 || causes["node(s) didn't match node selector"] != 9 {
+		t.Errorf("Unexpected causes: %v", causes)
+	}
+
+	_, causes = parseSchedulingMessage("0/3 nodes are available: 3 Insufficient memory. preemption: 0/3 nodes are available: 3 No preemption victims found.")
+	if len(causes) != 1 || causes["Insufficient memory"] != 3 {
+		t.Errorf("Unexpected causes with preemption: %v", causes)
+	}
+
+	if _, causes := parseSchedulingMessage("pod has unbound immediate PersistentVolumeClaims"); causes != nil {
+		t.Errorf("Unexpected causes for other message: %v", causes)
+	}
+}
+
+func TestSchedulingEventHandlerFingerprint(t *testing.T) {
+	t.Parallel()
+
+	fingerprint := func(message string) string {
+		evt := &v1.Event{Reason: "FailedScheduling", Message: message}
+		event := sentry.NewEvent()
+		event.Fingerprint = []string{"default-scheduler", "Warning", "FailedScheduling", message}
+		applyHandler(event, NewSchedulingEventHandler(&application{}, evt))
+		return event.Fingerprint[3]
+	}
+	small := fingerprint("0/3 nodes are available: 1 Insufficient cpu, 2 node(s) had taints that the pod didn't tolerate.")
+	large := fingerprint("0/12 nodes are available: 9 node(s) had taints that the pod didn't tolerate, 3 Insufficient cpu.")
+	if small != large {
+		t.Errorf("Fingerprints differ: %q and %q", small, large)
+	}
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"regexp"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var volumeNameRegexp = regexp.MustCompile(`(?:for volume "|unmounted volumes=\[)([^"\s,\]]+)`)
+
+// VolumeEventHandler handles volume attach and mount failures. These are
+// grouped by storage driver and class, since failures for many volumes at
+// the same time usually indicate a problem in the storage layer.
+type VolumeEventHandler struct {
+	Event  *v1.Event
+	Volume string
+	PVC    *v1.PersistentVolumeClaim
+	PV     *v1.PersistentVolume
+}
+
+// Fingerprint returns the fingerprint entries that are specific for an event type
+func (h VolumeEventHandler) Fingerprint() []string {
+	return nil
+}
+
+// Tags returns a set of tags that should be added to the event
+func (h VolumeEventHandler) Tags() map[string]string {
+	tags := map[string]string{"volume": h.Volume}
+	if h.PVC != nil {
+		tags["volume.pvc"] = h.PVC.Name
+	}
+	if h.PV != nil {
+		tags["volume.pv"] = h.PV.Name
+		if driver := volumeDriver(h.PV); driver != "" {
+			tags["volume.driver"] = driver
+		}
+		if h.PV.Spec.StorageClassName != "" {
+			tags["volume.storage-class"] = h.PV.Spec.StorageClassName
+		}
+	}
+	return tags
+}
+
+// Enrich groups the event by driver and storage class, and adds the node
+// affinity of the volume.
+func (h VolumeEventHandler) Enrich(event *sentry.Event) {
+	if h.PV == nil {
+		return
+	}
+	if driver := volumeDriver(h.PV); driver != "" {
+		event.Fingerprint = []string{"volume", h.Event.Reason, driver, h.PV.Spec.StorageClassName}
+	}
+	if h.PV.Spec.NodeAffinity != nil && h.PV.Spec.NodeAffinity.Required != nil {
+		event.Extra["volume-node-affinity"] = h.PV.Spec.NodeAffinity.Required.NodeSelectorTerms
+	}
+}
+
+// NewVolumeEventHandler creates a new VolumeEventHandler instance, resolving
+// the PersistentVolumeClaim and PersistentVolume for the volume.
+func NewVolumeEventHandler(app *application, evt *v1.Event) EventHandler {
+	match := volumeNameRegexp.FindStringSubmatch(evt.Message)
+	if match == nil {
+		return nil
+	}
+	handler := &VolumeEventHandler{Event: evt, Volume: match[1]}
+	if app.clientset == nil {
+		return handler
+	}
+
+	// Attach failures use the name of the PersistentVolume, mount failures
+	// the name of the volume in the pod.
+	if evt.Reason == "FailedAttachVolume" {
+		if pv, err := app.clientset.CoreV1().PersistentVolumes().Get(handler.Volume, metav1.GetOptions{}); err == nil {
+			handler.PV = pv
+			return handler
+		}
+	}
+	if evt.InvolvedObject.Kind != "Pod" {
+		return handler
+	}
+	pod, err := app.clientset.CoreV1().Pods(evt.InvolvedObject.Namespace).Get(evt.InvolvedObject.Name, metav1.GetOptions{})
+	if err != nil {
+		logger.Debug("Unable to get pod", eventFields(evt, "error", err)...)
+		return handler
+	}
+	for _, volume := range pod.Spec.Volumes {
+		if volume.Name != handler.Volume || volume.PersistentVolumeClaim == nil {
+			continue
+		}
+		pvc, err := app.clientset.CoreV1().PersistentVolumeClaims(pod.Namespace).Get(volume.PersistentVolumeClaim.ClaimName, metav1.GetOptions{})
+		if err != nil {
+			logger.Debug("Unable to get persistent volume claim", eventFields(evt, "error", err)...)
+			break
+		}
+		handler.PVC = pvc
+		if pvc.Spec.VolumeName != "" {
+			if pv, err := app.clientset.CoreV1().PersistentVolumes().Get(pvc.Spec.VolumeName, metav1.GetOptions{}); err == nil {
+				handler.PV = pv
+			}
+		}
+		break
+	}
+	return handler
+}
+
+// volumeDriver returns the name of the driver for a PersistentVolume.
+func volumeDriver(pv *v1.PersistentVolume) string {
+	if pv.Spec.CSI != nil {
+		return pv.Spec.CSI.Driver
+	}
+	return pv.Annotations["pv.kubernetes.io/provisioned-by"]
+}
+
+// volumeAccessChecks returns the access checks for the VolumeEventHandler,
+// which follows the volumes of a pod to their PersistentVolumes.
+func volumeAccessChecks(app *application) []accessCheck {
+	return []accessCheck{
+		getAccess("", "pods", app.namespace),
+		getAccess("", "persistentvolumeclaims", app.namespace),
+		getAccess("", "persistentvolumes", ""),
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestVolumeEventHandler(t *testing.T) {
+	t.Parallel()
+
+	messages := map[string]string{
+		`AttachVolume.Attach failed for volume "pvc-0a1b2c" : rpc error: code = DeadlineExceeded desc = context deadline exceeded`:          "pvc-0a1b2c",
+		`MountVolume.SetUp failed for volume "data" : mount failed: exit status 32`:                                                         "data",
+		`Unable to attach or mount volumes: unmounted volumes=[data], unattached volumes=[data token]: timed out waiting for the condition`: "data",
+	}
+	for message, volume := range messages {
+		handler := NewVolumeEventHandler(&application{}, &v1.Event{Reason: "FailedMount", Message: message})
+		if handler == nil {
+			t.Errorf("Volume failure not recognised: %s", message)
+		} else if tags := handler.Tags(); tags["volume"] != volume {
+			t.Errorf("Unexpected volume %q for %s", tags["volume"], message)
+		}
+	}
+
+	handler := &VolumeEventHandler{
+		Event:  &v1.Event{Reason: "FailedAttachVolume"},
+		Volume: "pvc-0a1b2c",
+		PV: &v1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "pvc-0a1b2c"},
+			Spec: v1.PersistentVolumeSpec{
+				StorageClassName:       "gp2",
+				PersistentVolumeSource: v1.PersistentVolumeSource{CSI: &v1.CSIPersistentVolumeSource{Driver: "ebs.csi.aws.com"}},
+			},
+		},
+	}
+	event := sentry.NewEvent()
+	handler.Enrich(event)
+	if len(event.Fingerprint) != 4 || event.Fingerprint[2] != "ebs.csi.aws.com" || event.Fingerprint[3] != "gp2" {
+		t.Errorf("Unexpected fingerprint: %v", event.Fingerprint)
+	}
+}
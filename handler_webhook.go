@@ -0,0 +1,79 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+)
+
+var webhookFailureRegexp = regexp.MustCompile(`failed calling (?:admission )?webhook "([^"]+)": (?:[A-Za-z]+ "?https?://([^/:"]+))?`)
+
+// WebhookEventHandler handles events caused by failing admission webhooks.
+// A broken webhook can block all changes to a cluster, so these are always
+// reported as errors.
+type WebhookEventHandler struct {
+	Event   *v1.Event
+	Webhook string
+	Service string
+}
+
+// Fingerprint returns the fingerprint entries that are specific for an event type
+func (h WebhookEventHandler) Fingerprint() []string {
+	return nil
+}
+
+// Tags returns a set of tags that should be added to the event
+func (h WebhookEventHandler) Tags() map[string]string {
+	tags := map[string]string{"webhook.name": h.Webhook}
+	if h.Service != "" {
+		tags["webhook.service"] = h.Service
+	}
+	return tags
+}
+
+// Enrich reports the event as error, grouped by webhook.
+func (h WebhookEventHandler) Enrich(event *sentry.Event) {
+	event.Level = sentry.LevelError
+	event.Fingerprint = []string{"admission-webhook", h.Webhook, h.Event.InvolvedObject.Namespace}
+}
+
+// NewWebhookEventHandler creates a new WebhookEventHandler instance if the
+// event was caused by a failing webhook.
+func NewWebhookEventHandler(app *application, evt *v1.Event) EventHandler {
+	match := webhookFailureRegexp.FindStringSubmatch(evt.Message)
+	if match == nil {
+		return nil
+	}
+	return &WebhookEventHandler{
+		Event:   evt,
+		Webhook: match[1],
+		Service: webhookService(match[2]),
+	}
+}
+
+// webhookService converts the hostname of an in-cluster service
+// (name.namespace.svc) to namespace/name.
+func webhookService(host string) string {
+	parts := strings.Split(host, ".")
+	if len(parts) >= 3 && parts[2] == "svc" {
+		return parts[1] + "/" + parts[0]
+	}
+	return host
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestWebhookEventHandler(t *testing.T) {
+	t.Parallel()
+
+	evt := &v1.Event{
+		Reason:  "FailedCreate",
+		Message: `Error creating: Internal error occurred: failed calling webhook "validate.nginx.ingress.kubernetes.io": Post https://ingress-nginx-controller-admission.ingress-nginx.svc:443/networking/v1beta1/ingresses?timeout=10s: dial tcp 10.0.0.1:443: connect: connection refused`,
+	}
+	handler := NewWebhookEventHandler(&application{}, evt)
+	if handler == nil {
+		t.Fatal("Webhook failure not recognised")
+	}
+	tags := handler.Tags()
+	if tags["webhook.name"] != "validate.nginx.ingress.kubernetes.io" {
+		t.Errorf("Unexpected webhook name: %s", tags["webhook.name"])
+	}
+	if tags["webhook.service"] != "ingress-nginx/ingress-nginx-controller-admission" {
+		t.Errorf("Unexpected webhook service: %s", tags["webhook.service"])
+	}
+
+	evt.Message = `Error creating: pods "web-1" is forbidden: exceeded quota: compute`
+	if NewWebhookEventHandler(&application{}, evt) != nil {
+		t.Error("Quota failure recognised as webhook failure")
+	}
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// healthServer serves liveness and readiness checks for Kubernetes probes,
+// and metrics for Prometheus.
+type healthServer struct {
+	watches *watchMonitor
+	syncs   *syncTracker
+}
+
+func newHealthServer(watches *watchMonitor, syncs *syncTracker) *healthServer {
+	return &healthServer{watches: watches, syncs: syncs}
+}
+
+// Start serves the health checks on address in the background.
+func (s *healthServer) Start(address string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.live)
+	mux.HandleFunc("/readyz", s.ready)
+	mux.HandleFunc("/metrics", s.metrics)
+
+	go func() {
+		logger.Info("Starting health server", "address", address)
+		if err := http.ListenAndServe(address, mux); err != nil {
+			logger.Error("Error running health server", "error", err)
+		}
+	}()
+}
+
+func (s *healthServer) live(w http.ResponseWriter, req *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+// ready fails until all informers have synced, and if an informer is unable
+// to watch its resources. With the verbose parameter the sync status of
+// every informer is included.
+func (s *healthServer) ready(w http.ResponseWriter, req *http.Request) {
+	problems := s.watches.Failing()
+	for _, name := range s.syncs.Unsynced(nil) {
+		problems = append(problems, name+" not synced")
+	}
+
+	var body strings.Builder
+	if _, verbose := req.URL.Query()["verbose"]; verbose {
+		status := s.syncs.Status()
+		var names []string
+		for name := range status {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if status[name] {
+				fmt.Fprintf(&body, "[+]%s synced\n", name)
+			} else {
+				fmt.Fprintf(&body, "[-]%s not synced\n", name)
+			}
+		}
+	}
+	if len(problems) > 0 {
+		body.WriteString(strings.Join(problems, "\n"))
+		http.Error(w, body.String(), http.StatusServiceUnavailable)
+		return
+	}
+	body.WriteString("ok")
+	fmt.Fprintln(w, body.String())
+}
+
+// metrics reports the number of events dropped because a queue was full,
+// and the number of relists of every informer, in the Prometheus text
+// format.
+func (s *healthServer) metrics(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintln(w, "# HELP k8s_sentry_dropped_events_total Events dropped because a queue was full.")
+	fmt.Fprintln(w, "# TYPE k8s_sentry_dropped_events_total counter")
+	keys, counts := droppedEvents.Counts()
+	for i, key := range keys {
+		fmt.Fprintf(w, "k8s_sentry_dropped_events_total{queue=%q,level=%q} %d\n", key.Queue, key.Level, counts[i])
+	}
+	fmt.Fprintln(w, "# HELP k8s_sentry_relists_total Lists of all resources after a watch could not be resumed.")
+	fmt.Fprintln(w, "# TYPE k8s_sentry_relists_total counter")
+	for _, relists := range s.watches.Relists() {
+		fmt.Fprintf(w, "k8s_sentry_relists_total{cluster=%q,resource=%q} %d\n", relists.Cluster, relists.Resource, relists.Count)
+	}
+}
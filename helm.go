@@ -0,0 +1,171 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/tools/cache"
+)
+
+// helmStatusLevels are the statuses of Helm releases that are reported,
+// with their level.
+var helmStatusLevels = map[string]sentry.Level{
+	"failed":           sentry.LevelError,
+	"pending-rollback": sentry.LevelWarning,
+}
+
+// helmRelease contains the fields of a Helm 3 release that are reported.
+type helmRelease struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Version   int    `json:"version"`
+	Info      struct {
+		Status      string `json:"status"`
+		Description string `json:"description"`
+	} `json:"info"`
+	Chart struct {
+		Metadata struct {
+			Name       string `json:"name"`
+			Version    string `json:"version"`
+			AppVersion string `json:"appVersion"`
+		} `json:"metadata"`
+	} `json:"chart"`
+}
+
+func (app *application) monitorHelmReleases(stop chan struct{}) {
+	started := time.Now()
+	watchList := cache.NewFilteredListWatchFromClient(
+		app.clientset.CoreV1().RESTClient(),
+		"secrets",
+		app.namespace,
+		func(options *metav1.ListOptions) {
+			options.LabelSelector = "owner=helm"
+			options.FieldSelector = fields.OneTermEqualSelector("type", "helm.sh/release.v1").String()
+		},
+	)
+	report := func(secret *v1.Secret) {
+		release, err := decodeHelmRelease(secret)
+		if err != nil {
+			logger.Warning("Error decoding Helm release", "namespace", secret.Namespace, "secret", secret.Name, "error", err)
+			return
+		}
+		logger.Info("Reporting Helm release", "namespace", release.Namespace, "release", release.Name, "status", release.Info.Status)
+		key := fmt.Sprintf("helm-release/%s/%s/%d/%s", release.Namespace, release.Name, release.Version, release.Info.Status)
+		app.reportMonitorEvent(app.newHelmReleaseEvent(release), objectReference("Secret", secret), key)
+	}
+	_, controller := cache.NewInformer(
+		app.instrument("Helm release monitor", "secrets", watchList),
+		&v1.Secret{},
+		0,
+		recoverHandlers("Helm release monitor", cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				// Releases that already existed when k8s-sentry started have
+				// been reported before.
+				if secret, ok := obj.(*v1.Secret); ok && secret.CreationTimestamp.After(started) {
+					if _, ok := helmStatusLevels[secret.Labels["status"]]; ok {
+						report(secret)
+					}
+				}
+			},
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				oldSecret, ok := oldObj.(*v1.Secret)
+				if !ok {
+					return
+				}
+				secret, ok := newObj.(*v1.Secret)
+				if !ok || oldSecret.Labels["status"] == secret.Labels["status"] {
+					return
+				}
+				if _, ok := helmStatusLevels[secret.Labels["status"]]; ok {
+					report(secret)
+				}
+			},
+		}),
+	)
+
+	app.registerInformer("Helm release monitor", controller.HasSynced)
+	controller.Run(stop)
+}
+
+// decodeHelmRelease decodes the release stored in a Helm storage Secret,
+// which is base64 encoded, gzipped JSON.
+func decodeHelmRelease(secret *v1.Secret) (*helmRelease, error) {
+	data, err := base64.StdEncoding.DecodeString(string(secret.Data["release"]))
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		if data, err = ioutil.ReadAll(reader); err != nil {
+			return nil, err
+		}
+	}
+	var release helmRelease
+	if err := json.Unmarshal(data, &release); err != nil {
+		return nil, err
+	}
+	if release.Namespace == "" {
+		release.Namespace = secret.Namespace
+	}
+	if release.Info.Status == "" {
+		release.Info.Status = secret.Labels["status"]
+	}
+	return &release, nil
+}
+
+// newHelmReleaseEvent creates a Sentry event for a Helm release that failed
+// or is being rolled back.
+func (app *application) newHelmReleaseEvent(release *helmRelease) *sentry.Event {
+	chart := release.Chart.Metadata
+	sentryEvent := app.newBaseEvent(release.Namespace)
+	sentryEvent.Level = helmStatusLevels[release.Info.Status]
+	if sentryEvent.Level == "" {
+		sentryEvent.Level = sentry.LevelWarning
+	}
+	sentryEvent.Message = fmt.Sprintf("Helm release %s is %s", release.Name, release.Info.Status)
+	if release.Info.Description != "" {
+		sentryEvent.Message += ": " + release.Info.Description
+	}
+	sentryEvent.Fingerprint = []string{"helm-release", release.Namespace, release.Name, release.Info.Status}
+	sentryEvent.Tags["kind"] = "HelmRelease"
+	sentryEvent.Tags["helm.release"] = release.Name
+	sentryEvent.Tags["helm.status"] = release.Info.Status
+	if chart.Name != "" {
+		sentryEvent.Tags["helm.chart"] = chart.Name
+		sentryEvent.Tags["helm.chart-version"] = chart.Version
+	}
+	sentryEvent.Extra["revision"] = strconv.Itoa(release.Version)
+	if chart.AppVersion != "" {
+		sentryEvent.Extra["app-version"] = chart.AppVersion
+	}
+	return sentryEvent
+}
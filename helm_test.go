@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"testing"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestDecodeHelmRelease(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	writer.Write([]byte(`{"name": "shop", "version": 7, "info": {"status": "failed", "description": "Upgrade \"shop\" failed: timed out waiting for the condition"}, "chart": {"metadata": {"name": "webshop", "version": "1.4.2", "appVersion": "2.0"}}}`))
+	writer.Close()
+
+	secret := &v1.Secret{}
+	secret.Namespace = "shop"
+	secret.Name = "sh.helm.release.v1.shop.v7"
+	secret.Labels = map[string]string{"owner": "helm", "status": "failed"}
+	secret.Data = map[string][]byte{"release": []byte(base64.StdEncoding.EncodeToString(buf.Bytes()))}
+
+	release, err := decodeHelmRelease(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if release.Name != "shop" || release.Namespace != "shop" || release.Version != 7 || release.Chart.Metadata.Version != "1.4.2" {
+		t.Errorf("Unexpected release %+v", release)
+	}
+
+	event := (&application{}).newHelmReleaseEvent(release)
+	if event.Level != sentry.LevelError {
+		t.Errorf("Unexpected level %s", event.Level)
+	}
+	if event.Message != `Helm release shop is failed: Upgrade "shop" failed: timed out waiting for the condition` {
+		t.Errorf("Unexpected message %q", event.Message)
+	}
+	if event.Tags["helm.chart"] != "webshop" || event.Tags["helm.chart-version"] != "1.4.2" || event.Tags["namespace"] != "shop" {
+		t.Errorf("Unexpected tags %v", event.Tags)
+	}
+	if len(event.Fingerprint) != 4 || event.Fingerprint[3] != "failed" {
+		t.Errorf("Unexpected fingerprint %v", event.Fingerprint)
+	}
+
+	secret.Data["release"] = []byte("not base64!")
+	if _, err := decodeHelmRelease(secret); err == nil {
+		t.Error("No error for invalid release")
+	}
+}
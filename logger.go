@@ -0,0 +1,164 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type logLevel int
+
+const (
+	logLevelDebug logLevel = iota
+	logLevelInfo
+	logLevelWarning
+	logLevelError
+)
+
+var logLevelNames = map[logLevel]string{
+	logLevelDebug:   "debug",
+	logLevelInfo:    "info",
+	logLevelWarning: "warning",
+	logLevelError:   "error",
+}
+
+func parseLogLevel(value string) (logLevel, error) {
+	for level, name := range logLevelNames {
+		if strings.EqualFold(value, name) {
+			return level, nil
+		}
+	}
+	return logLevelInfo, fmt.Errorf("invalid log level '%s'", value)
+}
+
+// leveledLogger writes log messages with a set of key/value fields, either
+// as plain text or as JSON objects.
+type leveledLogger struct {
+	lock  sync.Mutex
+	out   io.Writer
+	level logLevel
+	json  bool
+}
+
+var logger = &leveledLogger{out: os.Stderr, level: logLevelInfo}
+
+// Configure sets the minimum log level and output format.
+func (l *leveledLogger) Configure(level, format string) error {
+	lvl, err := parseLogLevel(level)
+	if err != nil {
+		return err
+	}
+	if format != "text" && format != "json" {
+		return fmt.Errorf("invalid log format '%s', expected text or json", format)
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.level = lvl
+	l.json = format == "json"
+	return nil
+}
+
+// Debug logs a message with debug level. Fields must be given as key/value pairs.
+func (l *leveledLogger) Debug(msg string, fields ...interface{}) {
+	l.log(logLevelDebug, msg, fields)
+}
+
+// Info logs a message with info level. Fields must be given as key/value pairs.
+func (l *leveledLogger) Info(msg string, fields ...interface{}) {
+	l.log(logLevelInfo, msg, fields)
+}
+
+// Warning logs a message with warning level. Fields must be given as key/value pairs.
+func (l *leveledLogger) Warning(msg string, fields ...interface{}) {
+	l.log(logLevelWarning, msg, fields)
+}
+
+// Error logs a message with error level. Fields must be given as key/value pairs.
+func (l *leveledLogger) Error(msg string, fields ...interface{}) {
+	l.log(logLevelError, msg, fields)
+}
+
+// Fatal logs a message with error level and terminates the process.
+func (l *leveledLogger) Fatal(msg string, fields ...interface{}) {
+	l.log(logLevelError, msg, fields)
+	os.Exit(1)
+}
+
+func (l *leveledLogger) log(level logLevel, msg string, fields []interface{}) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if level < l.level {
+		return
+	}
+
+	now := time.Now()
+	if l.json {
+		entry := map[string]interface{}{
+			"time":  now.Format(time.RFC3339),
+			"level": logLevelNames[level],
+			"msg":   msg,
+		}
+		for i := 0; i < len(fields); i += 2 {
+			entry[fieldKey(fields, i)] = fieldValue(fields, i)
+		}
+		data, err := json.Marshal(entry)
+		if err != nil {
+			data = []byte(fmt.Sprintf(`{"level":"error","msg":"error encoding log entry: %v"}`, err))
+		}
+		l.out.Write(append(data, '\n'))
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString(now.Format("2006/01/02 15:04:05 "))
+	b.WriteString(strings.ToUpper(logLevelNames[level]))
+	b.WriteString(" ")
+	b.WriteString(msg)
+	for i := 0; i < len(fields); i += 2 {
+		value := fmt.Sprint(fieldValue(fields, i))
+		if strings.ContainsAny(value, " =\"") {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(&b, " %s=%s", fieldKey(fields, i), value)
+	}
+	b.WriteString("\n")
+	io.WriteString(l.out, b.String())
+}
+
+func fieldKey(fields []interface{}, i int) string {
+	if key, ok := fields[i].(string); ok {
+		return key
+	}
+	return fmt.Sprint(fields[i])
+}
+
+func fieldValue(fields []interface{}, i int) interface{} {
+	if i+1 >= len(fields) {
+		return nil
+	}
+	if err, ok := fields[i+1].(error); ok {
+		return err.Error()
+	}
+	return fields[i+1]
+}
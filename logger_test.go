@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestLoggerLevel(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	l := &leveledLogger{out: &buf}
+	if err := l.Configure("warning", "text"); err != nil {
+		t.Fatal(err)
+	}
+
+	l.Info("hidden")
+	if buf.Len() != 0 {
+		t.Error("Info message logged with warning level")
+	}
+
+	l.Warning("shown", "key", "some value")
+	if !strings.Contains(buf.String(), `WARNING shown key="some value"`) {
+		t.Errorf("Unexpected log output: %s", buf.String())
+	}
+}
+
+func TestLoggerJSON(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	l := &leveledLogger{out: &buf}
+	if err := l.Configure("debug", "json"); err != nil {
+		t.Fatal(err)
+	}
+
+	l.Debug("message", "count", 3)
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Invalid JSON output: %v", err)
+	}
+	if entry["level"] != "debug" || entry["msg"] != "message" || entry["count"] != 3.0 {
+		t.Errorf("Unexpected log entry: %v", entry)
+	}
+}
+
+func TestLoggerConfigureErrors(t *testing.T) {
+	t.Parallel()
+
+	l := &leveledLogger{}
+	if l.Configure("verbose", "text") == nil {
+		t.Error("Invalid log level accepted")
+	}
+	if l.Configure("info", "xml") == nil {
+		t.Error("Invalid log format accepted")
+	}
+}
@@ -18,76 +18,318 @@ package main
 import (
 	"flag"
 	"fmt"
-	"log"
 	"os"
 	"os/signal"
 	"os/user"
 	"path/filepath"
+	"sort"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/getsentry/sentry-go"
-	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
-var configFlag = flag.String("kubeconfig", "", "Configuration file")
-var defaultEnvironment = os.Getenv("ENVIRONMENT")
-var release = os.Getenv("RELEASE")
-var defaultTags = os.Getenv("TAGS")
+// command is a k8s-sentry subcommand. Subcommands are dispatched by hand
+// instead of with a CLI framework such as Cobra: every command parses the
+// same configuration with the flag package, so a framework would add a
+// dependency without removing any code, and would change how environment
+// variables and flags are combined.
+type command struct {
+	description string
+	run         func(args []string) error
+}
+
+var commands = map[string]command{
+	"run":             {description: "Monitor clusters and report issues to Sentry (default)", run: runCommand},
+	"version":         {description: "Show version information", run: versionCommand},
+	"check-config":    {description: "Validate the configuration and Kubernetes permissions", run: checkConfigCommand},
+	"send-test-event": {description: "Send a test event to Sentry", run: sendTestEventCommand},
+	"replay":          {description: "Run exported events through the event pipeline", run: replayCommand},
+	"simulate":        {description: "Send synthetic events through the event pipeline", run: simulateCommand},
+}
 
 func main() {
-	flag.Parse()
+	name := "run"
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
 
-	if os.Getenv("SENTRY_DSN") == "" {
-		log.Println("Warning: SENTRY_DSN environment variable not set. Can not report to Sentry")
+	cmd, ok := commands[name]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(args); err != nil {
+		logger.Fatal("Error running command", "command", name, "error", err)
 	}
+}
 
-	tags, err := parseTags(defaultTags)
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags]\n\nCommands:\n", filepath.Base(os.Args[0]))
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-18s %s\n", name, commands[name].description)
+	}
+	fmt.Fprintf(os.Stderr, "\nUse \"%s <command> -h\" for the flags of a command.\n", filepath.Base(os.Args[0]))
+}
+
+// parseConfig parses the flags for a command. Command-specific flags must be
+// registered with fs before calling parseConfig.
+func parseConfig(fs *flag.FlagSet, args []string) (*config, error) {
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		values, err := loadConfigFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading configuration file: %v", err)
+		}
+		configFileValues = values
+	}
+	cfg := &config{}
+	cfg.bindFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if err := logger.Configure(cfg.logLevel, cfg.logFormat); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func runCommand(args []string) error {
+	cfg, err := parseConfig(flag.NewFlagSet("run", flag.ExitOnError), args)
 	if err != nil {
-		log.Fatalf("Error parsing default tags: %v", err)
+		return err
+	}
+
+	logger.Info("Starting k8s-sentry", "version", version, "commit", commit)
+
+	if cfg.pprofAddress != "" {
+		startPprofServer(cfg.pprofAddress)
+	}
+
+	if cfg.dsn == "" && cfg.dsnFile == "" {
+		logger.Warning("SENTRY_DSN environment variable not set. Can not report to Sentry")
 	}
 
-	err = sentry.Init(sentry.ClientOptions{
-		Environment: defaultEnvironment,
-		Release:     release,
-	})
+	options, err := cfg.sentryOptions()
 	if err != nil {
-		log.Fatalf("Error initialising sentry: %v", err)
+		return err
+	}
+	err = sentry.Init(options)
+	if err != nil {
+		return fmt.Errorf("error initialising sentry: %v", err)
+	}
+	if cfg.selfDSN != "" {
+		selfOptions := options
+		selfOptions.Dsn = cfg.selfDSN
+		selfTransport := newQueuedTransport("self-monitoring", cfg.bufferSize, 1)
+		selfTransport.tunnel = cfg.tunnel
+		selfOptions.Transport = selfTransport
+		selfOptions.SampleRate = 1.0
+		client, err := sentry.NewClient(selfOptions)
+		if err != nil {
+			return fmt.Errorf("error initialising sentry for self-monitoring: %v", err)
+		}
+		selfHub = sentry.NewHub(client, sentry.NewScope())
 	}
 
-	clientset, err := createKubernetesClient(*configFlag)
+	apps, err := cfg.applications()
 	if err != nil {
 		sentry.CaptureException(err)
-		log.Fatalf("Error creating kubernetes client: %v", err)
+		return err
 	}
 
-	app := application{
-		clientset:          clientset,
-		defaultEnvironment: os.Getenv("ENVIRONMENT"),
-		namespace:          os.Getenv("NAMESPACE"),
-		defaultTags:        tags,
+	if cfg.auditAddress != "" {
+		receiver, err := newAuditReceiver(apps[0], parseList(cfg.auditIgnoreUsers))
+		if err != nil {
+			return err
+		}
+		receiver.token = cfg.auditToken
+		if err := receiver.Start(cfg.auditAddress, cfg.auditTLSCert, cfg.auditTLSKey, cfg.auditClientCA); err != nil {
+			return err
+		}
 	}
 
-	stopSignal, err := app.Run()
+	watches := newWatchMonitor(cfg.watchThreshold)
+	syncs := newSyncTracker()
+	if cfg.healthAddress != "" {
+		newHealthServer(watches, syncs).Start(cfg.healthAddress)
+	}
+
+	mutes := newMuteList()
+	var recent *recentEvents
+	if cfg.apiAddress != "" {
+		if cfg.apiToken == "" {
+			return fmt.Errorf("API_TOKEN must be set to enable the runtime API")
+		}
+		if cfg.recentEvents > 0 {
+			recent = newRecentEvents(cfg.recentEvents)
+			if recent.scrubber, err = newScrubber(cfg.scrubBuiltins, parseScrubPatterns(cfg.scrubPatterns)); err != nil {
+				return err
+			}
+		}
+		server := newAPIServer(cfg.apiToken, mutes, cfg.filters(), recent, watches, syncs)
+		server.settings = apps[0].filters
+		server.Start(cfg.apiAddress)
+	}
+
+	archive, err := cfg.eventArchive()
 	if err != nil {
-		sentry.CaptureException(err)
-		log.Fatalf("Error starting monitors: %v", err)
+		return fmt.Errorf("error creating event archive: %v", err)
+	}
+
+	exporter, err := cfg.otlpExporter()
+	if err != nil {
+		return err
+	}
+
+	dedup, err := cfg.dedupStore(apps)
+	if err != nil {
+		return fmt.Errorf("error loading reported events: %v", err)
+	}
+
+	var health *healthMonitor
+	if cfg.selfInterval > 0 {
+		health = newHealthMonitor(cfg.selfInterval, cfg.goroutineLimit)
+		if transport, ok := options.Transport.(*queuedTransport); ok {
+			health.AddQueue("Sentry", transport.Usage)
+		}
+	}
+
+	var stopSignals []chan struct{}
+	if exporter != nil {
+		stopSignal := make(chan struct{})
+		goSafe("OTLP exporter", func() { exporter.Run(stopSignal) })
+		stopSignals = append(stopSignals, stopSignal)
+		if health != nil {
+			health.AddQueue("OTLP", exporter.Usage)
+		}
+	}
+	if archive != nil {
+		stopSignal := make(chan struct{})
+		goSafe("event archive", func() { archive.Run(stopSignal) })
+		stopSignals = append(stopSignals, stopSignal)
+	}
+	if dedup != nil {
+		stopSignal := make(chan struct{})
+		goSafe("reported event store", func() { dedup.Run(stopSignal) })
+		stopSignals = append(stopSignals, stopSignal)
+	}
+	for _, app := range apps {
+		app.archive = archive
+		app.mutes = mutes
+		app.recent = recent
+		app.dedup = dedup
+		app.otlp = exporter
+		app.watches = watches
+		app.syncs = syncs
+		stopSignal, err := app.Run()
+		if err != nil {
+			sentry.CaptureException(err)
+			return fmt.Errorf("error starting monitors: %v", err)
+		}
+		stopSignals = append(stopSignals, stopSignal)
+		if health != nil && app.transactions != nil {
+			health.AddQueue(strings.TrimSpace("transaction "+app.clusterName), app.transactions.Usage)
+		}
+		if health != nil && app.logs != nil {
+			health.AddQueue(strings.TrimSpace("logs "+app.clusterName), app.logs.Usage)
+		}
+	}
+	if health != nil {
+		stopSignal := make(chan struct{})
+		goSafe("health monitor", func() { health.Run(stopSignal) })
+		stopSignals = append(stopSignals, stopSignal)
+	}
+	if cfg.dsnFile != "" {
+		stopSignal := make(chan struct{})
+		goSafe("DSN file watcher", func() { watchDSNFile(cfg.dsnFile, health, stopSignal) })
+		stopSignals = append(stopSignals, stopSignal)
+	}
+	ownership, err := cfg.ownershipSyncer(options.Dsn)
+	if err != nil {
+		return err
+	}
+	if ownership != nil {
+		for _, app := range apps {
+			if app.clientset != nil {
+				ownership.AddSource(app.clientset, app.namespace)
+			}
+		}
+		stopSignal := make(chan struct{})
+		goSafe("ownership syncer", func() { ownership.Run(cfg.ownershipInterval, stopSignal) })
+		stopSignals = append(stopSignals, stopSignal)
+	}
+	reloadSignal := make(chan os.Signal, 1)
+	signal.Notify(reloadSignal, syscall.SIGHUP)
+	abortSignal := make(chan os.Signal, 1)
+	signal.Notify(abortSignal, os.Interrupt, syscall.SIGTERM)
+	for running := true; running; {
+		select {
+		case <-reloadSignal:
+			logger.Info("Reloading configuration")
+			if err := reloadConfig(args, apps, health); err != nil {
+				logger.Error("Error reloading configuration, keeping the current configuration", "error", err)
+			}
+		case <-abortSignal:
+			running = false
+		}
+	}
+
+	shutdown(cfg.shutdownTimeout, stopSignals, apps, archive, exporter, dedup)
+	return nil
+}
+
+// shutdown stops all informers and workers, waits for events that are being
+// processed, and sends all queued events. It gives up after timeout.
+func shutdown(timeout time.Duration, stopSignals []chan struct{}, apps []*application, archive *eventArchive, exporter *otlpExporter, dedup *dedupStore) {
+	logger.Info("Shutting down", "timeout", timeout)
+	deadline := time.Now().Add(timeout)
+	for _, stopSignal := range stopSignals {
+		close(stopSignal)
+	}
+	for _, app := range apps {
+		if !app.Wait(time.Until(deadline)) {
+			logger.Warning("Timeout waiting for event processing to finish", "cluster", app.clusterName)
+			break
+		}
+	}
+	if archive != nil {
+		if err := archive.Close(); err != nil {
+			logger.Error("Error closing event archive", "error", err)
+		}
+	}
+	if exporter != nil {
+		exporter.Flush()
+	}
+	if dedup != nil {
+		if err := dedup.Save(time.Now()); err != nil {
+			logger.Error("Error saving reported events", "error", err)
+		}
 	}
-	abortSignal := make(chan os.Signal)
-	signal.Notify(abortSignal, os.Interrupt, syscall.SIGHUP, syscall.SIGTERM)
-	<-abortSignal
 
-	stopSignal <- struct{}{}
-	log.Println("Exiting")
 	// Make sure all events are flushed before we terminate
-	sentry.Flush(time.Second * 1)
+	remaining := time.Until(deadline)
+	if remaining < time.Second {
+		remaining = time.Second
+	}
+	if !sentry.Flush(remaining) {
+		logger.Warning("Timeout sending events to Sentry, events may have been lost")
+	}
+	if selfHub != nil {
+		selfHub.Flush(time.Second)
+	}
+	logger.Info("Exiting")
 }
 
-func createKubernetesClient(configFile string) (client *kubernetes.Clientset, err error) {
-	var config *rest.Config
+func createKubernetesConfig(configFile string) (config *rest.Config, err error) {
 	if configFile == "" && !inCluster() {
 		// If we are not running in a cluster default to reading ~/.kube/config
 		if usr, err := user.Current(); err == nil {
@@ -100,25 +342,5 @@ func createKubernetesClient(configFile string) (client *kubernetes.Clientset, er
 	} else {
 		config, err = clientcmd.BuildConfigFromFlags("", configFile)
 	}
-	if err != nil {
-		return
-	}
-	return kubernetes.NewForConfig(config)
-}
-
-func parseTags(tags string) (map[string]string, error) {
-	result := make(map[string]string)
-	for _, tag := range strings.Split(tags, ",") {
-		keyValue := strings.Split(tag, "=")
-		if len(keyValue) != 2 {
-			return nil, fmt.Errorf("invalid tag '%s', expected key=value pair", tag)
-		}
-
-		key := keyValue[0]
-		value := keyValue[1]
-
-		result[key] = value
-	}
-
-	return result, nil
+	return
 }
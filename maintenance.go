@@ -0,0 +1,198 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+const (
+	maintenanceSuppress  = "suppress"
+	maintenanceDowngrade = "downgrade"
+)
+
+// maxMaintenanceDuration limits how far back a schedule is searched for the
+// start of a window.
+const maxMaintenanceDuration = 7 * 24 * time.Hour
+
+// cronField is the set of values a field of a cron expression matches.
+type cronField map[int]bool
+
+// cronSchedule is a standard five field cron expression: minute, hour, day
+// of month, month and day of week.
+type cronSchedule struct {
+	minute, hour, day, month, weekday cronField
+}
+
+// maintenanceWindow is a recurring period during which events are
+// suppressed or downgraded.
+type maintenanceWindow struct {
+	schedule   cronSchedule
+	duration   time.Duration
+	action     string
+	namespaces map[string]bool
+}
+
+// parseMaintenanceWindows parses a semicolon-separated list of maintenance
+// windows. Each window has the form "<cron expression> <duration> [action]
+// [namespaces]", for example "0 2 * * 6 4h suppress shop,billing".
+func parseMaintenanceWindows(value string) ([]maintenanceWindow, error) {
+	var windows []maintenanceWindow
+	for _, entry := range strings.Split(value, ";") {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 6 || len(fields) > 8 {
+			return nil, fmt.Errorf("invalid maintenance window '%s'", strings.TrimSpace(entry))
+		}
+		schedule, err := parseCronSchedule(fields[:5])
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule in maintenance window '%s': %v", strings.TrimSpace(entry), err)
+		}
+		duration, err := time.ParseDuration(fields[5])
+		if err != nil || duration <= 0 || duration > maxMaintenanceDuration {
+			return nil, fmt.Errorf("invalid duration in maintenance window '%s'", strings.TrimSpace(entry))
+		}
+		window := maintenanceWindow{schedule: schedule, duration: duration, action: maintenanceSuppress}
+		if len(fields) > 6 {
+			window.action = fields[6]
+			if window.action != maintenanceSuppress && window.action != maintenanceDowngrade {
+				return nil, fmt.Errorf("invalid action '%s', expected %s or %s", window.action, maintenanceSuppress, maintenanceDowngrade)
+			}
+		}
+		if len(fields) > 7 {
+			window.namespaces = make(map[string]bool)
+			for _, namespace := range parseList(fields[7]) {
+				window.namespaces[namespace] = true
+			}
+		}
+		windows = append(windows, window)
+	}
+	return windows, nil
+}
+
+func parseCronSchedule(fields []string) (cronSchedule, error) {
+	var schedule cronSchedule
+	var err error
+	if schedule.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return schedule, err
+	}
+	if schedule.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return schedule, err
+	}
+	if schedule.day, err = parseCronField(fields[2], 1, 31); err != nil {
+		return schedule, err
+	}
+	if schedule.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return schedule, err
+	}
+	if schedule.weekday, err = parseCronField(fields[4], 0, 7); err != nil {
+		return schedule, err
+	}
+	// Both 0 and 7 mean Sunday.
+	if schedule.weekday[7] {
+		schedule.weekday[0] = true
+	}
+	return schedule, nil
+}
+
+// parseCronField parses a comma-separated list of values, ranges (1-5) and
+// steps (*/15 or 1-10/2).
+func parseCronField(value string, min, max int) (cronField, error) {
+	field := make(cronField)
+	for _, part := range strings.Split(value, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i != -1 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return nil, fmt.Errorf("invalid step in '%s'", part)
+			}
+			part = part[:i]
+		}
+		start, end := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if start, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("invalid value '%s'", part)
+			}
+			end = start
+			if len(bounds) == 2 {
+				if end, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("invalid value '%s'", part)
+				}
+			}
+		}
+		if start < min || end > max || start > end {
+			return nil, fmt.Errorf("value '%s' out of range %d-%d", part, min, max)
+		}
+		for i := start; i <= end; i += step {
+			field[i] = true
+		}
+	}
+	return field, nil
+}
+
+// Matches returns true if the schedule fires at the minute of t.
+func (s cronSchedule) Matches(t time.Time) bool {
+	return s.minute[t.Minute()] && s.hour[t.Hour()] && s.day[t.Day()] &&
+		s.month[int(t.Month())] && s.weekday[int(t.Weekday())]
+}
+
+// Active returns true if t falls in the window for namespace.
+func (w maintenanceWindow) Active(namespace string, t time.Time) bool {
+	if w.namespaces != nil && !w.namespaces[namespace] {
+		return false
+	}
+	t = t.UTC().Truncate(time.Minute)
+	for start := t; t.Sub(start) < w.duration; start = start.Add(-time.Minute) {
+		if w.schedule.Matches(start) {
+			return true
+		}
+	}
+	return false
+}
+
+// activeMaintenanceWindow returns the first maintenance window that is
+// active for namespace at time t, or nil.
+func activeMaintenanceWindow(windows []maintenanceWindow, namespace string, t time.Time) *maintenanceWindow {
+	for i := range windows {
+		if windows[i].Active(namespace, t) {
+			return &windows[i]
+		}
+	}
+	return nil
+}
+
+// downgradeLevel returns the level below level.
+func downgradeLevel(level sentry.Level) sentry.Level {
+	switch level {
+	case sentry.LevelFatal:
+		return sentry.LevelError
+	case sentry.LevelError:
+		return sentry.LevelWarning
+	case sentry.LevelWarning:
+		return sentry.LevelInfo
+	default:
+		return sentry.LevelDebug
+	}
+}
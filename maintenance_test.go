@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+func TestParseMaintenanceWindows(t *testing.T) {
+	t.Parallel()
+
+	windows, err := parseMaintenanceWindows("0 2 * * 6 4h; */30 9-17 * * 1-5 10m downgrade shop,billing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(windows) != 2 {
+		t.Fatalf("Unexpected number of windows: %d", len(windows))
+	}
+	if windows[0].action != maintenanceSuppress || windows[0].duration != 4*time.Hour || windows[0].namespaces != nil {
+		t.Errorf("Unexpected first window: %+v", windows[0])
+	}
+	if windows[1].action != maintenanceDowngrade || !windows[1].namespaces["billing"] {
+		t.Errorf("Unexpected second window: %+v", windows[1])
+	}
+
+	for _, value := range []string{"0 2 * * 6", "0 25 * * * 1h", "0 2 * * * 1h ignore", "0 2 * * * forever"} {
+		if _, err := parseMaintenanceWindows(value); err == nil {
+			t.Errorf("No error for '%s'", value)
+		}
+	}
+}
+
+func TestMaintenanceWindowActive(t *testing.T) {
+	t.Parallel()
+
+	windows, err := parseMaintenanceWindows("0 2 * * 6 4h suppress; 0 12 * * * 30m downgrade shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2019-11-02 is a Saturday.
+	saturday := time.Date(2019, 11, 2, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		namespace string
+		time      time.Time
+		expected  *maintenanceWindow
+	}{
+		{"web", saturday.Add(3 * time.Hour), &windows[0]},
+		{"web", saturday.Add(6 * time.Hour), nil},
+		{"web", saturday.Add(24*time.Hour + 3*time.Hour), nil},
+		{"shop", saturday.Add(12*time.Hour + 10*time.Minute), &windows[1]},
+		{"web", saturday.Add(12*time.Hour + 10*time.Minute), nil},
+	}
+	for _, test := range tests {
+		if window := activeMaintenanceWindow(windows, test.namespace, test.time); window != test.expected {
+			t.Errorf("Unexpected window for %s at %s", test.namespace, test.time)
+		}
+	}
+
+	if level := downgradeLevel(sentry.LevelError); level != sentry.LevelWarning {
+		t.Errorf("Unexpected downgraded level: %s", level)
+	}
+}
@@ -0,0 +1,214 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+)
+
+// Like transactions, metrics are not supported by the Sentry SDK used by
+// k8s-sentry. They are aggregated here and sent to the envelope endpoint as
+// statsd items. Sentry discontinued statsd metrics, so they are only
+// accepted by self-hosted Sentry and Relay versions that still support them.
+
+// metricsInterval is how often metrics are flushed. Sentry stores metrics in
+// buckets of ten seconds.
+const metricsInterval = 10 * time.Second
+
+// metricKey identifies a metric series: its type, name and tags.
+type metricKey struct {
+	kind string
+	name string
+	tags string
+}
+
+type gaugeValue struct {
+	last, min, max, sum float64
+	count               int
+}
+
+// sentryMetrics aggregates counters and gauges until they are flushed.
+type sentryMetrics struct {
+	tunnel string
+	client *http.Client
+
+	lock     sync.Mutex
+	counters map[metricKey]float64
+	gauges   map[metricKey]*gaugeValue
+}
+
+func newSentryMetrics(tunnel string) *sentryMetrics {
+	return &sentryMetrics{
+		tunnel:   tunnel,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		counters: make(map[metricKey]float64),
+		gauges:   make(map[metricKey]*gaugeValue),
+	}
+}
+
+// Increment adds value to a counter.
+func (m *sentryMetrics) Increment(name string, value float64, tags map[string]string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.counters[metricKey{"c", name, encodeMetricTags(tags)}] += value
+}
+
+// Gauge records the current value of a gauge.
+func (m *sentryMetrics) Gauge(name string, value float64, tags map[string]string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	key := metricKey{"g", name, encodeMetricTags(tags)}
+	gauge := m.gauges[key]
+	if gauge == nil {
+		m.gauges[key] = &gaugeValue{last: value, min: value, max: value, sum: value, count: 1}
+		return
+	}
+	gauge.last = value
+	if value < gauge.min {
+		gauge.min = value
+	}
+	if value > gauge.max {
+		gauge.max = value
+	}
+	gauge.sum += value
+	gauge.count++
+}
+
+// RecordEvent counts a Kubernetes event by namespace, reason and type, and
+// records how often the event has occurred according to Kubernetes.
+func (m *sentryMetrics) RecordEvent(cluster string, evt *v1.Event) {
+	tags := map[string]string{
+		"namespace": evt.InvolvedObject.Namespace,
+		"reason":    evt.Reason,
+		"type":      evt.Type,
+		"kind":      evt.InvolvedObject.Kind,
+	}
+	if cluster != "" {
+		tags["cluster"] = cluster
+	}
+	m.Increment("kubernetes.events", 1, tags)
+	if evt.Count > 0 {
+		m.Gauge("kubernetes.event.count", float64(evt.Count), tags)
+	}
+}
+
+// Flush returns the aggregated metrics in the statsd format used by Sentry,
+// and resets them.
+func (m *sentryMetrics) Flush(now time.Time) []byte {
+	m.lock.Lock()
+	counters, gauges := m.counters, m.gauges
+	m.counters = make(map[metricKey]float64)
+	m.gauges = make(map[metricKey]*gaugeValue)
+	m.lock.Unlock()
+
+	var lines []string
+	format := func(value float64) string {
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	line := func(key metricKey, value string) string {
+		result := key.name + "@none:" + value + "|" + key.kind
+		if key.tags != "" {
+			result += "|#" + key.tags
+		}
+		return result + "|T" + strconv.FormatInt(now.Unix(), 10)
+	}
+	for key, value := range counters {
+		lines = append(lines, line(key, format(value)))
+	}
+	for key, gauge := range gauges {
+		lines = append(lines, line(key, strings.Join([]string{format(gauge.last), format(gauge.min), format(gauge.max), format(gauge.sum), strconv.Itoa(gauge.count)}, ":")))
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	sort.Strings(lines)
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// Run sends the aggregated metrics every ten seconds until stop is closed.
+func (m *sentryMetrics) Run(stop chan struct{}) {
+	ticker := time.NewTicker(metricsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			m.sendOrLog(m.Flush(time.Now()))
+			return
+		case <-ticker.C:
+			m.sendOrLog(m.Flush(time.Now()))
+		}
+	}
+}
+
+func (m *sentryMetrics) sendOrLog(payload []byte) {
+	if err := m.send(payload); err != nil {
+		logger.Error("Error sending metrics", "error", err)
+	}
+}
+
+func (m *sentryMetrics) send(payload []byte) error {
+	client := sentry.CurrentHub().Client()
+	if len(payload) == 0 || client == nil || client.Options().Dsn == "" {
+		return nil
+	}
+	dsn, err := sentry.NewDsn(client.Options().Dsn)
+	if err != nil {
+		return err
+	}
+	request, err := newSentryRequest(dsn, m.tunnel, "statsd", "", payload)
+	if err != nil {
+		return err
+	}
+	return sendSentryRequest(m.client, request)
+}
+
+// encodeMetricTags encodes tags in the statsd format, sorted by key. Sentry
+// only allows a limited set of characters in tag keys and values.
+func encodeMetricTags(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var buf bytes.Buffer
+	for _, key := range keys {
+		name := sanitizeTagKey(key)
+		if name == "" {
+			continue
+		}
+		if buf.Len() > 0 {
+			buf.WriteByte(',')
+		}
+		fmt.Fprintf(&buf, "%s:%s", name, escapeMetricTagValue(sanitizeTagValue(tags[key])))
+	}
+	return buf.String()
+}
+
+var metricTagValueEscaper = strings.NewReplacer("\\", `\\`, "|", `\u{7c}`, ",", `\u{2c}`)
+
+func escapeMetricTagValue(value string) string {
+	return metricTagValueEscaper.Replace(value)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestSentryMetricsFlush(t *testing.T) {
+	t.Parallel()
+
+	metrics := newSentryMetrics("")
+	now := time.Unix(1700000000, 0)
+	evt := &v1.Event{
+		InvolvedObject: v1.ObjectReference{Kind: "Pod", Namespace: "shop"},
+		Reason:         "FailedScheduling",
+		Type:           v1.EventTypeWarning,
+		Count:          3,
+	}
+	metrics.RecordEvent("prod", evt)
+	evt.Count = 5
+	metrics.RecordEvent("prod", evt)
+
+	expected := strings.Join([]string{
+		"kubernetes.event.count@none:5:3:5:8:2|g|#cluster:prod,kind:Pod,namespace:shop,reason:FailedScheduling,type:Warning|T1700000000",
+		"kubernetes.events@none:2|c|#cluster:prod,kind:Pod,namespace:shop,reason:FailedScheduling,type:Warning|T1700000000",
+	}, "\n")
+	if payload := string(metrics.Flush(now)); payload != expected {
+		t.Errorf("Unexpected payload:\n%s", payload)
+	}
+	if payload := metrics.Flush(now); payload != nil {
+		t.Errorf("Metrics not reset after flush: %s", payload)
+	}
+}
+
+func TestEncodeMetricTags(t *testing.T) {
+	t.Parallel()
+
+	tags := encodeMetricTags(map[string]string{"reason": "a|b,c", "bad key!": "x", "": "y"})
+	if tags != `bad_key:x,reason:a\u{7c}b\u{2c}c` {
+		t.Errorf("Unexpected tags %s", tags)
+	}
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// reportMonitorEvent reports an event created by a monitor, such as a failed
+// pod or a stuck StatefulSet, about the object ref. It applies the same
+// filters as Kubernetes events: shards, snoozes, mutes, maintenance windows,
+// rules, sampling and the event budget. If key is not empty it is used to
+// avoid reporting the event again after a restart. The reason of the event
+// is its reason tag, or the first element of its fingerprint. It returns
+// true if the event was reported.
+func (app *application) reportMonitorEvent(sentryEvent *sentry.Event, ref v1.ObjectReference, key string) bool {
+	if app.settingsLock != nil {
+		app.settingsLock.RLock()
+		defer app.settingsLock.RUnlock()
+	}
+	if key != "" {
+		key = app.clusterName + "/" + key
+	}
+	now := time.Now()
+	if sentryEvent.Tags["reason"] == "" && len(sentryEvent.Fingerprint) > 0 {
+		sentryEvent.Tags["reason"] = sentryEvent.Fingerprint[0]
+	}
+	evt := &v1.Event{
+		InvolvedObject: ref,
+		Reason:         sentryEvent.Tags["reason"],
+		Message:        sentryEvent.Message,
+		Type:           v1.EventTypeWarning,
+		Count:          1,
+		LastTimestamp:  metav1.NewTime(now),
+	}
+
+	cause := app.filterMonitorEvent(sentryEvent, evt, key, now)
+	if cause != "" {
+		logger.Debug("Skipping monitor event", eventFields(evt, "cause", cause)...)
+		if app.recent != nil {
+			app.recent.Record(app.clusterName, evt, nil, cause, now)
+		}
+		return false
+	}
+
+	app.capture(sentryEvent)
+	if app.dedup != nil {
+		app.dedup.Add(key, now)
+	}
+	if app.recent != nil {
+		app.recent.Record(app.clusterName, evt, sentryEvent, "", now)
+	}
+	return true
+}
+
+// filterMonitorEvent runs a monitor event through the filters of the event
+// pipeline, and returns why it should not be reported, or an empty string.
+func (app *application) filterMonitorEvent(sentryEvent *sentry.Event, evt *v1.Event, key string, now time.Time) string {
+	namespace := evt.InvolvedObject.Namespace
+	if app.shards != nil && !app.shards.Owns(namespace) {
+		return "namespace not in shard"
+	}
+	if app.dedup != nil && app.dedup.Reported(key, now) {
+		return "already reported"
+	}
+	if app.snooze != nil {
+		if until := app.snooze.SnoozedUntil(evt, now); !until.IsZero() {
+			return snoozeCause(until)
+		}
+	}
+	if app.mutes != nil {
+		if m := app.mutes.Match(namespace, evt.Reason, sentryEvent.Fingerprint, now); m != nil {
+			return "muted by " + m.ID
+		}
+	}
+	if window := activeMaintenanceWindow(app.maintenance, namespace, now); window != nil {
+		if window.action == maintenanceSuppress {
+			return "maintenance window"
+		}
+		sentryEvent.Level = downgradeLevel(sentryEvent.Level)
+		sentryEvent.Tags["maintenance"] = "true"
+	}
+	if node := sentryEvent.Tags["node"]; node != "" && app.nodes != nil {
+		app.nodes.Enrich(sentryEvent, node, now)
+	}
+	if !applyRules(app.rules, sentryEvent, evt) {
+		return "dropped by rule"
+	}
+	if app.sampler != nil && !app.sampler.Sample(sentryEvent, evt.Reason) {
+		return "sampled out"
+	}
+	if app.budget != nil && !app.budget.Allow(namespace, evt.Reason, now) {
+		return "event budget exceeded"
+	}
+	return ""
+}
+
+// fingerprintKey returns a key for the dedup store for monitor events about a
+// condition, such as a stuck rollout. The condition is reported at most once
+// per DEDUP_TTL, also across restarts.
+func fingerprintKey(sentryEvent *sentry.Event) string {
+	return strings.Join(sentryEvent.Fingerprint, "/")
+}
+
+// objectReference returns a reference to an object for monitor events.
+func objectReference(kind string, obj metav1.Object) v1.ObjectReference {
+	return v1.ObjectReference{
+		Kind:      kind,
+		Namespace: obj.GetNamespace(),
+		Name:      obj.GetName(),
+		UID:       obj.GetUID(),
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestReportMonitorEvent(t *testing.T) {
+	t.Parallel()
+
+	mutes := newMuteList()
+	m, err := mutes.Add(mute{Reason: "daemonset-unavailable"}, time.Hour, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &application{
+		clusterName: "prod",
+		mutes:       mutes,
+		dedup:       &dedupStore{ttl: time.Hour, reported: make(map[string]time.Time)},
+		recent:      newRecentEvents(10),
+	}
+	ref := v1.ObjectReference{Kind: "DaemonSet", Namespace: "shop", Name: "agent"}
+
+	event := app.newBaseEvent("shop")
+	event.Level = sentry.LevelError
+	event.Fingerprint = []string{"daemonset-unavailable", "shop", "agent"}
+	if app.reportMonitorEvent(event, ref, "") {
+		t.Error("Muted monitor event reported")
+	}
+	skipped := app.recent.List(recentEventFilter{Decision: decisionSkipped}, 1)
+	if len(skipped) != 1 || skipped[0].Cause != "muted by "+m.ID || skipped[0].Reason != "daemonset-unavailable" {
+		t.Errorf("Muted monitor event not recorded: %+v", skipped)
+	}
+
+	app.dedup.Add("prod/pod-failed/1234", time.Now())
+	event = app.newBaseEvent("shop")
+	event.Level = sentry.LevelError
+	event.Fingerprint = []string{"pod-failed", "shop", "web", "Evicted"}
+	event.Tags["reason"] = "Evicted"
+	if app.reportMonitorEvent(event, v1.ObjectReference{Kind: "Pod", Namespace: "shop", Name: "web-1"}, "pod-failed/1234") {
+		t.Error("Monitor event reported again")
+	}
+	skipped = app.recent.List(recentEventFilter{Decision: decisionSkipped}, 1)
+	if len(skipped) != 1 || skipped[0].Cause != "already reported" {
+		t.Errorf("Duplicate monitor event not recorded: %+v", skipped)
+	}
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxMuteDuration is the longest time a mute can be active.
+const maxMuteDuration = 7 * 24 * time.Hour
+
+// mute silences events that match all of its non-empty fields until a
+// given time.
+type mute struct {
+	ID          string    `json:"id"`
+	Namespace   string    `json:"namespace,omitempty"`
+	Reason      string    `json:"reason,omitempty"`
+	Fingerprint []string  `json:"fingerprint,omitempty"`
+	Comment     string    `json:"comment,omitempty"`
+	Until       time.Time `json:"until"`
+}
+
+func (m *mute) matches(namespace, reason string, fingerprint []string) bool {
+	if m.Namespace != "" && m.Namespace != namespace {
+		return false
+	}
+	if m.Reason != "" && m.Reason != reason {
+		return false
+	}
+	if len(m.Fingerprint) > 0 {
+		if len(m.Fingerprint) != len(fingerprint) {
+			return false
+		}
+		for i := range fingerprint {
+			if m.Fingerprint[i] != fingerprint[i] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// muteList contains the mutes added at runtime. It is shared by all
+// clusters.
+type muteList struct {
+	lock  sync.Mutex
+	mutes map[string]*mute
+}
+
+func newMuteList() *muteList {
+	return &muteList{mutes: make(map[string]*mute)}
+}
+
+// Add adds a mute that is active for duration.
+func (l *muteList) Add(m mute, duration time.Duration, now time.Time) (*mute, error) {
+	if m.Namespace == "" && m.Reason == "" && len(m.Fingerprint) == 0 {
+		return nil, fmt.Errorf("a mute needs a namespace, reason or fingerprint")
+	}
+	if duration <= 0 || duration > maxMuteDuration {
+		return nil, fmt.Errorf("duration must be between 0 and %s", maxMuteDuration)
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	m.ID = hex.EncodeToString(id)
+	m.Until = now.Add(duration).UTC()
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.mutes[m.ID] = &m
+	return &m, nil
+}
+
+// Delete removes a mute. It returns false if the mute does not exist.
+func (l *muteList) Delete(id string) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	_, ok := l.mutes[id]
+	delete(l.mutes, id)
+	return ok
+}
+
+// Active returns all active mutes, ordered by expiry time. Expired mutes are
+// removed.
+func (l *muteList) Active(now time.Time) []mute {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	active := []mute{}
+	for id, m := range l.mutes {
+		if now.After(m.Until) {
+			delete(l.mutes, id)
+		} else {
+			active = append(active, *m)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool { return active[i].Until.Before(active[j].Until) })
+	return active
+}
+
+// Match returns the first active mute matching an event, or nil.
+func (l *muteList) Match(namespace, reason string, fingerprint []string, now time.Time) *mute {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	for _, m := range l.mutes {
+		if !now.After(m.Until) && m.matches(namespace, reason, fingerprint) {
+			return m
+		}
+	}
+	return nil
+}
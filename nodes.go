@@ -0,0 +1,285 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/tools/cache"
+)
+
+// nodeActivityRetention is how long node maintenance activity is attached
+// to events for pods on the node.
+const nodeActivityRetention = time.Hour
+
+// nodeEventActions maps reasons of Node events to maintenance actions.
+var nodeEventActions = map[string]string{
+	"ScaleDown":    "drain",
+	"Drain":        "drain",
+	"Drained":      "drain",
+	"RemovingNode": "remove",
+	"Rebooted":     "reboot",
+}
+
+// spotInterruptionReasons are reasons of Node events that announce the
+// reclamation of a spot or preemptible instance, as reported by the AWS node
+// termination handler, Karpenter and Azure scheduled events.
+var spotInterruptionReasons = map[string]bool{
+	"SpotInterruption": true,
+	"SpotInterrupted":  true,
+	"PreemptScheduled": true,
+}
+
+// spotInterruptionTaints are taints added to nodes that are about to be
+// reclaimed.
+var spotInterruptionTaints = map[string]bool{
+	"aws-node-termination-handler/spot-itn":       true,
+	"cloud.google.com/impending-node-termination": true,
+}
+
+// spotNodeLabels are labels cloud providers and provisioners add to spot or
+// preemptible nodes, with their value.
+var spotNodeLabels = map[string]string{
+	"eks.amazonaws.com/capacityType":        "SPOT",
+	"karpenter.sh/capacity-type":            "spot",
+	"cloud.google.com/gke-spot":             "true",
+	"cloud.google.com/gke-preemptible":      "true",
+	"kubernetes.azure.com/scalesetpriority": "spot",
+}
+
+type nodeActivity struct {
+	Time    time.Time
+	Action  string
+	Message string
+}
+
+// nodeTracker keeps track of cordon, drain and uncordon activity for nodes,
+// so errors caused by maintenance can be distinguished from real failures.
+//
+// Spot interruptions are tracked separately, since they remain relevant after
+// the node is deleted. If interruptionLevel is set, events for pods on an
+// interrupted node are reported at that level.
+type nodeTracker struct {
+	interruptionLevel sentry.Level
+
+	lock        sync.Mutex
+	activity    map[string][]nodeActivity
+	cordoned    map[string]bool
+	interrupted map[string]time.Time
+}
+
+func newNodeTracker() *nodeTracker {
+	return &nodeTracker{
+		activity:    make(map[string][]nodeActivity),
+		cordoned:    make(map[string]bool),
+		interrupted: make(map[string]time.Time),
+	}
+}
+
+// RecordEvent records maintenance activity from a Node event.
+func (t *nodeTracker) RecordEvent(evt *v1.Event) {
+	if evt.InvolvedObject.Kind != "Node" {
+		return
+	}
+	if spotInterruptionReasons[evt.Reason] {
+		t.interrupt(evt.InvolvedObject.Name, eventTime(evt), evt.Message)
+	} else if action, ok := nodeEventActions[evt.Reason]; ok {
+		t.record(evt.InvolvedObject.Name, nodeActivity{Time: eventTime(evt), Action: action, Message: evt.Message})
+	}
+}
+
+// UpdateNode records a spot interruption if a node has an interruption
+// taint.
+func (t *nodeTracker) UpdateNode(node *v1.Node, now time.Time) {
+	for _, taint := range node.Spec.Taints {
+		if spotInterruptionTaints[taint.Key] {
+			t.interrupt(node.Name, now, "Node tainted with "+taint.Key)
+			return
+		}
+	}
+}
+
+// NodeDeleted records the deletion of a spot node, without preceding drain
+// activity, as a spot interruption.
+func (t *nodeTracker) NodeDeleted(node *v1.Node, now time.Time) {
+	if !isSpotNode(node) {
+		return
+	}
+	t.lock.Lock()
+	drained := len(t.prune(node.Name, now)) > 0
+	t.lock.Unlock()
+	if !drained {
+		t.interrupt(node.Name, now, "Spot node deleted")
+	}
+}
+
+func isSpotNode(node *v1.Node) bool {
+	for label, value := range spotNodeLabels {
+		if node.Labels[label] == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *nodeTracker) interrupt(node string, when time.Time, message string) {
+	t.lock.Lock()
+	_, known := t.interrupted[node]
+	if !known {
+		t.interrupted[node] = when
+	}
+	t.lock.Unlock()
+	if !known {
+		t.record(node, nodeActivity{Time: when, Action: "spot-interruption", Message: message})
+	}
+}
+
+// Interrupted returns true if a node was recently reclaimed as a spot or
+// preemptible instance.
+func (t *nodeTracker) Interrupted(node string, now time.Time) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	when, ok := t.interrupted[node]
+	if ok && now.Sub(when) >= nodeActivityRetention {
+		delete(t.interrupted, node)
+		return false
+	}
+	return ok
+}
+
+// SetUnschedulable records the unschedulable state of a node. A change is
+// recorded as a cordon or uncordon action.
+func (t *nodeTracker) SetUnschedulable(node string, unschedulable bool, changed bool, now time.Time) {
+	t.lock.Lock()
+	t.cordoned[node] = unschedulable
+	t.lock.Unlock()
+	if !changed {
+		return
+	}
+	if unschedulable {
+		t.record(node, nodeActivity{Time: now, Action: "cordon", Message: "Node marked unschedulable"})
+	} else {
+		t.record(node, nodeActivity{Time: now, Action: "uncordon", Message: "Node marked schedulable"})
+	}
+}
+
+// Delete stops tracking a node.
+func (t *nodeTracker) Delete(node string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.activity, node)
+	delete(t.cordoned, node)
+}
+
+func (t *nodeTracker) record(node string, activity nodeActivity) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.activity[node] = append(t.prune(node, activity.Time), activity)
+}
+
+func (t *nodeTracker) prune(node string, now time.Time) []nodeActivity {
+	var recent []nodeActivity
+	for _, activity := range t.activity[node] {
+		if now.Sub(activity.Time) < nodeActivityRetention {
+			recent = append(recent, activity)
+		}
+	}
+	return recent
+}
+
+// Activity returns the recent maintenance activity for a node, and whether
+// the node is currently cordoned.
+func (t *nodeTracker) Activity(node string, now time.Time) ([]nodeActivity, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	recent := t.prune(node, now)
+	t.activity[node] = recent
+	return recent, t.cordoned[node]
+}
+
+// Enrich adds the maintenance activity for a node to a Sentry event.
+func (t *nodeTracker) Enrich(event *sentry.Event, node string, now time.Time) {
+	activity, cordoned := t.Activity(node, now)
+	for _, a := range activity {
+		event.Breadcrumbs = append(event.Breadcrumbs, &sentry.Breadcrumb{
+			Category:  "node",
+			Message:   a.Message,
+			Timestamp: a.Time.Unix(),
+			Data:      map[string]interface{}{"node": node, "action": a.Action},
+		})
+	}
+	if cordoned || len(activity) > 0 {
+		event.Tags["node.maintenance"] = "true"
+	}
+	if cordoned {
+		event.Tags["node.cordoned"] = "true"
+	}
+	if t.Interrupted(node, now) {
+		event.Tags["interruption"] = "spot"
+		if t.interruptionLevel != "" {
+			event.Level = t.interruptionLevel
+		}
+	}
+}
+
+func (app *application) monitorNodes(stop chan struct{}) {
+	watchList := cache.NewListWatchFromClient(
+		app.clientset.CoreV1().RESTClient(),
+		"nodes",
+		v1.NamespaceAll,
+		fields.Everything(),
+	)
+	_, controller := cache.NewInformer(
+		app.instrument("node monitor", "nodes", watchList),
+		&v1.Node{},
+		time.Minute*10,
+		recoverHandlers("node monitor", cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				if node, ok := obj.(*v1.Node); ok {
+					app.nodes.SetUnschedulable(node.Name, node.Spec.Unschedulable, false, time.Now())
+					app.nodes.UpdateNode(node, time.Now())
+				}
+			},
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				oldNode, ok := oldObj.(*v1.Node)
+				if !ok {
+					return
+				}
+				if node, ok := newObj.(*v1.Node); ok {
+					changed := oldNode.Spec.Unschedulable != node.Spec.Unschedulable
+					app.nodes.SetUnschedulable(node.Name, node.Spec.Unschedulable, changed, time.Now())
+					app.nodes.UpdateNode(node, time.Now())
+				}
+			},
+			DeleteFunc: func(obj interface{}) {
+				if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+					obj = tombstone.Obj
+				}
+				if node, ok := obj.(*v1.Node); ok {
+					app.nodes.NodeDeleted(node, time.Now())
+					app.nodes.Delete(node.Name)
+				}
+			},
+		}),
+	)
+
+	app.registerInformer("node monitor", controller.HasSynced)
+	controller.Run(stop)
+}
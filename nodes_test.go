@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNodeTracker(t *testing.T) {
+	t.Parallel()
+
+	tracker := newNodeTracker()
+	start := time.Now()
+
+	tracker.SetUnschedulable("node-1", false, false, start)
+	tracker.SetUnschedulable("node-1", true, true, start)
+	tracker.RecordEvent(&v1.Event{
+		InvolvedObject: v1.ObjectReference{Kind: "Node", Name: "node-1"},
+		Reason:         "ScaleDown",
+		Message:        "node removed by cluster autoscaler",
+		LastTimestamp:  metav1.NewTime(start.Add(time.Minute)),
+	})
+
+	event := sentry.NewEvent()
+	tracker.Enrich(event, "node-1", start.Add(2*time.Minute))
+	if len(event.Breadcrumbs) != 2 {
+		t.Errorf("Unexpected breadcrumbs: %v", event.Breadcrumbs)
+	}
+	if event.Tags["node.cordoned"] != "true" || event.Tags["node.maintenance"] != "true" {
+		t.Errorf("Unexpected tags: %v", event.Tags)
+	}
+
+	tracker.SetUnschedulable("node-1", false, true, start.Add(3*time.Minute))
+	event = sentry.NewEvent()
+	tracker.Enrich(event, "node-1", start.Add(2*time.Hour))
+	if len(event.Breadcrumbs) != 0 || event.Tags["node.maintenance"] != "" {
+		t.Errorf("Old maintenance activity attached: %v %v", event.Breadcrumbs, event.Tags)
+	}
+}
+
+func TestNodeTrackerSpotInterruption(t *testing.T) {
+	t.Parallel()
+
+	tracker := newNodeTracker()
+	tracker.interruptionLevel = sentry.LevelInfo
+	start := time.Now()
+
+	tracker.UpdateNode(&v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "tainted"},
+		Spec:       v1.NodeSpec{Taints: []v1.Taint{{Key: "aws-node-termination-handler/spot-itn", Effect: v1.TaintEffectNoSchedule}}},
+	}, start)
+	tracker.RecordEvent(&v1.Event{
+		InvolvedObject: v1.ObjectReference{Kind: "Node", Name: "announced"},
+		Reason:         "SpotInterrupted",
+		LastTimestamp:  metav1.NewTime(start),
+	})
+	spot := map[string]string{"karpenter.sh/capacity-type": "spot"}
+	tracker.NodeDeleted(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "deleted", Labels: spot}}, start)
+	tracker.RecordEvent(&v1.Event{
+		InvolvedObject: v1.ObjectReference{Kind: "Node", Name: "scaled-down"},
+		Reason:         "ScaleDown",
+		LastTimestamp:  metav1.NewTime(start),
+	})
+	tracker.NodeDeleted(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "scaled-down", Labels: spot}}, start)
+	tracker.NodeDeleted(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "on-demand"}}, start)
+
+	for node, interrupted := range map[string]bool{"tainted": true, "announced": true, "deleted": true, "scaled-down": false, "on-demand": false} {
+		event := sentry.NewEvent()
+		event.Level = sentry.LevelError
+		tracker.Enrich(event, node, start.Add(time.Minute))
+		if interrupted && (event.Tags["interruption"] != "spot" || event.Level != sentry.LevelInfo) {
+			t.Errorf("Interruption of %s not reported: %v %s", node, event.Tags, event.Level)
+		}
+		if !interrupted && (event.Tags["interruption"] != "" || event.Level != sentry.LevelError) {
+			t.Errorf("Unexpected interruption of %s: %v %s", node, event.Tags, event.Level)
+		}
+	}
+
+	if tracker.Interrupted("tainted", start.Add(2*time.Hour)) {
+		t.Error("Old interruption still reported")
+	}
+}
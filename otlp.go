@@ -0,0 +1,230 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// otlpBatchSize is the maximum number of log records sent in one request.
+const otlpBatchSize = 100
+
+// otlpSeverity maps Sentry levels to OpenTelemetry severity numbers.
+var otlpSeverity = map[sentry.Level]int{
+	sentry.LevelDebug:   5,
+	sentry.LevelInfo:    9,
+	sentry.LevelWarning: 13,
+	sentry.LevelError:   17,
+	sentry.LevelFatal:   21,
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano   string          `json:"timeUnixNano"`
+	SeverityNumber int             `json:"severityNumber"`
+	SeverityText   string          `json:"severityText"`
+	Body           otlpValue       `json:"body"`
+	Attributes     []otlpAttribute `json:"attributes"`
+}
+
+// otlpExporter ships events as OpenTelemetry log records to a collector,
+// using OTLP over HTTP with JSON encoding.
+type otlpExporter struct {
+	endpoint string
+	headers  map[string]string
+	scrubber *scrubber
+	client   *http.Client
+
+	lock    sync.Mutex
+	records []otlpLogRecord
+}
+
+func newOTLPExporter(endpoint string, headers map[string]string, scrubber *scrubber) *otlpExporter {
+	return &otlpExporter{
+		endpoint: strings.TrimSuffix(endpoint, "/") + "/v1/logs",
+		headers:  headers,
+		scrubber: scrubber,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Export queues an event. Events are sent in batches.
+func (e *otlpExporter) Export(event *sentry.Event) {
+	if e.scrubber != nil {
+		e.scrubber.Scrub(event)
+	}
+	record := otlpLogRecordFromEvent(event)
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if len(e.records) >= otlpBatchSize*10 {
+		// Drop the oldest record with the lowest severity, or the new
+		// record if every queued record is more severe.
+		lowest := 0
+		for i, queued := range e.records {
+			if queued.SeverityNumber < e.records[lowest].SeverityNumber {
+				lowest = i
+			}
+		}
+		if record.SeverityNumber < e.records[lowest].SeverityNumber {
+			droppedEvents.Record("otlp", event.Level)
+			return
+		}
+		droppedEvents.Record("otlp", sentry.Level(strings.ToLower(e.records[lowest].SeverityText)))
+		e.records = append(e.records[:lowest], e.records[lowest+1:]...)
+	}
+	e.records = append(e.records, record)
+}
+
+// Usage returns the number of queued events and the size of the buffer.
+func (e *otlpExporter) Usage() (int, int) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return len(e.records), otlpBatchSize * 10
+}
+
+// Run sends queued events every five seconds until stop is closed.
+func (e *otlpExporter) Run(stop chan struct{}) {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			e.Flush()
+		}
+	}
+}
+
+// Flush sends all queued events.
+func (e *otlpExporter) Flush() {
+	e.lock.Lock()
+	records := e.records
+	e.records = nil
+	e.lock.Unlock()
+
+	for len(records) > 0 {
+		batch := records
+		if len(batch) > otlpBatchSize {
+			batch = batch[:otlpBatchSize]
+		}
+		records = records[len(batch):]
+		if err := e.send(batch); err != nil {
+			logger.Error("Error exporting events to OTLP collector", "error", err)
+		}
+	}
+}
+
+func (e *otlpExporter) send(records []otlpLogRecord) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"resourceLogs": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": []otlpAttribute{{Key: "service.name", Value: otlpValue{"k8s-sentry"}}},
+			},
+			"scopeLogs": []interface{}{map[string]interface{}{
+				"scope":      map[string]string{"name": "k8s-sentry", "version": version},
+				"logRecords": records,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range e.headers {
+		request.Header.Set(key, value)
+	}
+	response, err := e.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		message, _ := ioutil.ReadAll(response.Body)
+		return fmt.Errorf("collector returned %s: %s", response.Status, bytes.TrimSpace(message))
+	}
+	return nil
+}
+
+// otlpLogRecordFromEvent converts a Sentry event to a log record. Tags and
+// extra data become attributes.
+func otlpLogRecordFromEvent(event *sentry.Event) otlpLogRecord {
+	timestamp := time.Now()
+	if event.Timestamp > 0 {
+		timestamp = time.Unix(event.Timestamp, 0)
+	}
+	record := otlpLogRecord{
+		TimeUnixNano:   strconv.FormatInt(timestamp.UnixNano(), 10),
+		SeverityNumber: otlpSeverity[event.Level],
+		SeverityText:   strings.ToUpper(string(event.Level)),
+		Body:           otlpValue{event.Message},
+	}
+	add := func(key, value string) {
+		record.Attributes = append(record.Attributes, otlpAttribute{Key: key, Value: otlpValue{value}})
+	}
+	if event.Environment != "" {
+		add("deployment.environment", event.Environment)
+	}
+	if len(event.Fingerprint) > 0 {
+		add("sentry.fingerprint", strings.Join(event.Fingerprint, " "))
+	}
+	keys := make([]string, 0, len(event.Tags))
+	for key := range event.Tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		add(key, event.Tags[key])
+	}
+	keys = keys[:0]
+	for key := range event.Extra {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value, ok := event.Extra[key].(string)
+		if !ok {
+			encoded, _ := json.Marshal(event.Extra[key])
+			value = string(encoded)
+		}
+		add("extra."+key, value)
+	}
+	return record
+}
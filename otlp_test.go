@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getsentry/sentry-go"
+)
+
+func TestOTLPExporter(t *testing.T) {
+	t.Parallel()
+
+	var received struct {
+		ResourceLogs []struct {
+			ScopeLogs []struct {
+				LogRecords []otlpLogRecord `json:"logRecords"`
+			} `json:"scopeLogs"`
+		} `json:"resourceLogs"`
+	}
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/logs" {
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+		authorization = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer server.Close()
+
+	exporter := newOTLPExporter(server.URL, map[string]string{"Authorization": "Bearer token"}, nil)
+	event := sentry.NewEvent()
+	event.Level = sentry.LevelWarning
+	event.Message = "Pod/web-1: Back-off restarting failed container"
+	event.Tags["namespace"] = "shop"
+	event.Extra["count"] = 3
+	exporter.Export(event)
+	exporter.Flush()
+
+	if authorization != "Bearer token" {
+		t.Errorf("Unexpected authorization header: %s", authorization)
+	}
+	if len(received.ResourceLogs) != 1 || len(received.ResourceLogs[0].ScopeLogs[0].LogRecords) != 1 {
+		t.Fatalf("Unexpected request: %+v", received)
+	}
+	record := received.ResourceLogs[0].ScopeLogs[0].LogRecords[0]
+	if record.SeverityNumber != 13 || record.Body.StringValue != event.Message {
+		t.Errorf("Unexpected record: %+v", record)
+	}
+	attributes := make(map[string]string)
+	for _, attribute := range record.Attributes {
+		attributes[attribute.Key] = attribute.Value.StringValue
+	}
+	if attributes["namespace"] != "shop" || attributes["extra.count"] != "3" {
+		t.Errorf("Unexpected attributes: %v", attributes)
+	}
+}
@@ -0,0 +1,262 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Markers around the ownership rules managed by k8s-sentry. Rules outside
+// the markers are kept as they are.
+const (
+	ownershipBegin = "# BEGIN k8s-sentry"
+	ownershipEnd   = "# END k8s-sentry"
+)
+
+// ownershipSource is a cluster to read owners from.
+type ownershipSource struct {
+	clientset *kubernetes.Clientset
+	namespace string
+}
+
+// ownershipSyncer keeps the issue ownership rules of a Sentry project in
+// sync with the owners set in a label or annotation of namespaces and
+// workloads.
+type ownershipSyncer struct {
+	url     string
+	token   string
+	key     string
+	sources []ownershipSource
+	client  *http.Client
+}
+
+// ownershipRule assigns issues with a tag value to owners.
+type ownershipRule struct {
+	Tag    string
+	Value  string
+	Owners []string
+}
+
+func (r ownershipRule) String() string {
+	return fmt.Sprintf("tags.%s:%s %s", r.Tag, r.Value, strings.Join(r.Owners, " "))
+}
+
+func newOwnershipSyncer(apiURL, org, project, token, key string) *ownershipSyncer {
+	return &ownershipSyncer{
+		url:    fmt.Sprintf("%s/projects/%s/%s/ownership/", strings.TrimSuffix(apiURL, "/"), org, project),
+		token:  token,
+		key:    key,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// AddSource adds a cluster to read owners from.
+func (s *ownershipSyncer) AddSource(clientset *kubernetes.Clientset, namespace string) {
+	s.sources = append(s.sources, ownershipSource{clientset: clientset, namespace: namespace})
+}
+
+// Run synchronizes the ownership rules every interval until stop is closed.
+func (s *ownershipSyncer) Run(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.Sync(); err != nil {
+			logger.Error("Error synchronizing Sentry ownership rules", "error", err)
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync updates the ownership rules of the project if they changed.
+func (s *ownershipSyncer) Sync() error {
+	var rules []ownershipRule
+	for _, source := range s.sources {
+		sourceRules, err := s.rules(source)
+		if err != nil {
+			return err
+		}
+		rules = append(rules, sourceRules...)
+	}
+
+	current, err := s.get()
+	if err != nil {
+		return err
+	}
+	updated := replaceOwnershipRules(current, rules)
+	if updated == current {
+		return nil
+	}
+	logger.Info("Updating Sentry ownership rules", "rules", len(rules))
+	return s.put(updated)
+}
+
+// rules returns the ownership rules for the namespaces and workloads of a
+// cluster. Namespace rules come first, so the more specific workload rules
+// take precedence.
+func (s *ownershipSyncer) rules(source ownershipSource) ([]ownershipRule, error) {
+	var namespaces []v1.Namespace
+	if source.namespace == "" {
+		list, err := source.clientset.CoreV1().Namespaces().List(metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("error listing namespaces: %v", err)
+		}
+		namespaces = list.Items
+	} else {
+		namespace, err := source.clientset.CoreV1().Namespaces().Get(source.namespace, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("error getting namespace: %v", err)
+		}
+		namespaces = []v1.Namespace{*namespace}
+	}
+	var rules []ownershipRule
+	for _, namespace := range namespaces {
+		if owners := s.owners(&namespace.ObjectMeta); len(owners) > 0 {
+			rules = append(rules, ownershipRule{Tag: "namespace", Value: namespace.Name, Owners: owners})
+		}
+	}
+
+	var workloads []metav1.ObjectMeta
+	var kinds []string
+	deployments, err := source.clientset.AppsV1().Deployments(source.namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing deployments: %v", err)
+	}
+	for _, deployment := range deployments.Items {
+		workloads, kinds = append(workloads, deployment.ObjectMeta), append(kinds, "Deployment")
+	}
+	statefulSets, err := source.clientset.AppsV1().StatefulSets(source.namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing statefulsets: %v", err)
+	}
+	for _, statefulSet := range statefulSets.Items {
+		workloads, kinds = append(workloads, statefulSet.ObjectMeta), append(kinds, "StatefulSet")
+	}
+	daemonSets, err := source.clientset.AppsV1().DaemonSets(source.namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing daemonsets: %v", err)
+	}
+	for _, daemonSet := range daemonSets.Items {
+		workloads, kinds = append(workloads, daemonSet.ObjectMeta), append(kinds, "DaemonSet")
+	}
+	for i := range workloads {
+		if owners := s.owners(&workloads[i]); len(owners) > 0 {
+			rules = append(rules, ownershipRule{Tag: "workload", Value: kinds[i] + "/" + workloads[i].Name, Owners: owners})
+		}
+	}
+	return rules, nil
+}
+
+// owners returns the owners set in the label or annotation of an object.
+// Owners without # or @ are taken to be team names, since label values can
+// not contain these characters.
+func (s *ownershipSyncer) owners(meta *metav1.ObjectMeta) []string {
+	value := meta.Annotations[s.key]
+	if value == "" {
+		value = meta.Labels[s.key]
+	}
+	var owners []string
+	for _, owner := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' }) {
+		if !strings.HasPrefix(owner, "#") && !strings.Contains(owner, "@") {
+			owner = "#" + owner
+		}
+		owners = append(owners, owner)
+	}
+	return owners
+}
+
+// replaceOwnershipRules replaces the rules managed by k8s-sentry in the raw
+// ownership rules of a project. The rules are sorted, so they only change
+// when the owners change.
+func replaceOwnershipRules(raw string, rules []ownershipRule) string {
+	lines := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		lines = append(lines, rule.String())
+	}
+	sort.SliceStable(lines, func(i, j int) bool {
+		// Keep namespace rules before workload rules.
+		iNamespace, jNamespace := strings.HasPrefix(lines[i], "tags.namespace:"), strings.HasPrefix(lines[j], "tags.namespace:")
+		if iNamespace != jNamespace {
+			return iNamespace
+		}
+		return lines[i] < lines[j]
+	})
+	block := ownershipBegin + "\n" + strings.Join(append(lines, ownershipEnd), "\n")
+
+	begin := strings.Index(raw, ownershipBegin)
+	end := strings.Index(raw, ownershipEnd)
+	if begin == -1 || end < begin {
+		if strings.TrimSpace(raw) == "" {
+			return block
+		}
+		return strings.TrimRight(raw, "\n") + "\n" + block
+	}
+	return raw[:begin] + block + raw[end+len(ownershipEnd):]
+}
+
+func (s *ownershipSyncer) get() (string, error) {
+	var ownership struct {
+		Raw string `json:"raw"`
+	}
+	if err := s.request(http.MethodGet, nil, &ownership); err != nil {
+		return "", err
+	}
+	return ownership.Raw, nil
+}
+
+func (s *ownershipSyncer) put(raw string) error {
+	body, err := json.Marshal(map[string]string{"raw": raw})
+	if err != nil {
+		return err
+	}
+	return s.request(http.MethodPut, body, nil)
+}
+
+func (s *ownershipSyncer) request(method string, body []byte, result interface{}) error {
+	request, err := http.NewRequest(method, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+s.token)
+	request.Header.Set("Content-Type", "application/json")
+	response, err := s.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	data, _ := ioutil.ReadAll(response.Body)
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("Sentry returned %s: %s", response.Status, bytes.TrimSpace(data))
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(data, result)
+}
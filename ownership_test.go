@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestReplaceOwnershipRules(t *testing.T) {
+	t.Parallel()
+
+	rules := []ownershipRule{
+		{Tag: "workload", Value: "Deployment/checkout", Owners: []string{"#checkout"}},
+		{Tag: "namespace", Value: "payments", Owners: []string{"#payments-team", "lead@example.com"}},
+	}
+	expected := "path:src/* #backend\n" +
+		"# BEGIN k8s-sentry\n" +
+		"tags.namespace:payments #payments-team lead@example.com\n" +
+		"tags.workload:Deployment/checkout #checkout\n" +
+		"# END k8s-sentry"
+
+	raw := replaceOwnershipRules("path:src/* #backend\n", rules)
+	if raw != expected {
+		t.Errorf("Unexpected rules:\n%s", raw)
+	}
+	if updated := replaceOwnershipRules(raw, rules); updated != raw {
+		t.Errorf("Rules changed without changes:\n%s", updated)
+	}
+	if updated := replaceOwnershipRules(raw, nil); updated != "path:src/* #backend\n# BEGIN k8s-sentry\n# END k8s-sentry" {
+		t.Errorf("Unexpected rules without owners:\n%s", updated)
+	}
+}
+
+func TestOwnershipOwners(t *testing.T) {
+	t.Parallel()
+
+	syncer := newOwnershipSyncer("https://sentry.example.com/api/0", "acme", "k8s", "token", "example.com/owner")
+	meta := &metav1.ObjectMeta{
+		Labels:      map[string]string{"example.com/owner": "payments"},
+		Annotations: map[string]string{},
+	}
+	if owners := syncer.owners(meta); !reflect.DeepEqual(owners, []string{"#payments"}) {
+		t.Errorf("Unexpected owners from label: %v", owners)
+	}
+	meta.Annotations["example.com/owner"] = "#payments, lead@example.com"
+	if owners := syncer.owners(meta); !reflect.DeepEqual(owners, []string{"#payments", "lead@example.com"}) {
+		t.Errorf("Unexpected owners from annotation: %v", owners)
+	}
+}
+
+func TestOwnershipSync(t *testing.T) {
+	t.Parallel()
+
+	raw := "path:src/* #backend"
+	puts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/0/projects/acme/k8s/ownership/" || r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("Unexpected request %s %s", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		if r.Method == http.MethodPut {
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			raw = body["raw"]
+			puts++
+		}
+		json.NewEncoder(w).Encode(map[string]string{"raw": raw})
+	}))
+	defer server.Close()
+
+	syncer := newOwnershipSyncer(server.URL+"/api/0", "acme", "k8s", "token", "example.com/owner")
+	for i := 0; i < 2; i++ {
+		if err := syncer.Sync(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if puts != 1 || raw != "path:src/* #backend\n# BEGIN k8s-sentry\n# END k8s-sentry" {
+		t.Errorf("Unexpected updates (%d): %s", puts, raw)
+	}
+}
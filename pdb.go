@@ -0,0 +1,239 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/tools/cache"
+)
+
+// pdbMonitor reports PodDisruptionBudgets that are violated, or that block
+// the eviction of pods from a cordoned node, for longer than a threshold.
+type pdbMonitor struct {
+	violated *conditionTracker
+	blocked  *conditionTracker
+
+	lock  sync.Mutex
+	nodes map[string]string
+}
+
+func newPDBMonitor(threshold time.Duration) *pdbMonitor {
+	return &pdbMonitor{
+		violated: newConditionTracker(threshold),
+		blocked:  newConditionTracker(threshold),
+		nodes:    make(map[string]string),
+	}
+}
+
+// Update records the status of a PodDisruptionBudget.
+func (m *pdbMonitor) Update(key string, pdb *policyv1beta1.PodDisruptionBudget, now time.Time) {
+	m.violated.Set(key, pdbViolated(pdb), now)
+}
+
+// SetBlocked records the cordoned node that a PodDisruptionBudget prevents
+// from being drained, or an empty node if it does not block a drain. The
+// threshold starts again when the blocked node changes.
+func (m *pdbMonitor) SetBlocked(key, node string, now time.Time) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.nodes[key] != node {
+		m.blocked.Set(key, false, now)
+	}
+	m.blocked.Set(key, node != "", now)
+	if node == "" {
+		delete(m.nodes, key)
+	} else {
+		m.nodes[key] = node
+	}
+}
+
+// BlockedNode returns the cordoned node that a PodDisruptionBudget prevents
+// from being drained.
+func (m *pdbMonitor) BlockedNode(key string) string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.nodes[key]
+}
+
+// Delete stops tracking a PodDisruptionBudget.
+func (m *pdbMonitor) Delete(key string, now time.Time) {
+	m.violated.Set(key, false, now)
+	m.SetBlocked(key, "", now)
+}
+
+func pdbViolated(pdb *policyv1beta1.PodDisruptionBudget) bool {
+	return pdb.Status.ObservedGeneration >= pdb.Generation &&
+		pdb.Status.CurrentHealthy < pdb.Status.DesiredHealthy
+}
+
+func (app *application) monitorPDBs(stop chan struct{}) {
+	watchList := cache.NewListWatchFromClient(
+		app.clientset.PolicyV1beta1().RESTClient(),
+		"poddisruptionbudgets",
+		app.namespace,
+		fields.Everything(),
+	)
+	update := func(obj interface{}) {
+		pdb, ok := obj.(*policyv1beta1.PodDisruptionBudget)
+		if !ok {
+			return
+		}
+		if key, err := cache.MetaNamespaceKeyFunc(pdb); err == nil {
+			app.pdbs.Update(key, pdb, time.Now())
+		}
+	}
+	store, controller := cache.NewInformer(
+		app.instrument("PodDisruptionBudget monitor", "poddisruptionbudgets", watchList),
+		&policyv1beta1.PodDisruptionBudget{},
+		time.Minute*10,
+		recoverHandlers("PodDisruptionBudget monitor", cache.ResourceEventHandlerFuncs{
+			AddFunc: update,
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				update(newObj)
+			},
+			DeleteFunc: func(obj interface{}) {
+				if key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj); err == nil {
+					app.pdbs.Delete(key, time.Now())
+				}
+			},
+		}),
+	)
+	app.registerInformer("PodDisruptionBudget monitor", controller.HasSynced)
+	go controller.Run(stop)
+
+	ticker := time.NewTicker(time.Second * 30)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			cordoned := app.cordonedNodes()
+			app.checkPDBs(store, func(pdb *policyv1beta1.PodDisruptionBudget) string {
+				if len(cordoned) == 0 {
+					return ""
+				}
+				return app.cordonedNodeForPDB(pdb, cordoned)
+			}, now)
+		}
+	}
+}
+
+// checkPDBs reports the PodDisruptionBudgets in store that have been
+// violated, or have blocked the drain of a cordoned node, for longer than
+// the threshold. Blocked drains are determined again every time, since a
+// PodDisruptionBudget without allowed disruptions only blocks a drain once
+// a node running one of its pods is cordoned. cordoned returns that node.
+func (app *application) checkPDBs(store cache.Store, cordoned func(*policyv1beta1.PodDisruptionBudget) string, now time.Time) {
+	for _, obj := range store.List() {
+		pdb, ok := obj.(*policyv1beta1.PodDisruptionBudget)
+		if !ok {
+			continue
+		}
+		key, err := cache.MetaNamespaceKeyFunc(pdb)
+		if err != nil {
+			continue
+		}
+		node := ""
+		if pdb.Status.PodDisruptionsAllowed == 0 && !pdbViolated(pdb) {
+			node = cordoned(pdb)
+		}
+		app.pdbs.SetBlocked(key, node, now)
+	}
+
+	for key, since := range app.pdbs.violated.Expired(now) {
+		if obj, exists, _ := store.GetByKey(key); exists {
+			app.reportPDB(obj.(*policyv1beta1.PodDisruptionBudget), since, "")
+		}
+	}
+	for key, since := range app.pdbs.blocked.Expired(now) {
+		obj, exists, _ := store.GetByKey(key)
+		if node := app.pdbs.BlockedNode(key); exists && node != "" {
+			app.reportPDB(obj.(*policyv1beta1.PodDisruptionBudget), since, node)
+		}
+	}
+}
+
+// cordonedNodes returns the names of all cordoned nodes.
+func (app *application) cordonedNodes() map[string]bool {
+	nodes, err := app.clientset.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		logger.Debug("Unable to list nodes", "error", err)
+		return nil
+	}
+	cordoned := make(map[string]bool)
+	for _, node := range nodes.Items {
+		if node.Spec.Unschedulable {
+			cordoned[node.Name] = true
+		}
+	}
+	return cordoned
+}
+
+// cordonedNodeForPDB returns the name of a cordoned node running a pod that
+// is covered by a PodDisruptionBudget. This indicates a drain which is
+// blocked by the PodDisruptionBudget.
+func (app *application) cordonedNodeForPDB(pdb *policyv1beta1.PodDisruptionBudget, cordoned map[string]bool) string {
+	selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+	if err != nil {
+		return ""
+	}
+	pods, err := app.clientset.CoreV1().Pods(pdb.Namespace).List(metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		logger.Debug("Unable to list pods", "namespace", pdb.Namespace, "error", err)
+		return ""
+	}
+	for _, pod := range pods.Items {
+		if cordoned[pod.Spec.NodeName] {
+			return pod.Spec.NodeName
+		}
+	}
+	return ""
+}
+
+// reportPDB reports a PodDisruptionBudget problem. If node is empty the
+// PodDisruptionBudget is violated, otherwise it blocks draining node.
+func (app *application) reportPDB(pdb *policyv1beta1.PodDisruptionBudget, since time.Time, node string) {
+	sentryEvent := app.newBaseEvent(pdb.Namespace)
+	if node == "" {
+		sentryEvent.Level = sentry.LevelError
+		sentryEvent.Message = fmt.Sprintf("PodDisruptionBudget/%s: only %d of %d desired pods healthy",
+			pdb.Name, pdb.Status.CurrentHealthy, pdb.Status.DesiredHealthy)
+		sentryEvent.Fingerprint = []string{"pdb-violated", pdb.Namespace, pdb.Name}
+	} else {
+		sentryEvent.Level = sentry.LevelWarning
+		sentryEvent.Message = fmt.Sprintf("PodDisruptionBudget/%s: blocking eviction from cordoned node %s", pdb.Name, node)
+		sentryEvent.Fingerprint = []string{"pdb-blocked", pdb.Namespace, pdb.Name}
+		sentryEvent.Tags["node"] = node
+	}
+	sentryEvent.Tags["kind"] = "PodDisruptionBudget"
+	sentryEvent.Tags["pdb"] = pdb.Name
+	sentryEvent.Extra["since"] = since.UTC().Format(time.RFC3339)
+	sentryEvent.Extra["current-healthy"] = pdb.Status.CurrentHealthy
+	sentryEvent.Extra["desired-healthy"] = pdb.Status.DesiredHealthy
+	sentryEvent.Extra["expected-pods"] = pdb.Status.ExpectedPods
+	sentryEvent.Extra["disruptions-allowed"] = pdb.Status.PodDisruptionsAllowed
+
+	logger.Info("Reporting PodDisruptionBudget", "namespace", pdb.Namespace, "pdb", pdb.Name, "message", sentryEvent.Message)
+	app.reportMonitorEvent(sentryEvent, objectReference("PodDisruptionBudget", pdb), fingerprintKey(sentryEvent))
+}
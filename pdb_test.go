@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestCheckPDBsBlockedDrain(t *testing.T) {
+	t.Parallel()
+
+	app := &application{pdbs: newPDBMonitor(10 * time.Minute), recent: newRecentEvents(10)}
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	pdb := &policyv1beta1.PodDisruptionBudget{}
+	pdb.Namespace = "shop"
+	pdb.Name = "web"
+	pdb.Status.CurrentHealthy = 2
+	pdb.Status.DesiredHealthy = 2
+	store.Add(pdb)
+
+	node := ""
+	cordoned := func(*policyv1beta1.PodDisruptionBudget) string { return node }
+	start := time.Now()
+	app.checkPDBs(store, cordoned, start)
+	app.checkPDBs(store, cordoned, start.Add(time.Hour))
+	if reported := app.recent.List(recentEventFilter{}, 10); len(reported) != 0 {
+		t.Fatalf("PodDisruptionBudget without cordoned node reported: %+v", reported)
+	}
+
+	node = "node-1"
+	app.checkPDBs(store, cordoned, start.Add(time.Hour+time.Minute))
+	if reported := app.recent.List(recentEventFilter{}, 10); len(reported) != 0 {
+		t.Fatalf("Blocked drain reported before threshold: %+v", reported)
+	}
+	app.checkPDBs(store, cordoned, start.Add(time.Hour+11*time.Minute))
+	reported := app.recent.List(recentEventFilter{Decision: decisionReported}, 10)
+	if len(reported) != 1 || !strings.Contains(reported[0].Message, "node-1") {
+		t.Fatalf("Blocked drain not reported: %+v", reported)
+	}
+
+	app.checkPDBs(store, cordoned, start.Add(time.Hour+12*time.Minute))
+	if reported := app.recent.List(recentEventFilter{}, 10); len(reported) != 1 {
+		t.Errorf("Blocked drain reported again: %+v", reported)
+	}
+}
+
+func TestCheckPDBsViolated(t *testing.T) {
+	t.Parallel()
+
+	app := &application{pdbs: newPDBMonitor(10 * time.Minute), recent: newRecentEvents(10)}
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	pdb := &policyv1beta1.PodDisruptionBudget{}
+	pdb.Namespace = "shop"
+	pdb.Name = "web"
+	pdb.Status.CurrentHealthy = 1
+	pdb.Status.DesiredHealthy = 2
+	store.Add(pdb)
+
+	start := time.Now()
+	app.pdbs.Update("shop/web", pdb, start)
+	cordoned := func(*policyv1beta1.PodDisruptionBudget) string {
+		t.Error("Violated PodDisruptionBudget checked for blocked drain")
+		return ""
+	}
+	app.checkPDBs(store, cordoned, start.Add(11*time.Minute))
+	reported := app.recent.List(recentEventFilter{Decision: decisionReported}, 10)
+	if len(reported) != 1 || !strings.Contains(reported[0].Message, "only 1 of 2") {
+		t.Errorf("Violated PodDisruptionBudget not reported: %+v", reported)
+	}
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+)
+
+// podPullTimes records when a pod started and finished pulling images,
+// based on the Pulling and Pulled events.
+type podPullTimes struct {
+	start time.Time
+	end   time.Time
+}
+
+// podStartupTracker collects the information needed to build pod startup
+// transactions.
+type podStartupTracker struct {
+	lock  sync.Mutex
+	pulls *lru.Cache
+}
+
+func newPodStartupTracker() (*podStartupTracker, error) {
+	pulls, err := lru.New(5000)
+	if err != nil {
+		return nil, err
+	}
+	return &podStartupTracker{pulls: pulls}, nil
+}
+
+// RecordEvent records image pull times from Pulling and Pulled events.
+func (t *podStartupTracker) RecordEvent(evt *v1.Event) {
+	if evt.InvolvedObject.Kind != "Pod" || (evt.Reason != "Pulling" && evt.Reason != "Pulled") {
+		return
+	}
+	at := eventTime(evt)
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	times := podPullTimes{}
+	if cached, ok := t.pulls.Get(evt.InvolvedObject.UID); ok {
+		times = cached.(podPullTimes)
+	}
+	if evt.Reason == "Pulling" && (times.start.IsZero() || at.Before(times.start)) {
+		times.start = at
+	}
+	if evt.Reason == "Pulled" && at.After(times.end) {
+		times.end = at
+	}
+	t.pulls.Add(evt.InvolvedObject.UID, times)
+}
+
+func (t *podStartupTracker) pullTimes(uid types.UID) podPullTimes {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if cached, ok := t.pulls.Get(uid); ok {
+		t.pulls.Remove(uid)
+		return cached.(podPullTimes)
+	}
+	return podPullTimes{}
+}
+
+// podStartupHandlers returns the pod handlers that send a transaction when
+// a pod becomes ready for the first time.
+func (app *application) podStartupHandlers() cache.ResourceEventHandler {
+	return recoverHandlers("pod startup monitor", cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldPod, ok := oldObj.(*v1.Pod)
+			if !ok {
+				return
+			}
+			pod, ok := newObj.(*v1.Pod)
+			if !ok || podReady(oldPod) || !podReady(pod) || podRestarted(pod) || !app.watchedNamespace(pod.Namespace) {
+				return
+			}
+			if app.shards != nil && !app.shards.Owns(pod.Namespace) {
+				return
+			}
+			app.transactions.Send(app.newPodStartupTransaction(pod, app.podStartup.pullTimes(pod.UID)))
+		},
+	})
+}
+
+// newPodStartupTransaction creates a transaction covering the time from pod
+// creation until the pod is ready.
+func (app *application) newPodStartupTransaction(pod *v1.Pod, pulls podPullTimes) *sentryTransaction {
+	created := pod.CreationTimestamp.Time
+	scheduled := podConditionTime(pod, v1.PodScheduled)
+	initialized := podConditionTime(pod, v1.PodInitialized)
+	ready := podConditionTime(pod, v1.PodReady)
+	var started time.Time
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Running != nil && status.State.Running.StartedAt.After(started) {
+			started = status.State.Running.StartedAt.Time
+		}
+	}
+
+	workload := podWorkload(pod)
+	tx := newTransaction(fmt.Sprintf("pod startup %s/%s", pod.Namespace, workload), "pod.startup", created, ready)
+	tx.Environment = app.environment(pod.Namespace)
+	for k, v := range app.tags() {
+		tx.Tags[k] = v
+	}
+	if app.clusterName != "" {
+		tx.Tags["cluster"] = app.clusterName
+	}
+	tx.Tags["namespace"] = pod.Namespace
+	tx.Tags["workload"] = workload
+	tx.Tags["node"] = pod.Spec.NodeName
+
+	tx.AddSpan("pod.schedule", "Scheduling", created, scheduled)
+	if len(pod.Spec.InitContainers) > 0 {
+		tx.AddSpan("pod.initialize", "Init containers", scheduled, initialized)
+	}
+	tx.AddSpan("image.pull", "Pulling images", pulls.start, pulls.end)
+	containerStart := initialized
+	if pulls.end.After(containerStart) {
+		containerStart = pulls.end
+	}
+	tx.AddSpan("container.start", "Starting containers", containerStart, started)
+	tx.AddSpan("pod.readiness", "Waiting for readiness", started, ready)
+	return tx
+}
+
+func podConditionTime(pod *v1.Pod, conditionType v1.PodConditionType) time.Time {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == conditionType && condition.Status == v1.ConditionTrue {
+			return condition.LastTransitionTime.Time
+		}
+	}
+	return time.Time{}
+}
+
+func podReady(pod *v1.Pod) bool {
+	return !podConditionTime(pod, v1.PodReady).IsZero()
+}
+
+// podRestarted returns true if any container in a pod has restarted. A pod
+// becoming ready after a restart is not a startup.
+func podRestarted(pod *v1.Pod) bool {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.RestartCount > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPodStartupTransaction(t *testing.T) {
+	t.Parallel()
+
+	created := time.Date(2019, 11, 1, 12, 0, 0, 0, time.UTC)
+	at := func(seconds int) metav1.Time {
+		return metav1.NewTime(created.Add(time.Duration(seconds) * time.Second))
+	}
+	controller := true
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         "shop",
+			Name:              "web-5d4f-x2x8q",
+			UID:               "1234",
+			CreationTimestamp: metav1.NewTime(created),
+			Labels:            map[string]string{"pod-template-hash": "5d4f"},
+			OwnerReferences:   []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "web-5d4f", Controller: &controller}},
+		},
+		Status: v1.PodStatus{
+			Conditions: []v1.PodCondition{
+				{Type: v1.PodScheduled, Status: v1.ConditionTrue, LastTransitionTime: at(2)},
+				{Type: v1.PodInitialized, Status: v1.ConditionTrue, LastTransitionTime: at(3)},
+				{Type: v1.PodReady, Status: v1.ConditionTrue, LastTransitionTime: at(30)},
+			},
+			ContainerStatuses: []v1.ContainerStatus{
+				{State: v1.ContainerState{Running: &v1.ContainerStateRunning{StartedAt: at(20)}}},
+			},
+		},
+	}
+
+	tracker, err := newPodStartupTracker()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := v1.ObjectReference{Kind: "Pod", UID: pod.UID}
+	tracker.RecordEvent(&v1.Event{InvolvedObject: ref, Reason: "Pulling", LastTimestamp: at(4)})
+	tracker.RecordEvent(&v1.Event{InvolvedObject: ref, Reason: "Pulled", LastTimestamp: at(15)})
+
+	tx := (&application{clusterName: "production"}).newPodStartupTransaction(pod, tracker.pullTimes(pod.UID))
+	if tx.Transaction != "pod startup shop/Deployment/web" {
+		t.Errorf("Unexpected transaction name: %s", tx.Transaction)
+	}
+	if tx.Timestamp.Sub(tx.StartTimestamp) != 30*time.Second {
+		t.Errorf("Unexpected duration: %s", tx.Timestamp.Sub(tx.StartTimestamp))
+	}
+	ops := map[string]time.Duration{}
+	for _, span := range tx.Spans {
+		ops[span.Op] = span.Timestamp.Sub(span.StartTimestamp)
+	}
+	expected := map[string]time.Duration{
+		"pod.schedule":    2 * time.Second,
+		"image.pull":      11 * time.Second,
+		"container.start": 5 * time.Second,
+		"pod.readiness":   10 * time.Second,
+	}
+	for op, duration := range expected {
+		if ops[op] != duration {
+			t.Errorf("Unexpected duration for %s: %s", op, ops[op])
+		}
+	}
+
+	dsn, err := sentry.NewDsn("https://key@sentry.example.com/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := json.Marshal(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request, err := newSentryRequest(dsn, "", "transaction", tx.EventID, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.URL.Path != "/api/1/envelope/" {
+		t.Errorf("Unexpected endpoint %s", request.URL)
+	}
+	body, _ := ioutil.ReadAll(request.Body)
+	lines := bytes.Split(bytes.TrimSpace(body), []byte("\n"))
+	var item map[string]interface{}
+	if len(lines) != 3 || json.Unmarshal(lines[1], &item) != nil || item["type"] != "transaction" {
+		t.Errorf("Unexpected envelope: %s", body)
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/tools/cache"
+)
+
+// needsPods returns true if any monitor that follows pods is enabled.
+func (app *application) needsPods() bool {
+	return app.capacity != nil || app.critical != nil || app.failedPods || app.podStartup != nil
+}
+
+// podNamespace returns the namespace in which pods are watched. Capacity
+// summaries and critical namespaces need pods outside the watched namespace,
+// so pods in all namespaces are watched if they are enabled.
+func (app *application) podNamespace() string {
+	if app.capacity != nil || app.critical != nil {
+		return v1.NamespaceAll
+	}
+	return app.namespace
+}
+
+// newPodInformer creates the pod informer shared by all pod monitors, so
+// pods are only listed and watched once per cluster.
+func (app *application) newPodInformer() cache.SharedIndexInformer {
+	watchList := cache.NewListWatchFromClient(
+		app.clientset.CoreV1().RESTClient(),
+		"pods",
+		app.podNamespace(),
+		fields.Everything(),
+	)
+	return cache.NewSharedIndexInformer(
+		app.instrument("pod monitor", "pods", watchList),
+		&v1.Pod{},
+		0,
+		cache.Indexers{},
+	)
+}
+
+// monitorPods registers the handlers of all pod monitors with the shared
+// pod informer and runs it.
+func (app *application) monitorPods(stop chan struct{}) {
+	pods := app.newPodInformer()
+	if app.capacity != nil {
+		pods.AddIndexers(cache.Indexers{podNodeIndex: podNodeName})
+		app.capacity.lock.Lock()
+		app.capacity.pods = pods.GetIndexer()
+		app.capacity.lock.Unlock()
+	}
+	if app.critical != nil {
+		pods.AddEventHandler(app.criticalPodHandlers())
+	}
+	if app.failedPods {
+		pods.AddEventHandler(app.failedPodHandlers())
+	}
+	if app.podStartup != nil {
+		pods.AddEventHandler(app.podStartupHandlers())
+	}
+
+	app.registerInformer("pod monitor", pods.HasSynced)
+	pods.Run(stop)
+}
+
+// watchedNamespace returns true if events for a namespace are reported. The
+// shared pod informer can include pods outside the watched namespace.
+func (app *application) watchedNamespace(namespace string) bool {
+	return app.namespace == v1.NamespaceAll || app.namespace == namespace
+}
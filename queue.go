@@ -0,0 +1,144 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// levelRank orders Sentry levels by severity.
+var levelRank = map[sentry.Level]int{
+	sentry.LevelDebug:   0,
+	sentry.LevelInfo:    1,
+	sentry.LevelWarning: 2,
+	sentry.LevelError:   3,
+	sentry.LevelFatal:   4,
+}
+
+// eventQueue is a bounded priority queue of Sentry events. Events with the
+// highest level are sent first. When it is full the oldest event with the
+// lowest level is dropped to make room, so a storm of warnings does not push
+// out errors. A new event is dropped instead if its level is lower than that
+// of every queued event.
+type eventQueue struct {
+	name string
+	size int
+
+	lock   sync.Mutex
+	events []*sentry.Event
+}
+
+func newEventQueue(name string, size int) *eventQueue {
+	return &eventQueue{name: name, size: size}
+}
+
+// Push adds an event to the queue.
+func (q *eventQueue) Push(event *sentry.Event) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if len(q.events) < q.size {
+		q.events = append(q.events, event)
+		return
+	}
+
+	lowest := 0
+	for i, queued := range q.events {
+		if levelRank[queued.Level] < levelRank[q.events[lowest].Level] {
+			lowest = i
+		}
+	}
+	if levelRank[event.Level] < levelRank[q.events[lowest].Level] {
+		droppedEvents.Record(q.name, event.Level)
+		return
+	}
+	droppedEvents.Record(q.name, q.events[lowest].Level)
+	q.events = append(append(q.events[:lowest], q.events[lowest+1:]...), event)
+}
+
+// Pop removes the oldest event with the highest level from the queue, or
+// returns nil if the queue is empty.
+func (q *eventQueue) Pop() *sentry.Event {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if len(q.events) == 0 {
+		return nil
+	}
+	highest := 0
+	for i, queued := range q.events {
+		if levelRank[queued.Level] > levelRank[q.events[highest].Level] {
+			highest = i
+		}
+	}
+	event := q.events[highest]
+	copy(q.events[highest:], q.events[highest+1:])
+	q.events[len(q.events)-1] = nil
+	q.events = q.events[:len(q.events)-1]
+	return event
+}
+
+// Usage returns the number of queued events and the size of the queue.
+func (q *eventQueue) Usage() (int, int) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return len(q.events), q.size
+}
+
+// dropCounter counts dropped events per queue and level.
+type dropCounter struct {
+	lock   sync.Mutex
+	counts map[dropKey]int64
+}
+
+type dropKey struct {
+	Queue string
+	Level sentry.Level
+}
+
+// droppedEvents counts all events dropped by k8s-sentry because a queue
+// was full.
+var droppedEvents = &dropCounter{counts: make(map[dropKey]int64)}
+
+// Record counts a dropped event.
+func (c *dropCounter) Record(queue string, level sentry.Level) {
+	logger.Debug("Queue full, dropping event", "queue", queue, "level", level)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.counts[dropKey{Queue: queue, Level: level}]++
+}
+
+// Counts returns the number of dropped events, sorted by queue and level.
+func (c *dropCounter) Counts() ([]dropKey, []int64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	keys := make([]dropKey, 0, len(c.counts))
+	for key := range c.counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Queue != keys[j].Queue {
+			return keys[i].Queue < keys[j].Queue
+		}
+		return levelRank[keys[i].Level] < levelRank[keys[j].Level]
+	})
+	counts := make([]int64, len(keys))
+	for i, key := range keys {
+		counts[i] = c.counts[key]
+	}
+	return keys, counts
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/getsentry/sentry-go"
+)
+
+func TestEventQueue(t *testing.T) {
+	t.Parallel()
+
+	newEvent := func(level sentry.Level, message string) *sentry.Event {
+		event := sentry.NewEvent()
+		event.Level = level
+		event.Message = message
+		return event
+	}
+
+	queue := newEventQueue("queue-test", 3)
+	queue.Push(newEvent(sentry.LevelWarning, "warning 1"))
+	queue.Push(newEvent(sentry.LevelError, "error 1"))
+	queue.Push(newEvent(sentry.LevelWarning, "warning 2"))
+	queue.Push(newEvent(sentry.LevelError, "error 2"))
+	queue.Push(newEvent(sentry.LevelInfo, "info"))
+	if used, size := queue.Usage(); used != 3 || size != 3 {
+		t.Errorf("Unexpected usage %d/%d", used, size)
+	}
+
+	var messages []string
+	for event := queue.Pop(); event != nil; event = queue.Pop() {
+		messages = append(messages, event.Message)
+	}
+	if len(messages) != 3 || messages[0] != "error 1" || messages[1] != "error 2" || messages[2] != "warning 2" {
+		t.Errorf("Unexpected events %v", messages)
+	}
+
+	var dropped int64
+	keys, counts := droppedEvents.Counts()
+	for i, key := range keys {
+		if key.Queue == "queue-test" {
+			if key.Level != sentry.LevelWarning && key.Level != sentry.LevelInfo {
+				t.Errorf("Unexpected drop of %s event", key.Level)
+			}
+			dropped += counts[i]
+		}
+	}
+	if dropped != 2 {
+		t.Errorf("Expected 2 dropped events, got %d", dropped)
+	}
+}
+
+func TestDropCounter(t *testing.T) {
+	t.Parallel()
+
+	counter := &dropCounter{counts: make(map[dropKey]int64)}
+	counter.Record("sentry", sentry.LevelWarning)
+	counter.Record("otlp", sentry.LevelError)
+	counter.Record("sentry", sentry.LevelInfo)
+	counter.Record("sentry", sentry.LevelInfo)
+
+	keys, counts := counter.Counts()
+	expected := []dropKey{{"otlp", sentry.LevelError}, {"sentry", sentry.LevelInfo}, {"sentry", sentry.LevelWarning}}
+	if len(keys) != len(expected) {
+		t.Fatalf("Unexpected keys %v", keys)
+	}
+	for i := range expected {
+		if keys[i] != expected[i] {
+			t.Errorf("Unexpected key %v at %d", keys[i], i)
+		}
+	}
+	if counts[1] != 2 {
+		t.Errorf("Unexpected count %d", counts[1])
+	}
+}
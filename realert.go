@@ -0,0 +1,68 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// realertPolicy determines when an event that is repeated, and therefore
+// updated with a higher count instead of created again, is reported again.
+type realertPolicy struct {
+	every      int32
+	thresholds []int32
+}
+
+// eventCount returns the number of times an event occurred.
+func eventCount(evt *v1.Event) int32 {
+	if evt.Series != nil && evt.Series.Count > evt.Count {
+		return evt.Series.Count
+	}
+	return evt.Count
+}
+
+// Due returns true if the count of an event increasing from oldCount to
+// newCount passes a multiple of every or one of the thresholds.
+func (p realertPolicy) Due(oldCount, newCount int32) bool {
+	if newCount <= oldCount {
+		return false
+	}
+	if p.every > 0 && newCount/p.every > oldCount/p.every {
+		return true
+	}
+	for _, threshold := range p.thresholds {
+		if oldCount < threshold && newCount >= threshold {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRealertThresholds parses a comma-separated list of counts.
+func parseRealertThresholds(value string) ([]int32, error) {
+	var thresholds []int32
+	for _, item := range parseList(value) {
+		threshold, err := strconv.ParseInt(item, 10, 32)
+		if err != nil || threshold < 2 {
+			return nil, fmt.Errorf("invalid re-alert threshold '%s'", item)
+		}
+		thresholds = append(thresholds, int32(threshold))
+	}
+	return thresholds, nil
+}
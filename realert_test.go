@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestRealertPolicyDue(t *testing.T) {
+	t.Parallel()
+
+	policy := realertPolicy{every: 50, thresholds: []int32{10, 100, 1000}}
+	tests := []struct {
+		oldCount, newCount int32
+		due                bool
+	}{
+		{1, 2, false},
+		{9, 10, true},
+		{10, 11, false},
+		{48, 52, true},
+		{99, 100, true},
+		{120, 130, false},
+		{5, 5, false},
+		{999, 1001, true},
+	}
+	for _, test := range tests {
+		if due := policy.Due(test.oldCount, test.newCount); due != test.due {
+			t.Errorf("Unexpected result for %d -> %d: %v", test.oldCount, test.newCount, due)
+		}
+	}
+}
+
+func TestEventCount(t *testing.T) {
+	t.Parallel()
+
+	if count := eventCount(&v1.Event{Count: 3}); count != 3 {
+		t.Errorf("Unexpected count: %d", count)
+	}
+	if count := eventCount(&v1.Event{Count: 1, Series: &v1.EventSeries{Count: 12}}); count != 12 {
+		t.Errorf("Unexpected count for series: %d", count)
+	}
+}
+
+func TestParseRealertThresholds(t *testing.T) {
+	t.Parallel()
+
+	thresholds, err := parseRealertThresholds("10, 100,1000")
+	if err != nil || len(thresholds) != 3 || thresholds[2] != 1000 {
+		t.Errorf("Unexpected thresholds: %v %v", thresholds, err)
+	}
+	for _, value := range []string{"ten", "1", "-5"} {
+		if _, err := parseRealertThresholds(value); err == nil {
+			t.Errorf("No error for '%s'", value)
+		}
+	}
+}
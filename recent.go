@@ -0,0 +1,211 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+)
+
+// Decisions for recently processed events.
+const (
+	decisionReported = "reported"
+	decisionSkipped  = "skipped"
+)
+
+// recentEvent is a processed Kubernetes event, with the decision of the
+// event pipeline.
+type recentEvent struct {
+	Time      time.Time     `json:"time"`
+	Cluster   string        `json:"cluster,omitempty"`
+	Namespace string        `json:"namespace"`
+	Kind      string        `json:"kind"`
+	Name      string        `json:"name"`
+	Type      string        `json:"type"`
+	Reason    string        `json:"reason"`
+	Message   string        `json:"message"`
+	Decision  string        `json:"decision"`
+	Cause     string        `json:"cause,omitempty"`
+	Payload   *sentry.Event `json:"payload,omitempty"`
+}
+
+// recentEventFilter selects recent events. Empty fields match all events.
+type recentEventFilter struct {
+	Cluster   string
+	Namespace string
+	Reason    string
+	Decision  string
+}
+
+func (f recentEventFilter) matches(event *recentEvent) bool {
+	return (f.Cluster == "" || f.Cluster == event.Cluster) &&
+		(f.Namespace == "" || f.Namespace == event.Namespace) &&
+		(f.Reason == "" || f.Reason == event.Reason) &&
+		(f.Decision == "" || f.Decision == event.Decision)
+}
+
+// rateWindow is the period over which event rates per namespace are
+// counted, in minutes.
+const rateWindow = 60
+
+// namespaceRate is the number of events processed for a namespace during
+// the last rateWindow minutes.
+type namespaceRate struct {
+	Cluster   string
+	Namespace string
+	Reported  int
+	Skipped   int
+}
+
+// rateMinute counts the events processed per namespace during one minute.
+type rateMinute struct {
+	start  time.Time
+	counts map[[2]string]*namespaceRate
+}
+
+// recentEvents is a ring buffer of recently processed events, to find out
+// why an event did or did not reach Sentry. It also counts the events per
+// namespace over the last hour. Messages are scrubbed by scrubber, if it is
+// not nil, like the events sent to Sentry.
+type recentEvents struct {
+	scrubber *scrubber
+
+	lock    sync.Mutex
+	events  []*recentEvent
+	next    int
+	full    bool
+	minutes [rateWindow]rateMinute
+}
+
+func newRecentEvents(size int) *recentEvents {
+	return &recentEvents{events: make([]*recentEvent, size)}
+}
+
+func (r *recentEvents) scrubMessage(message string) string {
+	if r.scrubber == nil {
+		return message
+	}
+	return r.scrubber.String(message)
+}
+
+// Record adds a processed event. sentryEvent is the event sent to Sentry, or
+// nil if the event was skipped for cause.
+func (r *recentEvents) Record(cluster string, evt *v1.Event, sentryEvent *sentry.Event, cause string, now time.Time) {
+	event := &recentEvent{
+		Time:      now,
+		Cluster:   cluster,
+		Namespace: evt.InvolvedObject.Namespace,
+		Kind:      evt.InvolvedObject.Kind,
+		Name:      evt.InvolvedObject.Name,
+		Type:      evt.Type,
+		Reason:    evt.Reason,
+		Message:   r.scrubMessage(evt.Message),
+		Decision:  decisionReported,
+		Payload:   sentryEvent,
+	}
+	if sentryEvent == nil {
+		event.Decision = decisionSkipped
+		event.Cause = cause
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.events[r.next] = event
+	r.next = (r.next + 1) % len(r.events)
+	if r.next == 0 {
+		r.full = true
+	}
+
+	start := now.Truncate(time.Minute)
+	minute := &r.minutes[start.Unix()/60%rateWindow]
+	if !minute.start.Equal(start) {
+		minute.start = start
+		minute.counts = make(map[[2]string]*namespaceRate)
+	}
+	key := [2]string{cluster, event.Namespace}
+	rate := minute.counts[key]
+	if rate == nil {
+		rate = &namespaceRate{Cluster: cluster, Namespace: event.Namespace}
+		minute.counts[key] = rate
+	}
+	if sentryEvent == nil {
+		rate.Skipped++
+	} else {
+		rate.Reported++
+	}
+}
+
+// Rates returns the number of events processed per namespace during the
+// last hour, busiest namespace first.
+func (r *recentEvents) Rates(now time.Time) []namespaceRate {
+	r.lock.Lock()
+	totals := make(map[[2]string]*namespaceRate)
+	since := now.Add(-rateWindow * time.Minute)
+	for _, minute := range r.minutes {
+		if !minute.start.After(since) {
+			continue
+		}
+		for key, rate := range minute.counts {
+			total := totals[key]
+			if total == nil {
+				total = &namespaceRate{Cluster: rate.Cluster, Namespace: rate.Namespace}
+				totals[key] = total
+			}
+			total.Reported += rate.Reported
+			total.Skipped += rate.Skipped
+		}
+	}
+	r.lock.Unlock()
+
+	rates := make([]namespaceRate, 0, len(totals))
+	for _, total := range totals {
+		rates = append(rates, *total)
+	}
+	sort.Slice(rates, func(i, j int) bool {
+		a, b := rates[i], rates[j]
+		if a.Reported+a.Skipped != b.Reported+b.Skipped {
+			return a.Reported+a.Skipped > b.Reported+b.Skipped
+		}
+		if a.Cluster != b.Cluster {
+			return a.Cluster < b.Cluster
+		}
+		return a.Namespace < b.Namespace
+	})
+	return rates
+}
+
+// List returns the recent events matching filter, newest first, up to limit
+// events.
+func (r *recentEvents) List(filter recentEventFilter, limit int) []*recentEvent {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	count := r.next
+	if r.full {
+		count = len(r.events)
+	}
+	result := []*recentEvent{}
+	for i := 1; i <= count && len(result) < limit; i++ {
+		event := r.events[(r.next-i+len(r.events))%len(r.events)]
+		if filter.matches(event) {
+			result = append(result, event)
+		}
+	}
+	return result
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestRecentEvents(t *testing.T) {
+	t.Parallel()
+
+	recent := newRecentEvents(2)
+	now := time.Now()
+	for _, reason := range []string{"BackOff", "FailedMount", "Unhealthy"} {
+		evt := &v1.Event{Reason: reason, Type: v1.EventTypeWarning}
+		evt.InvolvedObject.Namespace = "shop"
+		if reason == "FailedMount" {
+			recent.Record("", evt, nil, "muted", now)
+		} else {
+			recent.Record("", evt, sentry.NewEvent(), "", now)
+		}
+	}
+
+	events := recent.List(recentEventFilter{}, 10)
+	if len(events) != 2 || events[0].Reason != "Unhealthy" || events[1].Reason != "FailedMount" {
+		t.Errorf("Unexpected events %+v", events)
+	}
+	events = recent.List(recentEventFilter{Decision: decisionSkipped}, 10)
+	if len(events) != 1 || events[0].Cause != "muted" || events[0].Payload != nil {
+		t.Errorf("Unexpected skipped events %+v", events)
+	}
+	if events := recent.List(recentEventFilter{Namespace: "other"}, 10); len(events) != 0 {
+		t.Errorf("Namespace filter returned %+v", events)
+	}
+	if events := recent.List(recentEventFilter{}, 1); len(events) != 1 {
+		t.Errorf("Limit returned %d events", len(events))
+	}
+}
+
+func TestRecentEventsScrub(t *testing.T) {
+	t.Parallel()
+
+	recent := newRecentEvents(2)
+	var err error
+	if recent.scrubber, err = newScrubber(true, nil); err != nil {
+		t.Fatal(err)
+	}
+	evt := &v1.Event{Reason: "Failed", Message: "connecting with password=hunter2 failed"}
+	recent.Record("", evt, nil, "muted", time.Now())
+	if events := recent.List(recentEventFilter{}, 1); len(events) != 1 || events[0].Message != "connecting with password=[Filtered] failed" {
+		t.Errorf("Message not scrubbed: %+v", events)
+	}
+}
+
+func TestAPIServerEvents(t *testing.T) {
+	t.Parallel()
+
+	server := newAPIServer("secret", newMuteList(), nil, newRecentEvents(10), nil, nil)
+	for _, path := range []string{"/api/v1/events?decision=skipped", "/api/v1/events?decision=other", "/api/v1/events?limit=0"} {
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		request.Header.Set("Authorization", "Bearer secret")
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		expected := http.StatusBadRequest
+		if path == "/api/v1/events?decision=skipped" {
+			expected = http.StatusOK
+		}
+		if response.Code != expected {
+			t.Errorf("%s returned %d", path, response.Code)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// configFileValues contains the settings read from CONFIG_FILE. They take
+// precedence over environment variables.
+var configFileValues map[string]string
+
+// loadConfigFile reads a file with KEY=value lines, using the names of the
+// environment variables. Empty lines and lines starting with # are ignored.
+func loadConfigFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		parts := strings.SplitN(text, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("%s:%d: expected KEY=value", path, line)
+		}
+		values[strings.TrimSpace(parts[0])] = strings.Trim(strings.TrimSpace(parts[1]), `"`)
+	}
+	return values, scanner.Err()
+}
+
+// eventSettings are the settings of the event pipeline that can be changed
+// by reloading the configuration.
+type eventSettings struct {
+	environment      string
+	tags             map[string]string
+	grouping         string
+	timestamps       string
+	maxEventAge      time.Duration
+	sampler          *sampler
+	preemptionLevel  sentry.Level
+	maintenance      []maintenanceWindow
+	rules            []rule
+	extensions       []extension
+	extensionTimeout time.Duration
+	escalation       *escalator
+	// filters describes the settings for the runtime API.
+	filters map[string]interface{}
+}
+
+func (c *config) eventSettings() (*eventSettings, error) {
+	tags, err := c.defaultTags()
+	if err != nil {
+		return nil, err
+	}
+	rates, err := parseSampleRates(c.sampleRates)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing sample rates: %v", err)
+	}
+	eventSampler, err := newSampler(rates)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateFingerprintStrategy(c.fingerprint); err != nil {
+		return nil, err
+	}
+	if err := validateTimestampSource(c.timestampSource); err != nil {
+		return nil, err
+	}
+
+	settings := &eventSettings{
+		environment:      c.environment,
+		tags:             tags,
+		grouping:         c.fingerprint,
+		timestamps:       c.timestampSource,
+		maxEventAge:      c.maxEventAge,
+		sampler:          eventSampler,
+		extensions:       parseExtensions(c.extensions),
+		extensionTimeout: c.extensionTimeout,
+		filters:          c.settingsFilters(),
+	}
+	switch sentry.Level(c.preemptionLevel) {
+	case "", sentry.LevelInfo, sentry.LevelWarning:
+		settings.preemptionLevel = sentry.Level(c.preemptionLevel)
+	default:
+		return nil, fmt.Errorf("invalid preemption level '%s', expected info or warning", c.preemptionLevel)
+	}
+	if settings.maintenance, err = parseMaintenanceWindows(c.maintenanceWindows); err != nil {
+		return nil, err
+	}
+	if settings.rules, err = loadRules(c.rulesFile); err != nil {
+		return nil, err
+	}
+	escalationRules, err := parseEscalationRules(c.escalationRules)
+	if err != nil {
+		return nil, err
+	}
+	if len(escalationRules) > 0 {
+		if settings.escalation, err = newEscalator(escalationRules); err != nil {
+			return nil, err
+		}
+	}
+	return settings, nil
+}
+
+// applySettings changes the settings of the event pipeline. Events that are
+// being processed are finished with the old settings.
+func (app *application) applySettings(settings *eventSettings) {
+	if app.settingsLock != nil {
+		app.settingsLock.Lock()
+		defer app.settingsLock.Unlock()
+	}
+	app.baseLock.Lock()
+	app.defaultEnvironment = settings.environment
+	app.defaultTags = settings.tags
+	app.baseLock.Unlock()
+	app.grouping = settings.grouping
+	app.timestamps = settings.timestamps
+	app.maxEventAge = settings.maxEventAge
+	// Keep the counts of the sampler and escalator if their configuration
+	// did not change, so reloading does not reset them.
+	if app.sampler == nil || settings.sampler == nil || !reflect.DeepEqual(app.sampler.rates, settings.sampler.rates) {
+		app.sampler = settings.sampler
+	}
+	app.preemptionLevel = settings.preemptionLevel
+	app.maintenance = settings.maintenance
+	app.rules = settings.rules
+	app.extensions = settings.extensions
+	app.extensionTimeout = settings.extensionTimeout
+	if app.escalation == nil || settings.escalation == nil || !reflect.DeepEqual(app.escalation.rules, settings.escalation.rules) {
+		app.escalation = settings.escalation
+	}
+	app.settingsFilters = settings.filters
+}
+
+// filters returns a description of the current settings of the filters that
+// can be reloaded, for the runtime API.
+func (app *application) filters() map[string]interface{} {
+	if app.settingsLock != nil {
+		app.settingsLock.RLock()
+		defer app.settingsLock.RUnlock()
+	}
+	return app.settingsFilters
+}
+
+// reloadConfig reads the configuration again, and applies the settings of
+// the event pipeline and the Sentry client. Informers keep running with
+// their original settings. If the new configuration is invalid nothing is
+// changed.
+func reloadConfig(args []string, apps []*application, health *healthMonitor) error {
+	cfg, err := parseConfig(flag.NewFlagSet("run", flag.ContinueOnError), args)
+	if err != nil {
+		return err
+	}
+
+	// Every cluster gets its own settings, so the state of samplers and
+	// escalators is not shared between clusters.
+	settings := make([]*eventSettings, len(apps))
+	for i := range apps {
+		if settings[i], err = cfg.eventSettings(); err != nil {
+			return err
+		}
+	}
+	options, err := cfg.sentryOptions()
+	if err != nil {
+		return err
+	}
+	client, err := sentry.NewClient(options)
+	if err != nil {
+		return fmt.Errorf("error creating Sentry client: %v", err)
+	}
+
+	for i, app := range apps {
+		app.applySettings(settings[i])
+	}
+	hub := sentry.CurrentHub()
+	oldClient := hub.Client()
+	hub.BindClient(client)
+	if health != nil {
+		if transport, ok := options.Transport.(*queuedTransport); ok {
+			health.AddQueue("Sentry", transport.Usage)
+		}
+	}
+	// Flush the old client after the new one is bound, so events that were
+	// captured while switching are not lost.
+	if oldClient != nil {
+		oldClient.Flush(time.Second * 1)
+	}
+	return nil
+}
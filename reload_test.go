@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/getsentry/sentry-go"
+)
+
+func TestLoadConfigFile(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "k8s-sentry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.env")
+	data := "# Filters\nSAMPLE_RATES=Normal=0.1\n\nTAGS = \"team=platform\"\n"
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	values, err := loadConfigFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]string{"SAMPLE_RATES": "Normal=0.1", "TAGS": "team=platform"}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("unexpected values: %v", values)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("TAGS\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfigFile(path); err == nil {
+		t.Error("expected an error for a line without value")
+	}
+}
+
+func TestApplySettings(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config{
+		tags:            "team=platform",
+		fingerprint:     fingerprintWorkload,
+		timestampSource: timestampLast,
+		preemptionLevel: "info",
+		escalationRules: "warning 10 1m error",
+	}
+	settings, err := cfg.eventSettings()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	app := &application{grouping: fingerprintObject}
+	app.applySettings(settings)
+	if app.grouping != fingerprintWorkload || app.timestamps != timestampLast || app.preemptionLevel != sentry.LevelInfo {
+		t.Errorf("settings not applied: %+v", app)
+	}
+	if app.defaultTags["team"] != "platform" || app.escalation == nil {
+		t.Errorf("settings not applied: %+v", app)
+	}
+
+	cfg.fingerprint = "pod"
+	if _, err := cfg.eventSettings(); err == nil {
+		t.Error("expected an error for an invalid fingerprint strategy")
+	}
+}
+
+func TestApplySettingsKeepsState(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config{fingerprint: fingerprintObject, timestampSource: timestampCreation, sampleRates: "BackOff=0.5", escalationRules: "warning 10 1m error"}
+	settings, err := cfg.eventSettings()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	app := &application{}
+	app.applySettings(settings)
+	sampler, escalation := app.sampler, app.escalation
+
+	if settings, err = cfg.eventSettings(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	app.applySettings(settings)
+	if app.sampler != sampler || app.escalation != escalation {
+		t.Error("sampler and escalator replaced without a configuration change")
+	}
+
+	cfg.escalationRules = "warning 5 1m error"
+	if settings, err = cfg.eventSettings(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	app.applySettings(settings)
+	if app.sampler != sampler || app.escalation == escalation {
+		t.Error("escalator not replaced after a configuration change")
+	}
+	if app.filters()["escalation-rules"] != "warning 5 1m error" {
+		t.Errorf("filters not updated: %v", app.filters())
+	}
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+)
+
+// replayResult is the outcome of replaying a single event.
+type replayResult struct {
+	Namespace string        `json:"namespace"`
+	Kind      string        `json:"kind"`
+	Name      string        `json:"name"`
+	Reason    string        `json:"reason"`
+	Decision  string        `json:"decision"`
+	Cause     string        `json:"cause,omitempty"`
+	Sentry    *sentry.Event `json:"sentry,omitempty"`
+}
+
+func newReplayResult(evt *v1.Event, sentryEvent *sentry.Event, cause string) replayResult {
+	result := replayResult{
+		Namespace: evt.InvolvedObject.Namespace,
+		Kind:      evt.InvolvedObject.Kind,
+		Name:      evt.InvolvedObject.Name,
+		Reason:    evt.Reason,
+		Decision:  "report",
+		Cause:     cause,
+		Sentry:    sentryEvent,
+	}
+	if sentryEvent == nil {
+		result.Decision = "skip"
+	}
+	return result
+}
+
+func replayCommand(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	send := fs.Bool("send", false, "Send events to Sentry instead of printing them")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s replay [flags] <file>...\n\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "Replay exported events (JSON or NDJSON, use - for stdin). Flags:\n")
+		fs.PrintDefaults()
+	}
+	cfg, err := parseConfig(fs, args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("no input files given")
+	}
+
+	if *send {
+		options, err := cfg.sentryOptions()
+		if err != nil {
+			return err
+		}
+		if err := sentry.Init(options); err != nil {
+			return fmt.Errorf("error initialising sentry: %v", err)
+		}
+		defer sentry.Flush(time.Second * 5)
+	}
+
+	apps, err := cfg.applications()
+	if err != nil {
+		logger.Warning("Kubernetes cluster not available, replaying without enrichment", "error", err)
+		app, err := cfg.newApplication(cluster{name: cfg.clusterName})
+		if err != nil {
+			return err
+		}
+		apps = []*application{app}
+	}
+	for _, app := range apps {
+		// Replayed events are old, and may belong to any shard.
+		app.maxEventAge = 0
+		app.shards = nil
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	for _, path := range fs.Args() {
+		events, err := readEvents(path)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %v", path, err)
+		}
+
+		for i := range events {
+			evt := &events[i]
+			sentryEvent, cause := replayApplication(apps, evt).processEvent(evt)
+			if *send {
+				if sentryEvent != nil {
+					sentry.CaptureEvent(sentryEvent)
+				}
+				continue
+			}
+
+			if err := encoder.Encode(newReplayResult(evt, sentryEvent, cause)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// replayApplication returns the application for the cluster an event was
+// archived for, or the first application if the cluster is not known.
+func replayApplication(apps []*application, evt *v1.Event) *application {
+	for _, app := range apps {
+		if evt.ClusterName != "" && app.clusterName == evt.ClusterName {
+			return app
+		}
+	}
+	return apps[0]
+}
+
+// readEvents reads events from a file. The file may contain a JSON list of
+// events, an EventList as produced by kubectl get events -o json, or any
+// number of concatenated events such as NDJSON.
+func readEvents(path string) ([]v1.Event, error) {
+	var input io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		input = file
+	}
+
+	var events []v1.Event
+	decoder := json.NewDecoder(input)
+	for {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err == io.EOF {
+			return events, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("[")) {
+			var list []v1.Event
+			if err := json.Unmarshal(raw, &list); err != nil {
+				return nil, err
+			}
+			events = append(events, list...)
+			continue
+		}
+
+		var list v1.EventList
+		if err := json.Unmarshal(raw, &list); err != nil {
+			return nil, err
+		}
+		if list.Kind == "EventList" || list.Kind == "List" {
+			events = append(events, list.Items...)
+			continue
+		}
+
+		var evt v1.Event
+		if err := json.Unmarshal(raw, &evt); err != nil {
+			return nil, err
+		}
+		events = append(events, evt)
+	}
+}
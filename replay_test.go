@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestReadEvents(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "k8s-sentry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	inputs := map[string]string{
+		"ndjson": `{"reason":"BackOff"}` + "\n" + `{"reason":"Failed"}` + "\n",
+		"list":   `{"kind":"List","items":[{"reason":"BackOff"},{"reason":"Failed"}]}`,
+		"array":  `[{"reason":"BackOff"},{"reason":"Failed"}]`,
+	}
+	for name, input := range inputs {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(input), 0644); err != nil {
+			t.Fatal(err)
+		}
+		events, err := readEvents(path)
+		if err != nil {
+			t.Errorf("Error reading %s input: %v", name, err)
+			continue
+		}
+		if len(events) != 2 || events[0].Reason != "BackOff" || events[1].Reason != "Failed" {
+			t.Errorf("Unexpected events read from %s input: %v", name, events)
+		}
+	}
+}
+
+func TestReplayApplication(t *testing.T) {
+	t.Parallel()
+
+	apps := []*application{{clusterName: "prod"}, {clusterName: "staging"}}
+	for cluster, expected := range map[string]string{"staging": "staging", "prod": "prod", "": "prod", "other": "prod"} {
+		evt := &v1.Event{}
+		evt.ClusterName = cluster
+		if app := replayApplication(apps, evt); app.clusterName != expected {
+			t.Errorf("Event for cluster '%s' replayed with %s", cluster, app.clusterName)
+		}
+	}
+}
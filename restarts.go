@@ -0,0 +1,112 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"sort"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	v1 "k8s.io/api/core/v1"
+)
+
+// maxRestartHistory is the number of terminations of a container included
+// in events.
+const maxRestartHistory = 3
+
+// restartHistoryReasons are the reasons of events about failing containers,
+// to which the restart history is added.
+var restartHistoryReasons = map[string]bool{
+	"BackOff":   true,
+	"Failed":    true,
+	"Unhealthy": true,
+	"OOMKilled": true,
+}
+
+// containerTermination is a termination of a container.
+type containerTermination struct {
+	Reason      string    `json:"reason,omitempty"`
+	ExitCode    int32     `json:"exit-code"`
+	Signal      int32     `json:"signal,omitempty"`
+	FinishedAt  time.Time `json:"finished-at"`
+	containerID string
+}
+
+// containerHistory is the restart history of a container.
+type containerHistory struct {
+	Restarts     int32                  `json:"restarts"`
+	Terminations []containerTermination `json:"last-terminations,omitempty"`
+}
+
+// restartHistory returns the restart count and the last terminations of a
+// container of a pod, or of all its containers if name is empty. Container
+// statuses only contain the current and previous termination, so
+// terminations seen in earlier events are remembered in seen, if it is not
+// nil. Containers that never terminated are left out.
+func restartHistory(pod *v1.Pod, name string, seen *lru.Cache) map[string]containerHistory {
+	result := make(map[string]containerHistory)
+	add := func(statuses []v1.ContainerStatus) {
+		for _, status := range statuses {
+			if name != "" && status.Name != name {
+				continue
+			}
+			key := string(pod.UID) + "/" + status.Name
+			var terminations []containerTermination
+			if seen != nil {
+				if value, ok := seen.Get(key); ok {
+					terminations = value.([]containerTermination)
+				}
+			}
+			for _, state := range []v1.ContainerState{status.State, status.LastTerminationState} {
+				if state.Terminated != nil {
+					terminations = addTermination(terminations, state.Terminated)
+				}
+			}
+			if seen != nil && len(terminations) > 0 {
+				seen.Add(key, terminations)
+			}
+			if status.RestartCount > 0 || len(terminations) > 0 {
+				result[status.Name] = containerHistory{Restarts: status.RestartCount, Terminations: terminations}
+			}
+		}
+	}
+	add(pod.Status.InitContainerStatuses)
+	add(pod.Status.ContainerStatuses)
+	return result
+}
+
+// addTermination adds a termination to a list of terminations, newest
+// first, unless the list already contains it.
+func addTermination(terminations []containerTermination, state *v1.ContainerStateTerminated) []containerTermination {
+	termination := containerTermination{
+		Reason:      state.Reason,
+		ExitCode:    state.ExitCode,
+		Signal:      state.Signal,
+		FinishedAt:  state.FinishedAt.Time.UTC(),
+		containerID: state.ContainerID,
+	}
+	for _, known := range terminations {
+		if known.containerID == termination.containerID && known.FinishedAt.Equal(termination.FinishedAt) {
+			return terminations
+		}
+	}
+	result := append([]containerTermination{termination}, terminations...)
+	sort.SliceStable(result, func(i, j int) bool { return result[i].FinishedAt.After(result[j].FinishedAt) })
+	if len(result) > maxRestartHistory {
+		result = result[:maxRestartHistory]
+	}
+	return result
+}
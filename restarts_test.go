@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRestartHistory(t *testing.T) {
+	t.Parallel()
+
+	seen, _ := lru.New(10)
+	start := time.Date(2019, 10, 22, 15, 0, 0, 0, time.UTC)
+	pod := &v1.Pod{}
+	pod.UID = "2f6b1c"
+	restart := func(count int32) {
+		pod.Status.ContainerStatuses = []v1.ContainerStatus{
+			{Name: "sidecar"},
+			{Name: "app", RestartCount: count, LastTerminationState: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{
+				Reason:      "OOMKilled",
+				ExitCode:    137,
+				FinishedAt:  metav1.NewTime(start.Add(time.Duration(count) * time.Minute)),
+				ContainerID: "containerd://" + string(rune('a'+count)),
+			}}},
+		}
+	}
+
+	for count := int32(1); count <= 4; count++ {
+		restart(count)
+		restartHistory(pod, "app", seen)
+	}
+	history := restartHistory(pod, "", seen)
+	if len(history) != 1 {
+		t.Fatalf("Unexpected containers %v", history)
+	}
+	app := history["app"]
+	if app.Restarts != 4 || len(app.Terminations) != maxRestartHistory {
+		t.Fatalf("Unexpected history %+v", app)
+	}
+	if !app.Terminations[0].FinishedAt.Equal(start.Add(4*time.Minute)) || !app.Terminations[2].FinishedAt.Equal(start.Add(2*time.Minute)) {
+		t.Errorf("Terminations not ordered newest first: %+v", app.Terminations)
+	}
+	if app.Terminations[0].Reason != "OOMKilled" || app.Terminations[0].ExitCode != 137 {
+		t.Errorf("Unexpected termination %+v", app.Terminations[0])
+	}
+
+	if history := restartHistory(pod, "app", nil); len(history["app"].Terminations) != 1 {
+		t.Errorf("Unexpected history without cache %+v", history)
+	}
+}
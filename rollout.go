@@ -0,0 +1,169 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+)
+
+// revisionAnnotation is set by the Deployment controller, and is increased
+// for every change to the pod template.
+const revisionAnnotation = "deployment.kubernetes.io/revision"
+
+type rollout struct {
+	revision string
+	started  time.Time
+	observed time.Time
+	updated  time.Time
+}
+
+// rolloutTracker follows Deployment rollouts, from the moment a new
+// revision is created until all replicas are updated and available.
+type rolloutTracker struct {
+	lock     sync.Mutex
+	rollouts map[types.UID]*rollout
+}
+
+func newRolloutTracker() *rolloutTracker {
+	return &rolloutTracker{rollouts: make(map[types.UID]*rollout)}
+}
+
+// Update processes a new state of a Deployment. If this completes a rollout
+// the rollout is returned. initial must be true for Deployments seen when
+// starting, whose rollouts are not tracked since their start is unknown.
+func (t *rolloutTracker) Update(deployment *appsv1.Deployment, initial bool, now time.Time) *rollout {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	revision := deployment.Annotations[revisionAnnotation]
+	state, ok := t.rollouts[deployment.UID]
+	if !ok || state.revision != revision {
+		state = &rollout{revision: revision}
+		if ok && !initial {
+			state.started = now
+		}
+		t.rollouts[deployment.UID] = state
+	}
+	if state.started.IsZero() {
+		return nil
+	}
+
+	desired := int32(1)
+	if deployment.Spec.Replicas != nil {
+		desired = *deployment.Spec.Replicas
+	}
+	status := deployment.Status
+	if state.observed.IsZero() && status.ObservedGeneration >= deployment.Generation {
+		state.observed = now
+	}
+	if state.observed.IsZero() {
+		return nil
+	}
+	if state.updated.IsZero() && status.UpdatedReplicas >= desired {
+		state.updated = now
+	}
+	if status.UpdatedReplicas >= desired && status.AvailableReplicas >= desired && status.Replicas == status.UpdatedReplicas {
+		completed := *state
+		t.rollouts[deployment.UID] = &rollout{revision: revision}
+		return &completed
+	}
+	return nil
+}
+
+// Delete stops tracking a Deployment.
+func (t *rolloutTracker) Delete(uid types.UID) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.rollouts, uid)
+}
+
+func (app *application) monitorRollouts(stop chan struct{}) {
+	watchList := cache.NewListWatchFromClient(
+		app.clientset.AppsV1().RESTClient(),
+		"deployments",
+		app.namespace,
+		fields.Everything(),
+	)
+	update := func(obj interface{}, initial bool) {
+		deployment, ok := obj.(*appsv1.Deployment)
+		if !ok {
+			return
+		}
+		completed := app.rollouts.Update(deployment, initial, time.Now())
+		if completed == nil || (app.shards != nil && !app.shards.Owns(deployment.Namespace)) {
+			return
+		}
+		app.transactions.Send(app.newRolloutTransaction(deployment, completed, time.Now()))
+	}
+	_, controller := cache.NewInformer(
+		app.instrument("rollout monitor", "deployments", watchList),
+		&appsv1.Deployment{},
+		0,
+		recoverHandlers("rollout monitor", cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				update(obj, true)
+			},
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				update(newObj, false)
+			},
+			DeleteFunc: func(obj interface{}) {
+				if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+					obj = tombstone.Obj
+				}
+				if deployment, ok := obj.(*appsv1.Deployment); ok {
+					app.rollouts.Delete(deployment.UID)
+				}
+			},
+		}),
+	)
+
+	app.registerInformer("rollout monitor", controller.HasSynced)
+	controller.Run(stop)
+}
+
+// newRolloutTransaction creates a transaction for a completed rollout.
+func (app *application) newRolloutTransaction(deployment *appsv1.Deployment, completed *rollout, end time.Time) *sentryTransaction {
+	var images []string
+	for _, container := range deployment.Spec.Template.Spec.Containers {
+		images = append(images, container.Image)
+	}
+
+	tx := newTransaction(fmt.Sprintf("rollout %s/%s", deployment.Namespace, deployment.Name), "deployment.rollout", completed.started, end)
+	tx.Environment = app.environment(deployment.Namespace)
+	for k, v := range app.tags() {
+		tx.Tags[k] = v
+	}
+	if app.clusterName != "" {
+		tx.Tags["cluster"] = app.clusterName
+	}
+	tx.Tags["namespace"] = deployment.Namespace
+	tx.Tags["deployment"] = deployment.Name
+	tx.Tags["revision"] = completed.revision
+	tx.Tags["image"] = truncate(strings.Join(images, ","), 200)
+
+	tx.AddSpan("rollout.observe", "Observing new generation", completed.started, completed.observed)
+	tx.AddSpan("rollout.update", "Updating replicas", completed.observed, completed.updated)
+	tx.AddSpan("rollout.available", "Waiting for available replicas", completed.updated, end)
+	return tx
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRolloutTracker(t *testing.T) {
+	t.Parallel()
+
+	replicas := int32(2)
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "shop",
+			Name:        "web",
+			UID:         "1234",
+			Generation:  4,
+			Annotations: map[string]string{revisionAnnotation: "3"},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Template: v1.PodTemplateSpec{Spec: v1.PodSpec{Containers: []v1.Container{{Image: "acme/web:1.2"}}}},
+		},
+		Status: appsv1.DeploymentStatus{ObservedGeneration: 4, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 2},
+	}
+	tracker := newRolloutTracker()
+	start := time.Now()
+	if tracker.Update(deployment, true, start) != nil {
+		t.Error("Rollout reported for initial state")
+	}
+
+	deployment.Generation = 5
+	deployment.Annotations[revisionAnnotation] = "4"
+	deployment.Status = appsv1.DeploymentStatus{ObservedGeneration: 4, Replicas: 2, UpdatedReplicas: 0, AvailableReplicas: 2}
+	if tracker.Update(deployment, false, start.Add(time.Second)) != nil {
+		t.Error("Rollout completed before it was observed")
+	}
+	deployment.Status = appsv1.DeploymentStatus{ObservedGeneration: 5, Replicas: 3, UpdatedReplicas: 1, AvailableReplicas: 2}
+	tracker.Update(deployment, false, start.Add(2*time.Second))
+	deployment.Status = appsv1.DeploymentStatus{ObservedGeneration: 5, Replicas: 3, UpdatedReplicas: 2, AvailableReplicas: 2}
+	if tracker.Update(deployment, false, start.Add(20*time.Second)) != nil {
+		t.Error("Rollout completed while old replicas exist")
+	}
+	deployment.Status = appsv1.DeploymentStatus{ObservedGeneration: 5, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 2}
+	completed := tracker.Update(deployment, false, start.Add(30*time.Second))
+	if completed == nil {
+		t.Fatal("Rollout not completed")
+	}
+
+	tx := (&application{}).newRolloutTransaction(deployment, completed, start.Add(30*time.Second))
+	if tx.Timestamp.Sub(tx.StartTimestamp) != 29*time.Second || tx.Tags["image"] != "acme/web:1.2" || tx.Tags["revision"] != "4" {
+		t.Errorf("Unexpected transaction: %s %v", tx.Timestamp.Sub(tx.StartTimestamp), tx.Tags)
+	}
+	if len(tx.Spans) != 3 {
+		t.Errorf("Unexpected spans: %d", len(tx.Spans))
+	}
+
+	deployment.Spec.Replicas = &replicas
+	if tracker.Update(deployment, false, start.Add(40*time.Second)) != nil {
+		t.Error("Rollout reported twice")
+	}
+}
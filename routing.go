@@ -0,0 +1,55 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// parseLevelDSNs parses a comma-separated list of level=dsn pairs, used to
+// send events of some levels to a different Sentry project.
+func parseLevelDSNs(value string) (map[sentry.Level]*sentry.Dsn, error) {
+	dsns := make(map[sentry.Level]*sentry.Dsn)
+	if value == "" {
+		return dsns, nil
+	}
+
+	pairs, err := parseTags(value)
+	if err != nil {
+		return nil, err
+	}
+	for level, value := range pairs {
+		if !validLevel(sentry.Level(level)) {
+			return nil, fmt.Errorf("invalid level '%s' in DSN routing", level)
+		}
+		dsn, err := sentry.NewDsn(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DSN for level %s: %v", level, err)
+		}
+		dsns[sentry.Level(level)] = dsn
+	}
+	return dsns, nil
+}
+
+// routeDSN returns the DSN to send an event with the given level to.
+func routeDSN(dsn *sentry.Dsn, levelDSNs map[sentry.Level]*sentry.Dsn, level sentry.Level) *sentry.Dsn {
+	if levelDSN, ok := levelDSNs[level]; ok {
+		return levelDSN
+	}
+	return dsn
+}
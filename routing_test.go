@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/getsentry/sentry-go"
+)
+
+func TestLevelDSNs(t *testing.T) {
+	t.Parallel()
+
+	levelDSNs, err := parseLevelDSNs("error=https://key@sentry.example.com/2,fatal=https://key@sentry.example.com/3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dsn, err := sentry.NewDsn("https://key@sentry.example.com/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[sentry.Level]string{
+		sentry.LevelWarning: "https://key@sentry.example.com/1",
+		sentry.LevelError:   "https://key@sentry.example.com/2",
+		sentry.LevelFatal:   "https://key@sentry.example.com/3",
+	}
+	for level, expected := range tests {
+		if routed := routeDSN(dsn, levelDSNs, level).String(); routed != expected {
+			t.Errorf("Unexpected DSN for %s: %s", level, routed)
+		}
+	}
+
+	for _, value := range []string{"critical=https://key@sentry.example.com/2", "error=sentry", "error"} {
+		if _, err := parseLevelDSNs(value); err == nil {
+			t.Errorf("No error for %q", value)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+)
+
+// ruleConfig is a rule as it appears in the rules file.
+type ruleConfig struct {
+	If          string            `json:"if"`
+	Message     string            `json:"message"`
+	Expires     string            `json:"expires"`
+	Drop        bool              `json:"drop"`
+	Level       string            `json:"level"`
+	Tags        map[string]string `json:"tags"`
+	Fingerprint []string          `json:"fingerprint"`
+}
+
+// rule modifies or drops events for which its condition is true and whose
+// message matches its message pattern, until it expires. Tag values and
+// fingerprint entries are expressions as well.
+type rule struct {
+	source      string
+	condition   expression
+	message     *regexp.Regexp
+	expires     time.Time
+	drop        bool
+	level       sentry.Level
+	tags        map[string]expression
+	fingerprint []expression
+}
+
+// loadRules reads a JSON file with a list of rules.
+func loadRules(path string) ([]rule, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var configs []ruleConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("error parsing rules file: %v", err)
+	}
+	return parseRules(configs)
+}
+
+func parseRules(configs []ruleConfig) ([]rule, error) {
+	var rules []rule
+	for i, cfg := range configs {
+		r := rule{source: cfg.If, drop: cfg.Drop, level: sentry.Level(cfg.Level), tags: make(map[string]expression)}
+		var err error
+		if cfg.If == "" && cfg.Message == "" {
+			return nil, fmt.Errorf("rule %d: no condition or message", i+1)
+		}
+		if cfg.If != "" {
+			if r.condition, err = compileExpression(cfg.If); err != nil {
+				return nil, fmt.Errorf("rule %d: invalid condition: %v", i+1, err)
+			}
+		}
+		if cfg.Message != "" {
+			if r.message, err = regexp.Compile(cfg.Message); err != nil {
+				return nil, fmt.Errorf("rule %d: invalid message pattern: %v", i+1, err)
+			}
+			if r.source == "" {
+				r.source = "message " + cfg.Message
+			}
+		}
+		if cfg.Expires != "" {
+			if r.expires, err = parseRuleExpiry(cfg.Expires); err != nil {
+				return nil, fmt.Errorf("rule %d: %v", i+1, err)
+			}
+			if !time.Now().Before(r.expires) {
+				logger.Warning("Rule has expired", "rule", i+1, "expires", cfg.Expires)
+			}
+		}
+		switch r.level {
+		case "", sentry.LevelDebug, sentry.LevelInfo, sentry.LevelWarning, sentry.LevelError, sentry.LevelFatal:
+		default:
+			return nil, fmt.Errorf("rule %d: invalid level '%s'", i+1, cfg.Level)
+		}
+		for key, source := range cfg.Tags {
+			if r.tags[key], err = compileExpression(source); err != nil {
+				return nil, fmt.Errorf("rule %d: invalid expression for tag %s: %v", i+1, key, err)
+			}
+		}
+		for _, source := range cfg.Fingerprint {
+			expr, err := compileExpression(source)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: invalid fingerprint expression: %v", i+1, err)
+			}
+			r.fingerprint = append(r.fingerprint, expr)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// parseRuleExpiry parses the expiry of a rule: a RFC 3339 time, or a date on
+// which the rule expires at midnight UTC.
+func parseRuleExpiry(value string) (time.Time, error) {
+	if expires, err := time.Parse(time.RFC3339, value); err == nil {
+		return expires, nil
+	}
+	expires, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid expiry '%s', expected a date or RFC 3339 time", value)
+	}
+	return expires, nil
+}
+
+// matches returns true if the rule applies to an event at now.
+func (r *rule) matches(vars map[string]interface{}, evt *v1.Event, now time.Time) (bool, error) {
+	if !r.expires.IsZero() && !now.Before(r.expires) {
+		return false, nil
+	}
+	if r.message != nil && !r.message.MatchString(evt.Message) {
+		return false, nil
+	}
+	if r.condition == nil {
+		return true, nil
+	}
+	return evalBool(r.condition, vars)
+}
+
+// ruleVariables returns the variables rule expressions are evaluated with.
+func ruleVariables(sentryEvent *sentry.Event, evt *v1.Event) map[string]interface{} {
+	return map[string]interface{}{
+		"event": map[string]interface{}{
+			"message":     sentryEvent.Message,
+			"level":       string(sentryEvent.Level),
+			"tags":        sentryEvent.Tags,
+			"fingerprint": sentryEvent.Fingerprint,
+			"reason":      evt.Reason,
+			"type":        evt.Type,
+			"count":       int64(evt.Count),
+			"component":   eventComponent(evt),
+		},
+		"object": map[string]interface{}{
+			"apiVersion": evt.InvolvedObject.APIVersion,
+			"kind":       evt.InvolvedObject.Kind,
+			"namespace":  evt.InvolvedObject.Namespace,
+			"name":       evt.InvolvedObject.Name,
+			"fieldPath":  evt.InvolvedObject.FieldPath,
+		},
+	}
+}
+
+// applyRules runs all rules against an event, in order. It returns false if
+// the event should be dropped. A rule that fails to evaluate or has expired
+// is skipped.
+func applyRules(rules []rule, sentryEvent *sentry.Event, evt *v1.Event) bool {
+	now := time.Now()
+	for _, r := range rules {
+		vars := ruleVariables(sentryEvent, evt)
+		match, err := r.matches(vars, evt, now)
+		if err != nil {
+			logger.Debug("Error evaluating rule", eventFields(evt, "rule", r.source, "error", err)...)
+			continue
+		}
+		if !match {
+			continue
+		}
+		if r.drop {
+			return false
+		}
+		if r.level != "" {
+			sentryEvent.Level = r.level
+		}
+		keys := make([]string, 0, len(r.tags))
+		for key := range r.tags {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if value, err := r.tags[key](vars); err == nil {
+				sentryEvent.Tags[key] = fmt.Sprint(value)
+			} else {
+				logger.Debug("Error evaluating rule tag", eventFields(evt, "rule", r.source, "tag", key, "error", err)...)
+			}
+		}
+		if len(r.fingerprint) > 0 {
+			fingerprint := make([]string, 0, len(r.fingerprint))
+			for _, expr := range r.fingerprint {
+				value, err := expr(vars)
+				if err != nil {
+					logger.Debug("Error evaluating rule fingerprint", eventFields(evt, "rule", r.source, "error", err)...)
+					fingerprint = nil
+					break
+				}
+				fingerprint = append(fingerprint, fmt.Sprint(value))
+			}
+			if fingerprint != nil {
+				sentryEvent.Fingerprint = fingerprint
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestApplyRules(t *testing.T) {
+	t.Parallel()
+
+	rules, err := parseRules([]ruleConfig{
+		{If: `object.namespace.startsWith("ci-")`, Drop: true},
+		{
+			If:          `event.reason == "BackOff" && object.kind == "Pod"`,
+			Level:       "error",
+			Tags:        map[string]string{"team": `"payments"`},
+			Fingerprint: []string{`event.reason`, `object.name`},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	evt := &v1.Event{
+		InvolvedObject: v1.ObjectReference{Kind: "Pod", Namespace: "shop", Name: "web-1"},
+		Reason:         "BackOff",
+		Type:           v1.EventTypeWarning,
+	}
+	sentryEvent := sentry.NewEvent()
+	sentryEvent.Level = sentry.LevelWarning
+	if !applyRules(rules, sentryEvent, evt) {
+		t.Fatal("Event dropped")
+	}
+	if sentryEvent.Level != sentry.LevelError {
+		t.Errorf("Unexpected level: %s", sentryEvent.Level)
+	}
+	if sentryEvent.Tags["team"] != "payments" {
+		t.Errorf("Unexpected tags: %v", sentryEvent.Tags)
+	}
+	if !reflect.DeepEqual(sentryEvent.Fingerprint, []string{"BackOff", "web-1"}) {
+		t.Errorf("Unexpected fingerprint: %v", sentryEvent.Fingerprint)
+	}
+
+	evt.InvolvedObject.Namespace = "ci-1234"
+	if applyRules(rules, sentry.NewEvent(), evt) {
+		t.Error("Event not dropped")
+	}
+}
+
+func TestParseRulesErrors(t *testing.T) {
+	t.Parallel()
+
+	for _, cfg := range []ruleConfig{
+		{If: `event.reason ==`},
+		{If: `true`, Level: "critical"},
+		{If: `true`, Tags: map[string]string{"team": `"unterminated`}},
+		{Drop: true},
+		{Message: `(unclosed`, Drop: true},
+		{Message: `noise`, Expires: "next week", Drop: true},
+	} {
+		if _, err := parseRules([]ruleConfig{cfg}); err == nil {
+			t.Errorf("No error for %+v", cfg)
+		}
+	}
+}
+
+func TestApplyRulesMessage(t *testing.T) {
+	t.Parallel()
+
+	rules, err := parseRules([]ruleConfig{
+		{Message: `^Readiness probe failed: .*connection refused`, Drop: true},
+		{Message: `disk`, Expires: "2019-12-01", Drop: true},
+		{If: `object.namespace == "shop"`, Message: `timeout`, Drop: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for message, drop := range map[string]bool{
+		"Readiness probe failed: dial tcp 10.0.0.1:8080: connection refused": true,
+		"Liveness probe failed: connection refused":                          false,
+		"disk pressure":              false,
+		"timeout waiting for volume": true,
+	} {
+		evt := &v1.Event{Message: message, InvolvedObject: v1.ObjectReference{Namespace: "shop"}}
+		if applyRules(rules, sentry.NewEvent(), evt) == drop {
+			t.Errorf("Unexpected result for %q", message)
+		}
+	}
+
+	evt := &v1.Event{Message: "timeout waiting for volume", InvolvedObject: v1.ObjectReference{Namespace: "db"}}
+	if !applyRules(rules, sentry.NewEvent(), evt) {
+		t.Error("Message rule ignored its condition")
+	}
+
+	expires, err := parseRuleExpiry("2019-12-01T12:00:00+01:00")
+	if err != nil || !expires.Equal(time.Date(2019, 12, 1, 11, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected expiry %v: %v", expires, err)
+	}
+	r := rules[1]
+	if match, _ := r.matches(nil, &v1.Event{Message: "disk"}, time.Date(2019, 11, 30, 0, 0, 0, 0, time.UTC)); !match {
+		t.Error("Rule expired early")
+	}
+}
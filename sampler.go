@@ -0,0 +1,93 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/getsentry/sentry-go"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// sampler decides which events are sent to Sentry based on sample rates per
+// level or event reason. Sampling is done per fingerprint: the first event
+// for a fingerprint is always sent, after which only one out of every 1/rate
+// events is sent.
+type sampler struct {
+	rates  map[string]float64
+	lock   sync.Mutex
+	counts *lru.Cache
+}
+
+func newSampler(rates map[string]float64) (*sampler, error) {
+	counts, err := lru.New(5000)
+	if err != nil {
+		return nil, err
+	}
+	return &sampler{rates: rates, counts: counts}, nil
+}
+
+// parseSampleRates parses a comma-separated list of key=rate pairs.
+func parseSampleRates(value string) (map[string]float64, error) {
+	rates := make(map[string]float64)
+	if value == "" {
+		return rates, nil
+	}
+
+	pairs, err := parseTags(value)
+	if err != nil {
+		return nil, err
+	}
+	for key, rateString := range pairs {
+		rate, err := strconv.ParseFloat(rateString, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("invalid sample rate '%s' for %s", rateString, key)
+		}
+		rates[key] = rate
+	}
+	return rates, nil
+}
+
+// Sample returns true if the event should be sent. A rate for the reason
+// takes precedence over a rate for the level, except for errors and fatal
+// events, which are only sampled by the rate for their level. The first
+// event for a fingerprint is always sent, also with a rate of 0.
+func (s *sampler) Sample(event *sentry.Event, reason string) bool {
+	rate, ok := s.rates[string(event.Level)]
+	if reasonRate, found := s.rates[reason]; found && levelRank[event.Level] < levelRank[sentry.LevelError] {
+		rate, ok = reasonRate, true
+	}
+	if !ok || rate >= 1 {
+		return true
+	}
+
+	key := strings.Join(event.Fingerprint, "\x00")
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	count := 0
+	if value, ok := s.counts.Get(key); ok {
+		count = value.(int)
+	}
+	s.counts.Add(key, count+1)
+	if rate <= 0 {
+		return count == 0
+	}
+	return count%int(math.Round(1/rate)) == 0
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/getsentry/sentry-go"
+)
+
+func TestParseSampleRates(t *testing.T) {
+	t.Parallel()
+
+	rates, err := parseSampleRates("warning=0.1,FailedScheduling=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rates["warning"] != 0.1 || rates["FailedScheduling"] != 0 {
+		t.Errorf("Unexpected sample rates: %v", rates)
+	}
+
+	if _, err := parseSampleRates("warning=2"); err == nil {
+		t.Error("Sample rate above 1 accepted")
+	}
+
+	if rates, err := parseSampleRates(""); err != nil || len(rates) != 0 {
+		t.Error("Empty sample rates not accepted")
+	}
+}
+
+func TestSampler(t *testing.T) {
+	t.Parallel()
+
+	s, err := newSampler(map[string]float64{"warning": 0.25, "Muted": 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := sentry.NewEvent()
+	event.Level = sentry.LevelWarning
+	event.Fingerprint = []string{"one"}
+	sent := 0
+	for i := 0; i < 8; i++ {
+		if s.Sample(event, "BackOff") {
+			sent++
+		}
+	}
+	if sent != 2 {
+		t.Errorf("Expected 2 out of 8 warnings to be sent, got %d", sent)
+	}
+
+	event.Fingerprint = []string{"two"}
+	if !s.Sample(event, "BackOff") {
+		t.Error("First event for a fingerprint must always be sent")
+	}
+
+	if s.Sample(event, "Muted") {
+		t.Error("Reason with sample rate 0 must not be sent")
+	}
+
+	event.Fingerprint = []string{"three"}
+	if !s.Sample(event, "Muted") {
+		t.Error("First event for a reason with sample rate 0 must be sent")
+	}
+
+	event.Level = sentry.LevelError
+	for i := 0; i < 3; i++ {
+		if !s.Sample(event, "BackOff") {
+			t.Error("Levels without sample rate must always be sent")
+		}
+		if !s.Sample(event, "Muted") {
+			t.Error("Errors must not be sampled by reason")
+		}
+	}
+}
+
+func TestSamplerErrorRate(t *testing.T) {
+	t.Parallel()
+
+	s, err := newSampler(map[string]float64{"error": 0.5, "BackOff": 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := sentry.NewEvent()
+	event.Level = sentry.LevelError
+	event.Fingerprint = []string{"one"}
+	sent := 0
+	for i := 0; i < 4; i++ {
+		if s.Sample(event, "BackOff") {
+			sent++
+		}
+	}
+	if sent != 2 {
+		t.Errorf("Expected 2 out of 4 errors to be sent, got %d", sent)
+	}
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// Limits applied by Sentry when ingesting events. Longer tag keys and
+// values cause the tag to be discarded, and longer messages are cut off
+// without warning.
+const (
+	maxTagKeyLength   = 32
+	maxTagValueLength = 200
+	maxMessageLength  = 8192
+)
+
+// sanitizeEvent makes sure an event fits within the limits of Sentry, so it
+// is not silently rejected or mangled.
+func sanitizeEvent(event *sentry.Event) {
+	event.Message = truncate(event.Message, maxMessageLength)
+	for i := range event.Exception {
+		event.Exception[i].Value = truncate(event.Exception[i].Value, maxMessageLength)
+	}
+	event.Tags = sanitizeTags(event.Tags)
+}
+
+// sanitizeTags returns a copy of tags with valid keys and values.
+func sanitizeTags(tags map[string]string) map[string]string {
+	result := make(map[string]string, len(tags))
+	for key, value := range tags {
+		key = sanitizeTagKey(key)
+		if key == "" {
+			continue
+		}
+		result[key] = sanitizeTagValue(value)
+	}
+	return result
+}
+
+// sanitizeTagKey removes characters Sentry does not allow in tag keys, and
+// truncates the key.
+func sanitizeTagKey(key string) string {
+	key = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r == '_', r == '.', r == ':', r == '-':
+			return r
+		case r == ' ', r == '/':
+			return '_'
+		default:
+			return -1
+		}
+	}, key)
+	if len(key) > maxTagKeyLength {
+		key = key[:maxTagKeyLength]
+	}
+	return key
+}
+
+// sanitizeTagValue replaces newlines in a tag value, and shortens values
+// that are too long. Long values end with a hash of the complete value, so
+// different values result in different tags, but values which only differ
+// near the end do not create a tag value each when truncated.
+func sanitizeTagValue(value string) string {
+	value = strings.Join(strings.Fields(value), " ")
+	if len(value) <= maxTagValueLength {
+		return value
+	}
+	sum := sha1.Sum([]byte(value))
+	hash := hex.EncodeToString(sum[:])[:8]
+	length := maxTagValueLength - len(hash) - 1
+	for length > 0 && !utf8.RuneStart(value[length]) {
+		length--
+	}
+	return value[:length] + "~" + hash
+}
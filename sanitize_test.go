@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/getsentry/sentry-go"
+)
+
+func TestSanitizeEvent(t *testing.T) {
+	t.Parallel()
+
+	event := sentry.NewEvent()
+	event.Message = strings.Repeat("x", maxMessageLength+100)
+	event.Tags = map[string]string{
+		"app.kubernetes.io/name":  "web",
+		"reason":                  strings.Repeat("é", 150),
+		"other reason":            strings.Repeat("é", 150) + "!",
+		"message":                 "multiple\nlines",
+		"!!!":                     "dropped",
+		strings.Repeat("k", 40):   "long key",
+		"k8s-sentry.version:test": "ok",
+	}
+	sanitizeEvent(event)
+
+	if len(event.Message) > maxMessageLength {
+		t.Errorf("Message not truncated: %d", len(event.Message))
+	}
+	if event.Tags["app.kubernetes.io_name"] != "web" {
+		t.Errorf("Unexpected tags %v", event.Tags)
+	}
+	if event.Tags["message"] != "multiple lines" {
+		t.Errorf("Newlines not replaced: %q", event.Tags["message"])
+	}
+	if _, ok := event.Tags[""]; ok {
+		t.Error("Empty tag key")
+	}
+	if event.Tags[strings.Repeat("k", maxTagKeyLength)] != "long key" {
+		t.Error("Long tag key not truncated")
+	}
+	if event.Tags["k8s-sentry.version:test"] != "ok" {
+		t.Error("Valid tag changed")
+	}
+
+	reason, otherReason := event.Tags["reason"], event.Tags["other_reason"]
+	if len(reason) > maxTagValueLength || !strings.Contains(reason, "~") {
+		t.Errorf("Long tag value not shortened: %q", reason)
+	}
+	if reason == otherReason {
+		t.Error("Different long values result in the same tag value")
+	}
+	if !utf8.ValidString(reason) || !strings.HasPrefix(reason, "éé") {
+		t.Errorf("Character split in tag value: %q", reason)
+	}
+}
@@ -0,0 +1,204 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"k8s.io/client-go/tools/cache"
+)
+
+// selfReportInterval is the minimum time between reports of the same
+// health anomaly.
+const selfReportInterval = time.Hour
+
+// queueSaturation is the fraction of a queue that must be in use for it to
+// be reported as saturated.
+const queueSaturation = 0.9
+
+// selfHub is used to report problems in k8s-sentry itself. If it is nil the
+// current hub is used.
+var selfHub *sentry.Hub
+
+func selfReportHub() *sentry.Hub {
+	if selfHub != nil {
+		return selfHub
+	}
+	return sentry.CurrentHub()
+}
+
+// newSelfEvent creates a Sentry event about k8s-sentry itself.
+func newSelfEvent(level sentry.Level, message string) *sentry.Event {
+	event := sentry.NewEvent()
+	event.Platform = "go"
+	event.Logger = "k8s-sentry"
+	event.Level = level
+	event.Message = message
+	return event
+}
+
+// reportPanic reports a recovered panic, including the stack trace of the
+// goroutine that panicked. It must be called from a deferred function.
+func reportPanic(where string, value interface{}) {
+	logger.Error("Recovered from panic", "where", where, "panic", fmt.Sprint(value))
+	event := newSelfEvent(sentry.LevelFatal, fmt.Sprintf("panic in %s: %v", where, value))
+	event.Tags["where"] = where
+	event.Exception = []sentry.Exception{{
+		Type:       "panic",
+		Value:      fmt.Sprint(value),
+		Stacktrace: sentry.NewStacktrace(),
+	}}
+	selfReportHub().CaptureEvent(event)
+}
+
+// recoverPanic reports a panic and recovers from it. Use it with defer.
+func recoverPanic(where string) {
+	if r := recover(); r != nil {
+		reportPanic(where, r)
+	}
+}
+
+// recoverHandlers wraps the functions of an informer event handler, so a
+// panic while handling one object is reported instead of stopping
+// k8s-sentry.
+func recoverHandlers(where string, handlers cache.ResourceEventHandlerFuncs) cache.ResourceEventHandlerFuncs {
+	if add := handlers.AddFunc; add != nil {
+		handlers.AddFunc = func(obj interface{}) {
+			defer recoverPanic(where)
+			add(obj)
+		}
+	}
+	if update := handlers.UpdateFunc; update != nil {
+		handlers.UpdateFunc = func(oldObj, newObj interface{}) {
+			defer recoverPanic(where)
+			update(oldObj, newObj)
+		}
+	}
+	if remove := handlers.DeleteFunc; remove != nil {
+		handlers.DeleteFunc = func(obj interface{}) {
+			defer recoverPanic(where)
+			remove(obj)
+		}
+	}
+	return handlers
+}
+
+// goSafe runs f in a goroutine. A panic is reported before it is passed on,
+// since a worker that stopped can not be recovered.
+func goSafe(where string, f func()) {
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				reportPanic(where, r)
+				selfReportHub().Flush(5 * time.Second)
+				panic(r)
+			}
+		}()
+		f()
+	}()
+}
+
+// queueUsage returns the number of items in a queue and its capacity.
+type queueUsage func() (int, int)
+
+// healthMonitor periodically checks k8s-sentry for anomalies, such as a
+// growing number of goroutines or queues that are almost full.
+type healthMonitor struct {
+	interval       time.Duration
+	goroutineLimit int
+
+	lock     sync.Mutex
+	queues   map[string]queueUsage
+	reported map[string]time.Time
+}
+
+func newHealthMonitor(interval time.Duration, goroutineLimit int) *healthMonitor {
+	return &healthMonitor{
+		interval:       interval,
+		goroutineLimit: goroutineLimit,
+		queues:         make(map[string]queueUsage),
+		reported:       make(map[string]time.Time),
+	}
+}
+
+// AddQueue adds a queue to check for saturation.
+func (m *healthMonitor) AddQueue(name string, usage queueUsage) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.queues[name] = usage
+}
+
+// Check returns the current anomalies, by name.
+func (m *healthMonitor) Check(goroutines int) map[string]string {
+	anomalies := make(map[string]string)
+	if m.goroutineLimit > 0 && goroutines > m.goroutineLimit {
+		anomalies["goroutines"] = fmt.Sprintf("%d goroutines running, more than the limit of %d", goroutines, m.goroutineLimit)
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for name, usage := range m.queues {
+		length, capacity := usage()
+		if capacity > 0 && float64(length) >= float64(capacity)*queueSaturation {
+			anomalies["queue "+name] = fmt.Sprintf("%s queue saturated: %d of %d used", name, length, capacity)
+		}
+	}
+	return anomalies
+}
+
+// Run checks for anomalies every interval until stop is closed. Every
+// anomaly is reported at most once per selfReportInterval.
+func (m *healthMonitor) Run(stop chan struct{}) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			m.report(m.Check(runtime.NumGoroutine()), now)
+		}
+	}
+}
+
+func (m *healthMonitor) report(anomalies map[string]string, now time.Time) {
+	var names []string
+	for name := range anomalies {
+		if now.Sub(m.reported[name]) >= selfReportInterval {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var memory runtime.MemStats
+	if len(names) > 0 {
+		runtime.ReadMemStats(&memory)
+	}
+	for _, name := range names {
+		m.reported[name] = now
+		logger.Warning("Health anomaly detected", "anomaly", anomalies[name])
+		event := newSelfEvent(sentry.LevelWarning, "k8s-sentry: "+anomalies[name])
+		event.Fingerprint = []string{"k8s-sentry-health", name}
+		event.Tags["anomaly"] = name
+		event.Extra["goroutines"] = runtime.NumGoroutine()
+		event.Extra["heap-alloc"] = memory.HeapAlloc
+		selfReportHub().CaptureEvent(event)
+	}
+}
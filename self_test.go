@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestRecoverHandlers(t *testing.T) {
+	t.Parallel()
+
+	called := false
+	handlers := recoverHandlers("test", cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			panic("boom")
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			called = true
+		},
+	})
+	handlers.OnAdd(nil)
+	handlers.OnUpdate(nil, nil)
+	if !called {
+		t.Error("update handler not called")
+	}
+	if handlers.DeleteFunc != nil {
+		t.Error("unexpected delete handler")
+	}
+}
+
+func TestHealthMonitorCheck(t *testing.T) {
+	t.Parallel()
+
+	m := newHealthMonitor(0, 100)
+	m.AddQueue("transactions", func() (int, int) { return 29, 30 })
+	m.AddQueue("otlp", func() (int, int) { return 10, 1000 })
+
+	anomalies := m.Check(50)
+	if len(anomalies) != 1 || anomalies["queue transactions"] != "transactions queue saturated: 29 of 30 used" {
+		t.Errorf("unexpected anomalies: %v", anomalies)
+	}
+	anomalies = m.Check(150)
+	if anomalies["goroutines"] != "150 goroutines running, more than the limit of 100" {
+		t.Errorf("unexpected anomalies: %v", anomalies)
+	}
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// testEventTarget is a DSN to send a test event to, and the level of the
+// events that are sent to it.
+type testEventTarget struct {
+	dsn   string
+	level sentry.Level
+}
+
+// sendTestEventCommand sends a test event to the DSN, and to every DSN for
+// a level, and reports the result of each.
+func sendTestEventCommand(args []string) error {
+	cfg, err := parseConfig(flag.NewFlagSet("send-test-event", flag.ExitOnError), args)
+	if err != nil {
+		return err
+	}
+
+	options, err := cfg.sentryOptions()
+	if err != nil {
+		return err
+	}
+	if options.Dsn == "" {
+		return fmt.Errorf("no Sentry DSN configured: set SENTRY_DSN or SENTRY_DSN_FILE")
+	}
+	queued := options.Transport.(*queuedTransport)
+	targets := []testEventTarget{{dsn: options.Dsn}}
+	levels := make([]string, 0, len(queued.levelDSNs))
+	for level := range queued.levelDSNs {
+		levels = append(levels, string(level))
+	}
+	sort.Strings(levels)
+	for _, level := range levels {
+		targets = append(targets, testEventTarget{dsn: queued.levelDSNs[sentry.Level(level)].String(), level: sentry.Level(level)})
+	}
+
+	app, err := cfg.newApplication(cluster{name: cfg.clusterName})
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, target := range targets {
+		description := "the Sentry DSN"
+		if target.level != "" {
+			description = fmt.Sprintf("the DSN for %s events", target.level)
+		}
+		eventID, err := sendTestEvent(app, options, target)
+		if err != nil {
+			fmt.Printf("ERROR: test event was not sent to %s: %v\n", description, err)
+			failed++
+			continue
+		}
+		fmt.Printf("Test event %s sent to %s\n", eventID, description)
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to send %d of %d test event(s)", failed, len(targets))
+	}
+	return nil
+}
+
+// sendTestEvent sends a test event to the DSN of target. The event has the
+// level of target, if it is set.
+func sendTestEvent(app *application, options sentry.ClientOptions, target testEventTarget) (sentry.EventID, error) {
+	transport := &syncTransport{tunnel: options.Transport.(*queuedTransport).tunnel}
+	options.Dsn = target.dsn
+	options.Transport = transport
+	client, err := sentry.NewClient(options)
+	if err != nil {
+		return "", fmt.Errorf("error creating Sentry client: %v", err)
+	}
+
+	sentryEvent := app.newSentryEvent(newTestEvent())
+	if target.level != "" {
+		sentryEvent.Level = target.level
+	}
+	eventID := sentry.NewHub(client, sentry.NewScope()).CaptureEvent(sentryEvent)
+	if transport.err != nil {
+		return "", transport.err
+	}
+	if eventID == nil {
+		return "", fmt.Errorf("the event was dropped, check the sample rate")
+	}
+	return *eventID, nil
+}
+
+// newTestEvent returns a synthetic Kubernetes event.
+func newTestEvent() *v1.Event {
+	now := metav1.NewTime(time.Now())
+	return &v1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "k8s-sentry-test",
+			Namespace:         "default",
+			CreationTimestamp: now,
+		},
+		InvolvedObject: v1.ObjectReference{
+			APIVersion: "v1",
+			Kind:       "Namespace",
+			Name:       "default",
+		},
+		Reason:         "TestEvent",
+		Message:        "This is a test event sent by k8s-sentry",
+		Source:         v1.EventSource{Component: "k8s-sentry"},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+		Type:           v1.EventTypeWarning,
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSendTestEventCommand(t *testing.T) {
+	t.Parallel()
+
+	var lock sync.Mutex
+	projects := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		projects[r.URL.Path]++
+		lock.Unlock()
+		if r.URL.Path == "/api/3/store/" {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+
+	dsn := func(project string) string {
+		return strings.Replace(server.URL, "http://", "http://key@", 1) + "/" + project
+	}
+	err := sendTestEventCommand([]string{"-sentry-dsn", dsn("1"), "-sentry-level-dsns", "error=" + dsn("2")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if projects["/api/1/store/"] != 1 || projects["/api/2/store/"] != 1 {
+		t.Errorf("Test events not sent to every DSN: %v", projects)
+	}
+
+	err = sendTestEventCommand([]string{"-sentry-dsn", dsn("1"), "-sentry-level-dsns", "error=" + dsn("3")})
+	if err == nil || !strings.Contains(err.Error(), "1 of 2") {
+		t.Errorf("Failed test event not reported: %v", err)
+	}
+}
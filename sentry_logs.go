@@ -0,0 +1,196 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+)
+
+// Sentry Logs are not supported by the Sentry SDK used by k8s-sentry either,
+// so log items are sent to the envelope endpoint directly.
+
+// sentryLogBatchSize is the maximum number of logs sent in one envelope.
+const sentryLogBatchSize = 100
+
+type sentryLogAttribute struct {
+	Value string `json:"value"`
+	Type  string `json:"type"`
+}
+
+type sentryLog struct {
+	Timestamp  float64                       `json:"timestamp"`
+	TraceID    string                        `json:"trace_id"`
+	Level      string                        `json:"level"`
+	Body       string                        `json:"body"`
+	Attributes map[string]sentryLogAttribute `json:"attributes"`
+}
+
+// sentryLogExporter sends events to Sentry Logs in batches. Logs are dropped
+// if the buffer is full.
+type sentryLogExporter struct {
+	bufferSize int
+	tunnel     string
+	scrubber   *scrubber
+	client     *http.Client
+
+	lock sync.Mutex
+	logs []sentryLog
+}
+
+func newSentryLogExporter(bufferSize int, tunnel string, scrubber *scrubber) *sentryLogExporter {
+	return &sentryLogExporter{
+		bufferSize: bufferSize,
+		tunnel:     tunnel,
+		scrubber:   scrubber,
+		client:     &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Export queues a log.
+func (e *sentryLogExporter) Export(log sentryLog) {
+	if e.scrubber != nil {
+		log.Body = e.scrubber.String(log.Body)
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if len(e.logs) >= e.bufferSize {
+		droppedEvents.Record("logs", sentry.Level(log.Level))
+		return
+	}
+	e.logs = append(e.logs, log)
+}
+
+// Usage returns the number of queued logs and the size of the buffer.
+func (e *sentryLogExporter) Usage() (int, int) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return len(e.logs), e.bufferSize
+}
+
+// Run sends queued logs every five seconds until stop is closed.
+func (e *sentryLogExporter) Run(stop chan struct{}) {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			e.Flush()
+			return
+		case <-ticker.C:
+			e.Flush()
+		}
+	}
+}
+
+// Flush sends all queued logs.
+func (e *sentryLogExporter) Flush() {
+	e.lock.Lock()
+	logs := e.logs
+	e.logs = nil
+	e.lock.Unlock()
+
+	for len(logs) > 0 {
+		batch := logs
+		if len(batch) > sentryLogBatchSize {
+			batch = batch[:sentryLogBatchSize]
+		}
+		logs = logs[len(batch):]
+		if err := e.send(batch); err != nil {
+			logger.Error("Error sending logs to Sentry", "error", err)
+		}
+	}
+}
+
+func (e *sentryLogExporter) send(logs []sentryLog) error {
+	client := sentry.CurrentHub().Client()
+	if client == nil || client.Options().Dsn == "" {
+		return nil
+	}
+	options := client.Options()
+	dsn, err := sentry.NewDsn(options.Dsn)
+	if err != nil {
+		return err
+	}
+	for _, log := range logs {
+		if options.Release != "" {
+			log.Attributes["sentry.release"] = sentryLogAttribute{options.Release, "string"}
+		}
+		if options.ServerName != "" {
+			log.Attributes["server.address"] = sentryLogAttribute{options.ServerName, "string"}
+		}
+	}
+	payload, err := json.Marshal(map[string]interface{}{"items": logs})
+	if err != nil {
+		return err
+	}
+	item := map[string]interface{}{
+		"type":         "log",
+		"item_count":   len(logs),
+		"content_type": "application/vnd.sentry.items.log+json",
+	}
+	request, err := newEnvelopeRequest(dsn, e.tunnel, "", item, payload)
+	if err != nil {
+		return err
+	}
+	return sendSentryRequest(e.client, request)
+}
+
+// objectTraceID returns a trace ID for the object an event is about. Logs
+// and issues for the same object share the trace ID, so Sentry shows the
+// logs of an object next to its issues.
+func objectTraceID(cluster string, ref v1.ObjectReference) string {
+	sum := sha256.Sum256([]byte(cluster + "/" + ref.Kind + "/" + ref.Namespace + "/" + ref.Name))
+	return hex.EncodeToString(sum[:16])
+}
+
+// newEventLog converts an event to a log. The tags that are added to all
+// events become attributes.
+func (app *application) newEventLog(evt *v1.Event) sentryLog {
+	log := sentryLog{
+		Timestamp:  float64(eventTimestamp(app.timestamps, evt).UnixNano()) / 1e9,
+		TraceID:    objectTraceID(app.clusterName, evt.InvolvedObject),
+		Level:      "info",
+		Body:       evt.InvolvedObject.Kind + "/" + evt.InvolvedObject.Name + ": " + evt.Message,
+		Attributes: make(map[string]sentryLogAttribute),
+	}
+	add := func(key, value string) {
+		if value != "" {
+			log.Attributes[key] = sentryLogAttribute{value, "string"}
+		}
+	}
+	for key, value := range app.tags() {
+		add(key, value)
+	}
+	add("sentry.environment", app.environment(evt.InvolvedObject.Namespace))
+	add("cluster", app.clusterName)
+	add("namespace", evt.InvolvedObject.Namespace)
+	add("kind", evt.InvolvedObject.Kind)
+	add("name", evt.InvolvedObject.Name)
+	add("reason", evt.Reason)
+	add("type", evt.Type)
+	add("component", eventComponent(evt))
+	add("count", strconv.Itoa(int(eventCount(evt))))
+	return log
+}
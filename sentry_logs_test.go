@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestProcessEventNormalToLogs(t *testing.T) {
+	t.Parallel()
+
+	app := &application{clusterName: "prod", logs: newSentryLogExporter(10, "", nil)}
+	evt := &v1.Event{
+		InvolvedObject: v1.ObjectReference{Kind: "Pod", Namespace: "shop", Name: "web-1"},
+		Reason:         "Pulled",
+		Type:           v1.EventTypeNormal,
+		Message:        "Container image already present",
+		LastTimestamp:  metav1.Now(),
+	}
+	if sentryEvent, cause := app.processEvent(evt); sentryEvent != nil || cause != "normal event sent to logs" {
+		t.Errorf("Unexpected result %v, %q", sentryEvent, cause)
+	}
+	if queued, _ := app.logs.Usage(); queued != 1 {
+		t.Fatalf("Expected 1 queued log, got %d", queued)
+	}
+	log := app.logs.logs[0]
+	if log.Body != "Pod/web-1: Container image already present" || log.Level != "info" {
+		t.Errorf("Unexpected log %+v", log)
+	}
+	if log.Attributes["reason"].Value != "Pulled" || log.Attributes["sentry.environment"].Value != "shop" {
+		t.Errorf("Unexpected attributes %v", log.Attributes)
+	}
+	if log.TraceID != objectTraceID("prod", evt.InvolvedObject) || len(log.TraceID) != 32 {
+		t.Errorf("Unexpected trace ID %s", log.TraceID)
+	}
+}
+
+func TestSentryLogExporterDropsWhenFull(t *testing.T) {
+	t.Parallel()
+
+	exporter := newSentryLogExporter(1, "", nil)
+	exporter.Export(sentryLog{Level: "info"})
+	exporter.Export(sentryLog{Level: "info"})
+	if queued, size := exporter.Usage(); queued != 1 || size != 1 {
+		t.Errorf("Unexpected usage %d/%d", queued, size)
+	}
+}
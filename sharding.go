@@ -0,0 +1,241 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const (
+	shardRetryPeriod = 5 * time.Second
+	// shardCheckInterval is how often the Leases of all shards are checked
+	// for shards that nobody claimed.
+	shardCheckInterval = time.Minute
+)
+
+// shardManager claims one out of a fixed number of shards using a Lease per
+// shard, and decides which namespaces belong to the claimed shard. This allows
+// multiple replicas to split the work without reporting events twice.
+type shardManager struct {
+	clientset      *kubernetes.Clientset
+	count          int
+	leaseNamespace string
+	identity       string
+
+	claimed chan struct{}
+
+	lock      sync.RWMutex
+	shard     int
+	unclaimed map[int]time.Time
+}
+
+func newShardManager(clientset *kubernetes.Clientset, count int, leaseNamespace, identity string) *shardManager {
+	return &shardManager{
+		clientset:      clientset,
+		count:          count,
+		leaseNamespace: leaseNamespace,
+		identity:       identity,
+		claimed:        make(chan struct{}, 1),
+		shard:          -1,
+		unclaimed:      make(map[int]time.Time),
+	}
+}
+
+// Run starts campaigning for all shards until ctx is cancelled.
+func (m *shardManager) Run(ctx context.Context) {
+	for shard := 0; shard < m.count; shard++ {
+		go m.campaign(ctx, shard)
+	}
+	go m.checkLeases(ctx)
+}
+
+// Claimed returns a channel that receives a value every time a shard is
+// claimed. Events of the namespaces in the shard must be listed again then,
+// since they were ignored while the shard was not claimed.
+func (m *shardManager) Claimed() <-chan struct{} {
+	return m.claimed
+}
+
+// Owns returns true if events for namespace should be handled by this replica.
+func (m *shardManager) Owns(namespace string) bool {
+	shard := m.current()
+	return shard != -1 && shardFor(namespace, m.count) == shard
+}
+
+func (m *shardManager) current() int {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.shard
+}
+
+func (m *shardManager) claim(shard int) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.shard != -1 {
+		return false
+	}
+	m.shard = shard
+	logger.Info("Claimed shard", "shard", shard, "shards", m.count)
+	select {
+	case m.claimed <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+func (m *shardManager) release(shard int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.shard == shard {
+		m.shard = -1
+		logger.Warning("Lost shard", "shard", shard, "shards", m.count)
+	}
+}
+
+func (m *shardManager) campaign(ctx context.Context, shard int) {
+	for {
+		// Only try to get a shard if we do not have one already.
+		if m.current() == -1 {
+			m.elect(ctx, shard)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(shardRetryPeriod):
+		}
+	}
+}
+
+func (m *shardManager) elect(ctx context.Context, shard int) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("k8s-sentry-shard-%d", shard),
+				Namespace: m.leaseNamespace,
+			},
+			Client:     m.clientset.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{Identity: m.identity},
+		},
+		LeaseDuration:   15 * time.Second,
+		RenewDeadline:   10 * time.Second,
+		RetryPeriod:     2 * time.Second,
+		ReleaseOnCancel: true,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(leaderCtx context.Context) {
+				if !m.claim(shard) {
+					// We got another shard in the meantime, so let someone
+					// else have this one.
+					cancel()
+					return
+				}
+				<-leaderCtx.Done()
+				m.release(shard)
+			},
+			OnStoppedLeading: func() {},
+		},
+	})
+	if err != nil {
+		logger.Error("Error creating leader election", "shard", shard, "error", err)
+		return
+	}
+	elector.Run(ctx)
+}
+
+// checkLeases periodically logs a warning for every shard whose Lease is not
+// held by any replica, since events in its namespaces are not reported.
+func (m *shardManager) checkLeases(ctx context.Context) {
+	ticker := time.NewTicker(shardCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, shard := range m.checkUnclaimed(now) {
+				logger.Warning("Shard not claimed by any replica", "shard", shard, "shards", m.count, "since", m.unclaimedSince(shard))
+			}
+		}
+	}
+}
+
+// checkUnclaimed returns the shards that have not been claimed for at least
+// shardCheckInterval.
+func (m *shardManager) checkUnclaimed(now time.Time) []int {
+	var unclaimed []int
+	for shard := 0; shard < m.count; shard++ {
+		lease, err := m.clientset.CoordinationV1().Leases(m.leaseNamespace).Get(fmt.Sprintf("k8s-sentry-shard-%d", shard), metav1.GetOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			logger.Debug("Unable to get shard Lease", "shard", shard, "error", err)
+			continue
+		}
+		if err == nil && leaseHeld(lease, now) {
+			m.lock.Lock()
+			delete(m.unclaimed, shard)
+			m.lock.Unlock()
+			continue
+		}
+		if since := m.markUnclaimed(shard, now); now.Sub(since) >= shardCheckInterval {
+			unclaimed = append(unclaimed, shard)
+		}
+	}
+	return unclaimed
+}
+
+func (m *shardManager) markUnclaimed(shard int, now time.Time) time.Time {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, ok := m.unclaimed[shard]; !ok {
+		m.unclaimed[shard] = now
+	}
+	return m.unclaimed[shard]
+}
+
+func (m *shardManager) unclaimedSince(shard int) time.Time {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.unclaimed[shard]
+}
+
+// leaseHeld returns true if a Lease has a holder that renewed it recently.
+func leaseHeld(lease *coordinationv1.Lease, now time.Time) bool {
+	spec := lease.Spec
+	if spec.HolderIdentity == nil || *spec.HolderIdentity == "" || spec.RenewTime == nil || spec.LeaseDurationSeconds == nil {
+		return false
+	}
+	return now.Before(spec.RenewTime.Add(time.Duration(*spec.LeaseDurationSeconds) * time.Second))
+}
+
+// shardFor returns the shard a namespace belongs to.
+func shardFor(namespace string, count int) int {
+	h := fnv.New32a()
+	h.Write([]byte(namespace))
+	return int(h.Sum32() % uint32(count))
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestShardFor(t *testing.T) {
+	t.Parallel()
+
+	if shardFor("default", 4) != shardFor("default", 4) {
+		t.Error("Shard assignment is not deterministic")
+	}
+
+	for _, namespace := range []string{"default", "kube-system", "monitoring", ""} {
+		if shard := shardFor(namespace, 3); shard < 0 || shard >= 3 {
+			t.Errorf("Namespace %s assigned to invalid shard %d", namespace, shard)
+		}
+	}
+}
+
+func TestShardManagerOwns(t *testing.T) {
+	t.Parallel()
+
+	m := newShardManager(nil, 2, "default", "test")
+	if m.Owns("default") {
+		t.Error("Namespaces must not be owned before a shard is claimed")
+	}
+
+	shard := shardFor("default", 2)
+	if !m.claim(shard) {
+		t.Fatal("Unable to claim shard")
+	}
+	select {
+	case <-m.Claimed():
+	default:
+		t.Error("Claim not signalled")
+	}
+	if !m.Owns("default") {
+		t.Error("Namespace not owned by its shard")
+	}
+	if m.claim(1 - shard) {
+		t.Error("Second shard claimed")
+	}
+
+	m.release(shard)
+	if m.Owns("default") {
+		t.Error("Namespace still owned after shard was released")
+	}
+}
+
+func TestLeaseHeld(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	holder := "replica-1"
+	duration := int32(15)
+	lease := &coordinationv1.Lease{}
+	if leaseHeld(lease, now) {
+		t.Error("Lease without holder is held")
+	}
+
+	lease.Spec.HolderIdentity = &holder
+	lease.Spec.LeaseDurationSeconds = &duration
+	renewed := metav1.NewMicroTime(now.Add(-10 * time.Second))
+	lease.Spec.RenewTime = &renewed
+	if !leaseHeld(lease, now) {
+		t.Error("Renewed lease is not held")
+	}
+	if leaseHeld(lease, now.Add(time.Minute)) {
+		t.Error("Expired lease is held")
+	}
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// simulatedObject is the name of the objects that simulated events are
+// about.
+const simulatedObject = "k8s-sentry-simulation"
+
+// simulations create synthetic events for common failures.
+var simulations = map[string]func(namespace, node string) *v1.Event{
+	"crash-loop": func(namespace, node string) *v1.Event {
+		evt := newSimulatedEvent("Pod", namespace, simulatedObject, "kubelet", "BackOff",
+			"Back-off restarting failed container app in pod "+simulatedObject)
+		evt.InvolvedObject.FieldPath = "spec.containers{app}"
+		evt.Source.Host = node
+		return evt
+	},
+	"oom": func(namespace, node string) *v1.Event {
+		evt := newSimulatedEvent("Node", "", node, "kubelet", "SystemOOM", "System OOM encountered, victim process: app, pid: 4242")
+		evt.Source.Host = node
+		return evt
+	},
+	"scheduling": func(namespace, node string) *v1.Event {
+		return newSimulatedEvent("Pod", namespace, simulatedObject, "default-scheduler", "FailedScheduling",
+			"0/3 nodes are available: 3 Insufficient memory.")
+	},
+	"node-pressure": func(namespace, node string) *v1.Event {
+		evt := newSimulatedEvent("Node", "", node, "kubelet", "EvictionThresholdMet", "Attempting to reclaim memory")
+		evt.Source.Host = node
+		return evt
+	},
+}
+
+func newSimulatedEvent(kind, namespace, name, component, reason, message string) *v1.Event {
+	now := metav1.Now()
+	return &v1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         namespace,
+			Name:              fmt.Sprintf("%s.%x", name, now.UnixNano()),
+			UID:               types.UID(randomID(16)),
+			CreationTimestamp: now,
+		},
+		InvolvedObject: v1.ObjectReference{Kind: kind, Namespace: namespace, Name: name},
+		Source:         v1.EventSource{Component: component},
+		Type:           v1.EventTypeWarning,
+		Reason:         reason,
+		Message:        message,
+		Count:          1,
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+	}
+}
+
+func simulateCommand(args []string) error {
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	namespace := fs.String("simulate-namespace", "default", "Namespace of the simulated events")
+	node := fs.String("simulate-node", simulatedObject, "Node of the simulated events")
+	printOnly := fs.Bool("print", false, "Print events instead of sending them")
+	fs.Usage = func() {
+		var names []string
+		for name := range simulations {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(fs.Output(), "Usage: %s simulate [flags] [scenario]...\n\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "Send synthetic events through the event pipeline. Scenarios: %v (default all). Flags:\n", names)
+		fs.PrintDefaults()
+	}
+	cfg, err := parseConfig(fs, args)
+	if err != nil {
+		return err
+	}
+	scenarios := fs.Args()
+	if len(scenarios) == 0 {
+		for name := range simulations {
+			scenarios = append(scenarios, name)
+		}
+		sort.Strings(scenarios)
+	}
+	for _, name := range scenarios {
+		if simulations[name] == nil {
+			fs.Usage()
+			return fmt.Errorf("unknown scenario '%s'", name)
+		}
+	}
+
+	var app *application
+	if apps, err := cfg.applications(); err == nil {
+		app = apps[0]
+	} else {
+		logger.Warning("Kubernetes cluster not available, simulating without enrichment", "error", err)
+		if app, err = cfg.newApplication(cluster{name: cfg.clusterName}); err != nil {
+			return err
+		}
+	}
+	app.shards = nil
+
+	if !*printOnly {
+		options, err := cfg.sentryOptions()
+		if err != nil {
+			return err
+		}
+		if err := sentry.Init(options); err != nil {
+			return fmt.Errorf("error initialising sentry: %v", err)
+		}
+		defer sentry.Flush(time.Second * 5)
+		if app.otlp, err = cfg.otlpExporter(); err != nil {
+			return err
+		}
+		if app.otlp != nil {
+			defer app.otlp.Flush()
+		}
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	for _, name := range scenarios {
+		evt := simulations[name](*namespace, *node)
+		sentryEvent, cause := app.processEvent(evt)
+		if sentryEvent != nil {
+			sentryEvent.Tags["simulated"] = "true"
+		}
+		if *printOnly {
+			if err := encoder.Encode(newReplayResult(evt, sentryEvent, cause)); err != nil {
+				return err
+			}
+			continue
+		}
+		if sentryEvent == nil {
+			logger.Warning("Simulated event skipped", "scenario", name, "cause", cause)
+			continue
+		}
+		logger.Info("Sending simulated event", "scenario", name, "message", sentryEvent.Message)
+		app.capture(sentryEvent)
+	}
+	return nil
+}
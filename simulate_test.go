@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSimulations(t *testing.T) {
+	t.Parallel()
+
+	app := &application{}
+	for name, simulate := range simulations {
+		evt := simulate("shop", "node-1")
+		if evt.UID == "" || evt.Type != "Warning" {
+			t.Errorf("Invalid %s event: %+v", name, evt)
+		}
+		if sentryEvent, cause := app.processEvent(evt); sentryEvent == nil {
+			t.Errorf("Simulated %s event skipped: %s", name, cause)
+		}
+	}
+	if first, second := simulations["oom"]("shop", "node-1"), simulations["oom"]("shop", "node-1"); first.UID == second.UID {
+		t.Error("Simulated events share a UID")
+	}
+}
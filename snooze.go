@@ -0,0 +1,142 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// snoozeAnnotation mutes events for a namespace or workload until the time
+// in its value.
+const snoozeAnnotation = "k8s-sentry.io/snooze-until"
+
+// snoozeCacheTTL is how long the annotations of an object are cached.
+const snoozeCacheTTL = time.Minute
+
+// maxOwnerDepth limits how many controllers are followed from the involved
+// object, for example Pod -> ReplicaSet -> Deployment.
+const maxOwnerDepth = 3
+
+type objectRef struct {
+	kind      string
+	namespace string
+	name      string
+}
+
+type snoozeInfo struct {
+	until   time.Time
+	owner   *objectRef
+	fetched time.Time
+}
+
+// snoozeChecker determines if events are muted by a snooze annotation on
+// their namespace, the involved object or one of its controllers.
+type snoozeChecker struct {
+	get   func(ref objectRef) (metav1.Object, error)
+	cache *lru.Cache
+}
+
+func newSnoozeChecker(clientset *kubernetes.Clientset) (*snoozeChecker, error) {
+	cache, err := lru.New(1000)
+	if err != nil {
+		return nil, err
+	}
+	return &snoozeChecker{
+		get:   func(ref objectRef) (metav1.Object, error) { return getObject(clientset, ref) },
+		cache: cache,
+	}, nil
+}
+
+// SnoozedUntil returns the time until which events for evt are snoozed, or
+// the zero time if they are not snoozed.
+func (c *snoozeChecker) SnoozedUntil(evt *v1.Event, now time.Time) time.Time {
+	if evt.InvolvedObject.Namespace != "" {
+		if info := c.lookup(objectRef{kind: "Namespace", name: evt.InvolvedObject.Namespace}, now); info.until.After(now) {
+			return info.until
+		}
+	}
+	ref := &objectRef{kind: evt.InvolvedObject.Kind, namespace: evt.InvolvedObject.Namespace, name: evt.InvolvedObject.Name}
+	for depth := 0; ref != nil && depth <= maxOwnerDepth; depth++ {
+		info := c.lookup(*ref, now)
+		if info.until.After(now) {
+			return info.until
+		}
+		ref = info.owner
+	}
+	return time.Time{}
+}
+
+func (c *snoozeChecker) lookup(ref objectRef, now time.Time) snoozeInfo {
+	if cached, ok := c.cache.Get(ref); ok && now.Sub(cached.(snoozeInfo).fetched) < snoozeCacheTTL {
+		return cached.(snoozeInfo)
+	}
+
+	info := snoozeInfo{fetched: now}
+	obj, err := c.get(ref)
+	if err != nil {
+		logger.Debug("Unable to check snooze annotation", "kind", ref.kind, "namespace", ref.namespace, "name", ref.name, "error", err)
+	} else if obj != nil {
+		if value, ok := obj.GetAnnotations()[snoozeAnnotation]; ok {
+			if info.until, err = time.Parse(time.RFC3339, value); err != nil {
+				logger.Warning("Invalid snooze annotation", "kind", ref.kind, "namespace", ref.namespace, "name", ref.name, "value", value)
+			}
+		}
+		for _, owner := range obj.GetOwnerReferences() {
+			if owner.Controller != nil && *owner.Controller {
+				info.owner = &objectRef{kind: owner.Kind, namespace: ref.namespace, name: owner.Name}
+			}
+		}
+	}
+	c.cache.Add(ref, info)
+	return info
+}
+
+// getObject fetches the metadata of the kinds of objects that can be
+// snoozed. It returns nil for other kinds.
+func getObject(clientset *kubernetes.Clientset, ref objectRef) (metav1.Object, error) {
+	options := metav1.GetOptions{}
+	switch ref.kind {
+	case "Namespace":
+		return clientset.CoreV1().Namespaces().Get(ref.name, options)
+	case "Pod":
+		return clientset.CoreV1().Pods(ref.namespace).Get(ref.name, options)
+	case "ReplicaSet":
+		return clientset.AppsV1().ReplicaSets(ref.namespace).Get(ref.name, options)
+	case "Deployment":
+		return clientset.AppsV1().Deployments(ref.namespace).Get(ref.name, options)
+	case "StatefulSet":
+		return clientset.AppsV1().StatefulSets(ref.namespace).Get(ref.name, options)
+	case "DaemonSet":
+		return clientset.AppsV1().DaemonSets(ref.namespace).Get(ref.name, options)
+	case "Job":
+		return clientset.BatchV1().Jobs(ref.namespace).Get(ref.name, options)
+	case "CronJob":
+		return clientset.BatchV1beta1().CronJobs(ref.namespace).Get(ref.name, options)
+	default:
+		return nil, nil
+	}
+}
+
+// snoozeCause describes why an event was skipped because of a snooze.
+func snoozeCause(until time.Time) string {
+	return fmt.Sprintf("snoozed until %s", until.Format(time.RFC3339))
+}
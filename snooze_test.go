@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSnoozeChecker(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2019, 11, 1, 12, 0, 0, 0, time.UTC)
+	controller := true
+	objects := map[objectRef]metav1.Object{
+		{kind: "Namespace", name: "shop"}: &v1.Namespace{},
+		{kind: "Pod", namespace: "shop", name: "web-5d4f-x2x8q"}: &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+			OwnerReferences: []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "web-5d4f", Controller: &controller}},
+		}},
+		{kind: "ReplicaSet", namespace: "shop", name: "web-5d4f"}: &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+			OwnerReferences: []metav1.OwnerReference{{Kind: "Deployment", Name: "web", Controller: &controller}},
+		}},
+		{kind: "Deployment", namespace: "shop", name: "web"}: &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{snoozeAnnotation: "2019-11-01T18:00:00Z"},
+		}},
+		{kind: "Namespace", name: "billing"}: &v1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{snoozeAnnotation: "2019-11-01T06:00:00Z"},
+		}},
+	}
+	cache, _ := lru.New(100)
+	checker := &snoozeChecker{
+		get:   func(ref objectRef) (metav1.Object, error) { return objects[ref], nil },
+		cache: cache,
+	}
+
+	evt := &v1.Event{InvolvedObject: v1.ObjectReference{Kind: "Pod", Namespace: "shop", Name: "web-5d4f-x2x8q"}}
+	if until := checker.SnoozedUntil(evt, now); !until.Equal(time.Date(2019, 11, 1, 18, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected snooze for deployment: %s", until)
+	}
+	if until := checker.SnoozedUntil(evt, now.Add(7*time.Hour)); !until.IsZero() {
+		t.Errorf("Snooze did not expire: %s", until)
+	}
+
+	evt = &v1.Event{InvolvedObject: v1.ObjectReference{Kind: "Pod", Namespace: "billing", Name: "api"}}
+	if until := checker.SnoozedUntil(evt, now); !until.IsZero() {
+		t.Errorf("Expired namespace snooze applied: %s", until)
+	}
+}
@@ -0,0 +1,231 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/tools/cache"
+)
+
+var missingClaimRegexp = regexp.MustCompile(`persistentvolumeclaim "([^"]+)" not found`)
+
+// statefulSetMonitor reports StatefulSets whose rollout is stuck, or whose
+// update partition prevents any pod from being updated, for longer than a
+// threshold.
+type statefulSetMonitor struct {
+	stuck     *conditionTracker
+	partition *conditionTracker
+}
+
+func newStatefulSetMonitor(threshold time.Duration) *statefulSetMonitor {
+	return &statefulSetMonitor{
+		stuck:     newConditionTracker(threshold),
+		partition: newConditionTracker(threshold),
+	}
+}
+
+// Update records the status of a StatefulSet.
+func (m *statefulSetMonitor) Update(key string, sts *appsv1.StatefulSet, now time.Time) {
+	updating := statefulSetUpdating(sts)
+	partitioned := statefulSetPartition(sts) >= statefulSetReplicas(sts)
+	m.stuck.Set(key, updating && statefulSetPartition(sts) == 0, now)
+	m.partition.Set(key, updating && partitioned, now)
+}
+
+// Delete stops tracking a StatefulSet.
+func (m *statefulSetMonitor) Delete(key string, now time.Time) {
+	m.stuck.Set(key, false, now)
+	m.partition.Set(key, false, now)
+}
+
+func statefulSetReplicas(sts *appsv1.StatefulSet) int32 {
+	if sts.Spec.Replicas == nil {
+		return 1
+	}
+	return *sts.Spec.Replicas
+}
+
+func statefulSetPartition(sts *appsv1.StatefulSet) int32 {
+	if update := sts.Spec.UpdateStrategy.RollingUpdate; update != nil && update.Partition != nil {
+		return *update.Partition
+	}
+	return 0
+}
+
+// statefulSetUpdating returns true if a StatefulSet using rolling updates has
+// pods that do not run the latest revision, or are not ready.
+func statefulSetUpdating(sts *appsv1.StatefulSet) bool {
+	if sts.Spec.UpdateStrategy.Type == appsv1.OnDeleteStatefulSetStrategyType || sts.Status.ObservedGeneration < sts.Generation {
+		return false
+	}
+	return sts.Status.UpdateRevision != sts.Status.CurrentRevision ||
+		sts.Status.ReadyReplicas < statefulSetReplicas(sts)
+}
+
+// statefulSetBlockingOrdinal returns the ordinal of the pod a StatefulSet is
+// waiting for. Pods are created from the lowest ordinal up, and updated from
+// the highest ordinal down.
+func statefulSetBlockingOrdinal(sts *appsv1.StatefulSet) int32 {
+	ordinal := sts.Status.ReadyReplicas
+	if sts.Status.UpdateRevision != sts.Status.CurrentRevision {
+		ordinal = statefulSetReplicas(sts) - sts.Status.UpdatedReplicas - 1
+	}
+	if ordinal >= statefulSetReplicas(sts) {
+		ordinal = statefulSetReplicas(sts) - 1
+	}
+	if ordinal < 0 {
+		return 0
+	}
+	return ordinal
+}
+
+func (app *application) monitorStatefulSets(stop chan struct{}) {
+	watchList := cache.NewListWatchFromClient(
+		app.clientset.AppsV1().RESTClient(),
+		"statefulsets",
+		app.namespace,
+		fields.Everything(),
+	)
+	update := func(obj interface{}) {
+		sts, ok := obj.(*appsv1.StatefulSet)
+		if !ok {
+			return
+		}
+		if key, err := cache.MetaNamespaceKeyFunc(sts); err == nil {
+			app.statefulSets.Update(key, sts, time.Now())
+		}
+	}
+	store, controller := cache.NewInformer(
+		app.instrument("StatefulSet monitor", "statefulsets", watchList),
+		&appsv1.StatefulSet{},
+		time.Minute*10,
+		recoverHandlers("StatefulSet monitor", cache.ResourceEventHandlerFuncs{
+			AddFunc: update,
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				update(newObj)
+			},
+			DeleteFunc: func(obj interface{}) {
+				if key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj); err == nil {
+					app.statefulSets.Delete(key, time.Now())
+				}
+			},
+		}),
+	)
+	app.registerInformer("StatefulSet monitor", controller.HasSynced)
+	go controller.Run(stop)
+
+	ticker := time.NewTicker(time.Second * 30)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			for key, since := range app.statefulSets.stuck.Expired(now) {
+				if obj, exists, _ := store.GetByKey(key); exists {
+					app.reportStatefulSet(obj.(*appsv1.StatefulSet), since, false)
+				}
+			}
+			for key, since := range app.statefulSets.partition.Expired(now) {
+				if obj, exists, _ := store.GetByKey(key); exists {
+					app.reportStatefulSet(obj.(*appsv1.StatefulSet), since, true)
+				}
+			}
+		}
+	}
+}
+
+// reportStatefulSet reports a stuck rollout, or a partition that prevents
+// the rollout from starting.
+func (app *application) reportStatefulSet(sts *appsv1.StatefulSet, since time.Time, partition bool) {
+	replicas := statefulSetReplicas(sts)
+	sentryEvent := app.newBaseEvent(sts.Namespace)
+	sentryEvent.Level = sentry.LevelWarning
+	if partition {
+		sentryEvent.Message = fmt.Sprintf("StatefulSet/%s: update partition %d is not lower than the number of replicas (%d), no pods will be updated",
+			sts.Name, statefulSetPartition(sts), replicas)
+		sentryEvent.Fingerprint = []string{"statefulset-partition", sts.Namespace, sts.Name}
+	} else {
+		ordinal := statefulSetBlockingOrdinal(sts)
+		sentryEvent.Level = sentry.LevelError
+		sentryEvent.Message = fmt.Sprintf("StatefulSet/%s: rollout stuck at %s-%d, %d of %d replicas updated and %d ready",
+			sts.Name, sts.Name, ordinal, sts.Status.UpdatedReplicas, replicas, sts.Status.ReadyReplicas)
+		sentryEvent.Fingerprint = []string{"statefulset-rollout-stuck", sts.Namespace, sts.Name}
+		sentryEvent.Tags["statefulset.ordinal"] = fmt.Sprint(ordinal)
+		if claims := statefulSetClaims(sts, fmt.Sprintf("%s-%d", sts.Name, ordinal)); len(claims) > 0 {
+			sentryEvent.Tags["pvc"] = truncate(strings.Join(claims, ","), 200)
+		}
+	}
+	sentryEvent.Tags["kind"] = "StatefulSet"
+	sentryEvent.Tags["statefulset"] = sts.Name
+	sentryEvent.Extra["since"] = since.UTC().Format(time.RFC3339)
+	sentryEvent.Extra["current-revision"] = sts.Status.CurrentRevision
+	sentryEvent.Extra["update-revision"] = sts.Status.UpdateRevision
+	sentryEvent.Extra["replicas"] = replicas
+	sentryEvent.Extra["updated-replicas"] = sts.Status.UpdatedReplicas
+	sentryEvent.Extra["ready-replicas"] = sts.Status.ReadyReplicas
+
+	logger.Info("Reporting StatefulSet", "namespace", sts.Namespace, "statefulset", sts.Name, "message", sentryEvent.Message)
+	app.reportMonitorEvent(sentryEvent, objectReference("StatefulSet", sts), fingerprintKey(sentryEvent))
+}
+
+// statefulSetClaims returns the names of the PersistentVolumeClaims the
+// volumeClaimTemplates of a StatefulSet create for a pod.
+func statefulSetClaims(sts *appsv1.StatefulSet, pod string) []string {
+	var claims []string
+	for _, template := range sts.Spec.VolumeClaimTemplates {
+		claims = append(claims, template.Name+"-"+pod)
+	}
+	return claims
+}
+
+// enrichStatefulSetPod adds the StatefulSet and ordinal of a pod to an
+// event. Events for pods that are blocked on a claim from the
+// volumeClaimTemplates are grouped per StatefulSet instead of per claim.
+func enrichStatefulSetPod(event *sentry.Event, pod *v1.Pod, evt *v1.Event) {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil || owner.Kind != "StatefulSet" || !strings.HasPrefix(pod.Name, owner.Name+"-") {
+		return
+	}
+	event.Tags["statefulset"] = owner.Name
+	event.Tags["statefulset.ordinal"] = strings.TrimPrefix(pod.Name, owner.Name+"-")
+
+	var claims []string
+	if match := missingClaimRegexp.FindStringSubmatch(evt.Message); match != nil {
+		claims = []string{match[1]}
+	} else if strings.Contains(evt.Message, "unbound immediate PersistentVolumeClaims") {
+		for _, volume := range pod.Spec.Volumes {
+			if claim := volume.PersistentVolumeClaim; claim != nil && strings.HasSuffix(claim.ClaimName, "-"+pod.Name) {
+				claims = append(claims, claim.ClaimName)
+			}
+		}
+		sort.Strings(claims)
+	} else {
+		return
+	}
+	event.Tags["pvc"] = truncate(strings.Join(claims, ","), 200)
+	event.Fingerprint = []string{"statefulset-pvc", pod.Namespace, owner.Name, evt.Reason}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newTestStatefulSet(replicas, partition int32) *appsv1.StatefulSet {
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "db", Name: "postgres", Generation: 2},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: &replicas,
+			UpdateStrategy: appsv1.StatefulSetUpdateStrategy{
+				Type:          appsv1.RollingUpdateStatefulSetStrategyType,
+				RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{Partition: &partition},
+			},
+			VolumeClaimTemplates: []v1.PersistentVolumeClaim{{ObjectMeta: metav1.ObjectMeta{Name: "data"}}},
+		},
+		Status: appsv1.StatefulSetStatus{
+			ObservedGeneration: 2,
+			CurrentRevision:    "postgres-1",
+			UpdateRevision:     "postgres-2",
+			UpdatedReplicas:    1,
+			ReadyReplicas:      2,
+		},
+	}
+	return sts
+}
+
+func TestStatefulSetMonitor(t *testing.T) {
+	t.Parallel()
+
+	monitor := newStatefulSetMonitor(10 * time.Minute)
+	start := time.Now()
+	monitor.Update("db/postgres", newTestStatefulSet(3, 0), start)
+	monitor.Update("db/staged", newTestStatefulSet(3, 1), start)
+	monitor.Update("db/paused", newTestStatefulSet(3, 3), start)
+
+	later := start.Add(11 * time.Minute)
+	if stuck := monitor.stuck.Expired(later); len(stuck) != 1 || stuck["db/postgres"].IsZero() {
+		t.Errorf("Unexpected stuck StatefulSets: %v", stuck)
+	}
+	if partitioned := monitor.partition.Expired(later); len(partitioned) != 1 || partitioned["db/paused"].IsZero() {
+		t.Errorf("Unexpected partitioned StatefulSets: %v", partitioned)
+	}
+
+	done := newTestStatefulSet(3, 0)
+	done.Status.CurrentRevision = done.Status.UpdateRevision
+	done.Status.ReadyReplicas = 3
+	monitor.Update("db/postgres", done, later)
+	monitor.Update("db/postgres", newTestStatefulSet(3, 0), later)
+	if stuck := monitor.stuck.Expired(later.Add(time.Minute)); len(stuck) != 0 {
+		t.Errorf("Completed rollout still tracked: %v", stuck)
+	}
+}
+
+func TestStatefulSetBlockingOrdinal(t *testing.T) {
+	t.Parallel()
+
+	sts := newTestStatefulSet(3, 0)
+	if ordinal := statefulSetBlockingOrdinal(sts); ordinal != 1 {
+		t.Errorf("Unexpected ordinal during update: %d", ordinal)
+	}
+	sts.Status.CurrentRevision = sts.Status.UpdateRevision
+	if ordinal := statefulSetBlockingOrdinal(sts); ordinal != 2 {
+		t.Errorf("Unexpected ordinal during scale up: %d", ordinal)
+	}
+	if claims := statefulSetClaims(sts, "postgres-2"); !reflect.DeepEqual(claims, []string{"data-postgres-2"}) {
+		t.Errorf("Unexpected claims: %v", claims)
+	}
+}
+
+func TestEnrichStatefulSetPod(t *testing.T) {
+	t.Parallel()
+
+	controller := true
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "db",
+			Name:            "postgres-2",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "StatefulSet", Name: "postgres", Controller: &controller}},
+		},
+		Spec: v1.PodSpec{Volumes: []v1.Volume{
+			{Name: "data", VolumeSource: v1.VolumeSource{PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: "data-postgres-2"}}},
+			{Name: "shared", VolumeSource: v1.VolumeSource{PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: "shared"}}},
+		}},
+	}
+
+	event := sentry.NewEvent()
+	enrichStatefulSetPod(event, pod, &v1.Event{Reason: "FailedScheduling", Message: "pod has unbound immediate PersistentVolumeClaims (repeated 3 times)"})
+	if event.Tags["statefulset"] != "postgres" || event.Tags["statefulset.ordinal"] != "2" || event.Tags["pvc"] != "data-postgres-2" {
+		t.Errorf("Unexpected tags: %v", event.Tags)
+	}
+	if !reflect.DeepEqual(event.Fingerprint, []string{"statefulset-pvc", "db", "postgres", "FailedScheduling"}) {
+		t.Errorf("Unexpected fingerprint: %v", event.Fingerprint)
+	}
+
+	event = sentry.NewEvent()
+	enrichStatefulSetPod(event, pod, &v1.Event{Reason: "FailedScheduling", Message: `persistentvolumeclaim "data-postgres-2" not found`})
+	if event.Tags["pvc"] != "data-postgres-2" {
+		t.Errorf("Unexpected tags: %v", event.Tags)
+	}
+
+	event = sentry.NewEvent()
+	event.Fingerprint = []string{"original"}
+	enrichStatefulSetPod(event, pod, &v1.Event{Reason: "BackOff", Message: "Back-off restarting failed container"})
+	if _, ok := event.Tags["pvc"]; ok || len(event.Fingerprint) != 1 {
+		t.Errorf("Unexpected changes for unrelated event: %v %v", event.Tags, event.Fingerprint)
+	}
+}
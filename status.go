@@ -0,0 +1,135 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// statusEvents is the number of recent events shown on the status page.
+const statusEvents = 50
+
+type informerStatus struct {
+	Name   string
+	Synced bool
+}
+
+type filterStatus struct {
+	Name  string
+	Value string
+}
+
+// statusData is everything shown on the status page.
+type statusData struct {
+	Version   string
+	Time      time.Time
+	Failing   []string
+	Informers []informerStatus
+	Rates     []namespaceRate
+	Mutes     []mute
+	Filters   []filterStatus
+	Events    []*recentEvent
+}
+
+var statusTemplate = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="30">
+<title>k8s-sentry status</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.2em 0.6em; text-align: left; vertical-align: top; }
+.ok { color: #080; }
+.failing { color: #c00; }
+</style>
+</head>
+<body>
+<h1>k8s-sentry {{.Version}}</h1>
+<p>Status at {{.Time.Format "2006-01-02 15:04:05 MST"}}.</p>
+
+<h2>Watches</h2>
+{{range .Failing}}<p class="failing">{{.}}</p>
+{{end}}<table>
+<tr><th>Informer</th><th>Status</th></tr>
+{{range .Informers}}<tr><td>{{.Name}}</td>{{if .Synced}}<td class="ok">synced</td>{{else}}<td class="failing">not synced</td>{{end}}</tr>
+{{end}}</table>
+
+<h2>Events per namespace in the last hour</h2>
+<table>
+<tr><th>Cluster</th><th>Namespace</th><th>Reported</th><th>Skipped</th></tr>
+{{range .Rates}}<tr><td>{{.Cluster}}</td><td>{{.Namespace}}</td><td>{{.Reported}}</td><td>{{.Skipped}}</td></tr>
+{{else}}<tr><td colspan="4">No events</td></tr>
+{{end}}</table>
+
+<h2>Mutes</h2>
+<table>
+<tr><th>Namespace</th><th>Reason</th><th>Fingerprint</th><th>Until</th><th>Comment</th></tr>
+{{range .Mutes}}<tr><td>{{.Namespace}}</td><td>{{.Reason}}</td><td>{{range .Fingerprint}}{{.}} {{end}}</td><td>{{.Until.Format "2006-01-02 15:04:05 MST"}}</td><td>{{.Comment}}</td></tr>
+{{else}}<tr><td colspan="5">No active mutes</td></tr>
+{{end}}</table>
+
+<h2>Filters</h2>
+<table>
+{{range .Filters}}<tr><th>{{.Name}}</th><td>{{.Value}}</td></tr>
+{{else}}<tr><td>No filters configured</td></tr>
+{{end}}</table>
+
+<h2>Recent events</h2>
+<table>
+<tr><th>Time</th><th>Cluster</th><th>Object</th><th>Reason</th><th>Message</th><th>Decision</th></tr>
+{{range .Events}}<tr><td>{{.Time.Format "15:04:05"}}</td><td>{{.Cluster}}</td><td>{{.Kind}} {{.Namespace}}/{{.Name}}</td><td>{{.Reason}}</td><td>{{.Message}}</td><td>{{.Decision}}{{if .Cause}}: {{.Cause}}{{end}}</td></tr>
+{{else}}<tr><td colspan="6">No recent events</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// status collects the data for the status page.
+func (s *apiServer) status(now time.Time) statusData {
+	data := statusData{Version: version, Time: now, Mutes: s.mutes.Active(now)}
+	if s.watches != nil {
+		data.Failing = s.watches.Failing()
+	}
+	if s.syncs != nil {
+		for name, synced := range s.syncs.Status() {
+			data.Informers = append(data.Informers, informerStatus{Name: name, Synced: synced})
+		}
+		sort.Slice(data.Informers, func(i, j int) bool { return data.Informers[i].Name < data.Informers[j].Name })
+	}
+	if s.recent != nil {
+		data.Rates = s.recent.Rates(now)
+		data.Events = s.recent.List(recentEventFilter{}, statusEvents)
+	}
+	for name, value := range s.currentFilters() {
+		data.Filters = append(data.Filters, filterStatus{Name: name, Value: fmt.Sprint(value)})
+	}
+	sort.Slice(data.Filters, func(i, j int) bool { return data.Filters[i].Name < data.Filters[j].Name })
+	return data
+}
+
+// statusPage serves a dashboard with the state of k8s-sentry.
+func (s *apiServer) statusPage(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := statusTemplate.Execute(w, s.status(time.Now())); err != nil {
+		logger.Error("Error rendering status page", "error", err)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestStatusPage(t *testing.T) {
+	t.Parallel()
+
+	recent := newRecentEvents(10)
+	evt := &v1.Event{Reason: "BackOff", Message: "Back-off <restarting>"}
+	evt.InvolvedObject.Namespace = "shop"
+	recent.Record("", evt, sentry.NewEvent(), "", time.Now())
+	syncs := newSyncTracker()
+	syncs.Expect("pod monitor")
+	server := newAPIServer("secret", newMuteList(), map[string]interface{}{"shards": 2}, recent, newWatchMonitor(time.Minute), syncs)
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+	if response.Code != http.StatusUnauthorized || len(response.Header()["Www-Authenticate"]) != 2 {
+		t.Errorf("Unauthenticated request returned %d with %v", response.Code, response.Header())
+	}
+
+	request = httptest.NewRequest(http.MethodGet, "/", nil)
+	request.SetBasicAuth("admin", "secret")
+	response = httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Status page returned %d", response.Code)
+	}
+	body := response.Body.String()
+	for _, expected := range []string{"pod monitor", "not synced", "<td>shop</td><td>1</td><td>0</td>", "<th>shards</th><td>2</td>", "Back-off &lt;restarting&gt;"} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Status page does not contain %q", expected)
+		}
+	}
+}
+
+func TestRecentEventsRates(t *testing.T) {
+	t.Parallel()
+
+	recent := newRecentEvents(10)
+	now := time.Now()
+	ages := []time.Duration{90 * time.Minute, 20 * time.Minute, 10 * time.Minute, 0}
+	for i, namespace := range []string{"shop", "shop", "db", "shop"} {
+		evt := &v1.Event{}
+		evt.InvolvedObject.Namespace = namespace
+		recent.Record("", evt, nil, "muted", now.Add(-ages[i]))
+	}
+	rates := recent.Rates(now)
+	if len(rates) != 2 || rates[0].Namespace != "shop" || rates[0].Skipped != 2 || rates[1].Namespace != "db" {
+		t.Errorf("Unexpected rates %+v", rates)
+	}
+}
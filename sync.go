@@ -0,0 +1,155 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+)
+
+// syncPollInterval is how often informers are checked while waiting for
+// them to sync.
+const syncPollInterval = 100 * time.Millisecond
+
+// syncTracker keeps track of whether the informers of all applications have
+// completed their initial list. Informers are expected before they are
+// started, so an informer that was not created yet counts as not synced.
+type syncTracker struct {
+	lock      sync.Mutex
+	informers map[string]cache.InformerSynced
+}
+
+func newSyncTracker() *syncTracker {
+	return &syncTracker{informers: make(map[string]cache.InformerSynced)}
+}
+
+// Expect adds an informer that will be registered later.
+func (t *syncTracker) Expect(name string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if _, ok := t.informers[name]; !ok {
+		t.informers[name] = nil
+	}
+}
+
+// Register sets the function that reports if an informer has synced.
+func (t *syncTracker) Register(name string, synced cache.InformerSynced) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.informers[name] = synced
+}
+
+// Status returns whether each informer has synced.
+func (t *syncTracker) Status() map[string]bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	status := make(map[string]bool)
+	for name, synced := range t.informers {
+		status[name] = synced != nil && synced()
+	}
+	return status
+}
+
+// Unsynced returns the names of all informers that have not synced, except
+// those for which skip returns true.
+func (t *syncTracker) Unsynced(skip func(name string) bool) []string {
+	var unsynced []string
+	for name, synced := range t.Status() {
+		if !synced && (skip == nil || !skip(name)) {
+			unsynced = append(unsynced, name)
+		}
+	}
+	sort.Strings(unsynced)
+	return unsynced
+}
+
+// syncName returns the name of an informer in the sync tracker.
+func (app *application) syncName(name string) string {
+	if app.clusterName == "" {
+		return name
+	}
+	return app.clusterName + ": " + name
+}
+
+// startWorker starts a function that runs until the application is
+// stopped.
+func (app *application) startWorker(name string, f func()) {
+	app.workers.Add(1)
+	goSafe(name, func() {
+		defer app.workers.Done()
+		f()
+	})
+}
+
+// startMonitor starts a function that runs an informer.
+func (app *application) startMonitor(name string, f func()) {
+	if app.syncs != nil {
+		app.syncs.Expect(app.syncName(name))
+	}
+	app.startWorker(name, f)
+}
+
+// Wait waits until all workers of a stopped application have finished, or
+// until timeout. It returns false on timeout.
+func (app *application) Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		app.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// registerInformer registers the sync status of an informer started with
+// startMonitor.
+func (app *application) registerInformer(name string, synced cache.InformerSynced) {
+	if app.syncs != nil {
+		app.syncs.Register(app.syncName(name), synced)
+	}
+}
+
+// waitForInformers blocks until all other informers of the application have
+// synced, so events are not processed with incomplete information, for
+// example about nodes.
+func (app *application) waitForInformers(name string, stop chan struct{}) {
+	if app.syncs == nil {
+		return
+	}
+	prefix := app.syncName("")
+	own := app.syncName(name)
+	pending := func() []string {
+		return app.syncs.Unsynced(func(other string) bool {
+			return other == own || !strings.HasPrefix(other, prefix)
+		})
+	}
+	if len(pending()) == 0 {
+		return
+	}
+	logger.Info("Waiting for informers to sync before processing events", "cluster", app.clusterName, "informers", pending())
+	wait.PollImmediateUntil(syncPollInterval, func() (bool, error) {
+		return len(pending()) == 0, nil
+	}, stop)
+}
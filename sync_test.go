@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSyncTracker(t *testing.T) {
+	t.Parallel()
+
+	tracker := newSyncTracker()
+	app := &application{clusterName: "prod", syncs: tracker}
+	app.syncs.Expect(app.syncName("event monitor"))
+	app.syncs.Expect(app.syncName("node monitor"))
+	tracker.Expect("staging: node monitor")
+
+	expected := []string{"prod: event monitor", "prod: node monitor", "staging: node monitor"}
+	if unsynced := tracker.Unsynced(nil); !reflect.DeepEqual(unsynced, expected) {
+		t.Errorf("unexpected unsynced informers: %v", unsynced)
+	}
+
+	synced := false
+	app.registerInformer("node monitor", func() bool { return synced })
+	done := make(chan struct{})
+	go func() {
+		app.waitForInformers("event monitor", make(chan struct{}))
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("stopped waiting before the node informer synced")
+	case <-time.After(3 * syncPollInterval):
+	}
+
+	app.registerInformer("node monitor", func() bool { return true })
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("still waiting after the node informer synced")
+	}
+}
+
+func TestHealthServerSync(t *testing.T) {
+	t.Parallel()
+
+	tracker := newSyncTracker()
+	tracker.Register("event monitor", func() bool { return true })
+	tracker.Expect("node monitor")
+	s := newHealthServer(newWatchMonitor(time.Minute), tracker)
+
+	recorder := httptest.NewRecorder()
+	s.ready(recorder, httptest.NewRequest(http.MethodGet, "/readyz?verbose", nil))
+	body := recorder.Body.String()
+	if recorder.Code != http.StatusServiceUnavailable || !strings.Contains(body, "[+]event monitor synced") || !strings.Contains(body, "[-]node monitor not synced") {
+		t.Errorf("unexpected response %d: %s", recorder.Code, body)
+	}
+
+	tracker.Register("node monitor", func() bool { return true })
+	recorder = httptest.NewRecorder()
+	s.ready(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("expected ready, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestApplicationWait(t *testing.T) {
+	t.Parallel()
+
+	app := &application{workers: &sync.WaitGroup{}}
+	release := make(chan struct{})
+	app.startWorker("test", func() { <-release })
+	if app.Wait(10 * time.Millisecond) {
+		t.Error("expected timeout while a worker is running")
+	}
+	close(release)
+	if !app.Wait(time.Second) {
+		t.Error("expected workers to finish")
+	}
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// Timestamp sources determine which time of an event is reported to Sentry.
+const (
+	// timestampCreation uses the time the event object was created. For
+	// events that are repeated this is the first occurrence.
+	timestampCreation = "creationTimestamp"
+	// timestampLast uses the time the event was last seen.
+	timestampLast = "lastTimestamp"
+	// timestampEvent uses the time the event was first observed, as set by
+	// newer event recorders.
+	timestampEvent = "eventTime"
+	// timestampSeries uses the time of the last occurrence of an event
+	// series.
+	timestampSeries = "series"
+)
+
+func validateTimestampSource(source string) error {
+	switch source {
+	case timestampCreation, timestampLast, timestampEvent, timestampSeries:
+		return nil
+	default:
+		return fmt.Errorf("invalid timestamp source '%s', expected creationTimestamp, lastTimestamp, eventTime or series", source)
+	}
+}
+
+// eventTimestamp returns the time of an event from the configured source. If
+// the event does not have that time it falls back to the most recent time it
+// does have.
+func eventTimestamp(source string, evt *v1.Event) time.Time {
+	switch source {
+	case timestampLast:
+		if !evt.LastTimestamp.IsZero() {
+			return evt.LastTimestamp.Time
+		}
+	case timestampEvent:
+		if !evt.EventTime.IsZero() {
+			return evt.EventTime.Time
+		}
+	case timestampSeries:
+		if evt.Series != nil && !evt.Series.LastObservedTime.IsZero() {
+			return evt.Series.LastObservedTime.Time
+		}
+	default:
+		return evt.CreationTimestamp.Time
+	}
+	return eventTime(evt)
+}
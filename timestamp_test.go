@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestEventTimestamp(t *testing.T) {
+	t.Parallel()
+
+	created := time.Date(2019, 10, 1, 8, 0, 0, 0, time.UTC)
+	last := created.Add(2 * time.Hour)
+	observed := created.Add(3 * time.Hour)
+	evt := &v1.Event{
+		ObjectMeta:    metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(created)},
+		LastTimestamp: metav1.NewTime(last),
+		Series:        &v1.EventSeries{LastObservedTime: metav1.NewMicroTime(observed)},
+	}
+
+	tests := []struct {
+		source   string
+		expected time.Time
+	}{
+		{timestampCreation, created},
+		{timestampLast, last},
+		{timestampSeries, observed},
+		// No eventTime, fall back to the most recent time
+		{timestampEvent, observed},
+	}
+	for _, tc := range tests {
+		if got := eventTimestamp(tc.source, evt); !got.Equal(tc.expected) {
+			t.Errorf("%s: expected %s, got %s", tc.source, tc.expected, got)
+		}
+	}
+}
+
+func TestValidateTimestampSource(t *testing.T) {
+	t.Parallel()
+
+	for _, source := range []string{timestampCreation, timestampLast, timestampEvent, timestampSeries} {
+		if err := validateTimestampSource(source); err != nil {
+			t.Errorf("%s: unexpected error %v", source, err)
+		}
+	}
+	if err := validateTimestampSource("firstTimestamp"); err == nil {
+		t.Error("expected an error for an unknown source")
+	}
+}
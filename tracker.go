@@ -0,0 +1,70 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+type trackedCondition struct {
+	since    time.Time
+	reported bool
+}
+
+// conditionTracker tracks how long a condition has been true for a set of
+// objects, and determines which conditions have lasted longer than a
+// threshold.
+type conditionTracker struct {
+	threshold time.Duration
+
+	lock       sync.Mutex
+	conditions map[string]*trackedCondition
+}
+
+func newConditionTracker(threshold time.Duration) *conditionTracker {
+	return &conditionTracker{
+		threshold:  threshold,
+		conditions: make(map[string]*trackedCondition),
+	}
+}
+
+// Set records the current state of the condition for key.
+func (t *conditionTracker) Set(key string, active bool, now time.Time) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if !active {
+		delete(t.conditions, key)
+	} else if _, ok := t.conditions[key]; !ok {
+		t.conditions[key] = &trackedCondition{since: now}
+	}
+}
+
+// Expired returns the keys of all conditions that have been true for longer
+// than the threshold, with the time they became true. Each condition is only
+// returned once until it is cleared.
+func (t *conditionTracker) Expired(now time.Time) map[string]time.Time {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	expired := make(map[string]time.Time)
+	for key, condition := range t.conditions {
+		if !condition.reported && now.Sub(condition.since) >= t.threshold {
+			condition.reported = true
+			expired[key] = condition.since
+		}
+	}
+	return expired
+}
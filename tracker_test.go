@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConditionTracker(t *testing.T) {
+	t.Parallel()
+
+	tracker := newConditionTracker(time.Minute)
+	start := time.Now()
+
+	tracker.Set("a", true, start)
+	tracker.Set("b", false, start)
+	tracker.Set("a", true, start.Add(30*time.Second))
+	if expired := tracker.Expired(start.Add(30 * time.Second)); len(expired) != 0 {
+		t.Errorf("Conditions expired before threshold: %v", expired)
+	}
+	expired := tracker.Expired(start.Add(time.Minute))
+	if len(expired) != 1 || !expired["a"].Equal(start) {
+		t.Errorf("Unexpected expired conditions: %v", expired)
+	}
+	if expired := tracker.Expired(start.Add(2 * time.Minute)); len(expired) != 0 {
+		t.Errorf("Condition expired twice: %v", expired)
+	}
+
+	tracker.Set("a", false, start.Add(3*time.Minute))
+	tracker.Set("a", true, start.Add(4*time.Minute))
+	if expired := tracker.Expired(start.Add(5 * time.Minute)); len(expired) != 1 {
+		t.Errorf("Condition not expired after it was cleared: %v", expired)
+	}
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// The Sentry SDK used by k8s-sentry predates performance monitoring, so
+// transactions are built and sent to the envelope endpoint directly.
+
+type sentrySpan struct {
+	TraceID        string            `json:"trace_id"`
+	SpanID         string            `json:"span_id"`
+	ParentSpanID   string            `json:"parent_span_id,omitempty"`
+	Op             string            `json:"op"`
+	Description    string            `json:"description,omitempty"`
+	StartTimestamp time.Time         `json:"start_timestamp"`
+	Timestamp      time.Time         `json:"timestamp"`
+	Tags           map[string]string `json:"tags,omitempty"`
+}
+
+type sentryTransaction struct {
+	EventID        string                 `json:"event_id"`
+	Type           string                 `json:"type"`
+	Transaction    string                 `json:"transaction"`
+	Platform       string                 `json:"platform"`
+	Environment    string                 `json:"environment,omitempty"`
+	Release        string                 `json:"release,omitempty"`
+	ServerName     string                 `json:"server_name,omitempty"`
+	StartTimestamp time.Time              `json:"start_timestamp"`
+	Timestamp      time.Time              `json:"timestamp"`
+	Tags           map[string]string      `json:"tags"`
+	Contexts       map[string]interface{} `json:"contexts"`
+	Spans          []*sentrySpan          `json:"spans"`
+
+	traceID string
+	spanID  string
+}
+
+func randomID(size int) string {
+	id := make([]byte, size)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+func newTransaction(name, op string, start, end time.Time) *sentryTransaction {
+	tx := &sentryTransaction{
+		EventID:        randomID(16),
+		Type:           "transaction",
+		Transaction:    name,
+		Platform:       "other",
+		StartTimestamp: start.UTC(),
+		Timestamp:      end.UTC(),
+		Tags:           make(map[string]string),
+		Spans:          []*sentrySpan{},
+		traceID:        randomID(16),
+		spanID:         randomID(8),
+	}
+	tx.Contexts = map[string]interface{}{
+		"trace": map[string]string{
+			"trace_id": tx.traceID,
+			"span_id":  tx.spanID,
+			"op":       op,
+			"status":   "ok",
+		},
+	}
+	return tx
+}
+
+// AddSpan adds a child span to the transaction. Spans without a valid
+// duration are ignored.
+func (tx *sentryTransaction) AddSpan(op, description string, start, end time.Time) {
+	if start.IsZero() || end.Before(start) {
+		return
+	}
+	tx.Spans = append(tx.Spans, &sentrySpan{
+		TraceID:        tx.traceID,
+		SpanID:         randomID(8),
+		ParentSpanID:   tx.spanID,
+		Op:             op,
+		Description:    description,
+		StartTimestamp: start.UTC(),
+		Timestamp:      end.UTC(),
+	})
+}
+
+// transactionSender sends transactions in the background. Transactions are
+// dropped if the buffer is full.
+type transactionSender struct {
+	queue  chan *sentryTransaction
+	tunnel string
+	client *http.Client
+}
+
+func newTransactionSender(bufferSize int, tunnel string) *transactionSender {
+	return &transactionSender{
+		queue:  make(chan *sentryTransaction, bufferSize),
+		tunnel: tunnel,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Send queues a transaction for sending.
+func (s *transactionSender) Send(tx *sentryTransaction) {
+	select {
+	case s.queue <- tx:
+	default:
+		logger.Warning("Transaction buffer full, dropping transaction", "transaction", tx.Transaction)
+		droppedEvents.Record("transactions", sentry.LevelInfo)
+	}
+}
+
+// Usage returns the number of queued transactions and the size of the
+// queue.
+func (s *transactionSender) Usage() (int, int) {
+	return len(s.queue), cap(s.queue)
+}
+
+// Run sends queued transactions until stop is closed. Transactions that
+// are still queued when stop is closed are sent before returning.
+func (s *transactionSender) Run(stop chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			for {
+				select {
+				case tx := <-s.queue:
+					s.sendOrLog(tx)
+				default:
+					return
+				}
+			}
+		case tx := <-s.queue:
+			s.sendOrLog(tx)
+		}
+	}
+}
+
+func (s *transactionSender) sendOrLog(tx *sentryTransaction) {
+	if err := s.send(tx); err != nil {
+		logger.Error("Error sending transaction", "transaction", tx.Transaction, "error", err)
+	}
+}
+
+func (s *transactionSender) send(tx *sentryTransaction) error {
+	client := sentry.CurrentHub().Client()
+	if client == nil || client.Options().Dsn == "" {
+		return nil
+	}
+	options := client.Options()
+	dsn, err := sentry.NewDsn(options.Dsn)
+	if err != nil {
+		return err
+	}
+	if tx.Environment == "" {
+		tx.Environment = options.Environment
+	}
+	if tx.Release == "" {
+		tx.Release = options.Release
+	}
+	if tx.ServerName == "" {
+		tx.ServerName = options.ServerName
+	}
+	tx.Tags["k8s-sentry.version"] = version
+	tx.Tags = sanitizeTags(tx.Tags)
+
+	payload, err := json.Marshal(tx)
+	if err != nil {
+		return err
+	}
+	request, err := newSentryRequest(dsn, s.tunnel, "transaction", tx.EventID, payload)
+	if err != nil {
+		return err
+	}
+	return sendSentryRequest(s.client, request)
+}
@@ -0,0 +1,299 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// syncTransport is a sentry.Transport which sends events synchronously and
+// remembers the result, so delivery problems can be reported.
+type syncTransport struct {
+	dsn       *sentry.Dsn
+	levelDSNs map[sentry.Level]*sentry.Dsn
+	tunnel    string
+	client    *http.Client
+	err       error
+}
+
+func (t *syncTransport) Configure(options sentry.ClientOptions) {
+	t.dsn, t.err = sentry.NewDsn(options.Dsn)
+	t.client = &http.Client{Timeout: 30 * time.Second}
+}
+
+func (t *syncTransport) SendEvent(event *sentry.Event) {
+	if t.dsn == nil {
+		return
+	}
+	t.err = t.send(event)
+}
+
+func (t *syncTransport) send(event *sentry.Event) error {
+	return postEvent(t.client, routeDSN(t.dsn, t.levelDSNs, event.Level), t.tunnel, event)
+}
+
+func (t *syncTransport) Flush(timeout time.Duration) bool {
+	return true
+}
+
+// sentryResponseError is returned when Sentry does not accept an event.
+type sentryResponseError struct {
+	status     string
+	statusCode int
+	message    string
+	retryAfter time.Duration
+}
+
+func (e *sentryResponseError) Error() string {
+	return fmt.Sprintf("Sentry returned %s: %s", e.status, e.message)
+}
+
+// postEvent sends an event to the store endpoint of a DSN, or to a tunnel.
+func postEvent(client *http.Client, dsn *sentry.Dsn, tunnel string, event *sentry.Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	request, err := newSentryRequest(dsn, tunnel, "event", string(event.EventID), body)
+	if err != nil {
+		return err
+	}
+	return sendSentryRequest(client, request)
+}
+
+// newSentryRequest creates a request to send an event, transaction or
+// metrics to Sentry. Events are sent to the store endpoint of the DSN and
+// everything else to its envelope endpoint. When a tunnel is used both are sent to the
+// tunnel as envelope, with the DSN in the envelope header so the tunnel
+// knows where to forward them to.
+func newSentryRequest(dsn *sentry.Dsn, tunnel, itemType, eventID string, payload []byte) (*http.Request, error) {
+	if tunnel == "" && itemType == "event" {
+		request, err := http.NewRequest(http.MethodPost, dsn.StoreAPIURL().String(), bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range dsn.RequestHeaders() {
+			request.Header.Set(key, value)
+		}
+		return request, nil
+	}
+	return newEnvelopeRequest(dsn, tunnel, eventID, map[string]interface{}{"type": itemType}, payload)
+}
+
+// newEnvelopeRequest creates a request to send an envelope with a single
+// item to Sentry, or to a tunnel.
+func newEnvelopeRequest(dsn *sentry.Dsn, tunnel, eventID string, item map[string]interface{}, payload []byte) (*http.Request, error) {
+	header := map[string]interface{}{"sent_at": time.Now().UTC()}
+	if eventID != "" {
+		header["event_id"] = eventID
+	}
+	endpoint := tunnel
+	if tunnel == "" {
+		endpoint = strings.Replace(dsn.StoreAPIURL().String(), "/store/", "/envelope/", 1)
+	} else {
+		header["dsn"] = dsn.String()
+	}
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	encoder.Encode(header)
+	item["length"] = len(payload)
+	encoder.Encode(item)
+	body.Write(payload)
+	body.WriteByte('\n')
+
+	request, err := http.NewRequest(http.MethodPost, endpoint, &body)
+	if err != nil {
+		return nil, err
+	}
+	if tunnel == "" {
+		for key, value := range dsn.RequestHeaders() {
+			request.Header.Set(key, value)
+		}
+	}
+	request.Header.Set("Content-Type", "application/x-sentry-envelope")
+	return request, nil
+}
+
+// sendSentryRequest sends a request created by newSentryRequest.
+func sendSentryRequest(client *http.Client, request *http.Request) error {
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		message, _ := ioutil.ReadAll(response.Body)
+		responseErr := &sentryResponseError{
+			status:     response.Status,
+			statusCode: response.StatusCode,
+			message:    string(bytes.TrimSpace(message)),
+		}
+		if response.StatusCode == http.StatusTooManyRequests {
+			responseErr.retryAfter = defaultRetryAfter
+			if seconds, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil && seconds > 0 {
+				responseErr.retryAfter = time.Duration(seconds) * time.Second
+			}
+		}
+		return responseErr
+	}
+	return nil
+}
+
+// defaultRetryAfter is how long to wait after Sentry rate limited an event
+// without a Retry-After header.
+const defaultRetryAfter = time.Minute
+
+// queuedTransport is a sentry.Transport which queues events in a bounded
+// eventQueue, so errors are kept when the queue is full during an event
+// storm. Events are sent in the background by up to concurrency workers,
+// which share a pool of keep-alive connections. Sentry accepts a single
+// event per request, so during a storm reusing connections and sending in
+// parallel is what keeps the per-event overhead down.
+type queuedTransport struct {
+	queue       *eventQueue
+	concurrency int
+	tunnel      string
+	dsn         *sentry.Dsn
+	levelDSNs   map[sentry.Level]*sentry.Dsn
+	client      *http.Client
+
+	lock    sync.Mutex
+	sending int
+	// idle is closed when no worker is running.
+	idle   chan struct{}
+	paused time.Time
+}
+
+// newQueuedTransport creates a queuedTransport. The name of the queue is used
+// in the metrics for dropped events.
+func newQueuedTransport(name string, size, concurrency int) *queuedTransport {
+	t := &queuedTransport{queue: newEventQueue(name, size), concurrency: concurrency, idle: make(chan struct{})}
+	close(t.idle)
+	return t
+}
+
+// clone creates an unconfigured transport with the same settings, for a new
+// client.
+func (t *queuedTransport) clone() *queuedTransport {
+	c := newQueuedTransport(t.queue.name, t.queue.size, t.concurrency)
+	c.tunnel = t.tunnel
+	c.levelDSNs = t.levelDSNs
+	return c
+}
+
+func (t *queuedTransport) Configure(options sentry.ClientOptions) {
+	if options.Dsn == "" {
+		return
+	}
+	dsn, err := sentry.NewDsn(options.Dsn)
+	if err != nil {
+		logger.Error("Invalid Sentry DSN", "error", err)
+		return
+	}
+	t.dsn = dsn
+	t.client = &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			MaxIdleConnsPerHost: t.concurrency,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
+
+// SendEvent queues an event, and starts another worker to send queued
+// events if fewer than concurrency are running.
+func (t *queuedTransport) SendEvent(event *sentry.Event) {
+	if t.dsn == nil {
+		return
+	}
+	t.queue.Push(event)
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.sending < t.concurrency {
+		if t.sending == 0 {
+			t.idle = make(chan struct{})
+		}
+		t.sending++
+		go t.run()
+	}
+}
+
+// run sends queued events until the queue is empty.
+func (t *queuedTransport) run() {
+	for {
+		t.lock.Lock()
+		wait := time.Until(t.paused)
+		t.lock.Unlock()
+		if wait > 0 {
+			time.Sleep(wait)
+		}
+
+		event := t.queue.Pop()
+		if event == nil {
+			t.lock.Lock()
+			t.sending--
+			if t.sending == 0 {
+				close(t.idle)
+			}
+			t.lock.Unlock()
+			return
+		}
+		err := postEvent(t.client, routeDSN(t.dsn, t.levelDSNs, event.Level), t.tunnel, event)
+		if responseErr, ok := err.(*sentryResponseError); ok && responseErr.retryAfter > 0 {
+			logger.Warning("Rate limited by Sentry, pausing", "duration", responseErr.retryAfter)
+			// Queue the event again, so it is sent after the pause. Pop
+			// returns the most severe event, so dropping it would lose
+			// errors first.
+			t.queue.Push(event)
+			t.lock.Lock()
+			t.paused = time.Now().Add(responseErr.retryAfter)
+			t.lock.Unlock()
+		} else if err != nil {
+			logger.Error("Error sending event to Sentry", "error", err)
+		}
+	}
+}
+
+// Usage returns the number of queued events and the size of the queue.
+func (t *queuedTransport) Usage() (int, int) {
+	return t.queue.Usage()
+}
+
+// Flush waits until all queued events are sent, or until timeout.
+func (t *queuedTransport) Flush(timeout time.Duration) bool {
+	t.lock.Lock()
+	idle := t.idle
+	t.lock.Unlock()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-idle:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
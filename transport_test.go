@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+func TestSyncTransport(t *testing.T) {
+	t.Parallel()
+
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/1/store/" {
+			t.Errorf("Unexpected request path %s", r.URL.Path)
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	transport := &syncTransport{}
+	transport.Configure(sentry.ClientOptions{Dsn: strings.Replace(server.URL, "http://", "http://key@", 1) + "/1"})
+	if transport.err != nil {
+		t.Fatal(transport.err)
+	}
+
+	transport.SendEvent(sentry.NewEvent())
+	if transport.err != nil {
+		t.Errorf("Unexpected error: %v", transport.err)
+	}
+
+	status = http.StatusForbidden
+	transport.SendEvent(sentry.NewEvent())
+	if transport.err == nil {
+		t.Error("HTTP errors are not reported")
+	}
+}
+
+func TestQueuedTransport(t *testing.T) {
+	t.Parallel()
+
+	received := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.URL.Path
+	}))
+	defer server.Close()
+
+	transport := newQueuedTransport("transport-test", 5, 2)
+	transport.Configure(sentry.ClientOptions{Dsn: strings.Replace(server.URL, "http://", "http://key@", 1) + "/1"})
+	transport.SendEvent(sentry.NewEvent())
+	transport.SendEvent(sentry.NewEvent())
+	if !transport.Flush(5 * time.Second) {
+		t.Fatal("Timeout flushing events")
+	}
+	if len(received) != 2 {
+		t.Errorf("Expected 2 requests, got %d", len(received))
+	}
+	if used, _ := transport.Usage(); used != 0 {
+		t.Errorf("Queue not empty after flush: %d", used)
+	}
+}
+
+func TestQueuedTransportFlushTimeout(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+
+	transport := newQueuedTransport("transport-test", 5, 1)
+	transport.Configure(sentry.ClientOptions{Dsn: strings.Replace(server.URL, "http://", "http://key@", 1) + "/1"})
+	if !transport.Flush(time.Second) {
+		t.Error("Idle transport not flushed")
+	}
+	transport.SendEvent(sentry.NewEvent())
+	if transport.Flush(10 * time.Millisecond) {
+		t.Error("Flush did not time out")
+	}
+	close(release)
+	if !transport.Flush(5 * time.Second) {
+		t.Error("Timeout flushing events")
+	}
+}
+
+func TestQueuedTransportRateLimit(t *testing.T) {
+	t.Parallel()
+
+	received := make(chan sentry.Level, 10)
+	limited := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !limited {
+			limited = true
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		var event sentry.Event
+		json.NewDecoder(r.Body).Decode(&event)
+		received <- event.Level
+	}))
+	defer server.Close()
+
+	transport := newQueuedTransport("transport-test", 5, 1)
+	transport.Configure(sentry.ClientOptions{Dsn: strings.Replace(server.URL, "http://", "http://key@", 1) + "/1"})
+	event := sentry.NewEvent()
+	event.Level = sentry.LevelError
+	transport.SendEvent(event)
+	if !transport.Flush(5 * time.Second) {
+		t.Fatal("Timeout flushing events")
+	}
+	if len(received) != 1 {
+		t.Fatalf("Expected 1 delivered event, got %d", len(received))
+	}
+	if level := <-received; level != sentry.LevelError {
+		t.Errorf("Unexpected level %s", level)
+	}
+}
+
+func TestPostEventRateLimit(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	dsn, err := sentry.NewDsn(strings.Replace(server.URL, "http://", "http://key@", 1) + "/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = postEvent(server.Client(), dsn, "", sentry.NewEvent())
+	responseErr, ok := err.(*sentryResponseError)
+	if !ok {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if responseErr.retryAfter != 30*time.Second {
+		t.Errorf("Unexpected retry delay %s", responseErr.retryAfter)
+	}
+}
+
+func TestTunnel(t *testing.T) {
+	t.Parallel()
+
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/tunnel" {
+			t.Errorf("Unexpected request path %s", r.URL.Path)
+		}
+		if r.Header.Get("X-Sentry-Auth") != "" {
+			t.Error("Sentry authentication sent to tunnel")
+		}
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	dsn, err := sentry.NewDsn("https://key@sentry.example.com/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := sentry.NewEvent()
+	event.EventID = "0123456789abcdef0123456789abcdef"
+	if err := postEvent(server.Client(), dsn, server.URL+"/tunnel", event); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := bytes.Split(bytes.TrimSpace(body), []byte("\n"))
+	var header, item map[string]interface{}
+	if len(lines) != 3 || json.Unmarshal(lines[0], &header) != nil || json.Unmarshal(lines[1], &item) != nil {
+		t.Fatalf("Unexpected envelope: %s", body)
+	}
+	if header["dsn"] != "https://key@sentry.example.com/1" || header["event_id"] != string(event.EventID) {
+		t.Errorf("Unexpected envelope header %v", header)
+	}
+	if item["type"] != "event" {
+		t.Errorf("Unexpected item header %v", item)
+	}
+}
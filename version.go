@@ -0,0 +1,53 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// Build information. These are set at build time using -ldflags, for example
+// go build -ldflags "-X main.version=1.4.0 -X main.commit=$(git rev-parse HEAD)"
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = "unknown"
+)
+
+func versionCommand(args []string) error {
+	fmt.Printf("k8s-sentry %s\n", version)
+	fmt.Printf("  commit:     %s\n", commit)
+	fmt.Printf("  build date: %s\n", buildDate)
+	fmt.Printf("  go version: %s\n", runtime.Version())
+	return nil
+}
+
+// addVersionInfo adds the k8s-sentry version to an event, both as SDK package
+// and as tag. This is used as BeforeSend hook for the Sentry client.
+func addVersionInfo(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+	event.Sdk.Packages = append(event.Sdk.Packages, sentry.SdkPackage{
+		Name:    "k8s-sentry",
+		Version: version,
+	})
+	if event.Tags == nil {
+		event.Tags = make(map[string]string)
+	}
+	event.Tags["k8s-sentry.version"] = version
+	return event
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/getsentry/sentry-go"
+)
+
+func TestAddVersionInfo(t *testing.T) {
+	t.Parallel()
+
+	event := addVersionInfo(&sentry.Event{}, nil)
+	if event.Tags["k8s-sentry.version"] != version {
+		t.Error("Version tag not added")
+	}
+	if len(event.Sdk.Packages) != 1 || event.Sdk.Packages[0].Name != "k8s-sentry" {
+		t.Error("k8s-sentry package not added to SDK information")
+	}
+}
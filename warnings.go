@@ -0,0 +1,132 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/getsentry/sentry-go"
+	lru "github.com/hashicorp/golang-lru"
+	v1 "k8s.io/api/core/v1"
+)
+
+// warningReporter reports warnings sent by the Kubernetes API server, such
+// as usage of deprecated APIs, to Sentry as monitor events of app. Each
+// warning is only reported once. The application is set after the client
+// that uses the reporter is created; warnings before that are only logged.
+type warningReporter struct {
+	clusterName string
+	app         *application
+	seen        *lru.Cache
+}
+
+func newWarningReporter(clusterName string) *warningReporter {
+	seen, _ := lru.New(100)
+	return &warningReporter{clusterName: clusterName, seen: seen}
+}
+
+// Wrap wraps the transport of a Kubernetes client, to report the warnings
+// in its responses.
+func (r *warningReporter) Wrap(next http.RoundTripper) http.RoundTripper {
+	return &warningTransport{next: next, reporter: r}
+}
+
+type warningTransport struct {
+	next     http.RoundTripper
+	reporter *warningReporter
+}
+
+func (t *warningTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	response, err := t.next.RoundTrip(req)
+	if response != nil {
+		for _, header := range response.Header["Warning"] {
+			if code, text, ok := parseWarningHeader(header); ok && code == 299 {
+				t.reporter.report(req, text)
+			}
+		}
+	}
+	return response, err
+}
+
+func (r *warningReporter) report(req *http.Request, text string) {
+	if seen, _ := r.seen.ContainsOrAdd(text, true); seen {
+		return
+	}
+
+	group, version := apiGroupVersion(req.URL.Path)
+	logger.Warning("Kubernetes API warning", "cluster", r.clusterName, "group", group, "version", version, "warning", text)
+	if r.app == nil {
+		return
+	}
+
+	sentryEvent := r.app.newBaseEvent("")
+	delete(sentryEvent.Tags, "namespace")
+	sentryEvent.Level = sentry.LevelWarning
+	sentryEvent.Message = fmt.Sprintf("Kubernetes API warning: %s", text)
+	sentryEvent.Fingerprint = []string{"api-warning", r.clusterName, text}
+	sentryEvent.Tags["api.group"] = group
+	sentryEvent.Tags["api.version"] = version
+	sentryEvent.Extra["method"] = req.Method
+	sentryEvent.Extra["path"] = req.URL.Path
+	r.app.reportMonitorEvent(sentryEvent, v1.ObjectReference{}, fingerprintKey(sentryEvent))
+}
+
+// parseWarningHeader parses a HTTP Warning header as defined in RFC 7234,
+// of the form: code agent "text" ["date"].
+func parseWarningHeader(header string) (int, string, bool) {
+	parts := strings.SplitN(strings.TrimSpace(header), " ", 3)
+	if len(parts) != 3 {
+		return 0, "", false
+	}
+	code, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, "", false
+	}
+
+	quoted := parts[2]
+	if !strings.HasPrefix(quoted, `"`) {
+		return 0, "", false
+	}
+	// Find the closing quote, skipping escaped characters.
+	for i := 1; i < len(quoted); i++ {
+		switch quoted[i] {
+		case '\\':
+			i++
+		case '"':
+			text, err := strconv.Unquote(quoted[:i+1])
+			if err != nil {
+				return 0, "", false
+			}
+			return code, text, true
+		}
+	}
+	return 0, "", false
+}
+
+// apiGroupVersion determines the API group and version from a request path.
+func apiGroupVersion(path string) (string, string) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) >= 2 && parts[0] == "api" {
+		return "core", parts[1]
+	}
+	if len(parts) >= 3 && parts[0] == "apis" {
+		return parts[1], parts[2]
+	}
+	return "", ""
+}
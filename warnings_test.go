@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseWarningHeader(t *testing.T) {
+	t.Parallel()
+
+	code, text, ok := parseWarningHeader(`299 - "extensions/v1beta1 Ingress is deprecated in v1.14+, unavailable in v1.22+; use networking.k8s.io/v1 Ingress"`)
+	if !ok || code != 299 || text != "extensions/v1beta1 Ingress is deprecated in v1.14+, unavailable in v1.22+; use networking.k8s.io/v1 Ingress" {
+		t.Errorf("Unexpected result: %d %q %v", code, text, ok)
+	}
+
+	_, text, ok = parseWarningHeader(`299 - "with \"quotes\"" "Mon, 02 Jan 2006 15:04:05 GMT"`)
+	if !ok || text != `with "quotes"` {
+		t.Errorf("Escaped quotes not handled: %q", text)
+	}
+
+	if _, _, ok := parseWarningHeader("invalid"); ok {
+		t.Error("Invalid header accepted")
+	}
+}
+
+func TestAPIGroupVersion(t *testing.T) {
+	t.Parallel()
+
+	if group, version := apiGroupVersion("/api/v1/namespaces/default/pods"); group != "core" || version != "v1" {
+		t.Errorf("Unexpected group/version for core API: %s/%s", group, version)
+	}
+	if group, version := apiGroupVersion("/apis/extensions/v1beta1/ingresses"); group != "extensions" || version != "v1beta1" {
+		t.Errorf("Unexpected group/version: %s/%s", group, version)
+	}
+}
+
+type warningRoundTripper string
+
+func (w warningRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Warning": {string(w)}}}, nil
+}
+
+func TestWarningReporterMute(t *testing.T) {
+	t.Parallel()
+
+	mutes := newMuteList()
+	if _, err := mutes.Add(mute{Reason: "api-warning"}, time.Hour, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	reporter := newWarningReporter("prod")
+	reporter.app = &application{clusterName: "prod", mutes: mutes, recent: newRecentEvents(10)}
+	transport := reporter.Wrap(warningRoundTripper(`299 - "policy/v1beta1 PodDisruptionBudget is deprecated"`))
+	req := httptest.NewRequest(http.MethodGet, "/apis/policy/v1beta1/poddisruptionbudgets", nil)
+	if _, err := transport.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	skipped := reporter.app.recent.List(recentEventFilter{Decision: decisionSkipped}, 1)
+	if len(skipped) != 1 || skipped[0].Reason != "api-warning" {
+		t.Errorf("Muted API warning not skipped: %+v", skipped)
+	}
+}
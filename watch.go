@@ -0,0 +1,221 @@
+/*
+Copyright 2019 Wichert Akkerman
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// watchFailure describes an informer that is unable to list or watch.
+type watchFailure struct {
+	cluster  string
+	resource string
+	since    time.Time
+	err      error
+	reported bool
+}
+
+// watchMonitor keeps track of informers that fail to list or watch their
+// resources. Informers retry forever, so without it a cluster that is
+// unreachable or a missing permission results in silence instead of an
+// error. Failures that persist for threshold are reported, and make
+// k8s-sentry not ready.
+type watchMonitor struct {
+	threshold time.Duration
+	report    func(failure *watchFailure)
+
+	lock     sync.Mutex
+	failures map[string]*watchFailure
+	lists    map[string]*relistCount
+}
+
+// relistCount is the number of times an informer listed all of its
+// resources again after the initial list.
+type relistCount struct {
+	Cluster  string
+	Resource string
+	Count    int
+}
+
+func newWatchMonitor(threshold time.Duration) *watchMonitor {
+	return &watchMonitor{
+		threshold: threshold,
+		report:    reportWatchFailure,
+		failures:  make(map[string]*watchFailure),
+		lists:     make(map[string]*relistCount),
+	}
+}
+
+// Listed records a successful list call by an informer. Informers list
+// once at startup, and again when a watch can not be resumed, for example
+// because its resource version expired. A list is a relist if the same
+// informer watched before; informers that are started again, such as the
+// event informer after a shard is claimed, start with a normal list.
+func (m *watchMonitor) Listed(key, cluster, resource string, relist bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	lists := m.lists[key]
+	if lists == nil {
+		lists = &relistCount{Cluster: cluster, Resource: resource}
+		m.lists[key] = lists
+	}
+	if relist {
+		lists.Count++
+		logger.Info("Relisted after the watch could not be resumed", "cluster", cluster, "resource", resource, "relists", lists.Count)
+	}
+}
+
+// Relists returns the number of relists of every informer, sorted by
+// cluster and resource.
+func (m *watchMonitor) Relists() []relistCount {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	var relists []relistCount
+	for _, lists := range m.lists {
+		relists = append(relists, *lists)
+	}
+	sort.Slice(relists, func(i, j int) bool {
+		if relists[i].Cluster != relists[j].Cluster {
+			return relists[i].Cluster < relists[j].Cluster
+		}
+		return relists[i].Resource < relists[j].Resource
+	})
+	return relists
+}
+
+// Observe records the result of a list or watch call by an informer.
+func (m *watchMonitor) Observe(key, cluster, resource string, err error, now time.Time) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	failure := m.failures[key]
+	if err == nil {
+		if failure != nil && failure.reported {
+			logger.Info("Watch recovered", "cluster", cluster, "resource", resource)
+		}
+		delete(m.failures, key)
+		return
+	}
+
+	if failure == nil {
+		failure = &watchFailure{cluster: cluster, resource: resource, since: now}
+		m.failures[key] = failure
+	}
+	failure.err = err
+	logger.Warning("Watch failed", "cluster", cluster, "resource", resource, "error", err)
+	if !failure.reported && now.Sub(failure.since) >= m.threshold {
+		failure.reported = true
+		m.report(failure)
+	}
+}
+
+// Failing returns a description of every failure that was reported.
+func (m *watchMonitor) Failing() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	var failing []string
+	for _, failure := range m.failures {
+		if failure.reported {
+			failing = append(failing, failure.String())
+		}
+	}
+	sort.Strings(failing)
+	return failing
+}
+
+func (f *watchFailure) String() string {
+	where := ""
+	if f.cluster != "" {
+		where = " in cluster " + f.cluster
+	}
+	if apierrors.IsForbidden(f.err) {
+		return fmt.Sprintf("not allowed to watch %s%s: grant the list and watch verbs for %s to the service account", f.resource, where, f.resource)
+	}
+	return fmt.Sprintf("unable to watch %s%s: %v", f.resource, where, f.err)
+}
+
+func reportWatchFailure(failure *watchFailure) {
+	logger.Error("Watch failing persistently", "cluster", failure.cluster, "resource", failure.resource, "since", failure.since, "error", failure.err)
+	event := newSelfEvent(sentry.LevelError, failure.String())
+	event.Fingerprint = []string{"k8s-sentry-watch", failure.cluster, failure.resource}
+	event.Tags["resource"] = failure.resource
+	if failure.cluster != "" {
+		event.Tags["cluster"] = failure.cluster
+	}
+	event.Extra["error"] = failure.err.Error()
+	event.Extra["failing-since"] = failure.since.Format(time.RFC3339)
+	selfReportHub().CaptureEvent(event)
+}
+
+// instrumentedListWatch passes the result of all list and watch calls to a
+// watchMonitor. Watches request bookmarks, so the API server regularly
+// sends the current resource version and a watch that is interrupted can be
+// resumed instead of listing all resources again.
+type instrumentedListWatch struct {
+	cache.ListerWatcher
+	monitor  *watchMonitor
+	key      string
+	cluster  string
+	resource string
+	// watched is set to 1 once a watch was started.
+	watched *int32
+}
+
+func (lw instrumentedListWatch) List(options metav1.ListOptions) (runtime.Object, error) {
+	obj, err := lw.ListerWatcher.List(options)
+	lw.monitor.Observe(lw.key, lw.cluster, lw.resource, err, time.Now())
+	// Lists are paged, only count the first page.
+	if err == nil && options.Continue == "" {
+		lw.monitor.Listed(lw.key, lw.cluster, lw.resource, atomic.LoadInt32(lw.watched) == 1)
+	}
+	return obj, err
+}
+
+func (lw instrumentedListWatch) Watch(options metav1.ListOptions) (watch.Interface, error) {
+	options.AllowWatchBookmarks = true
+	w, err := lw.ListerWatcher.Watch(options)
+	lw.monitor.Observe(lw.key, lw.cluster, lw.resource, err, time.Now())
+	if err == nil {
+		atomic.StoreInt32(lw.watched, 1)
+	}
+	return w, err
+}
+
+// instrument adds watch failure detection to the ListerWatcher of an
+// informer. name must be unique for the informer within the application.
+func (app *application) instrument(name, resource string, lw cache.ListerWatcher) cache.ListerWatcher {
+	if app.watches == nil {
+		return lw
+	}
+	return instrumentedListWatch{
+		ListerWatcher: lw,
+		monitor:       app.watches,
+		key:           app.clusterName + "/" + name,
+		cluster:       app.clusterName,
+		resource:      resource,
+		watched:       new(int32),
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestWatchMonitor(t *testing.T) {
+	t.Parallel()
+
+	var reported []*watchFailure
+	m := newWatchMonitor(5 * time.Minute)
+	m.report = func(failure *watchFailure) {
+		reported = append(reported, failure)
+	}
+
+	now := time.Now()
+	forbidden := apierrors.NewForbidden(schema.GroupResource{Resource: "pods"}, "", errors.New("no RBAC"))
+	m.Observe("prod/pods", "prod", "pods", forbidden, now)
+	m.Observe("prod/pods", "prod", "pods", forbidden, now.Add(4*time.Minute))
+	if len(reported) != 0 || len(m.Failing()) != 0 {
+		t.Fatal("failure reported before the threshold")
+	}
+	m.Observe("prod/pods", "prod", "pods", forbidden, now.Add(5*time.Minute))
+	m.Observe("prod/pods", "prod", "pods", forbidden, now.Add(6*time.Minute))
+	if len(reported) != 1 {
+		t.Fatalf("expected a single report, got %d", len(reported))
+	}
+	expected := "not allowed to watch pods in cluster prod: grant the list and watch verbs for pods to the service account"
+	if failing := m.Failing(); len(failing) != 1 || failing[0] != expected {
+		t.Errorf("unexpected failures: %v", failing)
+	}
+
+	m.Observe("prod/pods", "prod", "pods", nil, now.Add(7*time.Minute))
+	if len(m.Failing()) != 0 {
+		t.Error("failure not cleared after success")
+	}
+}
+
+func TestHealthServerReady(t *testing.T) {
+	t.Parallel()
+
+	m := newWatchMonitor(0)
+	m.report = func(*watchFailure) {}
+	s := newHealthServer(m, newSyncTracker())
+
+	recorder := httptest.NewRecorder()
+	s.ready(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("expected ready, got %d", recorder.Code)
+	}
+
+	m.Observe("events", "", "events", errors.New("connection refused"), time.Now())
+	recorder = httptest.NewRecorder()
+	s.ready(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if recorder.Code != http.StatusServiceUnavailable || !strings.Contains(recorder.Body.String(), "unable to watch events: connection refused") {
+		t.Errorf("unexpected response %d: %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestWatchMonitorRelists(t *testing.T) {
+	t.Parallel()
+
+	m := newWatchMonitor(time.Minute)
+	lw := instrumentedListWatch{
+		ListerWatcher: &cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) { return &v1.EventList{}, nil },
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				if !options.AllowWatchBookmarks {
+					t.Error("Watch without bookmarks")
+				}
+				return watch.NewFake(), nil
+			},
+		},
+		monitor:  m,
+		key:      "prod/event monitor",
+		cluster:  "prod",
+		resource: "events",
+		watched:  new(int32),
+	}
+	lw.List(metav1.ListOptions{})
+	lw.List(metav1.ListOptions{Continue: "page-2"})
+	lw.Watch(metav1.ListOptions{})
+	if relists := m.Relists(); len(relists) != 1 || relists[0].Count != 0 {
+		t.Errorf("Initial list counted as relist: %+v", relists)
+	}
+	lw.List(metav1.ListOptions{})
+
+	// An informer that is started again lists without a relist.
+	restarted := lw
+	restarted.watched = new(int32)
+	restarted.List(metav1.ListOptions{})
+
+	recorder := httptest.NewRecorder()
+	newHealthServer(m, newSyncTracker()).metrics(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(recorder.Body.String(), `k8s_sentry_relists_total{cluster="prod",resource="events"} 1`) {
+		t.Errorf("Relist not counted: %s", recorder.Body)
+	}
+}